@@ -60,11 +60,15 @@ func initConfig() {
 }
 
 func start() {
+	initLogger()
+
+	service.Init()
+	service.Serve()
+}
+
+func initLogger() {
 	log.InitAppLogger(
 		&log.Config{Level: viper.GetString("log.app.level"),
 			Encoder: viper.GetString("log.encoder")},
 		zap.AddCallerSkip(1), zap.AddCaller())
-
-	service.Init()
-	service.Serve()
 }
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/happyxhw/iself/pkg/strava/stravatest"
+)
+
+var (
+	fakeAddr     string
+	fakeFixtures string
+)
+
+// stravatestCmd 本地开发时启动 fake strava api, 将 oauth2 配置中 strava 的 base_url 指向该地址
+var stravatestCmd = &cobra.Command{
+	Use:   "stravatest",
+	Short: "run fake strava api for local development",
+	Run: func(cmd *cobra.Command, args []string) {
+		var f *stravatest.Fixtures
+		if fakeFixtures != "" {
+			var err error
+			f, err = stravatest.LoadFixtures(fakeFixtures)
+			exitOnErr(err)
+		}
+		srv := http.Server{
+			Addr:              fakeAddr,
+			Handler:           stravatest.NewFake(f),
+			ReadHeaderTimeout: time.Second * 10,
+		}
+		fmt.Println("fake strava api listening on", fakeAddr)
+		exitOnErr(srv.ListenAndServe())
+	},
+}
+
+func init() {
+	stravatestCmd.Flags().StringVar(&fakeAddr, "addr", "127.0.0.1:9090", "监听地址")
+	stravatestCmd.Flags().StringVar(&fakeFixtures, "fixtures", "", "初始数据 json 文件, 为空时使用内置数据")
+	rootCmd.AddCommand(stravatestCmd)
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/happyxhw/iself/pkg/oauth2x"
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+const (
+	subscriptionTimeout = time.Second * 30
+)
+
+// subscriptionCmd 管理 strava 推送订阅, 每个应用只能有一个订阅
+var subscriptionCmd = &cobra.Command{
+	Use:   "subscription",
+	Short: "manage strava push subscription",
+}
+
+var subscriptionCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "create push subscription with strava.callback_url and strava.verify_token",
+	Run: func(cmd *cobra.Command, args []string) {
+		cli, c := subscriptionClient()
+		ctx, cancel := context.WithTimeout(context.Background(), subscriptionTimeout)
+		defer cancel()
+		sub, err := cli.Subscription.Create(ctx, c.ClientID, c.ClientSecret,
+			viper.GetString("strava.callback_url"), viper.GetString("strava.verify_token"))
+		exitOnErr(err)
+		printJSON(sub)
+	},
+}
+
+var subscriptionViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "view push subscription",
+	Run: func(cmd *cobra.Command, args []string) {
+		cli, c := subscriptionClient()
+		ctx, cancel := context.WithTimeout(context.Background(), subscriptionTimeout)
+		defer cancel()
+		subs, err := cli.Subscription.View(ctx, c.ClientID, c.ClientSecret)
+		exitOnErr(err)
+		printJSON(subs)
+	},
+}
+
+var subscriptionDeleteCmd = &cobra.Command{
+	Use:   "delete [id]",
+	Short: "delete push subscription",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		exitOnErr(err)
+		cli, c := subscriptionClient()
+		ctx, cancel := context.WithTimeout(context.Background(), subscriptionTimeout)
+		defer cancel()
+		exitOnErr(cli.Subscription.Delete(ctx, c.ClientID, c.ClientSecret, id))
+		fmt.Println("deleted:", id)
+	},
+}
+
+func init() {
+	subscriptionCmd.AddCommand(subscriptionCreateCmd, subscriptionViewCmd, subscriptionDeleteCmd)
+	rootCmd.AddCommand(subscriptionCmd)
+}
+
+func subscriptionClient() (*strava.Client, *oauth2x.ClientConfig) {
+	initLogger()
+
+	var cfg []*oauth2x.ClientConfig
+	_ = viper.UnmarshalKey("oauth2.client", &cfg)
+	for _, c := range cfg {
+		if c.Name == oauth2x.StravaSource {
+			cli := strava.NewClient(http.DefaultClient)
+			cli.BaseURL = strava.APIURL(c.BaseURL)
+			return cli, c
+		}
+	}
+	exitOnErr(fmt.Errorf("oauth2 client %s not configured", oauth2x.StravaSource))
+	return nil, nil
+}
+
+func printJSON(v interface{}) {
+	b, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(b))
+}
+
+func exitOnErr(err error) {
+	if err != nil {
+		fmt.Printf("err: %+v\n", err)
+		os.Exit(1)
+	}
+}
@@ -23,6 +23,7 @@ type StravaActivityDetail struct {
 	ElapsedTime        int                   `gorm:"column:elapsed_time;default:0;NOT NULL" json:"elapsed_time"`
 	TotalElevationGain float64               `gorm:"column:total_elevation_gain;default:0.0;NOT NULL" json:"total_elevation_gain"`
 	StartDateLocal     time.Time             `gorm:"column:start_date_local;NOT NULL" json:"start_date_local"`
+	StartDate          *time.Time            `gorm:"column:start_date" json:"start_date"`
 	Polyline           string                `gorm:"column:polyline;NOT NULL" json:"polyline"`
 	SummaryPolyline    string                `gorm:"column:summary_polyline;NOT NULL" json:"summary_polyline"`
 	AverageSpeed       float64               `gorm:"column:average_speed;default:0.0;NOT NULL" json:"average_speed"`
@@ -35,6 +36,16 @@ type StravaActivityDetail struct {
 	SplitsMetric       []byte                `gorm:"column:splits_metric" json:"splits_metric"`
 	BestEfforts        []byte                `gorm:"column:best_efforts" json:"best_efforts"`
 	DeviceName         string                `gorm:"column:device_name" json:"device_name"`
+	Private            bool                  `gorm:"column:private;default:false;NOT NULL" json:"private"`
+	LapStructure       string                `gorm:"column:lap_structure;NOT NULL" json:"lap_structure"`
+	GearID             string                `gorm:"column:gear_id;NOT NULL" json:"gear_id"`
+	Description        string                `gorm:"column:description;NOT NULL" json:"description"`
+	Commute            bool                  `gorm:"column:commute;default:false;NOT NULL" json:"commute"`
+	Trainer            bool                  `gorm:"column:trainer;default:false;NOT NULL" json:"trainer"`
+	KudosCount         int                   `gorm:"column:kudos_count;default:0;NOT NULL" json:"kudos_count"`
+	CommentCount       int                   `gorm:"column:comment_count;default:0;NOT NULL" json:"comment_count"`
+	ExternalID         string                `gorm:"column:external_id;NOT NULL" json:"external_id"`
+	Source             int                   `gorm:"column:source;default:0;NOT NULL" json:"source"`
 	CreatedAt          time.Time             `gorm:"column:created_at" json:"created_at,omitempty"`
 	UpdatedAt          time.Time             `gorm:"column:updated_at" json:"updated_at,omitempty"`
 	DeletedAt          soft_delete.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,,omitempty"`
@@ -47,12 +58,29 @@ func (m *StravaActivityDetail) TableName() string {
 	return "strava_activity_detail"
 }
 
+// ActivitySource 活动来源, strava 同步的活动 id 为 strava 的活动 id, 本地导入的活动 id 为负数
+type ActivitySource int
+
+const (
+	ActivityStravaSource ActivitySource = iota // 从 strava 同步
+	ActivityFITSource                          // 本地导入的 fit 文件
+	ActivityGPXSource                          // 本地导入的 gpx 文件
+	ActivityTCXSource                          // 本地导入的 tcx 文件
+)
+
 type StravaActivityParam struct {
 	query.Param `gorm:"-"`
 
-	Type      *string               `gorm:"column:type;NOT NULL" json:"type"`
-	UpdatedAt *time.Time            `gorm:"column:updated_at" json:"updated_at,omitempty"`
-	DeletedAt soft_delete.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,,omitempty"`
+	Name        *string               `gorm:"column:name;NOT NULL" json:"name"`
+	Type        *string               `gorm:"column:type;NOT NULL" json:"type"`
+	Private     *bool                 `gorm:"column:private;NOT NULL" json:"private"`
+	Description *string               `gorm:"column:description;NOT NULL" json:"description"`
+	GearID      *string               `gorm:"column:gear_id;NOT NULL" json:"gear_id"`
+	Commute     *bool                 `gorm:"column:commute;NOT NULL" json:"commute"`
+	Trainer     *bool                 `gorm:"column:trainer;NOT NULL" json:"trainer"`
+	Source      *int                  `gorm:"column:source;NOT NULL" json:"source"`
+	UpdatedAt   *time.Time            `gorm:"column:updated_at" json:"updated_at,omitempty"`
+	DeletedAt   soft_delete.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,,omitempty"`
 }
 
 func (m *StravaActivityDetail) BeforeCreate(tx *gorm.DB) error {
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/plugin/soft_delete"
+)
+
+// StravaActivityLap 活动的圈数据
+type StravaActivityLap struct {
+	ID                 int64                 `gorm:"column:id;primary_key" json:"id"`
+	ActivityID         int64                 `gorm:"column:activity_id;NOT NULL" json:"activity_id"`
+	AthleteID          int64                 `gorm:"column:athlete_id;NOT NULL" json:"athlete_id"`
+	LapIndex           int                   `gorm:"column:lap_index;NOT NULL" json:"lap_index"`
+	Name               string                `gorm:"column:name;NOT NULL" json:"name"`
+	Distance           float64               `gorm:"column:distance;default:0.0;NOT NULL" json:"distance"`
+	MovingTime         int                   `gorm:"column:moving_time;default:0;NOT NULL" json:"moving_time"`
+	ElapsedTime        int                   `gorm:"column:elapsed_time;default:0;NOT NULL" json:"elapsed_time"`
+	TotalElevationGain float64               `gorm:"column:total_elevation_gain;default:0.0;NOT NULL" json:"total_elevation_gain"`
+	AverageSpeed       float64               `gorm:"column:average_speed;default:0.0;NOT NULL" json:"average_speed"`
+	MaxSpeed           float64               `gorm:"column:max_speed;default:0.0;NOT NULL" json:"max_speed"`
+	AverageHeartrate   float64               `gorm:"column:average_heartrate;default:0.0;NOT NULL" json:"average_heartrate"`
+	MaxHeartrate       float64               `gorm:"column:max_heartrate;default:0.0;NOT NULL" json:"max_heartrate"`
+	AverageCadence     float64               `gorm:"column:average_cadence;default:0.0;NOT NULL" json:"average_cadence"`
+	AverageWatts       float64               `gorm:"column:average_watts;default:0.0;NOT NULL" json:"average_watts"`
+	StartIndex         int                   `gorm:"column:start_index;default:0;NOT NULL" json:"start_index"`
+	EndIndex           int                   `gorm:"column:end_index;default:0;NOT NULL" json:"end_index"`
+	StartDateLocal     time.Time             `gorm:"column:start_date_local;NOT NULL" json:"start_date_local"`
+	CreatedAt          time.Time             `gorm:"column:created_at" json:"created_at,omitempty"`
+	UpdatedAt          time.Time             `gorm:"column:updated_at" json:"updated_at,omitempty"`
+	DeletedAt          soft_delete.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+}
+
+func (m *StravaActivityLap) TableName() string {
+	return "strava_activity_lap"
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/plugin/soft_delete"
+)
+
+// StravaActivityComment 活动的评论
+type StravaActivityComment struct {
+	ID               int64                 `gorm:"column:id;primary_key" json:"id"`
+	ActivityID       int64                 `gorm:"column:activity_id;NOT NULL" json:"activity_id"`
+	AthleteID        int64                 `gorm:"column:athlete_id;NOT NULL" json:"athlete_id"`
+	CommenterID      int64                 `gorm:"column:commenter_id;default:0;NOT NULL" json:"commenter_id"`
+	CommenterName    string                `gorm:"column:commenter_name;NOT NULL" json:"commenter_name"`
+	Text             string                `gorm:"column:text;NOT NULL" json:"text"`
+	CommentCreatedAt time.Time             `gorm:"column:comment_created_at;NOT NULL" json:"comment_created_at"`
+	CreatedAt        time.Time             `gorm:"column:created_at" json:"created_at,omitempty"`
+	UpdatedAt        time.Time             `gorm:"column:updated_at" json:"updated_at,omitempty"`
+	DeletedAt        soft_delete.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+}
+
+func (m *StravaActivityComment) TableName() string {
+	return "strava_activity_comment"
+}
+
+// StravaActivityKudos 给活动点赞的用户, strava 只返回名字, 按返回顺序保存
+type StravaActivityKudos struct {
+	ID         int64                 `gorm:"column:id;primary_key" json:"id"`
+	ActivityID int64                 `gorm:"column:activity_id;NOT NULL" json:"activity_id"`
+	AthleteID  int64                 `gorm:"column:athlete_id;NOT NULL" json:"athlete_id"`
+	Position   int                   `gorm:"column:position;NOT NULL" json:"position"`
+	Firstname  string                `gorm:"column:firstname;NOT NULL" json:"firstname"`
+	Lastname   string                `gorm:"column:lastname;NOT NULL" json:"lastname"`
+	CreatedAt  time.Time             `gorm:"column:created_at" json:"created_at,omitempty"`
+	UpdatedAt  time.Time             `gorm:"column:updated_at" json:"updated_at,omitempty"`
+	DeletedAt  soft_delete.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+}
+
+func (m *StravaActivityKudos) TableName() string {
+	return "strava_activity_kudos"
+}
+
+// StravaSocialStats 每月收到的点赞和评论数
+type StravaSocialStats struct {
+	Month    time.Time `gorm:"column:month" json:"month"`
+	Count    int       `gorm:"column:count" json:"count"`
+	Kudos    int       `gorm:"column:kudos" json:"kudos"`
+	Comments int       `gorm:"column:comments" json:"comments"`
+}
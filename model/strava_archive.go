@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+)
+
+// StravaArchive 用户的个人数据导出, 后台生成 zip 文件后通过邮件发送签名的下载链接
+type StravaArchive struct {
+	ID         int64      `gorm:"column:id;primary_key" json:"id"`
+	AthleteID  int64      `gorm:"column:athlete_id;NOT NULL" json:"athlete_id"`
+	Status     int        `gorm:"column:status" json:"status"`
+	Path       string     `gorm:"column:path;NOT NULL" json:"path"`
+	Size       int64      `gorm:"column:size;NOT NULL" json:"size"`
+	Activities int        `gorm:"column:activities;NOT NULL" json:"activities"`
+	LastError  string     `gorm:"column:last_error;NOT NULL" json:"last_error"`
+	Attempts   int        `gorm:"column:attempts;NOT NULL" json:"attempts"`
+	ExpiresAt  *time.Time `gorm:"column:expires_at" json:"expires_at"`
+
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (StravaArchive) TableName() string {
+	return "strava_archive"
+}
+
+type ArchiveStatus int
+
+const (
+	ArchivePendingStatus ArchiveStatus = iota // 等待生成或者生成中
+	ArchiveReadyStatus                        // 已生成, 可以下载
+	ArchiveFailedStatus                       // 生成失败
+	ArchiveExpiredStatus                      // 下载链接已过期, 文件已删除
+)
+
+type StravaArchiveParam struct {
+	Status     *int       `gorm:"column:status" json:"status"`
+	Path       *string    `gorm:"column:path" json:"path"`
+	Size       *int64     `gorm:"column:size" json:"size"`
+	Activities *int       `gorm:"column:activities" json:"activities"`
+	LastError  *string    `gorm:"column:last_error" json:"last_error"`
+	Attempts   *int       `gorm:"column:attempts" json:"attempts"`
+	ExpiresAt  *time.Time `gorm:"column:expires_at" json:"expires_at"`
+	UpdatedAt  *time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+// StravaAthlete 用户的 strava 资料和 strava 统计的累计数据, 登录和收到用户推送时同步
+type StravaAthlete struct {
+	AthleteID             int64     `gorm:"column:athlete_id;primary_key" json:"athlete_id"`
+	Username              string    `gorm:"column:username;NOT NULL" json:"username"`
+	Firstname             string    `gorm:"column:firstname;NOT NULL" json:"firstname"`
+	Lastname              string    `gorm:"column:lastname;NOT NULL" json:"lastname"`
+	Profile               string    `gorm:"column:profile;NOT NULL" json:"profile"`
+	ProfileMedium         string    `gorm:"column:profile_medium;NOT NULL" json:"profile_medium"`
+	City                  string    `gorm:"column:city;NOT NULL" json:"city"`
+	State                 string    `gorm:"column:state;NOT NULL" json:"state"`
+	Country               string    `gorm:"column:country;NOT NULL" json:"country"`
+	Sex                   string    `gorm:"column:sex;NOT NULL" json:"sex"`
+	Summit                bool      `gorm:"column:summit;default:false;NOT NULL" json:"summit"`
+	MeasurementPreference string    `gorm:"column:measurement_preference;NOT NULL" json:"measurement_preference"`
+	Ftp                   int       `gorm:"column:ftp;default:0;NOT NULL" json:"ftp"`
+	Weight                float64   `gorm:"column:weight;default:0.0;NOT NULL" json:"weight"`
+	Bikes                 []byte    `gorm:"column:bikes" json:"bikes"`
+	Shoes                 []byte    `gorm:"column:shoes" json:"shoes"`
+	Stats                 []byte    `gorm:"column:stats" json:"stats"`
+	CreatedAt             time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt             time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	BikesJSON []*strava.SummaryGear `gorm:"-"`
+	ShoesJSON []*strava.SummaryGear `gorm:"-"`
+	StatsJSON *strava.ActivityStats `gorm:"-"`
+}
+
+func (m *StravaAthlete) TableName() string {
+	return "strava_athlete"
+}
+
+func (m *StravaAthlete) BeforeCreate(tx *gorm.DB) error {
+	var err error
+	if m.BikesJSON != nil {
+		if m.Bikes, err = json.Marshal(m.BikesJSON); err != nil {
+			return err
+		}
+	}
+	if m.ShoesJSON != nil {
+		if m.Shoes, err = json.Marshal(m.ShoesJSON); err != nil {
+			return err
+		}
+	}
+	if m.StatsJSON != nil {
+		if m.Stats, err = json.Marshal(m.StatsJSON); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *StravaAthlete) AfterFind(tx *gorm.DB) error {
+	if len(m.Bikes) > 0 {
+		if err := json.Unmarshal(m.Bikes, &m.BikesJSON); err != nil {
+			return err
+		}
+	}
+	if len(m.Shoes) > 0 {
+		if err := json.Unmarshal(m.Shoes, &m.ShoesJSON); err != nil {
+			return err
+		}
+	}
+	if len(m.Stats) > 0 {
+		m.StatsJSON = new(strava.ActivityStats)
+		if err := json.Unmarshal(m.Stats, m.StatsJSON); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StravaActivityTotal 根据已导入的活动统计的累计数据, 与 strava.ActivityTotal 对应
+type StravaActivityTotal struct {
+	Count         int     `gorm:"column:count" json:"count"`
+	Distance      float64 `gorm:"column:distance" json:"distance"`
+	MovingTime    int     `gorm:"column:moving_time" json:"moving_time"`
+	ElapsedTime   int     `gorm:"column:elapsed_time" json:"elapsed_time"`
+	ElevationGain float64 `gorm:"column:elevation_gain" json:"elevation_gain"`
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+)
+
+// StravaBackfill 历史活动导入进度, 每个用户一条
+type StravaBackfill struct {
+	AthleteID int64  `gorm:"column:athlete_id;primary_key" json:"athlete_id"`
+	Status    int    `gorm:"column:status" json:"status"`
+	Before    int64  `gorm:"column:before" json:"before"`
+	Imported  int    `gorm:"column:imported" json:"imported"`
+	Skipped   int    `gorm:"column:skipped" json:"skipped"`
+	Attempts  int    `gorm:"column:attempts" json:"attempts"`
+	LastError string `gorm:"column:last_error" json:"last_error"`
+
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (StravaBackfill) TableName() string {
+	return "strava_backfill"
+}
+
+type BackfillStatus int
+
+const (
+	BackfillRunningStatus  BackfillStatus = iota // 导入中
+	BackfillFinishedStatus                       // 导入完成
+	BackfillFailedStatus                         // 导入失败, 如: 用户撤销了授权, 超过最大重试次数
+)
+
+type StravaBackfillParam struct {
+	Status    *int       `gorm:"column:status" json:"status"`
+	Before    *int64     `gorm:"column:before" json:"before"`
+	Imported  *int       `gorm:"column:imported" json:"imported"`
+	Skipped   *int       `gorm:"column:skipped" json:"skipped"`
+	Attempts  *int       `gorm:"column:attempts" json:"attempts"`
+	LastError *string    `gorm:"column:last_error" json:"last_error"`
+	UpdatedAt *time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"time"
+
+	"github.com/happyxhw/pkg/query"
+)
+
+// StravaClub strava 俱乐部, 多个用户可能属于同一个俱乐部
+type StravaClub struct {
+	ID            int64     `gorm:"column:id;primary_key" json:"id"`
+	Name          string    `gorm:"column:name;NOT NULL" json:"name"`
+	SportType     string    `gorm:"column:sport_type;NOT NULL" json:"sport_type"`
+	City          string    `gorm:"column:city;NOT NULL" json:"city"`
+	Country       string    `gorm:"column:country;NOT NULL" json:"country"`
+	Private       bool      `gorm:"column:private;default:false;NOT NULL" json:"private"`
+	MemberCount   int       `gorm:"column:member_count;default:0;NOT NULL" json:"member_count"`
+	ProfileMedium string    `gorm:"column:profile_medium;NOT NULL" json:"profile_medium"`
+	CoverPhoto    string    `gorm:"column:cover_photo;NOT NULL" json:"cover_photo"`
+	URL           string    `gorm:"column:url;NOT NULL" json:"url"`
+	RefreshedAt   time.Time `gorm:"column:refreshed_at" json:"refreshed_at"`
+
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (StravaClub) TableName() string {
+	return "strava_club"
+}
+
+// StravaClubAthlete 用户加入的俱乐部, 刷新俱乐部动态时使用成员的 token
+type StravaClubAthlete struct {
+	ClubID    int64     `gorm:"column:club_id;primary_key" json:"club_id"`
+	AthleteID int64     `gorm:"column:athlete_id;primary_key" json:"athlete_id"`
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (StravaClubAthlete) TableName() string {
+	return "strava_club_athlete"
+}
+
+// StravaClubActivity 俱乐部动态中的活动, strava 不返回活动 id 和时间, 以用户和活动数据的指纹去重,
+// 以第一次出现的时间作为活动时间
+type StravaClubActivity struct {
+	ID                 int64     `gorm:"column:id;primary_key" json:"id"`
+	ClubID             int64     `gorm:"column:club_id;NOT NULL" json:"club_id"`
+	Fingerprint        string    `gorm:"column:fingerprint;NOT NULL" json:"fingerprint"`
+	AthleteName        string    `gorm:"column:athlete_name;NOT NULL" json:"athlete_name"`
+	Name               string    `gorm:"column:name;NOT NULL" json:"name"`
+	Type               string    `gorm:"column:type;NOT NULL" json:"type"`
+	Distance           float64   `gorm:"column:distance;default:0.0;NOT NULL" json:"distance"`
+	MovingTime         int       `gorm:"column:moving_time;default:0;NOT NULL" json:"moving_time"`
+	ElapsedTime        int       `gorm:"column:elapsed_time;default:0;NOT NULL" json:"elapsed_time"`
+	TotalElevationGain float64   `gorm:"column:total_elevation_gain;default:0.0;NOT NULL" json:"total_elevation_gain"`
+	Backfilled         bool      `gorm:"column:backfilled;default:false;NOT NULL" json:"backfilled"`
+	FirstSeenAt        time.Time `gorm:"column:first_seen_at;NOT NULL" json:"first_seen_at"`
+
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (StravaClubActivity) TableName() string {
+	return "strava_club_activity"
+}
+
+type StravaClubActivityQueryParam struct {
+	query.Param
+}
+
+// StravaClubLeaderboard 俱乐部成员在一段时间内的累计数据
+type StravaClubLeaderboard struct {
+	AthleteName   string  `gorm:"column:athlete_name" json:"athlete_name"`
+	Count         int     `gorm:"column:count" json:"count"`
+	Distance      float64 `gorm:"column:distance" json:"distance"`
+	MovingTime    int     `gorm:"column:moving_time" json:"moving_time"`
+	ElevationGain float64 `gorm:"column:elevation_gain" json:"elevation_gain"`
+}
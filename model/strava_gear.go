@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/plugin/soft_delete"
+)
+
+// StravaGear 装备: 跑鞋, 自行车
+type StravaGear struct {
+	ID             string                `gorm:"column:id;primary_key" json:"id"`
+	AthleteID      int64                 `gorm:"column:athlete_id;NOT NULL" json:"athlete_id"`
+	Name           string                `gorm:"column:name;NOT NULL" json:"name"`
+	BrandName      string                `gorm:"column:brand_name;NOT NULL" json:"brand_name"`
+	ModelName      string                `gorm:"column:model_name;NOT NULL" json:"model_name"`
+	Description    string                `gorm:"column:description;NOT NULL" json:"description"`
+	FrameType      int                   `gorm:"column:frame_type;default:0;NOT NULL" json:"frame_type"`
+	Primary        bool                  `gorm:"column:primary;default:false;NOT NULL" json:"primary"`
+	Distance       float64               `gorm:"column:distance;default:0.0;NOT NULL" json:"distance"`
+	RetireDistance float64               `gorm:"column:retire_distance;default:0.0;NOT NULL" json:"retire_distance"`
+	RetireTime     int                   `gorm:"column:retire_time;default:0;NOT NULL" json:"retire_time"`
+	Alerted        bool                  `gorm:"column:alerted;default:false;NOT NULL" json:"alerted"`
+	CreatedAt      time.Time             `gorm:"column:created_at" json:"created_at,omitempty"`
+	UpdatedAt      time.Time             `gorm:"column:updated_at" json:"updated_at,omitempty"`
+	DeletedAt      soft_delete.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+}
+
+func (m *StravaGear) TableName() string {
+	return "strava_gear"
+}
+
+// StravaGearParam 更新装备的报废提醒设置
+type StravaGearParam struct {
+	RetireDistance *float64   `gorm:"column:retire_distance" json:"retire_distance"`
+	RetireTime     *int       `gorm:"column:retire_time" json:"retire_time"`
+	Alerted        *bool      `gorm:"column:alerted" json:"alerted"`
+	UpdatedAt      *time.Time `gorm:"column:updated_at" json:"updated_at,omitempty"`
+}
+
+// StravaGearStats 根据已导入的活动统计的装备累计数据
+type StravaGearStats struct {
+	GearID     string  `gorm:"column:gear_id" json:"gear_id"`
+	Distance   float64 `gorm:"column:distance" json:"distance"`
+	MovingTime int     `gorm:"column:moving_time" json:"moving_time"`
+	Count      int     `gorm:"column:count" json:"count"`
+}
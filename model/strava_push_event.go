@@ -2,18 +2,23 @@ package model
 
 import (
 	"time"
+
+	"github.com/happyxhw/pkg/query"
 )
 
 // PushEvent 推送事件
 type StravaPushEvent struct {
-	ID         int64  `gorm:"column:id;primary_key" json:"id"`
-	AspectType string `gorm:"column:aspect_type" json:"aspect_type"`
-	EventTime  int64  `gorm:"column:event_time" json:"event_time"`
-	ObjectID   int64  `gorm:"column:object_id" json:"object_id"`
-	ObjectType string `gorm:"column:object_type" json:"object_type"`
-	OwnerID    int64  `gorm:"column:owner_id" json:"owner_id"`
-	Updates    string `gorm:"column:updates" json:"updates"`
-	Status     int    `gorm:"column:status" json:"status"`
+	ID             int64  `gorm:"column:id;primary_key" json:"id"`
+	SubscriptionID int64  `gorm:"column:subscription_id" json:"subscription_id"`
+	AspectType     string `gorm:"column:aspect_type" json:"aspect_type"`
+	EventTime      int64  `gorm:"column:event_time" json:"event_time"`
+	ObjectID       int64  `gorm:"column:object_id" json:"object_id"`
+	ObjectType     string `gorm:"column:object_type" json:"object_type"`
+	OwnerID        int64  `gorm:"column:owner_id" json:"owner_id"`
+	Updates        string `gorm:"column:updates" json:"updates"`
+	Status         int    `gorm:"column:status" json:"status"`
+	Attempts       int    `gorm:"column:attempts" json:"attempts"`
+	LastError      string `gorm:"column:last_error" json:"last_error"`
 
 	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
@@ -26,11 +31,26 @@ func (StravaPushEvent) TableName() string {
 type PushStatus int
 
 const (
-	EventProcessingStatus PushStatus = iota
-	EventProcessedStatus
+	EventProcessingStatus PushStatus = iota // 待处理
+	EventProcessedStatus                    // 处理成功
+	EventRetryingStatus                     // 处理失败, 等待重试
+	EventFailedStatus                       // 超过最大重试次数, 不再处理
 )
 
+// StravaPushEventQueryParam 推送记录查询条件, Start 和 End 为 event_time 的范围
+type StravaPushEventQueryParam struct {
+	query.Param
+
+	Status     *int
+	OwnerID    *int64
+	ObjectType *string
+	Start      int64
+	End        int64
+}
+
 type StravaPushEventParam struct {
 	Status    *int       `gorm:"status" json:"status"`
+	Attempts  *int       `gorm:"column:attempts" json:"attempts"`
+	LastError *string    `gorm:"column:last_error" json:"last_error"`
 	UpdatedAt *time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
 }
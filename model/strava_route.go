@@ -0,0 +1,121 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/soft_delete"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+// StravaRoute 用户在 strava 创建的路线
+type StravaRoute struct {
+	ID                  int64                 `gorm:"column:id;primary_key" json:"id"`
+	AthleteID           int64                 `gorm:"column:athlete_id;NOT NULL" json:"athlete_id"`
+	Name                string                `gorm:"column:name;NOT NULL" json:"name"`
+	Description         string                `gorm:"column:description;NOT NULL" json:"description"`
+	Type                int                   `gorm:"column:type;default:0;NOT NULL" json:"type"`
+	SubType             int                   `gorm:"column:sub_type;default:0;NOT NULL" json:"sub_type"`
+	Distance            float64               `gorm:"column:distance;default:0.0;NOT NULL" json:"distance"`
+	ElevationGain       float64               `gorm:"column:elevation_gain;default:0.0;NOT NULL" json:"elevation_gain"`
+	EstimatedMovingTime int                   `gorm:"column:estimated_moving_time;default:0;NOT NULL" json:"estimated_moving_time"`
+	Private             bool                  `gorm:"column:private;default:false;NOT NULL" json:"private"`
+	Starred             bool                  `gorm:"column:starred;default:false;NOT NULL" json:"starred"`
+	Polyline            string                `gorm:"column:polyline;NOT NULL" json:"polyline"`
+	SummaryPolyline     string                `gorm:"column:summary_polyline;NOT NULL" json:"summary_polyline"`
+	RouteCreatedAt      time.Time             `gorm:"column:route_created_at" json:"route_created_at"`
+	RouteUpdatedAt      time.Time             `gorm:"column:route_updated_at" json:"route_updated_at"`
+	CreatedAt           time.Time             `gorm:"column:created_at" json:"created_at,omitempty"`
+	UpdatedAt           time.Time             `gorm:"column:updated_at" json:"updated_at,omitempty"`
+	DeletedAt           soft_delete.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+}
+
+func (m *StravaRoute) TableName() string {
+	return "strava_route"
+}
+
+type RouteType int
+
+const (
+	RouteRideType RouteType = iota + 1 // 骑行路线
+	RouteRunType                       // 跑步路线
+)
+
+type StravaRouteQueryParam struct {
+	query.Param
+
+	Type    *int
+	Starred *bool
+}
+
+// StravaRouteStream 路线的 stream, 只有位置, 距离和海拔
+type StravaRouteStream struct {
+	ID        int64                 `gorm:"column:id;primary_key" json:"id"`
+	Latlng    []byte                `gorm:"column:latlng" json:"latlng"`
+	Distance  []byte                `gorm:"column:distance" json:"distance"`
+	Altitude  []byte                `gorm:"column:altitude" json:"altitude"`
+	CreatedAt time.Time             `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time             `gorm:"column:updated_at" json:"updated_at,omitempty"`
+	DeletedAt soft_delete.DeletedAt `gorm:"column:deleted_at" json:"deleted_at"`
+
+	LatlngStream   *strava.LatLngStream   `gorm:"-"`
+	DistanceStream *strava.DistanceStream `gorm:"-"`
+	AltitudeStream *strava.AltitudeStream `gorm:"-"`
+}
+
+func (s *StravaRouteStream) TableName() string {
+	return "strava_route_stream"
+}
+
+func (s *StravaRouteStream) BeforeCreate(tx *gorm.DB) error {
+	if s.LatlngStream != nil {
+		data, err := json.Marshal(s.LatlngStream)
+		if err != nil {
+			return err
+		}
+		s.Latlng = data
+	}
+	if s.DistanceStream != nil {
+		data, err := json.Marshal(s.DistanceStream)
+		if err != nil {
+			return err
+		}
+		s.Distance = data
+	}
+	if s.AltitudeStream != nil {
+		data, err := json.Marshal(s.AltitudeStream)
+		if err != nil {
+			return err
+		}
+		s.Altitude = data
+	}
+
+	return nil
+}
+
+func (s *StravaRouteStream) AfterFind(tx *gorm.DB) error {
+	if len(s.Latlng) > 0 {
+		s.LatlngStream = new(strava.LatLngStream)
+		if err := json.Unmarshal(s.Latlng, s.LatlngStream); err != nil {
+			return err
+		}
+	}
+	if len(s.Distance) > 0 {
+		s.DistanceStream = new(strava.DistanceStream)
+		if err := json.Unmarshal(s.Distance, s.DistanceStream); err != nil {
+			return err
+		}
+	}
+	if len(s.Altitude) > 0 {
+		s.AltitudeStream = new(strava.AltitudeStream)
+		if err := json.Unmarshal(s.Altitude, s.AltitudeStream); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
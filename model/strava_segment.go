@@ -0,0 +1,81 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/plugin/soft_delete"
+
+	"github.com/happyxhw/pkg/query"
+)
+
+// StravaSegment 路段, 所有用户共享
+type StravaSegment struct {
+	ID            int64     `gorm:"column:id;primary_key" json:"id"`
+	Name          string    `gorm:"column:name;NOT NULL" json:"name"`
+	ActivityType  string    `gorm:"column:activity_type;NOT NULL" json:"activity_type"`
+	Distance      float64   `gorm:"column:distance;default:0.0;NOT NULL" json:"distance"`
+	AverageGrade  float64   `gorm:"column:average_grade;default:0.0;NOT NULL" json:"average_grade"`
+	MaximumGrade  float64   `gorm:"column:maximum_grade;default:0.0;NOT NULL" json:"maximum_grade"`
+	ElevationHigh float64   `gorm:"column:elevation_high;default:0.0;NOT NULL" json:"elevation_high"`
+	ElevationLow  float64   `gorm:"column:elevation_low;default:0.0;NOT NULL" json:"elevation_low"`
+	StartLat      float64   `gorm:"column:start_lat;default:0.0;NOT NULL" json:"start_lat"`
+	StartLng      float64   `gorm:"column:start_lng;default:0.0;NOT NULL" json:"start_lng"`
+	EndLat        float64   `gorm:"column:end_lat;default:0.0;NOT NULL" json:"end_lat"`
+	EndLng        float64   `gorm:"column:end_lng;default:0.0;NOT NULL" json:"end_lng"`
+	ClimbCategory int       `gorm:"column:climb_category;default:0;NOT NULL" json:"climb_category"`
+	City          string    `gorm:"column:city;NOT NULL" json:"city"`
+	State         string    `gorm:"column:state;NOT NULL" json:"state"`
+	Country       string    `gorm:"column:country;NOT NULL" json:"country"`
+	Private       bool      `gorm:"column:private;default:false;NOT NULL" json:"private"`
+	CreatedAt     time.Time `gorm:"column:created_at" json:"created_at,omitempty"`
+	UpdatedAt     time.Time `gorm:"column:updated_at" json:"updated_at,omitempty"`
+}
+
+func (m *StravaSegment) TableName() string {
+	return "strava_segment"
+}
+
+// StravaSegmentEffort 用户在路段上的一次成绩
+type StravaSegmentEffort struct {
+	ID               int64                 `gorm:"column:id;primary_key" json:"id"`
+	SegmentID        int64                 `gorm:"column:segment_id;NOT NULL" json:"segment_id"`
+	ActivityID       int64                 `gorm:"column:activity_id;NOT NULL" json:"activity_id"`
+	AthleteID        int64                 `gorm:"column:athlete_id;NOT NULL" json:"athlete_id"`
+	Name             string                `gorm:"column:name;NOT NULL" json:"name"`
+	ElapsedTime      int                   `gorm:"column:elapsed_time;default:0;NOT NULL" json:"elapsed_time"`
+	MovingTime       int                   `gorm:"column:moving_time;default:0;NOT NULL" json:"moving_time"`
+	Distance         float64               `gorm:"column:distance;default:0.0;NOT NULL" json:"distance"`
+	StartDateLocal   time.Time             `gorm:"column:start_date_local;NOT NULL" json:"start_date_local"`
+	AverageHeartrate float64               `gorm:"column:average_heartrate;default:0.0;NOT NULL" json:"average_heartrate"`
+	MaxHeartrate     float64               `gorm:"column:max_heartrate;default:0.0;NOT NULL" json:"max_heartrate"`
+	AverageWatts     float64               `gorm:"column:average_watts;default:0.0;NOT NULL" json:"average_watts"`
+	DeviceWatts      bool                  `gorm:"column:device_watts;default:false;NOT NULL" json:"device_watts"`
+	AverageCadence   float64               `gorm:"column:average_cadence;default:0.0;NOT NULL" json:"average_cadence"`
+	StartIndex       int                   `gorm:"column:start_index;default:0;NOT NULL" json:"start_index"`
+	EndIndex         int                   `gorm:"column:end_index;default:0;NOT NULL" json:"end_index"`
+	PrRank           int                   `gorm:"column:pr_rank;default:0;NOT NULL" json:"pr_rank"`
+	IsPr             bool                  `gorm:"column:is_pr;default:false;NOT NULL" json:"is_pr"`
+	Hidden           bool                  `gorm:"column:hidden;default:false;NOT NULL" json:"hidden"`
+	CreatedAt        time.Time             `gorm:"column:created_at" json:"created_at,omitempty"`
+	UpdatedAt        time.Time             `gorm:"column:updated_at" json:"updated_at,omitempty"`
+	DeletedAt        soft_delete.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+}
+
+func (m *StravaSegmentEffort) TableName() string {
+	return "strava_segment_effort"
+}
+
+// StravaSegmentParam 路段查询条件
+type StravaSegmentParam struct {
+	query.Param
+
+	ActivityType *string
+}
+
+// StravaSegmentStats 用户在路段上的成绩统计
+type StravaSegmentStats struct {
+	SegmentID      int64     `gorm:"column:segment_id" json:"segment_id"`
+	EffortCount    int       `gorm:"column:effort_count" json:"effort_count"`
+	BestTime       int       `gorm:"column:best_time" json:"best_time"`
+	LastEffortDate time.Time `gorm:"column:last_effort_date" json:"last_effort_date"`
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+
+	"github.com/happyxhw/pkg/query"
+)
+
+// StravaUpload 通过 iself 上传到 strava 的活动文件, id 为 strava 返回的 upload id
+type StravaUpload struct {
+	ID           int64  `gorm:"column:id;primary_key" json:"id"`
+	AthleteID    int64  `gorm:"column:athlete_id;NOT NULL" json:"athlete_id"`
+	Filename     string `gorm:"column:filename;NOT NULL" json:"filename"`
+	DataType     string `gorm:"column:data_type;NOT NULL" json:"data_type"`
+	ExternalID   string `gorm:"column:external_id;NOT NULL" json:"external_id"`
+	Status       int    `gorm:"column:status" json:"status"`
+	StravaStatus string `gorm:"column:strava_status;NOT NULL" json:"strava_status"`
+	LastError    string `gorm:"column:last_error;NOT NULL" json:"last_error"`
+	ActivityID   int64  `gorm:"column:activity_id;NOT NULL" json:"activity_id"`
+	Attempts     int    `gorm:"column:attempts;NOT NULL" json:"attempts"`
+
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (StravaUpload) TableName() string {
+	return "strava_upload"
+}
+
+type UploadStatus int
+
+const (
+	UploadProcessingStatus UploadStatus = iota // strava 处理中
+	UploadReadyStatus                          // strava 已经生成活动, 已经加入推送队列导入
+	UploadFailedStatus                         // 上传失败, 如: 文件格式错误, 重复的活动
+)
+
+type StravaUploadParam struct {
+	Status       *int       `gorm:"column:status" json:"status"`
+	StravaStatus *string    `gorm:"column:strava_status" json:"strava_status"`
+	LastError    *string    `gorm:"column:last_error" json:"last_error"`
+	ActivityID   *int64     `gorm:"column:activity_id" json:"activity_id"`
+	Attempts     *int       `gorm:"column:attempts" json:"attempts"`
+	UpdatedAt    *time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+type StravaUploadQueryParam struct {
+	query.Param
+
+	Status *int
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/soft_delete"
+
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+const (
+	HeartrateZone = "heartrate"
+	PowerZone     = "power"
+)
+
+// StravaActivityZone 活动在每个心率、功率区间的时间, 每个区间一行
+type StravaActivityZone struct {
+	ID             int64                 `gorm:"column:id;primary_key" json:"id"`
+	ActivityID     int64                 `gorm:"column:activity_id;NOT NULL" json:"activity_id"`
+	AthleteID      int64                 `gorm:"column:athlete_id;NOT NULL" json:"athlete_id"`
+	ActivityType   string                `gorm:"column:activity_type;NOT NULL" json:"activity_type"`
+	Type           string                `gorm:"column:type;NOT NULL" json:"type"`
+	Zone           int                   `gorm:"column:zone;NOT NULL" json:"zone"`
+	Min            int                   `gorm:"column:min;default:0;NOT NULL" json:"min"`
+	Max            int                   `gorm:"column:max;default:0;NOT NULL" json:"max"`
+	Time           int                   `gorm:"column:time;default:0;NOT NULL" json:"time"`
+	SensorBased    bool                  `gorm:"column:sensor_based;default:false;NOT NULL" json:"sensor_based"`
+	StartDateLocal time.Time             `gorm:"column:start_date_local;NOT NULL" json:"start_date_local"`
+	CreatedAt      time.Time             `gorm:"column:created_at" json:"created_at,omitempty"`
+	UpdatedAt      time.Time             `gorm:"column:updated_at" json:"updated_at,omitempty"`
+	DeletedAt      soft_delete.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+}
+
+func (m *StravaActivityZone) TableName() string {
+	return "strava_activity_zone"
+}
+
+// StravaAthleteZone 用户设置的心率、功率区间
+type StravaAthleteZone struct {
+	AthleteID int64     `gorm:"column:athlete_id;primary_key" json:"athlete_id"`
+	HeartRate []byte    `gorm:"column:heart_rate" json:"heart_rate"`
+	Power     []byte    `gorm:"column:power" json:"power"`
+	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	HeartRateJSON *strava.HeartRateZoneRanges `gorm:"-"`
+	PowerJSON     *strava.PowerZoneRanges     `gorm:"-"`
+}
+
+func (m *StravaAthleteZone) TableName() string {
+	return "strava_athlete_zone"
+}
+
+func (m *StravaAthleteZone) BeforeCreate(tx *gorm.DB) error {
+	if m.HeartRateJSON != nil {
+		data, err := json.Marshal(m.HeartRateJSON)
+		if err != nil {
+			return err
+		}
+		m.HeartRate = data
+	}
+	if m.PowerJSON != nil {
+		data, err := json.Marshal(m.PowerJSON)
+		if err != nil {
+			return err
+		}
+		m.Power = data
+	}
+
+	return nil
+}
+
+func (m *StravaAthleteZone) AfterFind(tx *gorm.DB) error {
+	if len(m.HeartRate) > 0 {
+		m.HeartRateJSON = new(strava.HeartRateZoneRanges)
+		if err := json.Unmarshal(m.HeartRate, m.HeartRateJSON); err != nil {
+			return err
+		}
+	}
+	if len(m.Power) > 0 {
+		m.PowerJSON = new(strava.PowerZoneRanges)
+		if err := json.Unmarshal(m.Power, m.PowerJSON); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -20,6 +20,8 @@ type User struct {
 	SourceID  int64  `gorm:"source_id" json:"source_id"`
 	Status    int    `gorm:"status" json:"status"`
 
+	SourceStatus int `gorm:"column:source_status" json:"source_status"`
+
 	CreatedAt time.Time             `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time             `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
 	DeletedAt soft_delete.DeletedAt `gorm:"column:deleted_at;default:0" json:"deleted_at"`
@@ -37,6 +39,22 @@ const (
 	ActivatedStatus
 )
 
+// UserRole 用户角色
+type UserRole int
+
+const (
+	NormalRole UserRole = iota
+	AdminRole           // 管理员, 可以访问管理接口
+)
+
+// SourceStatus oauth2 来源的授权状态
+type SourceStatus int
+
+const (
+	SourceConnectedStatus    SourceStatus = iota // 已授权
+	SourceDisconnectedStatus                     // 用户在 oauth2 来源(如 strava)撤销了授权
+)
+
 type UserParam struct {
 	query.Param `gorm:"-"`
 
@@ -46,6 +64,8 @@ type UserParam struct {
 	Role      *int    `gorm:"role" json:"role"`
 	Status    *int    `gorm:"status" json:"status"`
 
+	SourceStatus *int `gorm:"column:source_status" json:"source_status"`
+
 	UpdatedAt *time.Time            `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
 	DeletedAt soft_delete.DeletedAt `gorm:"column:deleted_at;default:0" json:"deleted_at"`
 }
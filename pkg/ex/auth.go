@@ -10,6 +10,7 @@ type User struct {
 	SourceID int64
 	Source   string
 	Email    string
+	Role     int
 }
 
 // AuthRequired middleware
@@ -28,7 +29,20 @@ func AuthRequired() echo.MiddlewareFunc {
 			}
 			source, _ := sess.Values["source"].(string)
 			email, _ := sess.Values["email"].(string)
-			c.Set("user", User{ID: int64(id), SourceID: int64(sourceID), Source: source, Email: email})
+			role, _ := sess.Values["role"].(float64)
+			c.Set("user", User{ID: int64(id), SourceID: int64(sourceID), Source: source, Email: email, Role: int(role)})
+			return next(c)
+		}
+	}
+}
+
+// RoleRequired middleware, 需要在 AuthRequired 之后使用
+func RoleRequired(role int) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if GetUser(c).Role != role {
+				return ErrForbidden
+			}
 			return next(c)
 		}
 	}
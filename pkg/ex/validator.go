@@ -16,6 +16,18 @@ var typeMap = map[string]bool{
 	"all":         true,
 }
 
+// stravaTypeMap strava 的活动类型, 修改活动时使用
+var stravaTypeMap = map[string]bool{
+	"AlpineSki": true, "BackcountrySki": true, "Canoeing": true, "Crossfit": true, "EBikeRide": true,
+	"Elliptical": true, "Golf": true, "Handcycle": true, "Hike": true, "IceSkate": true,
+	"InlineSkate": true, "Kayaking": true, "Kitesurf": true, "NordicSki": true, "Ride": true,
+	"RockClimbing": true, "RollerSki": true, "Rowing": true, "Run": true, "Sail": true,
+	"Skateboard": true, "Snowboard": true, "Snowshoe": true, "Soccer": true, "StairStepper": true,
+	"StandUpPaddling": true, "Surfing": true, "Swim": true, "Velomobile": true, "VirtualRide": true,
+	"VirtualRun": true, "Walk": true, "WeightTraining": true, "Wheelchair": true, "Windsurf": true,
+	"Workout": true, "Yoga": true,
+}
+
 var fieldMap = map[string]bool{
 	"distance":    true,
 	"calories":    true,
@@ -39,6 +51,11 @@ func ActivityType(fl validator.FieldLevel) bool {
 	return typeMap[activityType]
 }
 
+// StravaActivityType validate strava activity type, 如: Run, VirtualRide
+func StravaActivityType(fl validator.FieldLevel) bool {
+	return stravaTypeMap[fl.Field().String()]
+}
+
 // StatsField validate stats field
 func StatsField(fl validator.FieldLevel) bool {
 	return fieldMap[fl.Field().String()]
@@ -65,6 +82,7 @@ func NewValidator() *CustomValidator {
 		Validator: validator.New(),
 	}
 	_ = v.Validator.RegisterValidation("activity", ActivityType)
+	_ = v.Validator.RegisterValidation("strava_activity", StravaActivityType)
 	_ = v.Validator.RegisterValidation("stats_field", StatsField)
 	_ = v.Validator.RegisterValidation("stats_freq", StatsFreq)
 	_ = v.Validator.RegisterValidation("stats_method", StatsMethod)
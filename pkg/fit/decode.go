@@ -0,0 +1,365 @@
+package fit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	headerSize       = 12
+	headerSizeCRC    = 14
+	compressedHeader = 0x80
+	definitionHeader = 0x40
+	developerFlag    = 0x20
+	localTypeMask    = 0x0F
+
+	compressedTypeMask   = 0x60
+	compressedOffsetMask = 0x1F
+)
+
+// base type 的编号, 最高位表示多字节类型
+const (
+	baseEnum    = 0x00
+	baseSint8   = 0x01
+	baseUint8   = 0x02
+	baseSint16  = 0x83
+	baseUint16  = 0x84
+	baseSint32  = 0x85
+	baseUint32  = 0x86
+	baseString  = 0x07
+	baseFloat32 = 0x88
+	baseFloat64 = 0x89
+	baseUint8z  = 0x0A
+	baseUint16z = 0x8B
+	baseUint32z = 0x8C
+	baseByte    = 0x0D
+	baseSint64  = 0x8E
+	baseUint64  = 0x8F
+	baseUint64z = 0x90
+)
+
+type fieldDef struct {
+	num      byte
+	size     byte
+	baseType byte
+}
+
+type definition struct {
+	global  uint16
+	order   binary.ByteOrder
+	fields  []fieldDef
+	devSize int // 开发者字段的总长度, 解码时跳过
+}
+
+// message 一条数据消息, 数值字段统一为 float64, 无效值不会出现在 values 中
+type message struct {
+	global  uint16
+	values  map[byte]float64
+	strings map[byte]string
+}
+
+func (m *message) float(num byte) *float64 {
+	v, ok := m.values[num]
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+func (m *message) int(num byte) *int {
+	v, ok := m.values[num]
+	if !ok {
+		return nil
+	}
+	r := int(v)
+	return &r
+}
+
+func (m *message) int64(num byte) *int64 {
+	v, ok := m.values[num]
+	if !ok {
+		return nil
+	}
+	r := int64(v)
+	return &r
+}
+
+// scaled FIT 的物理值为 原始值 / scale - offset
+func (m *message) scaled(num byte, scale, offset float64) *float64 {
+	v, ok := m.values[num]
+	if !ok {
+		return nil
+	}
+	r := v/scale - offset
+	return &r
+}
+
+func (m *message) time(num byte) time.Time {
+	v, ok := m.values[num]
+	if !ok {
+		return time.Time{}
+	}
+	return epoch.Add(time.Duration(v) * time.Second)
+}
+
+// semicircle 位置单位为 semicircle, 2^31 semicircle 为 180 度
+func (m *message) semicircle(num byte) *float64 {
+	v, ok := m.values[num]
+	if !ok {
+		return nil
+	}
+	r := v * 180 / math.Pow(2, 31)
+	return &r
+}
+
+// Decode 解码 FIT 文件, 校验文件头和文件的 crc, 只读取第一个 FIT 文件 (不支持连接在一起的多个文件)
+func Decode(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < headerSize {
+		return nil, ErrHeader
+	}
+	size := int(data[0])
+	if (size != headerSize && size != headerSizeCRC) || len(data) < size || !bytes.Equal(data[8:12], []byte(".FIT")) {
+		return nil, ErrHeader
+	}
+	if size == headerSizeCRC {
+		// 文件头的 crc 可以为 0, 表示不校验
+		if c := binary.LittleEndian.Uint16(data[12:14]); c != 0 && c != checksum(data[:12]) {
+			return nil, ErrCRC
+		}
+	}
+	dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	end := size + dataSize
+	if len(data) < end+2 {
+		return nil, ErrTruncated
+	}
+	if binary.LittleEndian.Uint16(data[end:end+2]) != checksum(data[:end]) {
+		return nil, ErrCRC
+	}
+
+	d := decoder{data: data[size:end], defs: make(map[byte]*definition)}
+	var f File
+	for d.pos < len(d.data) {
+		m, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			f.add(m)
+		}
+	}
+
+	return &f, nil
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+	defs map[byte]*definition
+
+	lastTimestamp uint32 // 最近的时间戳, 压缩时间戳的消息依赖它
+}
+
+// next 读取一条消息, 定义消息和不需要的数据消息返回 nil
+func (d *decoder) next() (*message, error) {
+	header, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	h := header[0]
+	if h&compressedHeader != 0 {
+		def := d.defs[(h&compressedTypeMask)>>5]
+		if def == nil {
+			return nil, fmt.Errorf("%w: undefined local message type", ErrFormat)
+		}
+		// 时间偏移为 5 位, 小于上一个时间戳的低 5 位时进位
+		offset := uint32(h & compressedOffsetMask)
+		ts := d.lastTimestamp&^compressedOffsetMask | offset
+		if offset < d.lastTimestamp&compressedOffsetMask {
+			ts += compressedOffsetMask + 1
+		}
+		d.lastTimestamp = ts
+		m, err := d.readData(def)
+		if m != nil {
+			m.values[fieldTimestamp] = float64(ts)
+		}
+		return m, err
+	}
+	if h&definitionHeader != 0 {
+		return nil, d.readDefinition(h&localTypeMask, h&developerFlag != 0)
+	}
+	def := d.defs[h&localTypeMask]
+	if def == nil {
+		return nil, fmt.Errorf("%w: undefined local message type", ErrFormat)
+	}
+	m, err := d.readData(def)
+	if m != nil {
+		if ts, ok := m.values[fieldTimestamp]; ok {
+			d.lastTimestamp = uint32(ts)
+		}
+	}
+	return m, err
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if d.pos+n > len(d.data) {
+		return nil, ErrTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) readDefinition(local byte, developer bool) error {
+	b, err := d.read(5)
+	if err != nil {
+		return err
+	}
+	def := definition{order: binary.LittleEndian}
+	if b[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.global = def.order.Uint16(b[2:4])
+	fields, err := d.read(int(b[4]) * 3)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(fields); i += 3 {
+		def.fields = append(def.fields, fieldDef{num: fields[i], size: fields[i+1], baseType: fields[i+2]})
+	}
+	if developer {
+		n, err := d.read(1)
+		if err != nil {
+			return err
+		}
+		devFields, err := d.read(int(n[0]) * 3)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(devFields); i += 3 {
+			def.devSize += int(devFields[i+1])
+		}
+	}
+	d.defs[local] = &def
+
+	return nil
+}
+
+func (d *decoder) readData(def *definition) (*message, error) {
+	_, wanted := messages[def.global]
+	m := message{global: def.global, values: make(map[byte]float64), strings: make(map[byte]string)}
+	for _, item := range def.fields {
+		b, err := d.read(int(item.size))
+		if err != nil {
+			return nil, err
+		}
+		// 时间戳需要用于压缩时间戳, 不需要的消息也要解析
+		if !wanted && item.num != fieldTimestamp {
+			continue
+		}
+		if item.baseType == baseString {
+			if s := string(bytes.TrimRight(b, "\x00")); s != "" {
+				m.strings[item.num] = s
+			}
+			continue
+		}
+		if v, ok := decodeValue(b, item.baseType, def.order); ok {
+			m.values[item.num] = v
+		}
+	}
+	if _, err := d.read(def.devSize); err != nil {
+		return nil, err
+	}
+	if !wanted {
+		if ts, ok := m.values[fieldTimestamp]; ok {
+			d.lastTimestamp = uint32(ts)
+		}
+		return nil, nil
+	}
+
+	return &m, nil
+}
+
+// decodeValue 解码一个数值, 无效值和数组返回 false
+//
+//nolint:gocyclo
+func decodeValue(b []byte, baseType byte, order binary.ByteOrder) (float64, bool) {
+	switch baseType {
+	case baseEnum, baseUint8, baseByte:
+		if len(b) != 1 || b[0] == 0xFF {
+			return 0, false
+		}
+		return float64(b[0]), true
+	case baseUint8z:
+		if len(b) != 1 || b[0] == 0 {
+			return 0, false
+		}
+		return float64(b[0]), true
+	case baseSint8:
+		if len(b) != 1 || b[0] == 0x7F {
+			return 0, false
+		}
+		return float64(int8(b[0])), true
+	case baseUint16, baseUint16z:
+		if len(b) != 2 {
+			return 0, false
+		}
+		v := order.Uint16(b)
+		if (baseType == baseUint16 && v == math.MaxUint16) || (baseType == baseUint16z && v == 0) {
+			return 0, false
+		}
+		return float64(v), true
+	case baseSint16:
+		if len(b) != 2 || order.Uint16(b) == math.MaxInt16 {
+			return 0, false
+		}
+		return float64(int16(order.Uint16(b))), true
+	case baseUint32, baseUint32z:
+		if len(b) != 4 {
+			return 0, false
+		}
+		v := order.Uint32(b)
+		if (baseType == baseUint32 && v == math.MaxUint32) || (baseType == baseUint32z && v == 0) {
+			return 0, false
+		}
+		return float64(v), true
+	case baseSint32:
+		if len(b) != 4 || order.Uint32(b) == math.MaxInt32 {
+			return 0, false
+		}
+		return float64(int32(order.Uint32(b))), true
+	case baseUint64, baseUint64z:
+		if len(b) != 8 {
+			return 0, false
+		}
+		v := order.Uint64(b)
+		if (baseType == baseUint64 && v == math.MaxUint64) || (baseType == baseUint64z && v == 0) {
+			return 0, false
+		}
+		return float64(v), true
+	case baseSint64:
+		if len(b) != 8 || order.Uint64(b) == math.MaxInt64 {
+			return 0, false
+		}
+		return float64(int64(order.Uint64(b))), true
+	case baseFloat32:
+		if len(b) != 4 || order.Uint32(b) == math.MaxUint32 {
+			return 0, false
+		}
+		return float64(math.Float32frombits(order.Uint32(b))), true
+	case baseFloat64:
+		if len(b) != 8 || order.Uint64(b) == math.MaxUint64 {
+			return 0, false
+		}
+		return math.Float64frombits(order.Uint64(b)), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,162 @@
+// Package fit 解码 Garmin FIT 活动文件, 只解析 file_id, record, lap, session, device_info 和 activity 消息,
+// 其它消息和开发者字段会被跳过, 协议参考 https://developer.garmin.com/fit/protocol/
+package fit
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrHeader    = errors.New("fit: invalid file header")
+	ErrCRC       = errors.New("fit: crc mismatch")
+	ErrTruncated = errors.New("fit: unexpected end of file")
+	ErrFormat    = errors.New("fit: invalid message")
+)
+
+// epoch FIT 时间戳为 1989-12-31 00:00:00 UTC 起的秒数
+var epoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// Sport 运动类型, 只列出常用的值
+type Sport uint8
+
+const (
+	SportGeneric            Sport = 0
+	SportRunning            Sport = 1
+	SportCycling            Sport = 2
+	SportFitnessEquipment   Sport = 4
+	SportSwimming           Sport = 5
+	SportTraining           Sport = 10
+	SportWalking            Sport = 11
+	SportCrossCountrySkiing Sport = 12
+	SportAlpineSkiing       Sport = 13
+	SportRowing             Sport = 15
+	SportHiking             Sport = 17
+	SportEBiking            Sport = 21
+	SportInvalid            Sport = 0xFF
+)
+
+// SubSport 运动子类型, 只列出常用的值
+type SubSport uint8
+
+const (
+	SubSportGeneric         SubSport = 0
+	SubSportTreadmill       SubSport = 1
+	SubSportTrail           SubSport = 3
+	SubSportIndoorCycling   SubSport = 6
+	SubSportMountain        SubSport = 8
+	SubSportLapSwimming     SubSport = 17
+	SubSportOpenWater       SubSport = 18
+	SubSportVirtualActivity SubSport = 58
+	SubSportInvalid         SubSport = 0xFF
+)
+
+// manufacturers 常见的厂商, 用于生成设备名称
+var manufacturers = map[int]string{
+	1:   "Garmin",
+	23:  "Suunto",
+	32:  "Wahoo Fitness",
+	69:  "Stages Cycling",
+	89:  "Tacx",
+	123: "Polar",
+	255: "Development",
+	260: "Zwift",
+	265: "Strava",
+	294: "Coros",
+}
+
+// ManufacturerName 厂商名称, 未知的厂商返回空
+func ManufacturerName(id int) string {
+	return manufacturers[id]
+}
+
+// File 解码后的活动文件, 文件中没有的字段为 nil
+type File struct {
+	FileID   *FileID
+	Activity *Activity
+	Records  []*Record
+	Laps     []*Lap
+	Sessions []*Session
+	Devices  []*DeviceInfo
+}
+
+type FileID struct {
+	Type         *int
+	Manufacturer *int
+	Product      *int
+	SerialNumber *int64
+	TimeCreated  time.Time
+}
+
+// Activity local_timestamp 为当地时间, 与 timestamp 的差为时区偏移
+type Activity struct {
+	Timestamp      time.Time
+	LocalTimestamp time.Time
+}
+
+// Record 一个采样点
+type Record struct {
+	Timestamp   time.Time
+	Lat         *float64 // 纬度, 单位度
+	Lng         *float64 // 经度, 单位度
+	Altitude    *float64 // 海拔, 单位米
+	HeartRate   *int     // 心率, 单位 bpm
+	Cadence     *int     // 踏频或者单脚步频, 单位 rpm
+	Distance    *float64 // 累计距离, 单位米
+	Speed       *float64 // 速度, 单位 m/s
+	Power       *int     // 功率, 单位瓦
+	Temperature *int     // 温度, 单位摄氏度
+}
+
+// Summary lap 和 session 共有的统计字段
+type Summary struct {
+	Timestamp        time.Time // 结束时间
+	StartTime        time.Time
+	StartLat         *float64
+	StartLng         *float64
+	TotalElapsedTime *float64 // 总用时, 单位秒
+	TotalTimerTime   *float64 // 计时时间, 不包含暂停, 单位秒
+	TotalDistance    *float64 // 单位米
+	TotalCalories    *int
+	AvgSpeed         *float64 // 单位 m/s
+	MaxSpeed         *float64
+	AvgHeartRate     *int
+	MaxHeartRate     *int
+	AvgCadence       *int
+	AvgPower         *int
+	MaxPower         *int
+	TotalAscent      *int // 单位米
+	TotalDescent     *int
+}
+
+type Lap struct {
+	Summary
+	MessageIndex *int
+}
+
+type Session struct {
+	Summary
+	Sport    Sport
+	SubSport SubSport
+}
+
+// DeviceInfo device_index 为 0 的设备是生成文件的设备
+type DeviceInfo struct {
+	Timestamp       time.Time
+	DeviceIndex     *int
+	Manufacturer    *int
+	Product         *int
+	SerialNumber    *int64
+	SoftwareVersion *float64
+	ProductName     string
+}
+
+// Creator 生成文件的设备, 没有 device_info 时为空
+func (f *File) Creator() *DeviceInfo {
+	for _, item := range f.Devices {
+		if item.DeviceIndex != nil && *item.DeviceIndex == 0 {
+			return item
+		}
+	}
+	return nil
+}
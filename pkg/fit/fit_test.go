@@ -0,0 +1,175 @@
+package fit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// builder 构造测试用的 FIT 文件
+type builder struct {
+	buf bytes.Buffer
+}
+
+func (b *builder) define(local byte, global uint16, order binary.ByteOrder, fields ...fieldDef) {
+	b.buf.WriteByte(definitionHeader | local)
+	b.buf.WriteByte(0)
+	if order == binary.BigEndian {
+		b.buf.WriteByte(1)
+	} else {
+		b.buf.WriteByte(0)
+	}
+	_ = binary.Write(&b.buf, order, global)
+	b.buf.WriteByte(byte(len(fields)))
+	for _, item := range fields {
+		b.buf.Write([]byte{item.num, item.size, item.baseType})
+	}
+}
+
+func (b *builder) data(header byte, order binary.ByteOrder, values ...interface{}) {
+	b.buf.WriteByte(header)
+	for _, v := range values {
+		_ = binary.Write(&b.buf, order, v)
+	}
+}
+
+func (b *builder) bytes() []byte {
+	header := make([]byte, headerSizeCRC)
+	header[0] = headerSizeCRC
+	header[1] = 0x20
+	binary.LittleEndian.PutUint16(header[2:4], 2132)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(b.buf.Len()))
+	copy(header[8:12], ".FIT")
+	binary.LittleEndian.PutUint16(header[12:14], checksum(header[:12]))
+
+	data := append(header, b.buf.Bytes()...)
+	crc := make([]byte, 2)
+	binary.LittleEndian.PutUint16(crc, checksum(data))
+	return append(data, crc...)
+}
+
+func fitTime(t time.Time) uint32 {
+	return uint32(t.Sub(epoch) / time.Second)
+}
+
+func semicircles(deg float64) int32 {
+	return int32(deg / 180 * (1 << 31))
+}
+
+func TestDecode(t *testing.T) {
+	le := binary.LittleEndian
+	start := time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)
+	var b builder
+
+	b.define(0, mesgFileID, le,
+		fieldDef{0, 1, baseEnum}, fieldDef{1, 2, baseUint16}, fieldDef{3, 4, baseUint32z}, fieldDef{4, 4, baseUint32})
+	b.data(0, le, uint8(4), uint16(1), uint32(3001), fitTime(start))
+
+	var name [16]byte
+	copy(name[:], "Forerunner 955")
+	b.define(1, mesgDeviceInfo, le,
+		fieldDef{fieldTimestamp, 4, baseUint32}, fieldDef{0, 1, baseUint8}, fieldDef{2, 2, baseUint16},
+		fieldDef{5, 2, baseUint16}, fieldDef{27, 16, baseString})
+	b.data(1, le, fitTime(start), uint8(0), uint16(1), uint16(1234), name)
+
+	// 带开发者字段的 record 定义
+	b.buf.Write([]byte{definitionHeader | developerFlag | 2, 0, 0})
+	_ = binary.Write(&b.buf, le, uint16(mesgRecord))
+	b.buf.Write([]byte{7,
+		fieldTimestamp, 4, baseUint32, 0, 4, baseSint32, 1, 4, baseSint32, 2, 2, baseUint16,
+		3, 1, baseUint8, 5, 4, baseUint32, 7, 2, baseUint16,
+		1, 0, 2, 0})
+	b.data(2, le, fitTime(start), semicircles(31.2304), semicircles(121.4737), uint16(2525),
+		uint8(120), uint32(0), uint16(0xFFFF), uint16(7))
+	b.data(2, le, fitTime(start)+30, semicircles(31.23043), semicircles(121.47373), uint16(2526),
+		uint8(0xFF), uint32(1020), uint16(200), uint16(7))
+
+	// 未解析的 event 消息, 时间戳仍然用于压缩时间戳, 低 5 位为 30
+	last := (fitTime(start)+64)&^compressedOffsetMask | 30
+	b.define(3, 21, le, fieldDef{fieldTimestamp, 4, baseUint32}, fieldDef{0, 1, baseEnum})
+	b.data(3, le, last, uint8(0))
+
+	// 压缩时间戳的 record, 低 5 位从 30 回到 1, 需要进位
+	b.define(0, mesgRecord, le, fieldDef{3, 1, baseUint8})
+	b.data(compressedHeader|byte((last+3)&compressedOffsetMask), le, uint8(131))
+
+	b.define(1, mesgLap, binary.BigEndian,
+		fieldDef{fieldTimestamp, 4, baseUint32}, fieldDef{2, 4, baseUint32}, fieldDef{7, 4, baseUint32},
+		fieldDef{9, 4, baseUint32}, fieldDef{11, 2, baseUint16}, fieldDef{15, 1, baseUint8})
+	b.data(1, binary.BigEndian, fitTime(start)+34, fitTime(start), uint32(34000), uint32(102000), uint16(35), uint8(0xFF))
+
+	b.define(2, mesgSession, le,
+		fieldDef{fieldTimestamp, 4, baseUint32}, fieldDef{2, 4, baseUint32}, fieldDef{5, 1, baseEnum},
+		fieldDef{6, 1, baseEnum}, fieldDef{8, 4, baseUint32}, fieldDef{16, 1, baseUint8}, fieldDef{124, 4, baseUint32})
+	b.data(2, le, fitTime(start)+34, fitTime(start), uint8(SportRunning), uint8(0xFF), uint32(33500), uint8(125), uint32(3342))
+
+	b.define(3, mesgActivity, le, fieldDef{fieldTimestamp, 4, baseUint32}, fieldDef{5, 4, baseUint32})
+	b.data(3, le, fitTime(start)+34, fitTime(start.Add(8*time.Hour))+34)
+
+	f, err := Decode(bytes.NewReader(b.bytes()))
+	require.NoError(t, err)
+
+	require.Equal(t, *f.FileID.Type, 4)
+	require.Equal(t, *f.FileID.SerialNumber, int64(3001))
+	require.Equal(t, f.FileID.TimeCreated, start)
+	require.Nil(t, f.FileID.Product)
+
+	require.Equal(t, f.Creator().ProductName, "Forerunner 955")
+	require.InDelta(t, *f.Creator().SoftwareVersion, 12.34, 1e-9)
+
+	require.Len(t, f.Records, 3)
+	require.Equal(t, f.Records[0].Timestamp, start)
+	require.InDelta(t, *f.Records[0].Lat, 31.2304, 1e-6)
+	require.InDelta(t, *f.Records[0].Lng, 121.4737, 1e-6)
+	require.InDelta(t, *f.Records[0].Altitude, 5.1, 0.2)
+	require.Nil(t, f.Records[0].Power)
+	require.Nil(t, f.Records[1].HeartRate)
+	require.Equal(t, *f.Records[1].Distance, 10.2)
+	require.Equal(t, *f.Records[1].Power, 200)
+	require.Equal(t, f.Records[2].Timestamp, epoch.Add(time.Duration(last+3)*time.Second))
+	require.Equal(t, *f.Records[2].HeartRate, 131)
+	require.Nil(t, f.Records[2].Lat)
+
+	require.Len(t, f.Laps, 1)
+	require.Equal(t, *f.Laps[0].TotalElapsedTime, 34.0)
+	require.Equal(t, *f.Laps[0].TotalDistance, 1020.0)
+	require.Equal(t, *f.Laps[0].TotalCalories, 35)
+	require.Nil(t, f.Laps[0].AvgHeartRate)
+
+	require.Len(t, f.Sessions, 1)
+	require.Equal(t, f.Sessions[0].Sport, SportRunning)
+	require.Equal(t, f.Sessions[0].SubSport, SubSportInvalid)
+	require.Equal(t, *f.Sessions[0].TotalTimerTime, 33.5)
+	require.Equal(t, *f.Sessions[0].AvgHeartRate, 125)
+	require.Equal(t, *f.Sessions[0].AvgSpeed, 3.342)
+	require.Nil(t, f.Sessions[0].TotalDistance)
+
+	require.Equal(t, f.Activity.LocalTimestamp.Sub(f.Activity.Timestamp), 8*time.Hour)
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	var b builder
+	b.define(0, mesgRecord, binary.LittleEndian, fieldDef{3, 1, baseUint8})
+	b.data(0, binary.LittleEndian, uint8(120))
+	data := b.bytes()
+
+	_, err := Decode(bytes.NewReader(data[:10]))
+	require.ErrorIs(t, err, ErrHeader)
+
+	_, err = Decode(bytes.NewReader(data[:len(data)-3]))
+	require.ErrorIs(t, err, ErrTruncated)
+
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-3] = 121
+	_, err = Decode(bytes.NewReader(corrupted))
+	require.ErrorIs(t, err, ErrCRC)
+
+	// 数据消息引用未定义的 local message type
+	var u builder
+	u.data(1, binary.LittleEndian, uint8(120))
+	_, err = Decode(bytes.NewReader(u.bytes()))
+	require.ErrorIs(t, err, ErrFormat)
+}
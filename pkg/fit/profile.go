@@ -0,0 +1,161 @@
+package fit
+
+// 全局消息编号
+const (
+	mesgFileID     = 0
+	mesgSession    = 18
+	mesgLap        = 19
+	mesgRecord     = 20
+	mesgDeviceInfo = 23
+	mesgActivity   = 34
+)
+
+// 所有消息共用的字段编号
+const (
+	fieldTimestamp    = 253
+	fieldMessageIndex = 254
+)
+
+// messages 需要解析的消息
+var messages = map[uint16]struct{}{
+	mesgFileID:     {},
+	mesgSession:    {},
+	mesgLap:        {},
+	mesgRecord:     {},
+	mesgDeviceInfo: {},
+	mesgActivity:   {},
+}
+
+// summaryFields lap 和 session 中相同含义的字段编号不同
+type summaryFields struct {
+	avgSpeed, maxSpeed                 byte
+	avgHeartRate, maxHeartRate         byte
+	avgCadence                         byte
+	avgPower, maxPower                 byte
+	totalAscent, totalDescent          byte
+	enhancedAvgSpeed, enhancedMaxSpeed byte
+}
+
+var (
+	lapFields = summaryFields{
+		avgSpeed: 13, maxSpeed: 14,
+		avgHeartRate: 15, maxHeartRate: 16,
+		avgCadence: 17,
+		avgPower:   19, maxPower: 20,
+		totalAscent: 21, totalDescent: 22,
+		enhancedAvgSpeed: 110, enhancedMaxSpeed: 111,
+	}
+	sessionFields = summaryFields{
+		avgSpeed: 14, maxSpeed: 15,
+		avgHeartRate: 16, maxHeartRate: 17,
+		avgCadence: 18,
+		avgPower:   20, maxPower: 21,
+		totalAscent: 22, totalDescent: 23,
+		enhancedAvgSpeed: 124, enhancedMaxSpeed: 125,
+	}
+)
+
+func (f *File) add(m *message) {
+	switch m.global {
+	case mesgFileID:
+		f.FileID = &FileID{
+			Type:         m.int(0),
+			Manufacturer: m.int(1),
+			Product:      m.int(2),
+			SerialNumber: m.int64(3),
+			TimeCreated:  m.time(4),
+		}
+	case mesgActivity:
+		f.Activity = &Activity{
+			Timestamp:      m.time(fieldTimestamp),
+			LocalTimestamp: m.time(5),
+		}
+	case mesgRecord:
+		f.Records = append(f.Records, newRecord(m))
+	case mesgLap:
+		f.Laps = append(f.Laps, &Lap{
+			Summary:      newSummary(m, &lapFields),
+			MessageIndex: m.int(fieldMessageIndex),
+		})
+	case mesgSession:
+		s := Session{
+			Summary:  newSummary(m, &sessionFields),
+			Sport:    SportInvalid,
+			SubSport: SubSportInvalid,
+		}
+		if v := m.int(5); v != nil {
+			s.Sport = Sport(*v)
+		}
+		if v := m.int(6); v != nil {
+			s.SubSport = SubSport(*v)
+		}
+		f.Sessions = append(f.Sessions, &s)
+	case mesgDeviceInfo:
+		f.Devices = append(f.Devices, &DeviceInfo{
+			Timestamp:       m.time(fieldTimestamp),
+			DeviceIndex:     m.int(0),
+			Manufacturer:    m.int(2),
+			SerialNumber:    m.int64(3),
+			Product:         m.int(4),
+			SoftwareVersion: m.scaled(5, 100, 0),
+			ProductName:     m.strings[27],
+		})
+	}
+}
+
+// newRecord enhanced 字段的范围更大, 存在时优先使用
+func newRecord(m *message) *Record {
+	r := Record{
+		Timestamp:   m.time(fieldTimestamp),
+		Lat:         m.semicircle(0),
+		Lng:         m.semicircle(1),
+		Altitude:    m.scaled(2, 5, 500),
+		HeartRate:   m.int(3),
+		Cadence:     m.int(4),
+		Distance:    m.scaled(5, 100, 0),
+		Speed:       m.scaled(6, 1000, 0),
+		Power:       m.int(7),
+		Temperature: m.int(13),
+	}
+	if v := m.scaled(78, 5, 500); v != nil {
+		r.Altitude = v
+	}
+	if v := m.scaled(73, 1000, 0); v != nil {
+		r.Speed = v
+	}
+	if r.Lat == nil || r.Lng == nil {
+		r.Lat, r.Lng = nil, nil
+	}
+
+	return &r
+}
+
+func newSummary(m *message, fields *summaryFields) Summary {
+	s := Summary{
+		Timestamp:        m.time(fieldTimestamp),
+		StartTime:        m.time(2),
+		StartLat:         m.semicircle(3),
+		StartLng:         m.semicircle(4),
+		TotalElapsedTime: m.scaled(7, 1000, 0),
+		TotalTimerTime:   m.scaled(8, 1000, 0),
+		TotalDistance:    m.scaled(9, 100, 0),
+		TotalCalories:    m.int(11),
+		AvgSpeed:         m.scaled(fields.avgSpeed, 1000, 0),
+		MaxSpeed:         m.scaled(fields.maxSpeed, 1000, 0),
+		AvgHeartRate:     m.int(fields.avgHeartRate),
+		MaxHeartRate:     m.int(fields.maxHeartRate),
+		AvgCadence:       m.int(fields.avgCadence),
+		AvgPower:         m.int(fields.avgPower),
+		MaxPower:         m.int(fields.maxPower),
+		TotalAscent:      m.int(fields.totalAscent),
+		TotalDescent:     m.int(fields.totalDescent),
+	}
+	if v := m.scaled(fields.enhancedAvgSpeed, 1000, 0); v != nil {
+		s.AvgSpeed = v
+	}
+	if v := m.scaled(fields.enhancedMaxSpeed, 1000, 0); v != nil {
+		s.MaxSpeed = v
+	}
+
+	return s
+}
@@ -3,11 +3,13 @@ package oauth2x
 import (
 	"context"
 	"net/http"
+	"strings"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/endpoints"
 
 	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/strava"
 )
 
 const (
@@ -27,13 +29,19 @@ type ClientConfig struct {
 	ClientID     string `mapstructure:"client_id"`
 	ClientSecret string `mapstructure:"client_secret"`
 	Scopes       []string
+	BaseURL      string `mapstructure:"base_url"` // 为空时使用官方地址, 如: 本地开发时指向 stravatest
 }
 
-var provider map[string]Oauth2x
+var (
+	provider     map[string]Oauth2x
+	clientConfig map[string]*ClientConfig
+)
 
 func InitProvider(cfg []*ClientConfig) {
 	provider = make(map[string]Oauth2x, len(cfg))
+	clientConfig = make(map[string]*ClientConfig, len(cfg))
 	for _, c := range cfg {
+		clientConfig[c.Name] = c
 		if c.Name == StravaSource {
 			conf := oauth2.Config{
 				ClientID:     c.ClientID,
@@ -41,7 +49,14 @@ func InitProvider(cfg []*ClientConfig) {
 				Endpoint:     endpoints.Strava,
 				Scopes:       c.Scopes,
 			}
-			provider[c.Name] = NewStrava(&conf)
+			if c.BaseURL != "" {
+				host := strings.TrimRight(c.BaseURL, "/")
+				conf.Endpoint = oauth2.Endpoint{
+					AuthURL:  host + "/oauth/authorize",
+					TokenURL: host + "/oauth/token",
+				}
+			}
+			provider[c.Name] = NewStrava(&conf, strava.APIURL(c.BaseURL))
 		}
 	}
 }
@@ -49,3 +64,8 @@ func InitProvider(cfg []*ClientConfig) {
 func Provider() map[string]Oauth2x {
 	return provider
 }
+
+// GetClientConfig oauth2 应用配置, 如: strava 推送订阅需要 client id 和 client secret
+func GetClientConfig(name string) *ClientConfig {
+	return clientConfig[name]
+}
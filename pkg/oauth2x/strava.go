@@ -11,12 +11,14 @@ import (
 )
 
 type Strava struct {
-	conf *oauth2.Config
+	conf    *oauth2.Config
+	baseURL string
 }
 
-func NewStrava(conf *oauth2.Config) *Strava {
+func NewStrava(conf *oauth2.Config, baseURL string) *Strava {
 	return &Strava{
-		conf: conf,
+		conf:    conf,
+		baseURL: baseURL,
 	}
 }
 
@@ -28,6 +30,7 @@ func (s *Strava) Exchange(ctx context.Context, code string) (*oauth2.Token, erro
 func (s *Strava) GetUser(ctx context.Context, token *oauth2.Token) (*model.User, error) {
 	cli := s.conf.Client(ctx, token)
 	stravaCli := strava.NewClient(cli)
+	stravaCli.BaseURL = s.baseURL
 	athlete, err := stravaCli.Athlete.Athlete(ctx)
 	if err != nil {
 		return nil, err
@@ -8,7 +8,11 @@ import (
 )
 
 const (
-	activityAPI = "/activities"
+	activityAPI          = "/activities"
+	athleteActivitiesAPI = "/athlete/activities?before=%d&page=%d&per_page=%d"
+	activityZonesAPI     = "/activities/%d/zones"
+	activityCommentsAPI  = "/activities/%d/comments?page=%d&per_page=%d"
+	activityKudoersAPI   = "/activities/%d/kudos?page=%d&per_page=%d"
 
 	streamSet = "time,distance,latlng,altitude,velocity_smooth,heartrate,cadence,watts,temp,moving,grade_smooth"
 	streamAPI = "/activities/%d/streams?key_by_type=true&keys=%s"
@@ -19,7 +23,19 @@ type Activity service
 // Activity get activity info
 func (s *Activity) Activity(ctx context.Context, id int64) (*DetailedActivity, []byte, error) {
 	url := fmt.Sprintf("%s%s/%d", s.client.BaseURL, activityAPI, id)
-	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client.httpClient)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, nil, err
+	}
+	var resp DetailedActivity
+	err = json.Unmarshal(body, &resp)
+	return &resp, body, err
+}
+
+// UpdateActivity update the given activity owned by the authenticated athlete, requires activity:write scope
+func (s *Activity) UpdateActivity(ctx context.Context, id int64, activity *UpdatableActivity) (*DetailedActivity, []byte, error) {
+	url := fmt.Sprintf("%s%s/%d", s.client.BaseURL, activityAPI, id)
+	body, err := doJSON(ctx, url, http.MethodPut, activity, s.client)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -32,7 +48,7 @@ func (s *Activity) Activity(ctx context.Context, id int64) (*DetailedActivity, [
 func (s *Activity) ActivityStream(ctx context.Context, id int64) (*StreamSet, error) {
 	api := fmt.Sprintf(streamAPI, id, streamSet)
 	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
-	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client.httpClient)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
 	if err != nil {
 		return nil, err
 	}
@@ -40,3 +56,55 @@ func (s *Activity) ActivityStream(ctx context.Context, id int64) (*StreamSet, er
 	err = json.Unmarshal(body, &resp)
 	return &resp, err
 }
+
+// AthleteActivities list the authenticated athlete's activities started before the given unix time, newest first
+func (s *Activity) AthleteActivities(ctx context.Context, before int64, page, perPage int) ([]*SummaryActivity, error) {
+	api := fmt.Sprintf(athleteActivitiesAPI, before, page, perPage)
+	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp []*SummaryActivity
+	err = json.Unmarshal(body, &resp)
+	return resp, err
+}
+
+// ActivityZones get activity heart rate and power zones, summit feature, 402/403 for other athletes
+func (s *Activity) ActivityZones(ctx context.Context, id int64) ([]*ActivityZone, error) {
+	api := fmt.Sprintf(activityZonesAPI, id)
+	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp []*ActivityZone
+	err = json.Unmarshal(body, &resp)
+	return resp, err
+}
+
+// ActivityComments list the comments on the given activity, oldest first
+func (s *Activity) ActivityComments(ctx context.Context, id int64, page, perPage int) ([]*Comment, error) {
+	api := fmt.Sprintf(activityCommentsAPI, id, page, perPage)
+	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp []*Comment
+	err = json.Unmarshal(body, &resp)
+	return resp, err
+}
+
+// ActivityKudoers list the athletes who kudoed the given activity, only firstname and lastname are returned
+func (s *Activity) ActivityKudoers(ctx context.Context, id int64, page, perPage int) ([]*SummaryAthlete, error) {
+	api := fmt.Sprintf(activityKudoersAPI, id, page, perPage)
+	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp []*SummaryAthlete
+	err = json.Unmarshal(body, &resp)
+	return resp, err
+}
@@ -3,11 +3,14 @@ package strava
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 )
 
 const (
-	athleteAPI = "/athlete"
+	athleteAPI      = "/athlete"
+	athleteZonesAPI = "/athlete/zones"
+	athleteStatsAPI = "/athletes/%d/stats"
 )
 
 type Athlete service
@@ -15,7 +18,7 @@ type Athlete service
 // Athlete get athlete basic info
 func (s *Athlete) Athlete(ctx context.Context) (*SummaryAthlete, error) {
 	url := s.client.BaseURL + athleteAPI
-	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client.httpClient)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
 	if err != nil {
 		return nil, err
 	}
@@ -23,3 +26,40 @@ func (s *Athlete) Athlete(ctx context.Context) (*SummaryAthlete, error) {
 	err = json.Unmarshal(body, &resp)
 	return &resp, err
 }
+
+// DetailedAthlete get the authenticated athlete's profile: ftp, weight, measurement preference, bikes, shoes
+func (s *Athlete) DetailedAthlete(ctx context.Context) (*DetailedAthlete, error) {
+	url := s.client.BaseURL + athleteAPI
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp DetailedAthlete
+	err = json.Unmarshal(body, &resp)
+	return &resp, err
+}
+
+// Stats get the activity stats of the authenticated athlete, only includes activities set to Everyone visibility
+func (s *Athlete) Stats(ctx context.Context, id int64) (*ActivityStats, error) {
+	api := fmt.Sprintf(athleteStatsAPI, id)
+	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp ActivityStats
+	err = json.Unmarshal(body, &resp)
+	return &resp, err
+}
+
+// Zones get the authenticated athlete's heart rate and power zones
+func (s *Athlete) Zones(ctx context.Context) (*Zones, error) {
+	url := s.client.BaseURL + athleteZonesAPI
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp Zones
+	err = json.Unmarshal(body, &resp)
+	return &resp, err
+}
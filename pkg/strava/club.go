@@ -0,0 +1,56 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	athleteClubsAPI   = "/athlete/clubs?page=%d&per_page=%d"
+	clubAPI           = "/clubs/%d"
+	clubActivitiesAPI = "/clubs/%d/activities?page=%d&per_page=%d"
+)
+
+type Clubs service
+
+// AthleteClubs list the clubs whose membership includes the authenticated athlete
+func (s *Clubs) AthleteClubs(ctx context.Context, page, perPage int) ([]*SummaryClub, error) {
+	api := fmt.Sprintf(athleteClubsAPI, page, perPage)
+	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp []*SummaryClub
+	err = json.Unmarshal(body, &resp)
+	return resp, err
+}
+
+// Club get club by id
+func (s *Clubs) Club(ctx context.Context, id int64) (*DetailedClub, error) {
+	api := fmt.Sprintf(clubAPI, id)
+	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp DetailedClub
+	err = json.Unmarshal(body, &resp)
+	return &resp, err
+}
+
+// ClubActivities list recent activities performed by members of a club, newest first,
+// the authenticated athlete must be a member of the club
+func (s *Clubs) ClubActivities(ctx context.Context, id int64, page, perPage int) ([]*ClubActivity, error) {
+	api := fmt.Sprintf(clubActivitiesAPI, id, page, perPage)
+	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp []*ClubActivity
+	err = json.Unmarshal(body, &resp)
+	return resp, err
+}
@@ -0,0 +1,91 @@
+package strava
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrBadRequest   = errors.New("strava: bad request")
+	ErrUnauthorized = errors.New("strava: unauthorized")
+	ErrNotFound     = errors.New("strava: not found")
+	ErrRateLimited  = errors.New("strava: rate limited")
+	ErrServer       = errors.New("strava: server error")
+)
+
+// APIError strava api 返回的错误, 可以用 errors.Is 判断错误类型, 如: errors.Is(err, ErrNotFound)
+type APIError struct {
+	StatusCode int
+	Fault      *Fault
+	RetryAfter time.Duration // 429/503 响应的 Retry-After, 没有时为 0
+
+	kind error
+}
+
+func (e *APIError) Error() string {
+	msg := http.StatusText(e.StatusCode)
+	if e.Fault != nil && e.Fault.Message != "" {
+		msg = e.Fault.Message
+	}
+	s := fmt.Sprintf("%s: status %d: %s", e.kind, e.StatusCode, msg)
+	if e.Fault != nil {
+		for _, item := range e.Fault.Errors {
+			s += fmt.Sprintf("; %s %s %s", item.Resource, item.Field, item.Code)
+		}
+	}
+	return s
+}
+
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// Temporary 限流和服务端错误可以重试
+func (e *APIError) Temporary() bool {
+	return e.kind == ErrRateLimited || e.kind == ErrServer
+}
+
+// newAPIError 非 2xx 响应转换为 APIError, body 为 strava 的 Fault
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := APIError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+	var fault Fault
+	if json.Unmarshal(body, &fault) == nil && (fault.Message != "" || len(fault.Errors) > 0) {
+		e.Fault = &fault
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		e.kind = ErrUnauthorized
+	case resp.StatusCode == http.StatusNotFound:
+		e.kind = ErrNotFound
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.kind = ErrRateLimited
+	case resp.StatusCode >= http.StatusInternalServerError:
+		e.kind = ErrServer
+	default:
+		e.kind = ErrBadRequest
+	}
+	return &e
+}
+
+// parseRetryAfter 支持秒数和 http 时间两种格式
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if sec, err := strconv.Atoi(v); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
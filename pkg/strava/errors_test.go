@@ -0,0 +1,84 @@
+package strava
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{"0", 0, 0},
+		{"-5", 0, 0},
+		{"1.5", 0, 0},
+		{"soon", 0, 0},
+		// http 时间精确到秒, 与当前时间的差值略小于 30s
+		{time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat), 28 * time.Second, 30 * time.Second},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+		{"Mon, 02 Jan 2006 15:04:05", 0, 0},
+	}
+	for _, item := range tests {
+		d := parseRetryAfter(item.value)
+		require.GreaterOrEqual(t, d, item.min, item.value)
+		require.LessOrEqual(t, d, item.max, item.value)
+	}
+}
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		status     int
+		retryAfter string
+		kind       error
+		temporary  bool
+		wait       time.Duration
+	}{
+		{http.StatusBadRequest, "", ErrBadRequest, false, 0},
+		{http.StatusUnauthorized, "", ErrUnauthorized, false, 0},
+		{http.StatusForbidden, "", ErrUnauthorized, false, 0},
+		{http.StatusNotFound, "", ErrNotFound, false, 0},
+		{http.StatusConflict, "", ErrBadRequest, false, 0},
+		{http.StatusTooManyRequests, "900", ErrRateLimited, true, 15 * time.Minute},
+		{http.StatusTooManyRequests, "", ErrRateLimited, true, 0},
+		{http.StatusInternalServerError, "", ErrServer, true, 0},
+		{http.StatusBadGateway, "", ErrServer, true, 0},
+		{http.StatusServiceUnavailable, "30", ErrServer, true, 30 * time.Second},
+	}
+	for _, item := range tests {
+		resp := http.Response{StatusCode: item.status, Header: http.Header{}}
+		if item.retryAfter != "" {
+			resp.Header.Set("Retry-After", item.retryAfter)
+		}
+
+		e := newAPIError(&resp, nil)
+
+		require.True(t, errors.Is(e, item.kind), item.status)
+		require.Equal(t, e.Temporary(), item.temporary, item.status)
+		require.Equal(t, e.RetryAfter, item.wait, item.status)
+		require.Nil(t, e.Fault)
+	}
+}
+
+func TestNewAPIErrorFault(t *testing.T) {
+	body := `{"message":"Resource Not Found","errors":[{"resource":"Activity","field":"id","code":"invalid"}]}`
+	resp := http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}}
+
+	e := newAPIError(&resp, []byte(body))
+
+	require.Equal(t, e.Fault.Message, "Resource Not Found")
+	require.True(t, strings.HasSuffix(e.Error(), "Resource Not Found; Activity id invalid"))
+
+	// 不是 Fault 的 body 使用状态码的描述
+	e = newAPIError(&http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}}, []byte("<html>"))
+	require.Nil(t, e.Fault)
+	require.Equal(t, e.Error(), "strava: server error: status 502: Bad Gateway")
+}
@@ -0,0 +1,27 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	gearAPI = "/gear/%s"
+)
+
+type Gear service
+
+// Gear get equipment, shoes or bike, by id
+func (s *Gear) Gear(ctx context.Context, id string) (*DetailedGear, error) {
+	api := fmt.Sprintf(gearAPI, id)
+	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp DetailedGear
+	err = json.Unmarshal(body, &resp)
+	return &resp, err
+}
@@ -1,28 +1,149 @@
 package strava
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/happyxhw/pkg/log"
 )
 
-// do make request to strava
-func do(ctx context.Context, url, method string, body io.Reader, client *http.Client) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, method, url, body)
+const (
+	maxRetries   = 3
+	retryBackoff = time.Second
+)
+
+// do make request to strava, GET 请求在限流和服务端错误时按指数退避重试
+func do(ctx context.Context, url, method string, body io.Reader, client *Client) ([]byte, error) {
+	backoff := retryBackoff
+	for i := 0; ; i++ {
+		req, err := http.NewRequestWithContext(ctx, method, url, body)
+		if err != nil {
+			log.Error("new request", zap.Error(err))
+			return nil, err
+		}
+		data, err := send(req, client)
+		if err == nil || method != http.MethodGet || i >= maxRetries {
+			return data, err
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.Temporary() {
+			return nil, err
+		}
+		wait := backoff
+		if apiErr.RetryAfter > 0 {
+			wait = apiErr.RetryAfter
+		}
+		// 等待时间超过 ctx 的截止时间时直接返回, 由调用方决定是否重试
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return nil, err
+		}
+		log.Info("retry strava request", zap.String("url", req.URL.Path),
+			zap.Int("status", apiErr.StatusCode), zap.Duration("wait", wait))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// doJSON make json request to strava, 不重试
+func doJSON(ctx context.Context, url, method string, v interface{}, client *Client) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
 	if err != nil {
 		log.Error("new request", zap.Error(err))
 		return nil, err
 	}
-	resp, err := client.Do(req)
+	req.Header.Set("Content-Type", "application/json")
+	return send(req, client)
+}
+
+// doMultipart make multipart request to strava, 用于上传文件, 不重试
+func doMultipart(ctx context.Context, url string, form url.Values, filename string, file io.Reader,
+	client *Client) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, vs := range form {
+		for _, v := range vs {
+			if err := w.WriteField(k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	part, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(part, file); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
+	if err != nil {
+		log.Error("new request", zap.Error(err))
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return send(req, client)
+}
+
+// doForm make form request to strava
+func doForm(ctx context.Context, url, method string, form url.Values, client *Client) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader(form.Encode()))
+	if err != nil {
+		log.Error("new request", zap.Error(err))
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return send(req, client)
+}
+
+// send 非 2xx 响应返回 APIError
+func send(req *http.Request, client *Client) ([]byte, error) {
+	ctx := req.Context()
+	if client.Limiter != nil {
+		if err := client.Limiter.Wait(ctx, priorityFrom(ctx)); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := client.httpClient.Do(req)
 	if err != nil {
 		log.Error("do request", zap.Error(err))
 		return nil, err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	return io.ReadAll(resp.Body)
+	if rl := parseRateLimit(resp.Header); rl != nil && client.Limiter != nil {
+		if err = client.Limiter.Update(ctx, rl); err != nil {
+			log.Error("update strava rate limit", zap.Error(err))
+		}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, newAPIError(resp, body)
+	}
+	return body, nil
 }
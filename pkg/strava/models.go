@@ -91,8 +91,8 @@ type ExplorerSegment struct {
 // Fault
 // Encapsulates the errors that may be returned from the API.
 type Fault struct {
-	Errors  *Error `json:"errors,omitempty" bson:"errors"`   // The set of specific errors associated with this fault, if any.
-	Message string `json:"message,omitempty" bson:"message"` // The message of the fault.
+	Errors  []*Error `json:"errors,omitempty" bson:"errors"`   // The set of specific errors associated with this fault, if any.
+	Message string   `json:"message,omitempty" bson:"message"` // The message of the fault.
 }
 
 // HeartRateZoneRanges
@@ -121,6 +121,10 @@ type Lap struct {
 	StartDate          time.Time     `json:"start_date,omitempty" bson:"start_date"`                     // The time at which the lap was started.
 	StartDateLocal     time.Time     `json:"start_date_local,omitempty" bson:"start_date_local"`         // The time at which the lap was started in the local timezone.
 	TotalElevationGain float64       `json:"total_elevation_gain,omitempty" bson:"total_elevation_gain"` // The elevation gain of this lap, in meters
+	AverageHeartrate   float64       `json:"average_heartrate,omitempty" bson:"average_heartrate"`       // The lap's average heart rate
+	MaxHeartrate       float64       `json:"max_heartrate,omitempty" bson:"max_heartrate"`               // The lap's max heart rate
+	AverageWatts       float64       `json:"average_watts,omitempty" bson:"average_watts"`               // The lap's average power
+	DeviceWatts        bool          `json:"device_watts,omitempty" bson:"device_watts"`                 // Whether the watts are from a power meter
 }
 
 // LatLng
@@ -137,6 +141,26 @@ type MetaAthlete struct {
 	ID int64 `json:"id,omitempty" bson:"id"` // The unique identifier of the athlete
 }
 
+// ClubActivity 俱乐部动态中的活动, 没有 id 和开始时间
+type ClubActivity struct {
+	Athlete            *ClubAthlete `json:"athlete,omitempty" bson:"athlete"`                           // An instance of ClubAthlete.
+	Name               string       `json:"name,omitempty" bson:"name"`                                 // The name of the activity
+	Distance           float64      `json:"distance,omitempty" bson:"distance"`                         // The activity's distance, in meters
+	MovingTime         int          `json:"moving_time,omitempty" bson:"moving_time"`                   // The activity's moving time, in seconds
+	ElapsedTime        int          `json:"elapsed_time,omitempty" bson:"elapsed_time"`                 // The activity's elapsed time, in seconds
+	TotalElevationGain float64      `json:"total_elevation_gain,omitempty" bson:"total_elevation_gain"` // The activity's total elevation gain.
+	Type               string       `json:"type,omitempty" bson:"type"`                                 // Deprecated. Prefer to use sport_type
+	SportType          string       `json:"sport_type,omitempty" bson:"sport_type"`                     // An instance of SportType.
+	WorkoutType        int          `json:"workout_type,omitempty" bson:"workout_type"`                 // The activity's workout type
+}
+
+// ClubAthlete 俱乐部动态中的用户, 只有名字和姓氏的首字母
+type ClubAthlete struct {
+	ResourceState int    `json:"resource_state,omitempty" bson:"resource_state"` // Resource state, indicates level of detail. Possible values: 1 -> "meta", 2 -> "summary", 3 -> "detail"
+	Firstname     string `json:"firstname,omitempty" bson:"firstname"`           // The athlete's first name.
+	Lastname      string `json:"lastname,omitempty" bson:"lastname"`             // The athlete's last initial.
+}
+
 // MetaClub
 type MetaClub struct {
 	Id            int64  `json:"id,omitempty" bson:"id"`                         // The club's unique identifier.
@@ -172,23 +196,23 @@ type PowerZoneRanges struct {
 
 // Route
 type Route struct {
-	Athlete             *SummaryAthlete `json:"athlete,omitempty" bson:"athlete"`                             // An instance of SummaryAthlete.
-	Description         string          `json:"description,omitempty" bson:"description"`                     // The description of the route
-	Distance            float64         `json:"distance,omitempty" bson:"distance"`                           // The route's distance, in meters
-	ElevationGain       float64         `json:"elevation_gain,omitempty" bson:"elevation_gain"`               // The route's elevation gain.
-	Id                  int64           `json:"id,omitempty" bson:"id"`                                       // The unique identifier of this route
-	IdStr               string          `json:"id_str,omitempty" bson:"id_str"`                               // The unique identifier of the route in string format
-	Map                 *PolylineMap    `json:"map,omitempty" bson:"map"`                                     // An instance of PolylineMap.
-	Name                string          `json:"name,omitempty" bson:"name"`                                   // The name of this route
-	Private             bool            `json:"private,omitempty" bson:"private"`                             // Whether this route is private
-	Starred             bool            `json:"starred,omitempty" bson:"starred"`                             // Whether this route is starred by the logged-in athlete
-	Timestamp           int             `json:"timestamp,omitempty" bson:"timestamp"`                         // An epoch timestamp of when the route was created
-	Type                int             `json:"type,omitempty" bson:"type"`                                   // This route's type (1 for ride, 2 for runs)
-	SubType             int             `json:"sub_type,omitempty" bson:"sub_type"`                           // This route's sub-type (1 for road, 2 for mountain bike, 3 for cross, 4 for trail, 5 for mixed)
-	CreatedAt           time.Time       `json:"created_at,omitempty" bson:"created_at"`                       // The time at which the route was created
-	UpdatedAt           time.Time       `json:"updated_at,omitempty" bson:"updated_at"`                       // The time at which the route was last updated
-	EstimatedMovingTime int             `json:"estimated_moving_time,omitempty" bson:"estimated_moving_time"` // Estimated time in seconds for the authenticated athlete to complete route
-	Segments            *SummarySegment `json:"segments,omitempty" bson:"segments"`                           // The segments traversed by this route
+	Athlete             *SummaryAthlete   `json:"athlete,omitempty" bson:"athlete"`                             // An instance of SummaryAthlete.
+	Description         string            `json:"description,omitempty" bson:"description"`                     // The description of the route
+	Distance            float64           `json:"distance,omitempty" bson:"distance"`                           // The route's distance, in meters
+	ElevationGain       float64           `json:"elevation_gain,omitempty" bson:"elevation_gain"`               // The route's elevation gain.
+	Id                  int64             `json:"id,omitempty" bson:"id"`                                       // The unique identifier of this route
+	IdStr               string            `json:"id_str,omitempty" bson:"id_str"`                               // The unique identifier of the route in string format
+	Map                 *PolylineMap      `json:"map,omitempty" bson:"map"`                                     // An instance of PolylineMap.
+	Name                string            `json:"name,omitempty" bson:"name"`                                   // The name of this route
+	Private             bool              `json:"private,omitempty" bson:"private"`                             // Whether this route is private
+	Starred             bool              `json:"starred,omitempty" bson:"starred"`                             // Whether this route is starred by the logged-in athlete
+	Timestamp           int               `json:"timestamp,omitempty" bson:"timestamp"`                         // An epoch timestamp of when the route was created
+	Type                int               `json:"type,omitempty" bson:"type"`                                   // This route's type (1 for ride, 2 for runs)
+	SubType             int               `json:"sub_type,omitempty" bson:"sub_type"`                           // This route's sub-type (1 for road, 2 for mountain bike, 3 for cross, 4 for trail, 5 for mixed)
+	CreatedAt           time.Time         `json:"created_at,omitempty" bson:"created_at"`                       // The time at which the route was created
+	UpdatedAt           time.Time         `json:"updated_at,omitempty" bson:"updated_at"`                       // The time at which the route was last updated
+	EstimatedMovingTime int               `json:"estimated_moving_time,omitempty" bson:"estimated_moving_time"` // Estimated time in seconds for the authenticated athlete to complete route
+	Segments            []*SummarySegment `json:"segments,omitempty" bson:"segments"`                           // The segments traversed by this route
 }
 
 // RunningRace
@@ -287,13 +311,14 @@ type SummarySegmentEffort struct {
 type TimedZoneDistribution []*TimedZoneRange
 
 // UpdatableActivity
+// 字段为指针, 为空时不修改, 可以将 commute, trainer 设置为 false, description 设置为空
 type UpdatableActivity struct {
-	Commute     bool          `json:"commute,omitempty" bson:"commute"`         // Whether this activity is a commute
-	Trainer     bool          `json:"trainer,omitempty" bson:"trainer"`         // Whether this activity was recorded on a training machine
-	Description string        `json:"description,omitempty" bson:"description"` // The description of the activity
-	Name        string        `json:"name,omitempty" bson:"name"`               // The name of the activity
-	Type        *ActivityType `json:"type,omitempty" bson:"type"`               // An instance of ActivityType.
-	GearId      string        `json:"gear_id,omitempty" bson:"gear_id"`         // Identifier for the gear associated with the activity. ‘none’ clears gear from activity
+	Commute     *bool   `json:"commute,omitempty" bson:"commute"`         // Whether this activity is a commute
+	Trainer     *bool   `json:"trainer,omitempty" bson:"trainer"`         // Whether this activity was recorded on a training machine
+	Description *string `json:"description,omitempty" bson:"description"` // The description of the activity
+	Name        *string `json:"name,omitempty" bson:"name"`               // The name of the activity
+	Type        *string `json:"type,omitempty" bson:"type"`               // An instance of ActivityType.
+	GearId      *string `json:"gear_id,omitempty" bson:"gear_id"`         // Identifier for the gear associated with the activity. ‘none’ clears gear from activity
 }
 
 // Upload
@@ -627,28 +652,29 @@ type DetailedActivity struct {
 
 // DetailedAthlete
 type DetailedAthlete struct {
-	Id                    int64        `json:"id,omitempty" bson:"id"`                                         // The unique identifier of the athlete
-	ResourceState         int          `json:"resource_state,omitempty" bson:"resource_state"`                 // Resource state, indicates level of detail. Possible values: 1 -> "meta", 2 -> "summary", 3 -> "detail"
-	Firstname             string       `json:"firstname,omitempty" bson:"firstname"`                           // The athlete's first name.
-	Lastname              string       `json:"lastname,omitempty" bson:"lastname"`                             // The athlete's last name.
-	ProfileMedium         string       `json:"profile_medium,omitempty" bson:"profile_medium"`                 // URL to a 62x62 pixel profile picture.
-	Profile               string       `json:"profile,omitempty" bson:"profile"`                               // URL to a 124x124 pixel profile picture.
-	City                  string       `json:"city,omitempty" bson:"city"`                                     // The athlete's city.
-	State                 string       `json:"state,omitempty" bson:"state"`                                   // The athlete's state or geographical region.
-	Country               string       `json:"country,omitempty" bson:"country"`                               // The athlete's country.
-	Sex                   string       `json:"sex,omitempty" bson:"sex"`                                       // The athlete's sex. May take one of the following values: M, F
-	Premium               bool         `json:"premium,omitempty" bson:"premium"`                               // Deprecated.  Use summit field instead. Whether the athlete has any Summit subscription.
-	Summit                bool         `json:"summit,omitempty" bson:"summit"`                                 // Whether the athlete has any Summit subscription.
-	CreatedAt             time.Time    `json:"created_at,omitempty" bson:"created_at"`                         // The time at which the athlete was created.
-	UpdatedAt             time.Time    `json:"updated_at,omitempty" bson:"updated_at"`                         // The time at which the athlete was last updated.
-	FollowerCount         int          `json:"follower_count,omitempty" bson:"follower_count"`                 // The athlete's follower count.
-	FriendCount           int          `json:"friend_count,omitempty" bson:"friend_count"`                     // The athlete's friend count.
-	MeasurementPreference string       `json:"measurement_preference,omitempty" bson:"measurement_preference"` // The athlete's preferred unit systex. May take one of the following values: feet, meters
-	Ftp                   int          `json:"ftp,omitempty" bson:"ftp"`                                       // The athlete's FTP (Functional Threshold Power).
-	Weight                float64      `json:"weight,omitempty" bson:"weight"`                                 // The athlete's weight.
-	Clubs                 *SummaryClub `json:"clubs,omitempty" bson:"clubs"`                                   // The athlete's clubs.
-	Bikes                 *SummaryGear `json:"bikes,omitempty" bson:"bikes"`                                   // The athlete's bikes.
-	Shoes                 *SummaryGear `json:"shoes,omitempty" bson:"shoes"`                                   // The athlete's shoes.
+	Id                    int64          `json:"id,omitempty" bson:"id"`                                         // The unique identifier of the athlete
+	Username              string         `json:"username,omitempty" bson:"username"`                             // The athlete's user name.
+	ResourceState         int            `json:"resource_state,omitempty" bson:"resource_state"`                 // Resource state, indicates level of detail. Possible values: 1 -> "meta", 2 -> "summary", 3 -> "detail"
+	Firstname             string         `json:"firstname,omitempty" bson:"firstname"`                           // The athlete's first name.
+	Lastname              string         `json:"lastname,omitempty" bson:"lastname"`                             // The athlete's last name.
+	ProfileMedium         string         `json:"profile_medium,omitempty" bson:"profile_medium"`                 // URL to a 62x62 pixel profile picture.
+	Profile               string         `json:"profile,omitempty" bson:"profile"`                               // URL to a 124x124 pixel profile picture.
+	City                  string         `json:"city,omitempty" bson:"city"`                                     // The athlete's city.
+	State                 string         `json:"state,omitempty" bson:"state"`                                   // The athlete's state or geographical region.
+	Country               string         `json:"country,omitempty" bson:"country"`                               // The athlete's country.
+	Sex                   string         `json:"sex,omitempty" bson:"sex"`                                       // The athlete's sex. May take one of the following values: M, F
+	Premium               bool           `json:"premium,omitempty" bson:"premium"`                               // Deprecated.  Use summit field instead. Whether the athlete has any Summit subscription.
+	Summit                bool           `json:"summit,omitempty" bson:"summit"`                                 // Whether the athlete has any Summit subscription.
+	CreatedAt             time.Time      `json:"created_at,omitempty" bson:"created_at"`                         // The time at which the athlete was created.
+	UpdatedAt             time.Time      `json:"updated_at,omitempty" bson:"updated_at"`                         // The time at which the athlete was last updated.
+	FollowerCount         int            `json:"follower_count,omitempty" bson:"follower_count"`                 // The athlete's follower count.
+	FriendCount           int            `json:"friend_count,omitempty" bson:"friend_count"`                     // The athlete's friend count.
+	MeasurementPreference string         `json:"measurement_preference,omitempty" bson:"measurement_preference"` // The athlete's preferred unit systex. May take one of the following values: feet, meters
+	Ftp                   int            `json:"ftp,omitempty" bson:"ftp"`                                       // The athlete's FTP (Functional Threshold Power).
+	Weight                float64        `json:"weight,omitempty" bson:"weight"`                                 // The athlete's weight.
+	Clubs                 []*SummaryClub `json:"clubs,omitempty" bson:"clubs"`                                   // The athlete's clubs.
+	Bikes                 []*SummaryGear `json:"bikes,omitempty" bson:"bikes"`                                   // The athlete's bikes.
+	Shoes                 []*SummaryGear `json:"shoes,omitempty" bson:"shoes"`                                   // The athlete's shoes.
 }
 
 // DetailedClub
@@ -684,3 +710,13 @@ type SubscriptionEvent struct {
 	SubscriptionID int64                  `json:"subscription_id" binding:"required"`
 	Updates        map[string]interface{} `json:"updates" binding:"required"`
 }
+
+// PushSubscription 推送订阅, 每个应用只能有一个订阅
+type PushSubscription struct {
+	ID            int64     `json:"id"`
+	ResourceState int       `json:"resource_state,omitempty"`
+	ApplicationID int64     `json:"application_id,omitempty"`
+	CallbackURL   string    `json:"callback_url,omitempty"`
+	CreatedAt     time.Time `json:"created_at,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at,omitempty"`
+}
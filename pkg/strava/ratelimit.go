@@ -0,0 +1,75 @@
+package strava
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Priority 请求优先级, 额度不足时低优先级的请求先等待
+type Priority int
+
+const (
+	PriorityLow    Priority = iota // 如: 历史活动导入
+	PriorityNormal                 // 如: 用户请求
+	PriorityHigh                   // 如: 处理推送
+)
+
+// RateLimit strava 返回的应用请求额度, 分为 15 分钟和每天两个窗口
+type RateLimit struct {
+	ShortLimit int
+	DailyLimit int
+	ShortUsage int
+	DailyUsage int
+}
+
+// Limiter 请求额度控制, 多个进程共享同一个应用的额度
+type Limiter interface {
+	// Wait 请求前预留额度, 额度不足时等待下一个窗口或者返回 ErrRateLimited
+	Wait(ctx context.Context, p Priority) error
+	// Update 使用 strava 返回的用量校准
+	Update(ctx context.Context, rl *RateLimit) error
+}
+
+type priorityKey struct{}
+
+// WithPriority 设置 ctx 中请求的优先级, 未设置时为 PriorityNormal
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+func priorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+// parseRateLimit 解析 X-RateLimit-Limit 和 X-RateLimit-Usage, 格式: "15分钟,每天", 如: "100,1000"
+func parseRateLimit(h http.Header) *RateLimit {
+	shortLimit, dailyLimit, ok1 := parsePair(h.Get("X-RateLimit-Limit"))
+	shortUsage, dailyUsage, ok2 := parsePair(h.Get("X-RateLimit-Usage"))
+	if !ok1 || !ok2 {
+		return nil
+	}
+	return &RateLimit{
+		ShortLimit: shortLimit,
+		DailyLimit: dailyLimit,
+		ShortUsage: shortUsage,
+		DailyUsage: dailyUsage,
+	}
+}
+
+func parsePair(v string) (int, int, bool) {
+	parts := strings.Split(v, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	a, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	b, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+	return a, b, true
+}
@@ -0,0 +1,88 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	athleteRoutesAPI = "/athletes/%d/routes?page=%d&per_page=%d"
+	routeAPI         = "/routes/%d"
+	routeStreamAPI   = "/routes/%d/streams"
+)
+
+type Routes service
+
+// AthleteRoutes list the routes created by the authenticated athlete, newest first
+func (s *Routes) AthleteRoutes(ctx context.Context, athleteID int64, page, perPage int) ([]*Route, error) {
+	api := fmt.Sprintf(athleteRoutesAPI, athleteID, page, perPage)
+	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp []*Route
+	err = json.Unmarshal(body, &resp)
+	return resp, err
+}
+
+// Route get route by id, private routes are only visible to the owner
+func (s *Routes) Route(ctx context.Context, id int64) (*Route, error) {
+	api := fmt.Sprintf(routeAPI, id)
+	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp Route
+	err = json.Unmarshal(body, &resp)
+	return &resp, err
+}
+
+// RouteStream get route stream: latlng, distance, altitude
+func (s *Routes) RouteStream(ctx context.Context, id int64) (*StreamSet, error) {
+	api := fmt.Sprintf(routeStreamAPI, id)
+	url := fmt.Sprintf("%s%s", s.client.BaseURL, api)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	return parseStreamList(body)
+}
+
+// parseStreamList 路线的 stream 接口不支持 key_by_type, 返回的是 stream 列表, 按 type 转换为 StreamSet
+func parseStreamList(body []byte) (*StreamSet, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	var r StreamSet
+	for _, item := range list {
+		var meta struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(item, &meta); err != nil {
+			return nil, err
+		}
+		var v interface{}
+		switch meta.Type {
+		case "latlng":
+			r.Latlng = new(LatLngStream)
+			v = r.Latlng
+		case "distance":
+			r.Distance = new(DistanceStream)
+			v = r.Distance
+		case "altitude":
+			r.Altitude = new(AltitudeStream)
+			v = r.Altitude
+		default:
+			continue
+		}
+		if err := json.Unmarshal(item, v); err != nil {
+			return nil, err
+		}
+	}
+	return &r, nil
+}
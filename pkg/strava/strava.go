@@ -2,19 +2,29 @@ package strava
 
 import (
 	"net/http"
+	"strings"
 )
 
 const (
-	BaseURL = "https://www.strava.com/api/v3"
+	Host    = "https://www.strava.com"
+	BaseURL = Host + apiPath
+
+	apiPath = "/api/v3"
 )
 
 type Client struct {
 	httpClient *http.Client
 
 	BaseURL string
+	Limiter Limiter // 为空时不限制请求
 
-	Athlete  *Athlete
-	Activity *Activity
+	Athlete      *Athlete
+	Activity     *Activity
+	Clubs        *Clubs
+	Gear         *Gear
+	Routes       *Routes
+	Subscription *Subscription
+	Uploads      *Uploads
 
 	common service
 }
@@ -27,6 +37,11 @@ func NewClient(httpClient *http.Client) *Client {
 	c.common.client = c
 	c.Athlete = (*Athlete)(&c.common)
 	c.Activity = (*Activity)(&c.common)
+	c.Clubs = (*Clubs)(&c.common)
+	c.Gear = (*Gear)(&c.common)
+	c.Routes = (*Routes)(&c.common)
+	c.Subscription = (*Subscription)(&c.common)
+	c.Uploads = (*Uploads)(&c.common)
 
 	return c
 }
@@ -34,3 +49,11 @@ func NewClient(httpClient *http.Client) *Client {
 type service struct {
 	client *Client
 }
+
+// APIURL api 地址, host 为空时使用 strava 官方地址, 本地开发时可以指向 stravatest
+func APIURL(host string) string {
+	if host == "" {
+		return BaseURL
+	}
+	return strings.TrimRight(host, "/") + apiPath
+}
@@ -0,0 +1,68 @@
+package stravatest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+//go:embed testdata/fixtures.json
+var defaultFixtures []byte
+
+// Fixtures fake server 的初始数据
+type Fixtures struct {
+	Athletes   []*strava.SummaryAthlete    `json:"athletes"`
+	Activities []*strava.DetailedActivity  `json:"activities"`
+	Streams    map[int64]*strava.StreamSet `json:"streams"` // key 为活动 id
+	Tokens     []*Token                    `json:"tokens"`
+	Gears      []*strava.DetailedGear      `json:"gears"`
+
+	Zones        map[int64][]*strava.ActivityZone `json:"zones"`         // key 为活动 id
+	AthleteZones map[int64]*strava.Zones          `json:"athlete_zones"` // key 为用户 id
+
+	Routes       []*strava.Route             `json:"routes"`
+	RouteStreams map[int64]*strava.StreamSet `json:"route_streams"` // key 为路线 id
+
+	Clubs          []*strava.DetailedClub           `json:"clubs"`
+	ClubMembers    map[int64][]int64                `json:"club_members"`    // key 为俱乐部 id
+	ClubActivities map[int64][]*strava.ClubActivity `json:"club_activities"` // key 为俱乐部 id, 最新的在前
+
+	Comments map[int64][]*strava.Comment        `json:"comments"` // key 为活动 id
+	Kudoers  map[int64][]*strava.SummaryAthlete `json:"kudoers"`  // key 为活动 id
+}
+
+// Token 预置的 token, 授权码 code 换取 access token 时返回
+type Token struct {
+	AthleteID    int64  `json:"athlete_id"`
+	Code         string `json:"code"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// DefaultFixtures 内置的数据: 一个用户, 两个活动
+func DefaultFixtures() *Fixtures {
+	f, err := ParseFixtures(defaultFixtures)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// LoadFixtures 从 json 文件加载数据
+func LoadFixtures(path string) (*Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFixtures(data)
+}
+
+func ParseFixtures(data []byte) (*Fixtures, error) {
+	var f Fixtures
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
@@ -0,0 +1,357 @@
+package stravatest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+func TestServer_Activity(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	cli := s.Client("access-1001")
+
+	a, body, err := cli.Activity.Activity(context.TODO(), 2001)
+	require.NoError(t, err)
+	require.Equal(t, a.Name, "Morning Run")
+	require.NotEmpty(t, body)
+
+	streams, err := cli.Activity.ActivityStream(context.TODO(), 2001)
+	require.NoError(t, err)
+	require.Len(t, streams.Latlng.Data, 4)
+
+	list, err := cli.Activity.AthleteActivities(context.TODO(), time.Now().Unix(), 1, 30)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, list[0].Id, int64(2002))
+
+	_, _, err = cli.Activity.Activity(context.TODO(), 404)
+	require.ErrorIs(t, err, strava.ErrNotFound)
+
+	_, err = s.Client("wrong").Athlete.Athlete(context.TODO())
+	require.ErrorIs(t, err, strava.ErrUnauthorized)
+}
+
+func TestServer_Zones(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	cli := s.Client("access-1001")
+
+	zones, err := cli.Activity.ActivityZones(context.TODO(), 2001)
+	require.NoError(t, err)
+	require.Len(t, zones, 1)
+	require.Equal(t, zones[0].Type, "heartrate")
+	require.Len(t, *zones[0].DistributionBuckets, 5)
+
+	zones, err = cli.Activity.ActivityZones(context.TODO(), 2002)
+	require.NoError(t, err)
+	require.Empty(t, zones)
+
+	athleteZones, err := cli.Athlete.Zones(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, *athleteZones.HeartRate.Zones, 5)
+	require.Nil(t, athleteZones.Power)
+}
+
+func TestServer_Gear(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	cli := s.Client("access-1001")
+
+	a, _, err := cli.Activity.Activity(context.TODO(), 2001)
+	require.NoError(t, err)
+	gear, err := cli.Gear.Gear(context.TODO(), a.GearId)
+	require.NoError(t, err)
+	require.Equal(t, gear.Name, "Daily Trainer")
+
+	_, err = cli.Gear.Gear(context.TODO(), "b404")
+	require.ErrorIs(t, err, strava.ErrNotFound)
+}
+
+func TestServer_InjectError(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	cli := s.Client("access-1001")
+
+	// GET 在服务端错误时重试
+	s.InjectError("/activities", http.StatusInternalServerError, 1)
+	s.InjectRateLimit(1, 1)
+	a, _, err := cli.Activity.Activity(context.TODO(), 2002)
+	require.NoError(t, err)
+	require.Equal(t, a.Type, "Ride")
+	require.Equal(t, s.Usage(), 3)
+
+	// 超过截止时间不再等待
+	s.InjectRateLimit(1, 60)
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*5)
+	defer cancel()
+	_, _, err = cli.Activity.Activity(ctx, 2002)
+	require.ErrorIs(t, err, strava.ErrRateLimited)
+	var apiErr *strava.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, apiErr.RetryAfter, time.Minute)
+}
+
+type mockLimiter struct {
+	waits int
+	last  *strava.RateLimit
+}
+
+func (m *mockLimiter) Wait(_ context.Context, _ strava.Priority) error {
+	m.waits++
+	return nil
+}
+
+func (m *mockLimiter) Update(_ context.Context, rl *strava.RateLimit) error {
+	m.last = rl
+	return nil
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	s.SetRateLimit(200, 2000, 10, 100)
+	l := mockLimiter{}
+	cli := s.Client("access-1001")
+	cli.Limiter = &l
+
+	_, err := cli.Athlete.Athlete(context.TODO())
+
+	require.NoError(t, err)
+	require.Equal(t, l.waits, 1)
+	require.Equal(t, *l.last, strava.RateLimit{ShortLimit: 200, DailyLimit: 2000, ShortUsage: 11, DailyUsage: 101})
+}
+
+func TestServer_Subscription(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	var pushed strava.SubscriptionEvent
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			_ = json.NewDecoder(r.Body).Decode(&pushed)
+			return
+		}
+		if r.URL.Query().Get("hub.verify_token") != "token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"hub.challenge": r.URL.Query().Get("hub.challenge")})
+	}))
+	defer callback.Close()
+	cli := s.Client("")
+
+	_, err := cli.Subscription.Create(context.TODO(), "id", "secret", callback.URL, "wrong")
+	require.ErrorIs(t, err, strava.ErrBadRequest)
+
+	sub, err := cli.Subscription.Create(context.TODO(), "id", "secret", callback.URL, "token")
+	require.NoError(t, err)
+	require.Equal(t, sub.CallbackURL, callback.URL)
+
+	subs, err := cli.Subscription.View(context.TODO(), "id", "secret")
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+
+	err = s.SendEvent(context.TODO(), &strava.SubscriptionEvent{ObjectType: "activity", ObjectID: 2001, AspectType: "create"})
+	require.NoError(t, err)
+	require.Equal(t, pushed.SubscriptionID, sub.ID)
+
+	require.NoError(t, cli.Subscription.Delete(context.TODO(), "id", "secret", sub.ID))
+	require.Nil(t, s.Subscription())
+}
+
+func TestServer_OAuth(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	conf := oauth2.Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Endpoint:     oauth2.Endpoint{AuthURL: s.URL + "/oauth/authorize", TokenURL: s.URL + "/oauth/token"},
+	}
+
+	token, err := conf.Exchange(context.TODO(), "code-1001")
+	require.NoError(t, err)
+
+	cli := strava.NewClient(conf.Client(context.TODO(), token))
+	cli.BaseURL = s.APIURL()
+	athlete, err := cli.Athlete.Athlete(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, athlete.Id, int64(1001))
+
+	token.Expiry = time.Now().Add(-time.Minute)
+	refreshed, err := conf.TokenSource(context.TODO(), token).Token()
+	require.NoError(t, err)
+	require.NotEqual(t, refreshed.AccessToken, token.AccessToken)
+}
+
+func TestServer_AthleteStats(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	cli := s.Client("access-1001")
+
+	athlete, err := cli.Athlete.DetailedAthlete(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, athlete.Id, int64(1001))
+
+	stats, err := cli.Athlete.Stats(context.TODO(), athlete.Id)
+	require.NoError(t, err)
+	require.Equal(t, stats.AllRunTotals.Count, 1)
+	require.Equal(t, stats.AllRunTotals.Distance, 5012.3)
+	require.Equal(t, stats.AllRideTotals.Count, 1)
+	require.Zero(t, stats.RecentRunTotals.Count)
+
+	_, err = cli.Athlete.Stats(context.TODO(), 404)
+	require.ErrorIs(t, err, strava.ErrUnauthorized)
+}
+
+func TestServer_UpdateActivity(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	cli := s.Client("access-1001")
+
+	name, commute, gear := "Commute Run", true, "none"
+	a, body, err := cli.Activity.UpdateActivity(context.TODO(), 2001, &strava.UpdatableActivity{
+		Name:    &name,
+		Commute: &commute,
+		GearId:  &gear,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, body)
+	require.Equal(t, a.Name, name)
+	require.True(t, a.Commute)
+	require.Empty(t, a.GearId)
+	require.Equal(t, a.Type, "Run")
+
+	a, _, err = cli.Activity.Activity(context.TODO(), 2001)
+	require.NoError(t, err)
+	require.Equal(t, a.Name, name)
+
+	_, _, err = cli.Activity.UpdateActivity(context.TODO(), 404, &strava.UpdatableActivity{Name: &name})
+	require.ErrorIs(t, err, strava.ErrNotFound)
+}
+
+func TestServer_Upload(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	cli := s.Client("access-1001")
+
+	param := strava.UploadParam{DataType: "gpx", Name: "Track Session", ExternalID: "track.gpx"}
+	upload, err := cli.Uploads.Create(context.TODO(), "track.gpx", strings.NewReader("<gpx/>"), &param)
+	require.NoError(t, err)
+	require.Empty(t, upload.Error)
+	require.Zero(t, upload.ActivityId)
+
+	upload, err = cli.Uploads.Get(context.TODO(), upload.Id)
+	require.NoError(t, err)
+	require.Zero(t, upload.ActivityId)
+	upload, err = cli.Uploads.Get(context.TODO(), upload.Id)
+	require.NoError(t, err)
+	require.NotZero(t, upload.ActivityId)
+
+	a, _, err := cli.Activity.Activity(context.TODO(), upload.ActivityId)
+	require.NoError(t, err)
+	require.Equal(t, a.Name, "Track Session")
+
+	dup, err := cli.Uploads.Create(context.TODO(), "track.gpx", strings.NewReader("<gpx/>"), &param)
+	require.NoError(t, err)
+	require.Contains(t, dup.Error, "duplicate")
+
+	_, err = cli.Uploads.Get(context.TODO(), 404)
+	require.ErrorIs(t, err, strava.ErrNotFound)
+}
+
+func TestServer_Routes(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	cli := s.Client("access-1001")
+
+	routes, err := cli.Routes.AthleteRoutes(context.TODO(), 1001, 1, 30)
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+	require.Equal(t, routes[0].Id, int64(3001))
+	require.Equal(t, routes[0].Type, 2)
+	require.NotEmpty(t, routes[0].Map.Polyline)
+
+	route, err := cli.Routes.Route(context.TODO(), 3001)
+	require.NoError(t, err)
+	require.Equal(t, route.Name, "Riverside Loop")
+
+	streams, err := cli.Routes.RouteStream(context.TODO(), 3001)
+	require.NoError(t, err)
+	require.Len(t, streams.Latlng.Data, 4)
+	require.Equal(t, streams.Distance.Data[3], 438.9)
+	require.Len(t, streams.Altitude.Data, 4)
+	require.Nil(t, streams.Time)
+
+	_, err = cli.Routes.AthleteRoutes(context.TODO(), 404, 1, 30)
+	require.ErrorIs(t, err, strava.ErrUnauthorized)
+
+	s.DeleteRoute(3001)
+	_, err = cli.Routes.Route(context.TODO(), 3001)
+	require.ErrorIs(t, err, strava.ErrNotFound)
+}
+
+func TestServer_Clubs(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	cli := s.Client("access-1001")
+
+	clubs, err := cli.Clubs.AthleteClubs(context.TODO(), 1, 30)
+	require.NoError(t, err)
+	require.Len(t, clubs, 1)
+	require.Equal(t, clubs[0].Id, int64(5001))
+
+	club, err := cli.Clubs.Club(context.TODO(), 5001)
+	require.NoError(t, err)
+	require.True(t, club.Owner)
+
+	list, err := cli.Clubs.ClubActivities(context.TODO(), 5001, 1, 2)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, list[0].Athlete.Firstname, "I")
+
+	s.AddClubActivity(5001, &strava.ClubActivity{Athlete: &strava.ClubAthlete{Firstname: "Jane"}, Name: "Tempo"})
+	list, err = cli.Clubs.ClubActivities(context.TODO(), 5001, 1, 30)
+	require.NoError(t, err)
+	require.Len(t, list, 4)
+	require.Equal(t, list[0].Name, "Tempo")
+
+	_, err = cli.Clubs.ClubActivities(context.TODO(), 404, 1, 30)
+	require.ErrorIs(t, err, strava.ErrNotFound)
+}
+
+func TestServer_Social(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	cli := s.Client("access-1001")
+
+	comments, err := cli.Activity.ActivityComments(context.TODO(), 2001, 1, 30)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	require.Equal(t, comments[0].Athlete.Firstname, "Jane")
+
+	kudoers, err := cli.Activity.ActivityKudoers(context.TODO(), 2001, 2, 1)
+	require.NoError(t, err)
+	require.Len(t, kudoers, 1)
+	require.Equal(t, kudoers[0].Firstname, "Bob")
+
+	s.AddComment(2001, &strava.Comment{Id: 6002, Text: "Thanks!"})
+	a, _, err := cli.Activity.Activity(context.TODO(), 2001)
+	require.NoError(t, err)
+	require.Equal(t, a.CommentCount, 2)
+
+	comments, err = cli.Activity.ActivityComments(context.TODO(), 2002, 1, 30)
+	require.NoError(t, err)
+	require.Empty(t, comments)
+
+	_, err = cli.Activity.ActivityKudoers(context.TODO(), 404, 1, 30)
+	require.ErrorIs(t, err, strava.ErrNotFound)
+}
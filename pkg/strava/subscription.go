@@ -0,0 +1,60 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	subscriptionAPI = "/push_subscriptions"
+)
+
+// Subscription manage the application's push subscription, authenticated by client id and secret
+type Subscription service
+
+// Create create a push subscription, strava will validate the callback url with verify token before responding
+func (s *Subscription) Create(ctx context.Context, clientID, clientSecret, callbackURL, verifyToken string) (*PushSubscription, error) {
+	form := url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"callback_url":  {callbackURL},
+		"verify_token":  {verifyToken},
+	}
+	body, err := doForm(ctx, s.client.BaseURL+subscriptionAPI, http.MethodPost, form, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp PushSubscription
+	err = json.Unmarshal(body, &resp)
+	return &resp, err
+}
+
+// View view the application's push subscriptions
+func (s *Subscription) View(ctx context.Context, clientID, clientSecret string) ([]*PushSubscription, error) {
+	q := url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	}
+	u := fmt.Sprintf("%s%s?%s", s.client.BaseURL, subscriptionAPI, q.Encode())
+	body, err := do(ctx, u, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp []*PushSubscription
+	err = json.Unmarshal(body, &resp)
+	return resp, err
+}
+
+// Delete delete a push subscription
+func (s *Subscription) Delete(ctx context.Context, clientID, clientSecret string, id int64) error {
+	q := url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	}
+	u := fmt.Sprintf("%s%s/%d?%s", s.client.BaseURL, subscriptionAPI, id, q.Encode())
+	_, err := do(ctx, u, http.MethodDelete, http.NoBody, s.client)
+	return err
+}
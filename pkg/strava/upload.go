@@ -0,0 +1,66 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const (
+	uploadAPI = "/uploads"
+)
+
+// UploadParam 上传活动文件时的可选参数, DataType 必填: fit, fit.gz, tcx, tcx.gz, gpx, gpx.gz
+type UploadParam struct {
+	DataType    string
+	Name        string
+	Description string
+	Trainer     bool
+	Commute     bool
+	ExternalID  string
+}
+
+type Uploads service
+
+// Create upload a new data file to create an activity from, requires activity:write scope,
+// the activity is processed asynchronously, use Get to check the status
+func (s *Uploads) Create(ctx context.Context, filename string, file io.Reader, param *UploadParam) (*Upload, error) {
+	form := url.Values{"data_type": {param.DataType}}
+	if param.Name != "" {
+		form.Set("name", param.Name)
+	}
+	if param.Description != "" {
+		form.Set("description", param.Description)
+	}
+	if param.Trainer {
+		form.Set("trainer", "1")
+	}
+	if param.Commute {
+		form.Set("commute", "1")
+	}
+	if param.ExternalID != "" {
+		form.Set("external_id", param.ExternalID)
+	}
+	body, err := doMultipart(ctx, s.client.BaseURL+uploadAPI, form, filename, file, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp Upload
+	err = json.Unmarshal(body, &resp)
+	return &resp, err
+}
+
+// Get returns an upload for a given identifier, ActivityId is set once the activity is created
+func (s *Uploads) Get(ctx context.Context, id int64) (*Upload, error) {
+	url := fmt.Sprintf("%s%s/%d", s.client.BaseURL, uploadAPI, id)
+	body, err := do(ctx, url, http.MethodGet, http.NoBody, s.client)
+	if err != nil {
+		return nil, err
+	}
+	var resp Upload
+	err = json.Unmarshal(body, &resp)
+	return &resp, err
+}
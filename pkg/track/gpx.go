@@ -0,0 +1,242 @@
+package track
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	gpxNamespace    = "http://www.topografix.com/GPX/1/1"
+	gpxSchema       = "http://www.topografix.com/GPX/1/1/gpx.xsd"
+	gpxtpxNamespace = "http://www.garmin.com/xmlschemas/TrackPointExtension/v1"
+	gpxtpxSchema    = "http://www.garmin.com/xmlschemas/TrackPointExtensionv1.xsd"
+	xsiNamespace    = "http://www.w3.org/2001/XMLSchema-instance"
+	creator         = "iself"
+)
+
+// gpxFile encoding/xml 不支持自定义命名空间前缀, 扩展的前缀直接写在标签中
+type gpxFile struct {
+	XMLName        xml.Name     `xml:"gpx"`
+	Xmlns          string       `xml:"xmlns,attr"`
+	XmlnsGpxtpx    string       `xml:"xmlns:gpxtpx,attr,omitempty"`
+	XmlnsXsi       string       `xml:"xmlns:xsi,attr,omitempty"`
+	SchemaLocation string       `xml:"xsi:schemaLocation,attr,omitempty"`
+	Version        string       `xml:"version,attr"`
+	Creator        string       `xml:"creator,attr"`
+	Metadata       *gpxMetadata `xml:"metadata,omitempty"`
+	Track          *gpxTrack    `xml:"trk,omitempty"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name,omitempty"`
+	Desc string `xml:"desc,omitempty"`
+	Time string `xml:"time,omitempty"`
+}
+
+type gpxTrack struct {
+	Name    string     `xml:"name,omitempty"`
+	Desc    string     `xml:"desc,omitempty"`
+	Type    string     `xml:"type,omitempty"`
+	Segment gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []*gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat        float64        `xml:"lat,attr"`
+	Lon        float64        `xml:"lon,attr"`
+	Ele        *float64       `xml:"ele,omitempty"`
+	Time       string         `xml:"time,omitempty"`
+	Extensions *gpxExtensions `xml:"extensions,omitempty"`
+}
+
+// gpxExtensions 功率不在 TrackPointExtension 中, 与 strava 导出的 gpx 一致直接写在 extensions 下
+type gpxExtensions struct {
+	Power      *int              `xml:"power,omitempty"`
+	TrackPoint *gpxTrackPointExt `xml:"gpxtpx:TrackPointExtension,omitempty"`
+}
+
+// gpxTrackPointExt 元素顺序和 TrackPointExtension v1 schema 一致
+type gpxTrackPointExt struct {
+	Temp      *float64 `xml:"gpxtpx:atemp,omitempty"`
+	HeartRate *int     `xml:"gpxtpx:hr,omitempty"`
+	Cadence   *int     `xml:"gpxtpx:cad,omitempty"`
+}
+
+// WriteGPX 以 GPX 1.1 格式写入一条轨迹, 没有位置的点会被忽略, 没有时间的点不输出 time (如: 路线),
+// 所有点都没有位置时只输出 metadata (如: 室内活动), 心率, 踏频, 温度和功率写入 Garmin TrackPointExtension
+func WriteGPX(w io.Writer, t *Track) error {
+	f := gpxFile{
+		Xmlns:   gpxNamespace,
+		Version: "1.1",
+		Creator: creator,
+	}
+	if t.Name != "" || t.Description != "" || !t.Time.IsZero() {
+		f.Metadata = &gpxMetadata{Name: t.Name, Desc: t.Description, Time: formatTime(t.Time)}
+	}
+	var points []*gpxPoint
+	var extended bool
+	for _, p := range t.Points {
+		if p.Position == nil {
+			continue
+		}
+		item := gpxPoint{
+			Lat:        p.Position.Lat,
+			Lon:        p.Position.Lng,
+			Ele:        p.Ele,
+			Time:       formatTime(p.Time),
+			Extensions: newGPXExtensions(p),
+		}
+		if item.Extensions != nil {
+			extended = true
+		}
+		points = append(points, &item)
+	}
+	if len(points) > 0 {
+		f.Track = &gpxTrack{
+			Name:    t.Name,
+			Desc:    t.Description,
+			Type:    t.Type,
+			Segment: gpxSegment{Points: points},
+		}
+	}
+	if extended {
+		f.XmlnsGpxtpx = gpxtpxNamespace
+		f.XmlnsXsi = xsiNamespace
+		f.SchemaLocation = gpxNamespace + " " + gpxSchema + " " + gpxtpxNamespace + " " + gpxtpxSchema
+	}
+
+	return writeXML(w, &f)
+}
+
+// gpxReadFile 读取时只匹配元素名, 不区分命名空间, 兼容不同设备和软件使用的扩展前缀
+type gpxReadFile struct {
+	XMLName  xml.Name `xml:"gpx"`
+	Metadata struct {
+		Name string `xml:"name"`
+		Desc string `xml:"desc"`
+		Time string `xml:"time"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Desc     string `xml:"desc"`
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []*gpxReadPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxReadPoint struct {
+	Lat        float64  `xml:"lat,attr"`
+	Lon        float64  `xml:"lon,attr"`
+	Ele        *float64 `xml:"ele"`
+	Time       string   `xml:"time"`
+	Extensions struct {
+		Power      *int `xml:"power"`
+		TrackPoint struct {
+			Temp      *float64 `xml:"atemp"`
+			HeartRate *int     `xml:"hr"`
+			Cadence   *int     `xml:"cad"`
+		} `xml:"TrackPointExtension"`
+	} `xml:"extensions"`
+}
+
+// ErrFormat 文件不是 gpx 或者 tcx 格式
+var ErrFormat = errors.New("track: invalid file format")
+
+// ReadGPX 读取 GPX 1.1 文件中的轨迹, 多条轨迹和多个分段按顺序合并为一条, 名称和类型使用第一条轨迹;
+// 读取 Garmin TrackPointExtension 中的心率, 踏频, 温度和 extensions 下的功率
+func ReadGPX(r io.Reader) (*Track, error) {
+	var f gpxReadFile
+	if err := xml.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	t := Track{
+		Name:        f.Metadata.Name,
+		Description: f.Metadata.Desc,
+		Time:        parseTime(f.Metadata.Time),
+	}
+	for i, trk := range f.Tracks {
+		if i == 0 {
+			t.Type = trk.Type
+			if trk.Name != "" {
+				t.Name = trk.Name
+			}
+			if trk.Desc != "" {
+				t.Description = trk.Desc
+			}
+		}
+		for _, seg := range trk.Segments {
+			for _, item := range seg.Points {
+				ext := item.Extensions.TrackPoint
+				t.Points = append(t.Points, &Point{
+					Time:      parseTime(item.Time),
+					Position:  &LatLng{Lat: item.Lat, Lng: item.Lon},
+					Ele:       item.Ele,
+					HeartRate: ext.HeartRate,
+					Cadence:   ext.Cadence,
+					Power:     item.Extensions.Power,
+					Temp:      ext.Temp,
+				})
+			}
+		}
+	}
+	if t.Time.IsZero() && len(t.Points) > 0 {
+		t.Time = t.Points[0].Time
+	}
+
+	return &t, nil
+}
+
+func newGPXExtensions(p *Point) *gpxExtensions {
+	if p.HeartRate == nil && p.Cadence == nil && p.Power == nil && p.Temp == nil {
+		return nil
+	}
+	ext := gpxExtensions{Power: p.Power}
+	if p.HeartRate != nil || p.Cadence != nil || p.Temp != nil {
+		ext.TrackPoint = &gpxTrackPointExt{Temp: p.Temp, HeartRate: p.HeartRate, Cadence: p.Cadence}
+	}
+
+	return &ext
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+// parseTime 解析 xml 中的时间, 没有时区的时间视为 utc, 格式错误时返回零值
+func parseTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.UTC()
+	}
+	if t, err := time.Parse("2006-01-02T15:04:05", s); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,88 @@
+package track
+
+import "math"
+
+// Bounds 经纬度范围
+type Bounds struct {
+	Min LatLng
+	Max LatLng
+}
+
+// NewBounds 计算点的经纬度范围, 没有点时返回 nil
+func NewBounds(points []LatLng) *Bounds {
+	if len(points) == 0 {
+		return nil
+	}
+	b := Bounds{Min: points[0], Max: points[0]}
+	for _, p := range points[1:] {
+		b.Min.Lat = math.Min(b.Min.Lat, p.Lat)
+		b.Min.Lng = math.Min(b.Min.Lng, p.Lng)
+		b.Max.Lat = math.Max(b.Max.Lat, p.Lat)
+		b.Max.Lng = math.Max(b.Max.Lng, p.Lng)
+	}
+
+	return &b
+}
+
+// Intersects 两个范围是否重叠, margin 为向外扩展的距离, 单位米
+func (b *Bounds) Intersects(o *Bounds, margin float64) bool {
+	dLat := margin / earthRadius * 180 / math.Pi
+	dLng := dLat / math.Max(math.Cos((b.Min.Lat+b.Max.Lat)/2*math.Pi/180), 0.01)
+
+	return o.Min.Lat <= b.Max.Lat+dLat && o.Max.Lat >= b.Min.Lat-dLat &&
+		o.Min.Lng <= b.Max.Lng+dLng && o.Max.Lng >= b.Min.Lng-dLng
+}
+
+// Coverage 路线上距离轨迹 tolerance 米以内的点的比例, 最多取 samples 个点
+// 轨迹只用于判断是否经过, 不要求方向和顺序一致
+func Coverage(route, path []LatLng, tolerance float64, samples int) float64 {
+	if len(route) == 0 || len(path) == 0 {
+		return 0
+	}
+	step := 1
+	if samples > 0 && len(route) > samples {
+		step = (len(route) + samples - 1) / samples
+	}
+	var total, hit int
+	for i := 0; i < len(route); i += step {
+		total++
+		if near(route[i], path, tolerance) {
+			hit++
+		}
+	}
+
+	return float64(hit) / float64(total)
+}
+
+// near p 到轨迹上任一线段的距离是否在 tolerance 米以内
+func near(p LatLng, path []LatLng, tolerance float64) bool {
+	if len(path) == 1 {
+		return Distance(p, path[0]) <= tolerance
+	}
+	for i := 1; i < len(path); i++ {
+		if segmentDistance(p, path[i-1], path[i]) <= tolerance {
+			return true
+		}
+	}
+
+	return false
+}
+
+// segmentDistance 点到线段的距离, 以 p 为中心做等距投影, 短距离内误差可以忽略
+func segmentDistance(p, a, b LatLng) float64 {
+	cos := math.Cos(p.Lat * math.Pi / 180)
+	project := func(q LatLng) (float64, float64) {
+		x := (q.Lng - p.Lng) * math.Pi / 180 * cos * earthRadius
+		y := (q.Lat - p.Lat) * math.Pi / 180 * earthRadius
+		return x, y
+	}
+	ax, ay := project(a)
+	bx, by := project(b)
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l))
+	}
+
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
@@ -0,0 +1,226 @@
+package track
+
+import "math"
+
+const (
+	// MinMovingSpeed 低于该速度视为停止, 单位 m/s
+	MinMovingSpeed = 0.5
+	// elevationThreshold 海拔变化超过该值才计入爬升, 过滤 gps 和气压计的噪声, 单位米
+	elevationThreshold = 2.0
+	// velocityWindow 速度平滑的时间窗口, 以点为中心, 单位秒
+	velocityWindow = 10.0
+	// gradeWindow 坡度平滑的距离窗口, 以点为中心, 单位米
+	gradeWindow = 50.0
+	// minGradeDistance 窗口内距离小于该值时(如: 停止)沿用前一个点的坡度, 单位米
+	minGradeDistance = 10.0
+)
+
+// Summary 由轨迹点计算的统计数据, 用于导入的文件缺少汇总信息时
+type Summary struct {
+	Distance         float64 // 距离, 单位米
+	ElapsedTime      int     // 总用时, 单位秒
+	MovingTime       int     // 移动时间, 单位秒
+	ElevationGain    float64 // 累计爬升, 单位米
+	ElevHigh         float64
+	ElevLow          float64
+	AverageSpeed     float64 // 移动时间内的平均速度, 单位 m/s
+	MaxSpeed         float64
+	AverageHeartRate float64
+	MaxHeartRate     float64
+	AverageCadence   float64 // 不包含为 0 的点
+	AverageWatts     float64
+	Calories         float64 // 由功率估算, 人体效率约 24%, 1 kJ 做功约消耗 1 kcal, 没有功率时为 0
+}
+
+// Distances 每个点的累计距离, 优先使用点上的距离, 没有时由位置累加
+func Distances(points []*Point) []float64 {
+	r := make([]float64, len(points))
+	var total float64
+	var last *LatLng
+	for i, p := range points {
+		switch {
+		case p.Distance != nil:
+			total = math.Max(total, *p.Distance)
+		case p.Position != nil && last != nil:
+			total += Distance(*last, *p.Position)
+		}
+		if p.Position != nil {
+			last = p.Position
+		}
+		r[i] = total
+	}
+
+	return r
+}
+
+// Moving 每个点是否在移动: 与上一个点之间的速度不低于 MinMovingSpeed, 点上有速度时使用点上的速度;
+// 没有距离数据时(如: 没有速度传感器的室内活动)除第一个点外都视为移动
+func Moving(points []*Point, distances []float64) []bool {
+	r := make([]bool, len(points))
+	still := len(distances) == 0 || distances[len(distances)-1] == distances[0]
+	for i := 1; i < len(points); i++ {
+		dt := points[i].Time.Sub(points[i-1].Time).Seconds()
+		switch {
+		case dt <= 0:
+		case points[i].Speed != nil:
+			r[i] = *points[i].Speed >= MinMovingSpeed
+		case still:
+			r[i] = true
+		default:
+			r[i] = (distances[i]-distances[i-1])/dt >= MinMovingSpeed
+		}
+	}
+
+	return r
+}
+
+// SmoothVelocity 由累计距离计算的平滑速度, 单位 m/s, 为以点为中心 velocityWindow 秒内的平均速度;
+// 窗口内只有一个点时(如: 采样间隔较大)使用与前一个点之间的速度
+func SmoothVelocity(points []*Point, distances []float64) []float64 {
+	n := len(points)
+	r := make([]float64, n)
+	var lo, hi int
+	for i := range points {
+		for points[i].Time.Sub(points[lo].Time).Seconds() > velocityWindow/2 {
+			lo++
+		}
+		if hi < i {
+			hi = i
+		}
+		for hi+1 < n && points[hi+1].Time.Sub(points[i].Time).Seconds() <= velocityWindow/2 {
+			hi++
+		}
+		from, to := lo, hi
+		if from == to {
+			if i > 0 {
+				from = i - 1
+			} else if i+1 < n {
+				to = i + 1
+			}
+		}
+		if dt := points[to].Time.Sub(points[from].Time).Seconds(); dt > 0 {
+			r[i] = round((distances[to]-distances[from])/dt, 1000)
+		}
+	}
+
+	return r
+}
+
+// SmoothGrade 由海拔和累计距离计算的平滑坡度, 单位百分比, 为以点为中心 gradeWindow 米内的平均坡度;
+// 窗口内只有一个点时使用与前一个点之间的坡度
+func SmoothGrade(altitude, distances []float64) []float64 {
+	n := len(altitude)
+	r := make([]float64, n)
+	var lo, hi int
+	var last float64
+	for i := range altitude {
+		for distances[i]-distances[lo] > gradeWindow/2 {
+			lo++
+		}
+		if hi < i {
+			hi = i
+		}
+		for hi+1 < n && distances[hi+1]-distances[i] <= gradeWindow/2 {
+			hi++
+		}
+		from, to := lo, hi
+		if from == to {
+			if i > 0 {
+				from = i - 1
+			} else if i+1 < n {
+				to = i + 1
+			}
+		}
+		if d := distances[to] - distances[from]; d >= minGradeDistance {
+			last = round((altitude[to]-altitude[from])/d*100, 10)
+		}
+		r[i] = last
+	}
+
+	return r
+}
+
+func round(v, precision float64) float64 {
+	return math.Round(v*precision) / precision
+}
+
+// Summarize 计算一段轨迹的统计数据, 圈的统计使用 Points[Start:End]
+//
+//nolint:gocyclo
+func Summarize(points []*Point) *Summary {
+	var s Summary
+	if len(points) == 0 {
+		return &s
+	}
+	distances := Distances(points)
+	moving := Moving(points, distances)
+	velocity := SmoothVelocity(points, distances)
+
+	var movingTime, energy, hrSum, cadenceSum, powerSum float64
+	var hrCount, cadenceCount, powerCount int
+	var ref *float64 // 爬升的参考海拔
+	for i, p := range points {
+		var dt float64
+		if i > 0 {
+			dt = p.Time.Sub(points[i-1].Time).Seconds()
+		}
+		if moving[i] {
+			movingTime += dt
+			if p.Power != nil {
+				energy += float64(*p.Power) * dt
+			}
+		}
+		if p.Speed != nil {
+			s.MaxSpeed = math.Max(s.MaxSpeed, *p.Speed)
+		} else {
+			s.MaxSpeed = math.Max(s.MaxSpeed, velocity[i])
+		}
+		if p.HeartRate != nil {
+			hrSum += float64(*p.HeartRate)
+			hrCount++
+			s.MaxHeartRate = math.Max(s.MaxHeartRate, float64(*p.HeartRate))
+		}
+		if p.Cadence != nil && *p.Cadence > 0 {
+			cadenceSum += float64(*p.Cadence)
+			cadenceCount++
+		}
+		if p.Power != nil {
+			powerSum += float64(*p.Power)
+			powerCount++
+		}
+		if p.Ele != nil {
+			ele := *p.Ele
+			switch {
+			case ref == nil:
+				ref = &ele
+				s.ElevHigh, s.ElevLow = ele, ele
+			case ele-*ref >= elevationThreshold:
+				s.ElevationGain += ele - *ref
+				ref = &ele
+			case *ref-ele >= elevationThreshold:
+				ref = &ele
+			}
+			s.ElevHigh = math.Max(s.ElevHigh, ele)
+			s.ElevLow = math.Min(s.ElevLow, ele)
+		}
+	}
+
+	s.Distance = distances[len(distances)-1] - distances[0]
+	s.ElapsedTime = int(math.Round(points[len(points)-1].Time.Sub(points[0].Time).Seconds()))
+	s.MovingTime = int(math.Round(movingTime))
+	if s.MovingTime > 0 {
+		s.AverageSpeed = s.Distance / float64(s.MovingTime)
+	}
+	if hrCount > 0 {
+		s.AverageHeartRate = hrSum / float64(hrCount)
+	}
+	if cadenceCount > 0 {
+		s.AverageCadence = cadenceSum / float64(cadenceCount)
+	}
+	if powerCount > 0 {
+		s.AverageWatts = powerSum / float64(powerCount)
+	}
+	s.Calories = energy / 1000
+
+	return &s
+}
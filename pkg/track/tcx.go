@@ -0,0 +1,381 @@
+package track
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf8"
+)
+
+const (
+	tcxNamespace = "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"
+	tcxExtension = "http://www.garmin.com/xmlschemas/ActivityExtension/v2"
+
+	maxCourseName = 15 // garmin 设备的课程名最长 15 个字符
+)
+
+// TCX 活动的运动类型
+const (
+	SportRunning = "Running"
+	SportBiking  = "Biking"
+	SportOther   = "Other"
+)
+
+type tcxFile struct {
+	XMLName    xml.Name       `xml:"TrainingCenterDatabase"`
+	Xmlns      string         `xml:"xmlns,attr"`
+	XmlnsNs3   string         `xml:"xmlns:ns3,attr,omitempty"`
+	Activities *tcxActivities `xml:"Activities,omitempty"`
+	Courses    *tcxCourses    `xml:"Courses,omitempty"`
+}
+
+type tcxCourses struct {
+	Course []*tcxCourse `xml:"Course"`
+}
+
+type tcxCourse struct {
+	Name  string       `xml:"Name"`
+	Lap   tcxCourseLap `xml:"Lap"`
+	Track tcxTrack     `xml:"Track"`
+}
+
+type tcxCourseLap struct {
+	TotalTimeSeconds float64      `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64      `xml:"DistanceMeters"`
+	BeginPosition    *tcxPosition `xml:"BeginPosition,omitempty"`
+	EndPosition      *tcxPosition `xml:"EndPosition,omitempty"`
+	Intensity        string       `xml:"Intensity"`
+}
+
+type tcxActivities struct {
+	Activity []*tcxActivity `xml:"Activity"`
+}
+
+type tcxActivity struct {
+	Sport string    `xml:"Sport,attr"`
+	ID    string    `xml:"Id"`
+	Laps  []*tcxLap `xml:"Lap"`
+	Notes string    `xml:"Notes,omitempty"`
+}
+
+// tcxLap 元素顺序和 ActivityLap_t schema 一致, Calories, Intensity, TriggerMethod 必填
+type tcxLap struct {
+	StartTime           string        `xml:"StartTime,attr"`
+	TotalTimeSeconds    float64       `xml:"TotalTimeSeconds"`
+	DistanceMeters      float64       `xml:"DistanceMeters"`
+	Calories            int           `xml:"Calories"`
+	AverageHeartRateBpm *tcxHeartRate `xml:"AverageHeartRateBpm,omitempty"`
+	MaximumHeartRateBpm *tcxHeartRate `xml:"MaximumHeartRateBpm,omitempty"`
+	Intensity           string        `xml:"Intensity"`
+	Cadence             *int          `xml:"Cadence,omitempty"`
+	TriggerMethod       string        `xml:"TriggerMethod"`
+	Track               *tcxTrack     `xml:"Track,omitempty"`
+	Extensions          *tcxLapExt    `xml:"Extensions,omitempty"`
+}
+
+type tcxLapExt struct {
+	LX tcxLX `xml:"ns3:LX"`
+}
+
+type tcxLX struct {
+	AvgRunCadence *int `xml:"ns3:AvgRunCadence,omitempty"`
+	AvgWatts      *int `xml:"ns3:AvgWatts,omitempty"`
+}
+
+type tcxTrack struct {
+	Points []*tcxPoint `xml:"Trackpoint"`
+}
+
+type tcxPoint struct {
+	Time           string        `xml:"Time"`
+	Position       *tcxPosition  `xml:"Position,omitempty"`
+	AltitudeMeters *float64      `xml:"AltitudeMeters,omitempty"`
+	DistanceMeters *float64      `xml:"DistanceMeters,omitempty"`
+	HeartRateBpm   *tcxHeartRate `xml:"HeartRateBpm,omitempty"`
+	Cadence        *int          `xml:"Cadence,omitempty"`
+	Extensions     *tcxPointExt  `xml:"Extensions,omitempty"`
+}
+
+type tcxPointExt struct {
+	TPX tcxTPX `xml:"ns3:TPX"`
+}
+
+type tcxTPX struct {
+	RunCadence *int `xml:"ns3:RunCadence,omitempty"`
+	Watts      *int `xml:"ns3:Watts,omitempty"`
+}
+
+type tcxHeartRate struct {
+	Value int `xml:"Value"`
+}
+
+type tcxPosition struct {
+	LatitudeDegrees  float64 `xml:"LatitudeDegrees"`
+	LongitudeDegrees float64 `xml:"LongitudeDegrees"`
+}
+
+// tcxReadFile 读取时只匹配元素名, 不区分命名空间, 兼容不同的扩展前缀
+type tcxReadFile struct {
+	XMLName    xml.Name `xml:"TrainingCenterDatabase"`
+	Activities []struct {
+		Sport string `xml:"Sport,attr"`
+		ID    string `xml:"Id"`
+		Notes string `xml:"Notes"`
+		Laps  []struct {
+			StartTime        string          `xml:"StartTime,attr"`
+			TotalTimeSeconds float64         `xml:"TotalTimeSeconds"`
+			DistanceMeters   float64         `xml:"DistanceMeters"`
+			Calories         int             `xml:"Calories"`
+			Points           []*tcxReadPoint `xml:"Track>Trackpoint"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+type tcxReadPoint struct {
+	Time           string        `xml:"Time"`
+	Position       *tcxPosition  `xml:"Position"`
+	AltitudeMeters *float64      `xml:"AltitudeMeters"`
+	DistanceMeters *float64      `xml:"DistanceMeters"`
+	HeartRateBpm   *tcxHeartRate `xml:"HeartRateBpm"`
+	Cadence        *int          `xml:"Cadence"`
+	Extensions     struct {
+		TPX struct {
+			Speed      *float64 `xml:"Speed"`
+			RunCadence *int     `xml:"RunCadence"`
+			Watts      *int     `xml:"Watts"`
+		} `xml:"TPX"`
+	} `xml:"Extensions"`
+}
+
+// ReadTCX 读取 TCX 文件中的第一个活动, 所有圈的点按顺序合并, 圈的范围为合并后的下标;
+// t.Type 为 TCX 的运动类型, 如: Running, t.Name 为 Notes, 与 WriteTCXActivity 一致
+func ReadTCX(r io.Reader) (*Track, error) {
+	var f tcxReadFile
+	if err := xml.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	if len(f.Activities) == 0 {
+		return nil, fmt.Errorf("%w: no activity", ErrFormat)
+	}
+	a := f.Activities[0]
+	t := Track{
+		Name: a.Notes,
+		Type: a.Sport,
+		Time: parseTime(a.ID),
+	}
+	for _, lap := range a.Laps {
+		item := Lap{
+			Start:     len(t.Points),
+			Time:      parseTime(lap.StartTime),
+			TotalTime: lap.TotalTimeSeconds,
+			Distance:  lap.DistanceMeters,
+			Calories:  lap.Calories,
+		}
+		for _, p := range lap.Points {
+			tpx := p.Extensions.TPX
+			point := Point{
+				Time:     parseTime(p.Time),
+				Ele:      p.AltitudeMeters,
+				Distance: p.DistanceMeters,
+				Speed:    tpx.Speed,
+				Cadence:  p.Cadence,
+				Power:    tpx.Watts,
+			}
+			if p.Position != nil {
+				point.Position = &LatLng{Lat: p.Position.LatitudeDegrees, Lng: p.Position.LongitudeDegrees}
+			}
+			if p.HeartRateBpm != nil {
+				hr := p.HeartRateBpm.Value
+				point.HeartRate = &hr
+			}
+			// 跑步的步频在扩展中
+			if tpx.RunCadence != nil {
+				point.Cadence = tpx.RunCadence
+			}
+			t.Points = append(t.Points, &point)
+		}
+		item.End = len(t.Points)
+		t.Laps = append(t.Laps, &item)
+	}
+
+	return &t, nil
+}
+
+// WriteTCXCourse 以 TCX Course 格式写入一条路线, 供码表导航使用, 每个点都需要时间, 调用方根据预计用时生成
+func WriteTCXCourse(w io.Writer, t *Track) error {
+	name := t.Name
+	if utf8.RuneCountInString(name) > maxCourseName {
+		name = string([]rune(name)[:maxCourseName])
+	}
+	course := tcxCourse{
+		Name: name,
+		Lap:  tcxCourseLap{Intensity: "Active"},
+	}
+	var first, last *Point
+	for _, p := range t.Points {
+		if p.Position == nil {
+			continue
+		}
+		if first == nil {
+			first = p
+		}
+		last = p
+		course.Track.Points = append(course.Track.Points, &tcxPoint{
+			Time:           formatTime(p.Time),
+			Position:       newTCXPosition(p.Position),
+			AltitudeMeters: p.Ele,
+			DistanceMeters: p.Distance,
+		})
+	}
+	if first != nil {
+		course.Lap.TotalTimeSeconds = last.Time.Sub(first.Time).Seconds()
+		if last.Distance != nil {
+			course.Lap.DistanceMeters = *last.Distance
+		}
+		course.Lap.BeginPosition = newTCXPosition(first.Position)
+		course.Lap.EndPosition = newTCXPosition(last.Position)
+	}
+
+	return writeXML(w, &tcxFile{
+		Xmlns:   tcxNamespace,
+		Courses: &tcxCourses{Course: []*tcxCourse{&course}},
+	})
+}
+
+// WriteTCXActivity 以 TCX Activity 格式写入一个活动, t.Type 为 SportRunning, SportBiking 或 SportOther,
+// 每个点都需要时间, 没有位置的点也会输出 (如: 室内活动), 跑步的步频和功率写入 ActivityExtension
+func WriteTCXActivity(w io.Writer, t *Track) error {
+	activity := tcxActivity{
+		Sport: t.Type,
+		ID:    formatTime(t.Time),
+		Notes: t.Name,
+	}
+	if activity.Sport != SportRunning && activity.Sport != SportBiking {
+		activity.Sport = SportOther
+	}
+	laps := t.Laps
+	if len(laps) == 0 {
+		laps = []*Lap{wholeLap(t)}
+	}
+	for _, item := range laps {
+		activity.Laps = append(activity.Laps, newTCXLap(t, item))
+	}
+
+	return writeXML(w, &tcxFile{
+		Xmlns:      tcxNamespace,
+		XmlnsNs3:   tcxExtension,
+		Activities: &tcxActivities{Activity: []*tcxActivity{&activity}},
+	})
+}
+
+// wholeLap 没有圈数据时整条轨迹为一圈
+func wholeLap(t *Track) *Lap {
+	lap := Lap{End: len(t.Points), Time: t.Time}
+	if n := len(t.Points); n > 0 {
+		first, last := t.Points[0], t.Points[n-1]
+		lap.Time = first.Time
+		lap.TotalTime = last.Time.Sub(first.Time).Seconds()
+		if last.Distance != nil {
+			lap.Distance = *last.Distance
+		}
+	}
+
+	return &lap
+}
+
+func newTCXLap(t *Track, lap *Lap) *tcxLap {
+	r := tcxLap{
+		StartTime:        formatTime(lap.Time),
+		TotalTimeSeconds: lap.TotalTime,
+		DistanceMeters:   lap.Distance,
+		Calories:         lap.Calories,
+		Intensity:        "Active",
+		TriggerMethod:    "Manual",
+	}
+	start, end := lap.Start, lap.End
+	if end > len(t.Points) {
+		end = len(t.Points)
+	}
+	if start < 0 || start >= end {
+		return &r
+	}
+
+	running := t.Type == SportRunning
+	var hr, cad, power stat
+	r.Track = &tcxTrack{}
+	for _, p := range t.Points[start:end] {
+		item := tcxPoint{
+			Time:           formatTime(p.Time),
+			AltitudeMeters: p.Ele,
+			DistanceMeters: p.Distance,
+		}
+		if p.Position != nil {
+			item.Position = newTCXPosition(p.Position)
+		}
+		if p.HeartRate != nil {
+			item.HeartRateBpm = &tcxHeartRate{Value: *p.HeartRate}
+			hr.add(*p.HeartRate)
+		}
+		if p.Cadence != nil {
+			cad.add(*p.Cadence)
+		}
+		if p.Power != nil {
+			power.add(*p.Power)
+		}
+		tpx := tcxTPX{Watts: p.Power}
+		if running {
+			tpx.RunCadence = p.Cadence
+		} else {
+			item.Cadence = p.Cadence
+		}
+		if tpx.RunCadence != nil || tpx.Watts != nil {
+			item.Extensions = &tcxPointExt{TPX: tpx}
+		}
+		r.Track.Points = append(r.Track.Points, &item)
+	}
+
+	if hr.count > 0 {
+		r.AverageHeartRateBpm = &tcxHeartRate{Value: hr.avg()}
+		r.MaximumHeartRateBpm = &tcxHeartRate{Value: hr.max}
+	}
+	var lx tcxLX
+	if cad.count > 0 {
+		avg := cad.avg()
+		if running {
+			lx.AvgRunCadence = &avg
+		} else {
+			r.Cadence = &avg
+		}
+	}
+	if power.count > 0 {
+		avg := power.avg()
+		lx.AvgWatts = &avg
+	}
+	if lx.AvgRunCadence != nil || lx.AvgWatts != nil {
+		r.Extensions = &tcxLapExt{LX: lx}
+	}
+
+	return &r
+}
+
+func newTCXPosition(p *LatLng) *tcxPosition {
+	return &tcxPosition{LatitudeDegrees: p.Lat, LongitudeDegrees: p.Lng}
+}
+
+// stat 圈内数据的平均值和最大值
+type stat struct {
+	sum, max, count int
+}
+
+func (s *stat) add(v int) {
+	s.sum += v
+	s.count++
+	if v > s.max {
+		s.max = v
+	}
+}
+
+func (s *stat) avg() int {
+	return int(math.Round(float64(s.sum) / float64(s.count)))
+}
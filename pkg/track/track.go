@@ -0,0 +1,124 @@
+// Package track 轨迹数据及 GPX, TCX 文件的读写, 与 strava 无关, 路线和活动的导入导出共用
+package track
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+const earthRadius = 6371000.0 // 地球平均半径, 单位米
+
+// Track 一条轨迹, 活动或者路线
+type Track struct {
+	Name        string
+	Description string
+	Type        string    // 活动类型, 如: Run, Ride
+	Time        time.Time // 开始时间
+	Points      []*Point
+	Laps        []*Lap // 为空时整条轨迹为一圈
+}
+
+// Lap 一圈, 包含 Points[Start:End]
+type Lap struct {
+	Start     int
+	End       int
+	Time      time.Time // 开始时间
+	TotalTime float64   // 用时, 单位秒
+	Distance  float64   // 距离, 单位米
+	Calories  int
+}
+
+// LatLng 经纬度, 单位度
+type LatLng struct {
+	Lat float64
+	Lng float64
+}
+
+// Point 轨迹点, 除了时间外都是可选的, 如: 室内活动没有位置
+type Point struct {
+	Time      time.Time
+	Position  *LatLng
+	Ele       *float64 // 海拔, 单位米
+	Distance  *float64 // 累计距离, 单位米
+	Speed     *float64 // 速度, 单位 m/s
+	HeartRate *int     // 心率, 单位 bpm
+	Cadence   *int     // 踏频或者步频, 单位 rpm
+	Power     *int     // 功率, 单位瓦
+	Temp      *float64 // 温度, 单位摄氏度
+}
+
+// Distance 两点之间的球面距离, 单位米
+func Distance(a, b LatLng) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * earthRadius * math.Asin(math.Sqrt(math.Min(h, 1)))
+}
+
+// DecodePolyline 解码 google encoded polyline, strava 的 map.polyline 精度为 5 位小数
+func DecodePolyline(s string) []LatLng {
+	var r []LatLng
+	var lat, lng int
+	for i := 0; i < len(s); {
+		var ok bool
+		var d int
+		if d, i, ok = decodeValue(s, i); !ok {
+			break
+		}
+		lat += d
+		if d, i, ok = decodeValue(s, i); !ok {
+			break
+		}
+		lng += d
+		r = append(r, LatLng{Lat: float64(lat) / 1e5, Lng: float64(lng) / 1e5})
+	}
+
+	return r
+}
+
+// EncodePolyline 编码为 google encoded polyline, 精度为 5 位小数, 与 strava 一致
+func EncodePolyline(points []LatLng) string {
+	var b strings.Builder
+	var lat, lng int
+	for _, p := range points {
+		nextLat, nextLng := int(math.Round(p.Lat*1e5)), int(math.Round(p.Lng*1e5))
+		encodeValue(&b, nextLat-lat)
+		encodeValue(&b, nextLng-lng)
+		lat, lng = nextLat, nextLng
+	}
+
+	return b.String()
+}
+
+func encodeValue(b *strings.Builder, v int) {
+	u := v << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		b.WriteByte(byte(0x20|u&0x1f) + 63)
+		u >>= 5
+	}
+	b.WriteByte(byte(u) + 63)
+}
+
+func decodeValue(s string, i int) (int, int, bool) {
+	var v, shift int
+	for i < len(s) {
+		b := int(s[i]) - 63
+		i++
+		v |= (b & 0x1f) << shift
+		shift += 5
+		if b < 0x20 {
+			if v&1 != 0 {
+				return ^(v >> 1), i, true
+			}
+			return v >> 1, i, true
+		}
+	}
+
+	return 0, i, false
+}
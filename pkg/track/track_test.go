@@ -0,0 +1,415 @@
+package track
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodePolyline(t *testing.T) {
+	points := DecodePolyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@")
+
+	require.Equal(t, []LatLng{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}, points)
+	require.Empty(t, DecodePolyline(""))
+	// 截断的数据只保留完整的点
+	require.Len(t, DecodePolyline("_p~iF~ps|U_ulL"), 1)
+}
+
+func TestEncodePolyline(t *testing.T) {
+	points := []LatLng{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}
+
+	require.Equal(t, "_p~iF~ps|U_ulLnnqC_mqNvxq`@", EncodePolyline(points))
+	require.Equal(t, points, DecodePolyline(EncodePolyline(points)))
+	require.Empty(t, EncodePolyline(nil))
+}
+
+func TestSummarize(t *testing.T) {
+	start := time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)
+	intp := func(v int) *int { return &v }
+	floatp := func(v float64) *float64 { return &v }
+	// 每 10 秒向北约 33 米, 第 3 到 4 个点停止 60 秒
+	points := []*Point{
+		{Time: start, Position: &LatLng{31.2300, 121.47}, Ele: floatp(10), HeartRate: intp(100), Power: intp(0)},
+		{Time: start.Add(10 * time.Second), Position: &LatLng{31.2303, 121.47}, Ele: floatp(11), HeartRate: intp(120),
+			Cadence: intp(80), Power: intp(200)},
+		{Time: start.Add(20 * time.Second), Position: &LatLng{31.2306, 121.47}, Ele: floatp(13), HeartRate: intp(140),
+			Cadence: intp(0), Power: intp(200)},
+		{Time: start.Add(80 * time.Second), Position: &LatLng{31.2306, 121.47}, Ele: floatp(12), Power: intp(0)},
+		{Time: start.Add(90 * time.Second), Position: &LatLng{31.2309, 121.47}, Ele: floatp(9), HeartRate: intp(130),
+			Cadence: intp(90), Power: intp(200)},
+	}
+	s := Summarize(points)
+
+	require.InDelta(t, 100, s.Distance, 1)
+	require.Equal(t, 90, s.ElapsedTime)
+	require.Equal(t, 30, s.MovingTime)
+	require.InDelta(t, 3.33, s.AverageSpeed, 0.05)
+	require.InDelta(t, 3.33, s.MaxSpeed, 0.05)
+	// 10 -> 11 小于阈值, 10 -> 13 计入 3 米, 13 -> 12 -> 9 下降
+	require.Equal(t, 3.0, s.ElevationGain)
+	require.Equal(t, 13.0, s.ElevHigh)
+	require.Equal(t, 9.0, s.ElevLow)
+	require.Equal(t, 122.5, s.AverageHeartRate)
+	require.Equal(t, 140.0, s.MaxHeartRate)
+	require.Equal(t, 85.0, s.AverageCadence)
+	require.Equal(t, 120.0, s.AverageWatts)
+	require.Equal(t, 6.0, s.Calories)
+
+	// 点上有距离时以点上的距离为准, 圈从非零距离开始
+	d := 1000.0
+	points[3].Distance = &d
+	require.Equal(t, []float64{0, 1000}, Distances(points[2:4]))
+	require.InDelta(t, 33, Summarize(points[3:]).Distance, 1)
+
+	// 没有距离数据时都视为移动
+	indoor := []*Point{{Time: start}, {Time: start.Add(time.Second)}, {Time: start.Add(time.Second)}}
+	require.Equal(t, []bool{false, true, false}, Moving(indoor, Distances(indoor)))
+	require.Equal(t, 1, Summarize(indoor).MovingTime)
+	require.Equal(t, &Summary{}, Summarize(nil))
+}
+
+func TestDistance(t *testing.T) {
+	d := Distance(LatLng{31.2304, 121.4737}, LatLng{31.2404, 121.4737})
+
+	require.InDelta(t, 1112, d, 1)
+	require.Zero(t, Distance(LatLng{31, 121}, LatLng{31, 121}))
+}
+
+func TestCoverage(t *testing.T) {
+	route := []LatLng{{31.2300, 121.4700}, {31.2310, 121.4700}, {31.2320, 121.4700}, {31.2330, 121.4700}}
+	// 与路线平行, 偏移约 50 米
+	path := []LatLng{{31.2295, 121.4705}, {31.2335, 121.4705}}
+
+	require.Equal(t, 1.0, Coverage(route, path, 100, 0))
+	require.Equal(t, 0.0, Coverage(route, path, 20, 0))
+	require.Equal(t, 0.25, Coverage(route, path[:1], 100, 0))
+	require.Equal(t, 0.0, Coverage(route, nil, 100, 0))
+
+	b := NewBounds(path)
+	require.True(t, b.Intersects(NewBounds(route), 100))
+	require.False(t, b.Intersects(NewBounds(route), 0))
+	require.False(t, b.Intersects(NewBounds([]LatLng{{31.25, 121.47}}), 100))
+	require.True(t, b.Intersects(NewBounds([]LatLng{{31.2342, 121.4705}}), 100))
+	require.Nil(t, NewBounds(nil))
+}
+
+func TestWriteGPX(t *testing.T) {
+	ele := 5.1
+	tr := Track{
+		Name: "Morning <Run>",
+		Type: "Run",
+		Time: time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC),
+		Points: []*Point{
+			{Position: &LatLng{31.2304, 121.4737}, Ele: &ele, Time: time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)},
+			{Time: time.Date(2022, 11, 20, 22, 30, 1, 0, time.UTC)},
+			{Position: &LatLng{31.23043, 121.47373}},
+		},
+	}
+	var buf bytes.Buffer
+
+	require.NoError(t, WriteGPX(&buf, &tr))
+	s := buf.String()
+	require.True(t, strings.HasPrefix(s, `<?xml version="1.0" encoding="UTF-8"?>`))
+	require.Contains(t, s, `<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1" creator="iself">`)
+	require.Contains(t, s, `<name>Morning &lt;Run&gt;</name>`)
+	require.Contains(t, s, `<trkpt lat="31.2304" lon="121.4737">`)
+	require.Contains(t, s, `<ele>5.1</ele>`)
+	require.Contains(t, s, `<time>2022-11-20T22:30:00Z</time>`)
+	require.Equal(t, 2, strings.Count(s, "<trkpt "))
+}
+
+func TestWriteGPX_Extensions(t *testing.T) {
+	start := time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)
+	hr, cad, power, temp := 131, 88, 182, 21.0
+	tr := Track{
+		Name: "Evening Ride",
+		Time: start,
+		Points: []*Point{
+			{Position: &LatLng{31.2304, 121.4737}, Time: start, HeartRate: &hr, Cadence: &cad, Power: &power, Temp: &temp},
+			{Position: &LatLng{31.23043, 121.47373}, Time: start.Add(time.Second), Power: &power},
+		},
+	}
+	var buf bytes.Buffer
+
+	require.NoError(t, WriteGPX(&buf, &tr))
+	require.Contains(t, buf.String(), `xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1"`)
+
+	// 按命名空间解析, 验证前缀声明正确
+	var r struct {
+		Track struct {
+			Points []struct {
+				Lat  float64 `xml:"lat,attr"`
+				Time string  `xml:"time"`
+				Ext  struct {
+					Power int `xml:"power"`
+					TPX   *struct {
+						Temp      float64 `xml:"http://www.garmin.com/xmlschemas/TrackPointExtension/v1 atemp"`
+						HeartRate int     `xml:"http://www.garmin.com/xmlschemas/TrackPointExtension/v1 hr"`
+						Cadence   int     `xml:"http://www.garmin.com/xmlschemas/TrackPointExtension/v1 cad"`
+					} `xml:"http://www.garmin.com/xmlschemas/TrackPointExtension/v1 TrackPointExtension"`
+				} `xml:"extensions"`
+			} `xml:"trkseg>trkpt"`
+		} `xml:"http://www.topografix.com/GPX/1/1 trk"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &r))
+	require.Len(t, r.Track.Points, 2)
+	require.Equal(t, r.Track.Points[0].Time, "2022-11-20T22:30:00Z")
+	require.Equal(t, r.Track.Points[0].Ext.Power, 182)
+	require.Equal(t, r.Track.Points[0].Ext.TPX.HeartRate, 131)
+	require.Equal(t, r.Track.Points[0].Ext.TPX.Cadence, 88)
+	require.Equal(t, r.Track.Points[0].Ext.TPX.Temp, 21.0)
+	require.Nil(t, r.Track.Points[1].Ext.TPX)
+}
+
+func TestWriteGPX_NoPosition(t *testing.T) {
+	hr := 120
+	tr := Track{
+		Name:   "Treadmill",
+		Time:   time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC),
+		Points: []*Point{{Time: time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC), HeartRate: &hr}},
+	}
+	var buf bytes.Buffer
+
+	require.NoError(t, WriteGPX(&buf, &tr))
+	s := buf.String()
+	require.Contains(t, s, `<name>Treadmill</name>`)
+	require.NotContains(t, s, "<trk>")
+	require.NotContains(t, s, "gpxtpx")
+}
+
+func TestWriteTCXCourse(t *testing.T) {
+	start := time.Date(2022, 11, 20, 0, 0, 0, 0, time.UTC)
+	d0, d1 := 0.0, 1000.0
+	tr := Track{
+		Name: "A very long route name",
+		Points: []*Point{
+			{Position: &LatLng{31.23, 121.47}, Distance: &d0, Time: start},
+			{Position: &LatLng{31.24, 121.47}, Distance: &d1, Time: start.Add(5 * time.Minute)},
+		},
+	}
+	var buf bytes.Buffer
+
+	require.NoError(t, WriteTCXCourse(&buf, &tr))
+	s := buf.String()
+	require.Contains(t, s, `<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">`)
+	require.Contains(t, s, `<Name>A very long rou</Name>`)
+	require.Contains(t, s, `<TotalTimeSeconds>300</TotalTimeSeconds>`)
+	require.Contains(t, s, `<DistanceMeters>1000</DistanceMeters>`)
+	require.Contains(t, s, `<Time>2022-11-20T00:05:00Z</Time>`)
+	require.Equal(t, 2, strings.Count(s, "<Trackpoint>"))
+}
+
+func TestWriteTCXActivity(t *testing.T) {
+	start := time.Date(2022, 11, 22, 10, 0, 0, 0, time.UTC)
+	d0, d1, d2 := 0.0, 500.0, 1000.0
+	hr0, hr1, hr2 := 120, 130, 141
+	cad, w0, w1 := 85, 180, 200
+	tr := Track{
+		Name: "Evening Ride",
+		Type: SportBiking,
+		Time: start,
+		Points: []*Point{
+			{Time: start, Position: &LatLng{31.23, 121.47}, Distance: &d0, HeartRate: &hr0, Cadence: &cad, Power: &w0},
+			{Time: start.Add(time.Minute), Distance: &d1, HeartRate: &hr1, Power: &w1},
+			{Time: start.Add(2 * time.Minute), Distance: &d2, HeartRate: &hr2},
+		},
+		Laps: []*Lap{
+			{Start: 0, End: 2, Time: start, TotalTime: 60, Distance: 500, Calories: 30},
+			{Start: 2, End: 3, Time: start.Add(time.Minute), TotalTime: 60, Distance: 500, Calories: 20},
+		},
+	}
+	var buf bytes.Buffer
+
+	require.NoError(t, WriteTCXActivity(&buf, &tr))
+	s := buf.String()
+	require.Contains(t, s, `<Activity Sport="Biking">`)
+	require.Contains(t, s, `<Id>2022-11-22T10:00:00Z</Id>`)
+	require.Contains(t, s, `<Lap StartTime="2022-11-22T10:01:00Z">`)
+	require.Contains(t, s, `<Cadence>85</Cadence>`)
+
+	// 按命名空间解析, 验证扩展的前缀声明正确
+	var r struct {
+		Activity struct {
+			Sport string `xml:"Sport,attr"`
+			Laps  []struct {
+				Calories int `xml:"Calories"`
+				AvgHR    int `xml:"AverageHeartRateBpm>Value"`
+				MaxHR    int `xml:"MaximumHeartRateBpm>Value"`
+				Ext      struct {
+					AvgWatts int `xml:"http://www.garmin.com/xmlschemas/ActivityExtension/v2 AvgWatts"`
+				} `xml:"Extensions>LX"`
+				Points []struct {
+					Ext struct {
+						Watts int `xml:"http://www.garmin.com/xmlschemas/ActivityExtension/v2 Watts"`
+					} `xml:"Extensions>TPX"`
+				} `xml:"Track>Trackpoint"`
+			} `xml:"Lap"`
+		} `xml:"Activities>Activity"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &r))
+	require.Len(t, r.Activity.Laps, 2)
+	require.Equal(t, r.Activity.Laps[0].Calories, 30)
+	require.Equal(t, r.Activity.Laps[0].AvgHR, 125)
+	require.Equal(t, r.Activity.Laps[0].MaxHR, 130)
+	require.Equal(t, r.Activity.Laps[0].Ext.AvgWatts, 190)
+	require.Equal(t, r.Activity.Laps[0].Points[1].Ext.Watts, 200)
+	require.Equal(t, r.Activity.Laps[1].Ext.AvgWatts, 0)
+	require.Len(t, r.Activity.Laps[1].Points, 1)
+}
+
+func TestWriteTCXActivity_Run(t *testing.T) {
+	start := time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)
+	cad := 88
+	tr := Track{
+		Type:   "Swim",
+		Time:   start,
+		Points: []*Point{{Time: start, Cadence: &cad}, {Time: start.Add(time.Minute), Cadence: &cad}},
+	}
+	var buf bytes.Buffer
+
+	require.NoError(t, WriteTCXActivity(&buf, &tr))
+	require.Contains(t, buf.String(), `<Activity Sport="Other">`)
+	require.Contains(t, buf.String(), `<TotalTimeSeconds>60</TotalTimeSeconds>`)
+
+	tr.Type = SportRunning
+	buf.Reset()
+	require.NoError(t, WriteTCXActivity(&buf, &tr))
+	s := buf.String()
+	require.Contains(t, s, `<ns3:RunCadence>88</ns3:RunCadence>`)
+	require.Contains(t, s, `<ns3:AvgRunCadence>88</ns3:AvgRunCadence>`)
+	require.NotContains(t, s, `<Cadence>`)
+	require.NotContains(t, s, `<Position>`)
+}
+
+func TestReadGPX(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="Garmin Connect" xmlns="http://www.topografix.com/GPX/1/1"
+  xmlns:ns3="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+  <metadata><name>Metadata Name</name><time>2022-11-20T22:30:00Z</time></metadata>
+  <trk>
+    <name>Morning Run</name>
+    <type>running</type>
+    <trkseg>
+      <trkpt lat="31.2304" lon="121.4737"><ele>5.1</ele><time>2022-11-20T22:30:00.000Z</time>
+        <extensions><ns3:TrackPointExtension><ns3:hr>131</ns3:hr><ns3:cad>88</ns3:cad></ns3:TrackPointExtension></extensions>
+      </trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="31.2307" lon="121.4737"><time>2022-11-20T22:30:10</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+	tr, err := ReadGPX(strings.NewReader(data))
+	require.NoError(t, err)
+
+	require.Equal(t, tr.Name, "Morning Run")
+	require.Equal(t, tr.Type, "running")
+	require.Equal(t, tr.Time, time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC))
+	require.Len(t, tr.Points, 2)
+	require.Equal(t, *tr.Points[0].Position, LatLng{31.2304, 121.4737})
+	require.Equal(t, *tr.Points[0].Ele, 5.1)
+	require.Equal(t, *tr.Points[0].HeartRate, 131)
+	require.Equal(t, *tr.Points[0].Cadence, 88)
+	require.Nil(t, tr.Points[1].HeartRate)
+	require.Equal(t, tr.Points[1].Time, time.Date(2022, 11, 20, 22, 30, 10, 0, time.UTC))
+
+	_, err = ReadGPX(strings.NewReader("<gpx><trk>"))
+	require.ErrorIs(t, err, ErrFormat)
+}
+
+func TestReadGPX_WriteGPX(t *testing.T) {
+	start := time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)
+	hr, power := 131, 182
+	tr := Track{
+		Name: "Evening Ride",
+		Type: "Ride",
+		Time: start,
+		Points: []*Point{
+			{Position: &LatLng{31.2304, 121.4737}, Time: start, HeartRate: &hr, Power: &power},
+			{Position: &LatLng{31.2307, 121.4737}, Time: start.Add(time.Second)},
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, WriteGPX(&buf, &tr))
+
+	r, err := ReadGPX(&buf)
+	require.NoError(t, err)
+
+	require.Equal(t, r.Name, "Evening Ride")
+	require.Equal(t, r.Type, "Ride")
+	require.Len(t, r.Points, 2)
+	require.Equal(t, *r.Points[0].HeartRate, 131)
+	require.Equal(t, *r.Points[0].Power, 182)
+	require.Equal(t, r.Points[1].Time, start.Add(time.Second))
+}
+
+func TestReadTCX(t *testing.T) {
+	start := time.Date(2022, 11, 22, 10, 0, 0, 0, time.UTC)
+	d0, d1, d2 := 0.0, 500.0, 1000.0
+	hr0, hr1, hr2 := 120, 130, 141
+	cad, w0, w1 := 85, 180, 200
+	tr := Track{
+		Name: "Evening Ride",
+		Type: SportBiking,
+		Time: start,
+		Points: []*Point{
+			{Time: start, Position: &LatLng{31.23, 121.47}, Distance: &d0, HeartRate: &hr0, Cadence: &cad, Power: &w0},
+			{Time: start.Add(time.Minute), Distance: &d1, HeartRate: &hr1, Power: &w1},
+			{Time: start.Add(2 * time.Minute), Distance: &d2, HeartRate: &hr2},
+		},
+		Laps: []*Lap{
+			{Start: 0, End: 2, Time: start, TotalTime: 60, Distance: 500, Calories: 30},
+			{Start: 2, End: 3, Time: start.Add(time.Minute), TotalTime: 60, Distance: 500, Calories: 20},
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, WriteTCXActivity(&buf, &tr))
+
+	r, err := ReadTCX(&buf)
+	require.NoError(t, err)
+
+	require.Equal(t, r.Type, SportBiking)
+	require.Equal(t, r.Time, start)
+	require.Len(t, r.Points, 3)
+	require.Equal(t, *r.Points[0].Position, LatLng{31.23, 121.47})
+	require.Equal(t, *r.Points[0].Cadence, 85)
+	require.Equal(t, *r.Points[1].Power, 200)
+	require.Equal(t, *r.Points[2].Distance, 1000.0)
+	require.Nil(t, r.Points[1].Position)
+	require.Len(t, r.Laps, 2)
+	require.Equal(t, *r.Laps[1], Lap{Start: 2, End: 3, Time: start.Add(time.Minute), TotalTime: 60, Distance: 500, Calories: 20})
+
+	_, err = ReadTCX(strings.NewReader(`<TrainingCenterDatabase></TrainingCenterDatabase>`))
+	require.ErrorIs(t, err, ErrFormat)
+}
+
+func TestSmoothVelocity(t *testing.T) {
+	start := time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)
+	points := []*Point{
+		{Time: start},
+		{Time: start.Add(2 * time.Second)},
+		{Time: start.Add(4 * time.Second)},
+		{Time: start.Add(60 * time.Second)},
+	}
+	distances := []float64{0, 6, 12, 12}
+
+	v := SmoothVelocity(points, distances)
+
+	require.Equal(t, v, []float64{3, 3, 3, 0})
+}
+
+func TestSmoothGrade(t *testing.T) {
+	distances := []float64{0, 20, 40, 60, 80, 85}
+	altitude := []float64{0, 1, 2, 3, 3, 9}
+
+	g := SmoothGrade(altitude, distances)
+
+	require.Equal(t, g, []float64{5, 5, 5, 15.6, 24, 24})
+	// 没有移动时距离不足 minGradeDistance, 不计算坡度
+	require.Equal(t, SmoothGrade([]float64{0, 0, 5}, []float64{0, 0, 0}), []float64{0, 0, 0})
+}
@@ -61,3 +61,24 @@ func (cr *Cacher) SetNXObject(ctx context.Context, key string, val any, ex time.
 func (cr *Cacher) Del(ctx context.Context, key string) (int64, error) {
 	return cr.rdb.Del(ctx, key).Result()
 }
+
+// 值相同时才删除, 如: 只释放自己持有的锁
+const delIfEqualScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+
+// DelIfEqual 值与 val 相同时删除 key, 返回是否删除
+func (cr *Cacher) DelIfEqual(ctx context.Context, key string, val any) (bool, error) {
+	n, err := cr.rdb.Eval(ctx, delIfEqualScript, []string{key}, val).Int64()
+	return n > 0, err
+}
+
+// IncrBy 增加计数, 第一次创建 key 时设置过期时间
+func (cr *Cacher) IncrBy(ctx context.Context, key string, val int64, ex time.Duration) (int64, error) {
+	n, err := cr.rdb.IncrBy(ctx, key, val).Result()
+	if err != nil {
+		return 0, err
+	}
+	if n == val && ex > 0 {
+		err = cr.rdb.Expire(ctx, key, ex).Err()
+	}
+	return n, err
+}
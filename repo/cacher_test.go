@@ -143,3 +143,24 @@ func TestCacher_Del(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestCacher_DelIfEqual(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	mock.ExpectEval(delIfEqualScript, []string{mockKey}, int64(10)).SetVal(int64(1))
+	// 锁已经过期并被其它 worker 持有, 值不同时不删除
+	mock.ExpectEval(delIfEqualScript, []string{mockKey}, int64(11)).SetVal(int64(0))
+
+	cr := Cacher{rdb: rdb}
+
+	deleted, err := cr.DelIfEqual(context.TODO(), mockKey, int64(10))
+	require.NoError(t, err)
+	require.True(t, deleted)
+
+	deleted, err = cr.DelIfEqual(context.TODO(), mockKey, int64(11))
+	require.NoError(t, err)
+	require.False(t, deleted)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
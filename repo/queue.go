@@ -0,0 +1,53 @@
+package repo
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Queue 基于 redis sorted set 的延时队列, member 为任务 id, score 为任务可执行的时间(毫秒)
+type Queue struct {
+	rdb *redis.Client
+	key string
+}
+
+func NewQueue(rdb *redis.Client, key string) *Queue {
+	return &Queue{
+		rdb: rdb,
+		key: key,
+	}
+}
+
+// Push 添加任务, at 之后可被取出; 任务已经在队列中时不会修改原来的执行时间
+func (q *Queue) Push(ctx context.Context, id int64, at time.Time) error {
+	return q.rdb.ZAddNX(ctx, q.key, &redis.Z{Score: float64(at.UnixMilli()), Member: id}).Err()
+}
+
+// Pop 取出一个在 now 之前可执行的任务, 没有任务时返回 0
+func (q *Queue) Pop(ctx context.Context, now time.Time) (int64, error) {
+	opt := redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: 1,
+	}
+	for {
+		items, err := q.rdb.ZRangeByScore(ctx, q.key, &opt).Result()
+		if err != nil {
+			return 0, err
+		}
+		if len(items) == 0 {
+			return 0, nil
+		}
+		// 多个 worker 可能同时取到同一个任务, 只有 ZREM 成功的 worker 可以处理
+		n, err := q.rdb.ZRem(ctx, q.key, items[0]).Result()
+		if err != nil {
+			return 0, err
+		}
+		if n == 1 {
+			return strconv.ParseInt(items[0], 10, 64)
+		}
+	}
+}
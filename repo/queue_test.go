@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mockQueueKey = "mockQueue"
+)
+
+func TestQueue_Push(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	now := time.Now()
+	mock.ExpectZAddNX(mockQueueKey, &redis.Z{Score: float64(now.UnixMilli()), Member: int64(1)}).SetVal(1)
+
+	q := NewQueue(rdb, mockQueueKey)
+
+	err := q.Push(context.TODO(), 1, now)
+
+	require.NoError(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueue_Pop(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	now := time.Now()
+	opt := redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(now.UnixMilli(), 10), Count: 1}
+	// 第一次被其他 worker 抢先取走, 第二次成功
+	mock.ExpectZRangeByScore(mockQueueKey, &opt).SetVal([]string{"1"})
+	mock.ExpectZRem(mockQueueKey, "1").SetVal(0)
+	mock.ExpectZRangeByScore(mockQueueKey, &opt).SetVal([]string{"2"})
+	mock.ExpectZRem(mockQueueKey, "2").SetVal(1)
+
+	q := NewQueue(rdb, mockQueueKey)
+
+	id, err := q.Pop(context.TODO(), now)
+
+	require.NoError(t, err)
+	require.Equal(t, id, int64(2))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueue_PopEmpty(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	now := time.Now()
+	opt := redis.ZRangeBy{Min: "-inf", Max: strconv.FormatInt(now.UnixMilli(), 10), Count: 1}
+	mock.ExpectZRangeByScore(mockQueueKey, &opt).SetVal([]string{})
+
+	q := NewQueue(rdb, mockQueueKey)
+
+	id, err := q.Pop(context.TODO(), now)
+
+	require.NoError(t, err)
+	require.Equal(t, id, int64(0))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
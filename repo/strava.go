@@ -2,10 +2,13 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/happyxhw/pkg/query"
 
@@ -14,6 +17,13 @@ import (
 	"github.com/happyxhw/iself/model"
 )
 
+const (
+	// strava 同步的活动, 本地导入的活动 id 为负数并且有 external_id
+	stravaActivityCond = "athlete_id = ? AND source = ? AND id > 0 AND external_id = ''"
+	// postgres unique_violation
+	pgUniqueViolation = "23505"
+)
+
 type StravaRepo struct {
 	db *gorm.DB
 }
@@ -30,6 +40,45 @@ func (sr *StravaRepo) CreateDetailedActivity(ctx context.Context, e *model.Strav
 	return err
 }
 
+// UpsertDetailedActivity 创建或者覆盖活动详情, 不覆盖 deleted_at, 已经删除的活动不会因为重试的推送恢复
+func (sr *StravaRepo) UpsertDetailedActivity(ctx context.Context, e *model.StravaActivityDetail) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"athlete_id", "name", "type", "distance", "moving_time", "elapsed_time", "total_elevation_gain",
+			"start_date_local", "start_date", "polyline", "summary_polyline", "average_speed", "max_speed",
+			"average_heartrate", "max_heartrate", "elev_high", "elev_low", "calories", "splits_metric",
+			"best_efforts", "device_name", "private", "lap_structure", "gear_id", "description", "commute",
+			"trainer", "kudos_count", "comment_count", "external_id", "source", "updated_at",
+		}),
+	}).Create(e).Error
+
+	return err
+}
+
+// IsActivityDeleted 活动是否已经被删除
+func (sr *StravaRepo) IsActivityDeleted(ctx context.Context, id int64) (bool, error) {
+	var n int64
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Unscoped().Model(&model.StravaActivityDetail{})
+	err := tx.Where("id = ? AND deleted_at <> 0", id).Count(&n).Error
+
+	return n > 0, err
+}
+
+func (sr *StravaRepo) UpdateDetailedActivity(ctx context.Context, activityID int64, params *model.StravaActivityParam) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaActivityDetail{}).TableName())
+	r := tx.Where("id = ?", activityID).Updates(params)
+
+	return r.RowsAffected, r.Error
+}
+
+func (sr *StravaRepo) DeleteDetailedActivity(ctx context.Context, activityID int64) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaActivityDetail{})
+	r := tx.Where("id = ?", activityID).Delete(&model.StravaActivityDetail{})
+
+	return r.RowsAffected, r.Error
+}
+
 func (sr *StravaRepo) GetDetailedActivity(ctx context.Context, activityID, athleteID int64,
 	opt query.Opt) (*model.StravaActivityDetail, error) {
 	var r model.StravaActivityDetail
@@ -45,6 +94,31 @@ func (sr *StravaRepo) GetDetailedActivity(ctx context.Context, activityID, athle
 	return &r, nil
 }
 
+// GetActivityByExternalID 查询导入的活动, 用于避免重复导入同一个文件
+func (sr *StravaRepo) GetActivityByExternalID(ctx context.Context, athleteID int64, externalID string,
+	opt query.Opt) (*model.StravaActivityDetail, error) {
+	var r model.StravaActivityDetail
+	tx := trans.DB(ctx, sr.db.WithContext(ctx))
+	tx = tx.Where("athlete_id = ? AND external_id = ?", athleteID, externalID)
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// NextLocalIDs 生成 n 个导入的活动和圈使用的 id, 为负数, 不会与 strava 的 id 冲突
+func (sr *StravaRepo) NextLocalIDs(ctx context.Context, n int) ([]int64, error) {
+	var r []int64
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).
+		Raw("SELECT -nextval('strava_local_id_seq') FROM generate_series(1, ?)", n).Scan(&r).Error
+
+	return r, err
+}
+
 func (sr *StravaRepo) QueryDetailedActivity(ctx context.Context, athleteID int64,
 	params *model.StravaActivityParam, opt query.Opt) (*query.PagingResult, []*model.StravaActivityDetail, error) {
 	var list []*model.StravaActivityDetail
@@ -53,6 +127,9 @@ func (sr *StravaRepo) QueryDetailedActivity(ctx context.Context, athleteID int64
 	if params.Type != nil {
 		db = db.Where("type = ?", *params.Type)
 	}
+	if params.Source != nil {
+		db = db.Where("source = ?", *params.Source)
+	}
 	if params.Filter != "" {
 		db = db.Where("name ILIKE ?", "%"+params.Filter+"%")
 	}
@@ -74,6 +151,19 @@ func (sr *StravaRepo) QueryDetailedActivity(ctx context.Context, athleteID int64
 	return pr, list, nil
 }
 
+// ScanDetailedActivity 按 id 顺序分批读取用户的活动, 返回 id 大于 afterID 的最多 limit 个, 用于遍历所有活动, 如: 个人数据导出
+func (sr *StravaRepo) ScanDetailedActivity(ctx context.Context, athleteID, afterID int64, limit int,
+	opt query.Opt) ([]*model.StravaActivityDetail, error) {
+	var r []*model.StravaActivityDetail
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("athlete_id = ? AND id > ?", athleteID, afterID)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("id").Limit(limit).Find(&r).Error
+
+	return r, err
+}
+
 func (sr *StravaRepo) GetActivityProgressStats(ctx context.Context, athleteID int64,
 	activityType, method, field, start string) (float64, error) {
 	result := map[string]interface{}{}
@@ -135,6 +225,26 @@ func (sr *StravaRepo) CreateStreamSet(ctx context.Context, e *model.StravaActivi
 	return err
 }
 
+// UpsertStreamSet 创建或者覆盖 stream, 不覆盖 deleted_at
+func (sr *StravaRepo) UpsertStreamSet(ctx context.Context, e *model.StravaActivityStream) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"time", "distance", "latlng", "altitude", "velocity_smooth", "heartrate", "cadence", "watts", "temp",
+			"moving", "grade_smooth", "updated_at",
+		}),
+	}).Create(e).Error
+
+	return err
+}
+
+func (sr *StravaRepo) DeleteStreamSet(ctx context.Context, activityID int64) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaActivityStream{})
+	r := tx.Where("id = ?", activityID).Delete(&model.StravaActivityStream{})
+
+	return r.RowsAffected, r.Error
+}
+
 func (sr *StravaRepo) GetStreamSet(ctx context.Context, activityID int64, opt query.Opt) (*model.StravaActivityStream, error) {
 	var r model.StravaActivityStream
 	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("id = ?", activityID)
@@ -154,15 +264,19 @@ func (sr *StravaRepo) CreateActivityRaw(ctx context.Context, m *model.StravaActi
 	return err
 }
 
-func (sr *StravaRepo) CreatePushEvent(ctx context.Context, e *model.StravaPushEvent) error {
-	err := trans.DB(ctx, sr.db.WithContext(ctx)).Create(e).Error
+// UpsertActivityRaw 创建或者覆盖原始数据, 不覆盖 deleted_at
+func (sr *StravaRepo) UpsertActivityRaw(ctx context.Context, m *model.StravaActivityRaw) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"data"}),
+	}).Create(m).Error
 
 	return err
 }
 
-func (sr *StravaRepo) GetPushEvent(ctx context.Context, athleteID int64, opt query.Opt) (*model.StravaPushEvent, error) {
-	var r model.StravaPushEvent
-	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("object_id = ?", athleteID)
+func (sr *StravaRepo) GetActivityRaw(ctx context.Context, activityID int64, opt query.Opt) (*model.StravaActivityRaw, error) {
+	var r model.StravaActivityRaw
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("id = ?", activityID)
 	if err := query.Take(tx, opt, &r); err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
@@ -173,77 +287,1304 @@ func (sr *StravaRepo) GetPushEvent(ctx context.Context, athleteID int64, opt que
 	return &r, nil
 }
 
-func (sr *StravaRepo) UpdatePushEvent(ctx context.Context, activityID int64, params *model.StravaPushEventParam) (int64, error) {
-	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaPushEvent{}).TableName())
-	r := tx.Where("object_id = ?", activityID).Updates(params)
+func (sr *StravaRepo) DeleteActivityRaw(ctx context.Context, activityID int64) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaActivityRaw{})
+	r := tx.Where("id = ?", activityID).Delete(&model.StravaActivityRaw{})
 
 	return r.RowsAffected, r.Error
 }
 
-func (sr *StravaRepo) CreateGoal(ctx context.Context, g *model.StravaGoal) error {
-	err := trans.DB(ctx, sr.db.WithContext(ctx)).Create(g).Error
+// UpsertLaps 覆盖活动的圈数据, 删除已经不存在的圈
+func (sr *StravaRepo) UpsertLaps(ctx context.Context, activityID int64, laps []*model.StravaActivityLap) error {
+	db := trans.DB(ctx, sr.db.WithContext(ctx))
+	ids := make([]int64, 0, len(laps))
+	for _, item := range laps {
+		ids = append(ids, item.ID)
+	}
+	tx := db.Model(&model.StravaActivityLap{}).Where("activity_id = ?", activityID)
+	if len(ids) > 0 {
+		tx = tx.Where("id NOT IN ?", ids)
+	}
+	if err := tx.Delete(&model.StravaActivityLap{}).Error; err != nil {
+		return err
+	}
+	if len(laps) == 0 {
+		return nil
+	}
+	// 不覆盖 deleted_at, 活动删除后重试的推送不会恢复已经删除的圈
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"activity_id", "athlete_id", "lap_index", "name", "distance", "moving_time", "elapsed_time",
+			"total_elevation_gain", "average_speed", "max_speed", "average_heartrate", "max_heartrate",
+			"average_cadence", "average_watts", "start_index", "end_index", "start_date_local", "updated_at",
+		}),
+	}).Create(laps).Error
+}
 
-	return err
+func (sr *StravaRepo) DeleteLaps(ctx context.Context, activityID int64) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaActivityLap{})
+	r := tx.Where("activity_id = ?", activityID).Delete(&model.StravaActivityLap{})
+
+	return r.RowsAffected, r.Error
 }
 
-func (sr *StravaRepo) GetGoal(ctx context.Context, g *model.StravaGoal, opt query.Opt) (*model.StravaGoal, error) {
-	var r model.StravaGoal
+// GetLaps 查询多个活动的圈数据, 按活动和圈的顺序排列
+func (sr *StravaRepo) GetLaps(ctx context.Context, activityIDs []int64, opt query.Opt) ([]*model.StravaActivityLap, error) {
+	var r []*model.StravaActivityLap
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("activity_id IN ?", activityIDs)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("activity_id, lap_index").Find(&r).Error
+
+	return r, err
+}
+
+// GetActivityByLapStructure 查询 before 及之前圈结构相同的活动, 按开始时间倒序
+func (sr *StravaRepo) GetActivityByLapStructure(ctx context.Context, athleteID int64, activityType, lapStructure string,
+	before time.Time, limit int, opt query.Opt) ([]*model.StravaActivityDetail, error) {
+	var r []*model.StravaActivityDetail
 	tx := trans.DB(ctx, sr.db.WithContext(ctx)).
-		Where("athlete_id = ?", g.AthleteID).
-		Where("type = ? AND field = ? AND freq = ?", g.Type, g.Field, g.Freq)
+		Where("athlete_id = ? AND type = ? AND lap_structure = ?", athleteID, activityType, lapStructure).
+		Where("start_date_local <= ?", before)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("start_date_local DESC").Limit(limit).Find(&r).Error
+
+	return r, err
+}
+
+// UpsertActivityZones 覆盖活动的区间数据, 旧数据软删除
+func (sr *StravaRepo) UpsertActivityZones(ctx context.Context, activityID int64, zones []*model.StravaActivityZone) error {
+	db := trans.DB(ctx, sr.db.WithContext(ctx))
+	err := db.Where("activity_id = ?", activityID).Delete(&model.StravaActivityZone{}).Error
+	if err != nil {
+		return err
+	}
+	if len(zones) == 0 {
+		return nil
+	}
+
+	return db.Create(zones).Error
+}
+
+func (sr *StravaRepo) DeleteActivityZones(ctx context.Context, activityID int64) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaActivityZone{})
+	r := tx.Where("activity_id = ?", activityID).Delete(&model.StravaActivityZone{})
+
+	return r.RowsAffected, r.Error
+}
+
+// GetActivityZones 查询活动的区间数据, 按区间类型和顺序排列
+func (sr *StravaRepo) GetActivityZones(ctx context.Context, activityID int64, opt query.Opt) ([]*model.StravaActivityZone, error) {
+	var r []*model.StravaActivityZone
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("activity_id = ?", activityID)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("type, zone").Find(&r).Error
+
+	return r, err
+}
+
+// UpsertActivityComments 覆盖活动的评论, strava 上已经删除的评论软删除
+func (sr *StravaRepo) UpsertActivityComments(ctx context.Context, activityID int64, comments []*model.StravaActivityComment) error {
+	db := trans.DB(ctx, sr.db.WithContext(ctx))
+	ids := make([]int64, 0, len(comments))
+	for _, item := range comments {
+		ids = append(ids, item.ID)
+	}
+	tx := db.Model(&model.StravaActivityComment{}).Where("activity_id = ?", activityID)
+	if len(ids) > 0 {
+		tx = tx.Where("id NOT IN ?", ids)
+	}
+	if err := tx.Delete(&model.StravaActivityComment{}).Error; err != nil {
+		return err
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+	// 不覆盖 deleted_at, 同 UpsertLaps
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"activity_id", "athlete_id", "commenter_id", "commenter_name", "text", "comment_created_at", "updated_at",
+		}),
+	}).Create(comments).Error
+}
+
+func (sr *StravaRepo) DeleteActivityComments(ctx context.Context, activityID int64) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaActivityComment{})
+	r := tx.Where("activity_id = ?", activityID).Delete(&model.StravaActivityComment{})
+
+	return r.RowsAffected, r.Error
+}
+
+// GetActivityComments 查询活动的评论, 按评论时间排列
+func (sr *StravaRepo) GetActivityComments(ctx context.Context, activityID int64, opt query.Opt) ([]*model.StravaActivityComment, error) {
+	var r []*model.StravaActivityComment
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("activity_id = ?", activityID)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("comment_created_at, id").Find(&r).Error
+
+	return r, err
+}
+
+// UpsertActivityKudos 覆盖活动的点赞用户, 旧数据软删除
+func (sr *StravaRepo) UpsertActivityKudos(ctx context.Context, activityID int64, kudos []*model.StravaActivityKudos) error {
+	db := trans.DB(ctx, sr.db.WithContext(ctx))
+	err := db.Where("activity_id = ?", activityID).Delete(&model.StravaActivityKudos{}).Error
+	if err != nil {
+		return err
+	}
+	if len(kudos) == 0 {
+		return nil
+	}
+
+	return db.Create(kudos).Error
+}
+
+func (sr *StravaRepo) DeleteActivityKudos(ctx context.Context, activityID int64) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaActivityKudos{})
+	r := tx.Where("activity_id = ?", activityID).Delete(&model.StravaActivityKudos{})
+
+	return r.RowsAffected, r.Error
+}
+
+// GetActivityKudos 查询活动的点赞用户, 按 strava 返回的顺序排列
+func (sr *StravaRepo) GetActivityKudos(ctx context.Context, activityID int64, opt query.Opt) ([]*model.StravaActivityKudos, error) {
+	var r []*model.StravaActivityKudos
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("activity_id = ?", activityID)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("position").Find(&r).Error
+
+	return r, err
+}
+
+// GetSocialStats 按月统计活动数, 收到的点赞数和评论数
+func (sr *StravaRepo) GetSocialStats(ctx context.Context, athleteID int64, start time.Time) ([]*model.StravaSocialStats, error) {
+	var r []*model.StravaSocialStats
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaActivityDetail{}).
+		Select("date_trunc('month', start_date_local) AS month, count(*) AS count, "+
+			"sum(kudos_count) AS kudos, sum(comment_count) AS comments").
+		Where("athlete_id = ? AND start_date_local >= ?", athleteID, start).
+		Group("month").Order("month").Scan(&r).Error
+
+	return r, err
+}
+
+// GetMostCommentedActivity 查询评论最多的活动
+func (sr *StravaRepo) GetMostCommentedActivity(ctx context.Context, athleteID int64, limit int,
+	opt query.Opt) ([]*model.StravaActivityDetail, error) {
+	var r []*model.StravaActivityDetail
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("athlete_id = ? AND comment_count > 0", athleteID)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("comment_count DESC, kudos_count DESC, start_date_local DESC").Limit(limit).Find(&r).Error
+
+	return r, err
+}
+
+// GetZoneAggStats 按日期统计每个区间的时间, 返回 zone -> date -> seconds
+func (sr *StravaRepo) GetZoneAggStats(ctx context.Context, athleteID int64,
+	activityType, zoneType, start, freq string) (map[int]map[string]float64, error) {
+	valMap := make(map[int]map[string]float64)
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaActivityZone{}).
+		Where("athlete_id = ? AND type = ? AND start_date_local >= ?", athleteID, zoneType, start)
+	if activityType != "all" {
+		tx = tx.Where("activity_type = ?", activityType)
+	}
+	rows, err := tx.
+		Select(fmt.Sprintf("zone, sum(time) AS time, date_trunc('%s', start_date_local) AS %s", freq, freq)).
+		Group("zone").Group(freq).Order("zone").Order(freq).Rows()
+	if err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var zone int
+		var t float64
+		var date time.Time
+		_ = rows.Scan(&zone, &t, &date)
+		if valMap[zone] == nil {
+			valMap[zone] = make(map[string]float64)
+		}
+		valMap[zone][date.Format("2006-01-02")] = t
+	}
+
+	return valMap, nil
+}
+
+// UpsertAthleteZones 创建或者覆盖用户的区间设置
+func (sr *StravaRepo) UpsertAthleteZones(ctx context.Context, e *model.StravaAthleteZone) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{UpdateAll: true}).Create(e).Error
+
+	return err
+}
+
+func (sr *StravaRepo) GetAthleteZones(ctx context.Context, athleteID int64, opt query.Opt) (*model.StravaAthleteZone, error) {
+	var r model.StravaAthleteZone
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("athlete_id = ?", athleteID)
 	if err := query.Take(tx, opt, &r); err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
 		return nil, err
 	}
+
 	return &r, nil
 }
 
-func (sr *StravaRepo) GetGoalByID(ctx context.Context, athleteID, goalID int64, opt query.Opt) (*model.StravaGoal, error) {
-	var r model.StravaGoal
+// DeleteAthleteActivity 软删除用户所有的 strava 活动数据: raw, stream, lap, zone, segment effort, comment, kudos, gear, detail,
+// 路线; 用户资料, 上传记录和俱乐部成员关系没有 deleted_at, 直接物理删除, 重新授权登录后重新同步;
+// 本地导入的活动(id 为负数, 有 external_id)及其数据不删除
+func (sr *StravaRepo) DeleteAthleteActivity(ctx context.Context, athleteID int64) (int64, error) {
+	db := trans.DB(ctx, sr.db.WithContext(ctx))
+	ids := db.Model(&model.StravaActivityDetail{}).Select("id").
+		Where(stravaActivityCond, athleteID, model.ActivityStravaSource)
+	r := db.Model(&model.StravaActivityRaw{}).Where("id IN (?)", ids).Delete(&model.StravaActivityRaw{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Model(&model.StravaActivityStream{}).Where("id IN (?)", ids).Delete(&model.StravaActivityStream{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Model(&model.StravaActivityLap{}).Where("activity_id IN (?)", ids).Delete(&model.StravaActivityLap{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Model(&model.StravaActivityZone{}).Where("activity_id IN (?)", ids).Delete(&model.StravaActivityZone{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Model(&model.StravaSegmentEffort{}).Where("activity_id IN (?)", ids).Delete(&model.StravaSegmentEffort{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Where("activity_id IN (?)", ids).Delete(&model.StravaActivityComment{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Where("activity_id IN (?)", ids).Delete(&model.StravaActivityKudos{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Model(&model.StravaGear{}).Where("athlete_id = ?", athleteID).Delete(&model.StravaGear{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Where("athlete_id = ?", athleteID).Delete(&model.StravaAthlete{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Where("athlete_id = ?", athleteID).Delete(&model.StravaUpload{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	routeIDs := db.Model(&model.StravaRoute{}).Select("id").Where("athlete_id = ?", athleteID)
+	r = db.Where("id IN (?)", routeIDs).Delete(&model.StravaRouteStream{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Where("athlete_id = ?", athleteID).Delete(&model.StravaRoute{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Where("athlete_id = ?", athleteID).Delete(&model.StravaClubAthlete{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Model(&model.StravaActivityDetail{}).Where(stravaActivityCond, athleteID, model.ActivityStravaSource).
+		Delete(&model.StravaActivityDetail{})
+
+	return r.RowsAffected, r.Error
+}
+
+// CreatePushEvent 保存推送记录, strava 重复推送的事件命中唯一索引时忽略, 返回是否写入了新记录
+func (sr *StravaRepo) CreatePushEvent(ctx context.Context, e *model.StravaPushEvent) (bool, error) {
+	r := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "subscription_id"}, {Name: "object_type"}, {Name: "object_id"}, {Name: "event_time"}, {Name: "aspect_type"},
+		},
+		DoNothing: true,
+	}).Create(e)
+
+	return r.RowsAffected > 0, r.Error
+}
+
+// GetPushEvent 查询推送记录, strava 可能会重复推送同一个事件, 以 subscription_id, object_type, object_id, aspect_type, event_time 区分
+func (sr *StravaRepo) GetPushEvent(ctx context.Context, e *model.StravaPushEvent, opt query.Opt) (*model.StravaPushEvent, error) {
+	var r model.StravaPushEvent
 	tx := trans.DB(ctx, sr.db.WithContext(ctx)).
-		Where("athlete_id = ? AND id = ?", athleteID, goalID)
+		Where("subscription_id = ? AND object_type = ? AND object_id = ? AND aspect_type = ? AND event_time = ?",
+			e.SubscriptionID, e.ObjectType, e.ObjectID, e.AspectType, e.EventTime)
 	if err := query.Take(tx, opt, &r); err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
 		return nil, err
 	}
+
 	return &r, nil
 }
 
-func (sr *StravaRepo) GetAllGoal(ctx context.Context, g *model.StravaGoal, opt query.Opt) ([]*model.StravaGoal, error) {
-	var r []*model.StravaGoal
-	tx := trans.DB(ctx, sr.db.WithContext(ctx)).
-		Where("athlete_id = ?", g.AthleteID).
-		Where("type = ? AND field = ?", g.Type, g.Field)
+func (sr *StravaRepo) GetPushEventByID(ctx context.Context, id int64, opt query.Opt) (*model.StravaPushEvent, error) {
+	var r model.StravaPushEvent
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("id = ?", id)
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// GetPushEventByStatus 按状态查询推送记录
+func (sr *StravaRepo) GetPushEventByStatus(ctx context.Context, status []int, opt query.Opt) ([]*model.StravaPushEvent, error) {
+	var r []*model.StravaPushEvent
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("status IN ?", status)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
 	err := tx.Find(&r).Error
 
 	return r, err
 }
 
-func (sr *StravaRepo) UpdateGoal(ctx context.Context, athleteID, goalID int64, params *model.StravaGoalParam) (int64, error) {
-	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaGoal{}).TableName())
-	r := tx.Where("athlete_id = ? AND id = ?", athleteID, goalID).Updates(params)
+// QueryPushEvent 分页查询推送记录
+func (sr *StravaRepo) QueryPushEvent(ctx context.Context, params *model.StravaPushEventQueryParam,
+	opt query.Opt) (*query.PagingResult, []*model.StravaPushEvent, error) {
+	var list []*model.StravaPushEvent
+	db := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaPushEvent{})
+
+	if params.Status != nil {
+		db = db.Where("status = ?", *params.Status)
+	}
+	if params.OwnerID != nil {
+		db = db.Where("owner_id = ?", *params.OwnerID)
+	}
+	if params.ObjectType != nil {
+		db = db.Where("object_type = ?", *params.ObjectType)
+	}
+	if params.Start != 0 {
+		db = db.Where("event_time >= ?", params.Start)
+	}
+	if params.End != 0 {
+		db = db.Where("event_time < ?", params.End)
+	}
+
+	if len(opt.Fields) > 0 {
+		db = db.Select(opt.Fields)
+	}
+	if params.SortBy != "" {
+		if sortBy := query.ParseOrder(params.SortBy, pushEventSortFn); sortBy != "" {
+			db = db.Order(sortBy)
+		}
+	}
+
+	pr, err := query.WrapPageQuery(db, params.Param, &list)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pr, list, nil
+}
+
+// ScanPushEvent 按 id 顺序分批读取用户的推送记录, 返回 id 大于 afterID 的最多 limit 个
+func (sr *StravaRepo) ScanPushEvent(ctx context.Context, ownerID, afterID int64, limit int,
+	opt query.Opt) ([]*model.StravaPushEvent, error) {
+	var r []*model.StravaPushEvent
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("owner_id = ? AND id > ?", ownerID, afterID)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("id").Limit(limit).Find(&r).Error
+
+	return r, err
+}
+
+func (sr *StravaRepo) UpdatePushEvent(ctx context.Context, id int64, params *model.StravaPushEventParam) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaPushEvent{}).TableName())
+	r := tx.Where("id = ?", id).Updates(params)
 
 	return r.RowsAffected, r.Error
 }
 
-func (sr *StravaRepo) DeleteGoal(ctx context.Context, athleteID, goalID int64) (int64, error) {
-	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaGoal{}).TableName())
-	r := tx.Where("athlete_id = ? AND id = ?", athleteID, goalID).Delete(&model.StravaGoal{})
+// UpdatePushEventByStatus 只更新处于 status 中的推送记录, 用于原子地修改状态, 如: 重新处理已经失败的事件
+func (sr *StravaRepo) UpdatePushEventByStatus(ctx context.Context, id int64, status []int,
+	params *model.StravaPushEventParam) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaPushEvent{}).TableName())
+	r := tx.Where("id = ? AND status IN ?", id, status).Updates(params)
 
 	return r.RowsAffected, r.Error
 }
 
-func activitySortFn(key string) string {
-	k := map[string]bool{
-		"id":               true,
-		"start_date_local": true,
+// UpsertBackfill 创建或者重置导入进度
+func (sr *StravaRepo) UpsertBackfill(ctx context.Context, m *model.StravaBackfill) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{UpdateAll: true}).Create(m).Error
+
+	return err
+}
+
+func (sr *StravaRepo) GetBackfill(ctx context.Context, athleteID int64, opt query.Opt) (*model.StravaBackfill, error) {
+	var r model.StravaBackfill
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("athlete_id = ?", athleteID)
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
 	}
-	if k[key] {
+
+	return &r, nil
+}
+
+func (sr *StravaRepo) GetBackfillByStatus(ctx context.Context, status int, opt query.Opt) ([]*model.StravaBackfill, error) {
+	var r []*model.StravaBackfill
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("status = ?", status)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Find(&r).Error
+
+	return r, err
+}
+
+func (sr *StravaRepo) UpdateBackfill(ctx context.Context, athleteID int64, params *model.StravaBackfillParam) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaBackfill{}).TableName())
+	r := tx.Where("athlete_id = ?", athleteID).Updates(params)
+
+	return r.RowsAffected, r.Error
+}
+
+func (sr *StravaRepo) CreateUpload(ctx context.Context, m *model.StravaUpload) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Create(m).Error
+
+	return err
+}
+
+// GetUpload athleteID 为 0 时不限制用户, 供 worker 使用
+func (sr *StravaRepo) GetUpload(ctx context.Context, id, athleteID int64, opt query.Opt) (*model.StravaUpload, error) {
+	var r model.StravaUpload
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("id = ?", id)
+	if athleteID != 0 {
+		tx = tx.Where("athlete_id = ?", athleteID)
+	}
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (sr *StravaRepo) GetUploadByStatus(ctx context.Context, status int, opt query.Opt) ([]*model.StravaUpload, error) {
+	var r []*model.StravaUpload
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("status = ?", status)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Find(&r).Error
+
+	return r, err
+}
+
+// QueryUpload 分页查询用户的上传记录
+func (sr *StravaRepo) QueryUpload(ctx context.Context, athleteID int64, params *model.StravaUploadQueryParam,
+	opt query.Opt) (*query.PagingResult, []*model.StravaUpload, error) {
+	var list []*model.StravaUpload
+	db := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaUpload{}).Where("athlete_id = ?", athleteID)
+	if params.Status != nil {
+		db = db.Where("status = ?", *params.Status)
+	}
+	if len(opt.Fields) > 0 {
+		db = db.Select(opt.Fields)
+	}
+	if params.SortBy != "" {
+		if sortBy := query.ParseOrder(params.SortBy, uploadSortFn); sortBy != "" {
+			db = db.Order(sortBy)
+		}
+	}
+
+	pr, err := query.WrapPageQuery(db, params.Param, &list)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pr, list, nil
+}
+
+func (sr *StravaRepo) UpdateUpload(ctx context.Context, id int64, params *model.StravaUploadParam) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaUpload{}).TableName())
+	r := tx.Where("id = ?", id).Updates(params)
+
+	return r.RowsAffected, r.Error
+}
+
+func (sr *StravaRepo) CreateGoal(ctx context.Context, g *model.StravaGoal) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Create(g).Error
+
+	return err
+}
+
+func (sr *StravaRepo) GetGoal(ctx context.Context, g *model.StravaGoal, opt query.Opt) (*model.StravaGoal, error) {
+	var r model.StravaGoal
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).
+		Where("athlete_id = ?", g.AthleteID).
+		Where("type = ? AND field = ? AND freq = ?", g.Type, g.Field, g.Freq)
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (sr *StravaRepo) GetGoalByID(ctx context.Context, athleteID, goalID int64, opt query.Opt) (*model.StravaGoal, error) {
+	var r model.StravaGoal
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).
+		Where("athlete_id = ? AND id = ?", athleteID, goalID)
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (sr *StravaRepo) GetAllGoal(ctx context.Context, g *model.StravaGoal, opt query.Opt) ([]*model.StravaGoal, error) {
+	var r []*model.StravaGoal
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).
+		Where("athlete_id = ?", g.AthleteID).
+		Where("type = ? AND field = ?", g.Type, g.Field)
+	err := tx.Find(&r).Error
+
+	return r, err
+}
+
+// GetAthleteGoals 用户的所有目标
+func (sr *StravaRepo) GetAthleteGoals(ctx context.Context, athleteID int64, opt query.Opt) ([]*model.StravaGoal, error) {
+	var r []*model.StravaGoal
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("athlete_id = ?", athleteID)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("id").Find(&r).Error
+
+	return r, err
+}
+
+func (sr *StravaRepo) UpdateGoal(ctx context.Context, athleteID, goalID int64, params *model.StravaGoalParam) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaGoal{}).TableName())
+	r := tx.Where("athlete_id = ? AND id = ?", athleteID, goalID).Updates(params)
+
+	return r.RowsAffected, r.Error
+}
+
+func (sr *StravaRepo) DeleteGoal(ctx context.Context, athleteID, goalID int64) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaGoal{}).TableName())
+	r := tx.Where("athlete_id = ? AND id = ?", athleteID, goalID).Delete(&model.StravaGoal{})
+
+	return r.RowsAffected, r.Error
+}
+
+// UpsertGear 创建或者更新装备, 不覆盖用户的报废提醒设置
+func (sr *StravaRepo) UpsertGear(ctx context.Context, g *model.StravaGear) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"athlete_id", "name", "brand_name", "model_name", "description", "frame_type", "primary", "distance",
+			"updated_at", "deleted_at",
+		}),
+	}).Create(g).Error
+
+	return err
+}
+
+func (sr *StravaRepo) GetGear(ctx context.Context, athleteID int64, gearID string, opt query.Opt) (*model.StravaGear, error) {
+	var r model.StravaGear
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).
+		Where("athlete_id = ? AND id = ?", athleteID, gearID)
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (sr *StravaRepo) GetAllGear(ctx context.Context, athleteID int64, opt query.Opt) ([]*model.StravaGear, error) {
+	var r []*model.StravaGear
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("athlete_id = ?", athleteID)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("id").Find(&r).Error
+
+	return r, err
+}
+
+func (sr *StravaRepo) UpdateGear(ctx context.Context, athleteID int64, gearID string, params *model.StravaGearParam) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaGear{}).TableName())
+	r := tx.Where("athlete_id = ? AND id = ?", athleteID, gearID).Updates(params)
+
+	return r.RowsAffected, r.Error
+}
+
+// ClaimGearAlert 标记装备已经发送报废提醒, 已经标记过时返回 false, 避免多个 worker 重复发送
+func (sr *StravaRepo) ClaimGearAlert(ctx context.Context, athleteID int64, gearID string) (bool, error) {
+	alerted := true
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaGear{}).TableName())
+	r := tx.Where("athlete_id = ? AND id = ? AND alerted = ?", athleteID, gearID, false).
+		Updates(&model.StravaGearParam{Alerted: &alerted})
+
+	return r.RowsAffected > 0, r.Error
+}
+
+// GetGearStats 根据已导入的活动统计每个装备的累计距离, 时间和活动数
+func (sr *StravaRepo) GetGearStats(ctx context.Context, athleteID int64, gearIDs []string) (map[string]*model.StravaGearStats, error) {
+	var list []*model.StravaGearStats
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaActivityDetail{}).
+		Select("gear_id, sum(distance) AS distance, sum(moving_time) AS moving_time, count(*) AS count").
+		Where("athlete_id = ? AND gear_id IN ?", athleteID, gearIDs).
+		Group("gear_id").Scan(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	r := make(map[string]*model.StravaGearStats, len(list))
+	for _, item := range list {
+		r[item.GearID] = item
+	}
+
+	return r, nil
+}
+
+// UpsertSegments 创建或者更新路段
+func (sr *StravaRepo) UpsertSegments(ctx context.Context, segments []*model.StravaSegment) error {
+	if len(segments) == 0 {
+		return nil
+	}
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{UpdateAll: true}).Create(segments).Error
+
+	return err
+}
+
+func (sr *StravaRepo) GetSegment(ctx context.Context, segmentID int64, opt query.Opt) (*model.StravaSegment, error) {
+	var r model.StravaSegment
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("id = ?", segmentID)
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// QueryAthleteSegment 分页查询用户有成绩的路段
+func (sr *StravaRepo) QueryAthleteSegment(ctx context.Context, athleteID int64,
+	params *model.StravaSegmentParam, opt query.Opt) (*query.PagingResult, []*model.StravaSegment, error) {
+	var list []*model.StravaSegment
+	db := trans.DB(ctx, sr.db.WithContext(ctx))
+	segmentIDs := db.Model(&model.StravaSegmentEffort{}).Select("segment_id").Where("athlete_id = ?", athleteID)
+	db = db.Model(&model.StravaSegment{}).Where("id IN (?)", segmentIDs)
+
+	if params.ActivityType != nil {
+		db = db.Where("activity_type = ?", *params.ActivityType)
+	}
+	if params.Filter != "" {
+		db = db.Where("name ILIKE ?", "%"+params.Filter+"%")
+	}
+
+	if len(opt.Fields) > 0 {
+		db = db.Select(opt.Fields)
+	}
+	if params.SortBy != "" {
+		if sortBy := query.ParseOrder(params.SortBy, segmentSortFn); sortBy != "" {
+			db = db.Order(sortBy)
+		}
+	}
+
+	pr, err := query.WrapPageQuery(db, params.Param, &list)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pr, list, nil
+}
+
+// UpsertSegmentEfforts 覆盖活动的路段成绩, 删除已经不存在的成绩
+func (sr *StravaRepo) UpsertSegmentEfforts(ctx context.Context, activityID int64, efforts []*model.StravaSegmentEffort) error {
+	db := trans.DB(ctx, sr.db.WithContext(ctx))
+	ids := make([]int64, 0, len(efforts))
+	for _, item := range efforts {
+		ids = append(ids, item.ID)
+	}
+	tx := db.Model(&model.StravaSegmentEffort{}).Where("activity_id = ?", activityID)
+	if len(ids) > 0 {
+		tx = tx.Where("id NOT IN ?", ids)
+	}
+	if err := tx.Delete(&model.StravaSegmentEffort{}).Error; err != nil {
+		return err
+	}
+	if len(efforts) == 0 {
+		return nil
+	}
+	// 不覆盖 deleted_at, 同 UpsertLaps
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"segment_id", "activity_id", "athlete_id", "name", "elapsed_time", "moving_time", "distance",
+			"start_date_local", "average_heartrate", "max_heartrate", "average_watts", "device_watts",
+			"average_cadence", "start_index", "end_index", "pr_rank", "is_pr", "hidden", "updated_at",
+		}),
+	}).Create(efforts).Error
+}
+
+func (sr *StravaRepo) DeleteSegmentEfforts(ctx context.Context, activityID int64) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaSegmentEffort{})
+	r := tx.Where("activity_id = ?", activityID).Delete(&model.StravaSegmentEffort{})
+
+	return r.RowsAffected, r.Error
+}
+
+// GetActivitySegmentEfforts 查询活动的路段成绩, 按在活动中的顺序排列
+func (sr *StravaRepo) GetActivitySegmentEfforts(ctx context.Context, activityID int64,
+	opt query.Opt) ([]*model.StravaSegmentEffort, error) {
+	var r []*model.StravaSegmentEffort
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("activity_id = ?", activityID)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("start_index, id").Find(&r).Error
+
+	return r, err
+}
+
+// GetSegmentEfforts 查询用户在路段上的所有成绩, 按开始时间排列
+func (sr *StravaRepo) GetSegmentEfforts(ctx context.Context, athleteID, segmentID int64,
+	opt query.Opt) ([]*model.StravaSegmentEffort, error) {
+	var r []*model.StravaSegmentEffort
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("athlete_id = ? AND segment_id = ?", athleteID, segmentID)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("start_date_local, id").Find(&r).Error
+
+	return r, err
+}
+
+// UpdateSegmentEffortPr 更新成绩是否为个人最好成绩
+func (sr *StravaRepo) UpdateSegmentEffortPr(ctx context.Context, ids []int64, isPr bool) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaSegmentEffort{})
+	r := tx.Where("id IN ?", ids).Update("is_pr", isPr)
+
+	return r.RowsAffected, r.Error
+}
+
+// GetSegmentStats 统计用户在每个路段上的成绩数, 最好成绩和最近一次的日期
+func (sr *StravaRepo) GetSegmentStats(ctx context.Context, athleteID int64,
+	segmentIDs []int64) (map[int64]*model.StravaSegmentStats, error) {
+	var list []*model.StravaSegmentStats
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaSegmentEffort{}).
+		Select("segment_id, count(*) AS effort_count, min(elapsed_time) AS best_time, "+
+			"max(start_date_local) AS last_effort_date").
+		Where("athlete_id = ? AND segment_id IN ?", athleteID, segmentIDs).
+		Group("segment_id").Scan(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	r := make(map[int64]*model.StravaSegmentStats, len(list))
+	for _, item := range list {
+		r[item.SegmentID] = item
+	}
+
+	return r, nil
+}
+
+// UpsertAthlete 创建或者覆盖用户的 strava 资料
+func (sr *StravaRepo) UpsertAthlete(ctx context.Context, e *model.StravaAthlete) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{UpdateAll: true}).Create(e).Error
+
+	return err
+}
+
+func (sr *StravaRepo) GetAthlete(ctx context.Context, athleteID int64, opt query.Opt) (*model.StravaAthlete, error) {
+	var r model.StravaAthlete
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("athlete_id = ?", athleteID)
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// GetActivityTotal 统计 start 之后指定类型活动的累计数据, start 为空时统计全部
+func (sr *StravaRepo) GetActivityTotal(ctx context.Context, athleteID int64, activityTypes []string,
+	start time.Time) (*model.StravaActivityTotal, error) {
+	var r model.StravaActivityTotal
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaActivityDetail{}).
+		Select("count(*) AS count, coalesce(sum(distance), 0) AS distance, "+
+			"coalesce(sum(moving_time), 0) AS moving_time, coalesce(sum(elapsed_time), 0) AS elapsed_time, "+
+			"coalesce(sum(total_elevation_gain), 0) AS elevation_gain").
+		Where("athlete_id = ? AND type IN ?", athleteID, activityTypes)
+	if !start.IsZero() {
+		tx = tx.Where("start_date_local >= ?", start)
+	}
+	err := tx.Scan(&r).Error
+
+	return &r, err
+}
+
+// UpsertRoute 创建或者更新路线, 已经删除的路线重新出现时恢复
+func (sr *StravaRepo) UpsertRoute(ctx context.Context, m *model.StravaRoute) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{UpdateAll: true}).Create(m).Error
+
+	return err
+}
+
+// GetRoute athleteID 为 0 时不限制用户, 用于后台 worker
+func (sr *StravaRepo) GetRoute(ctx context.Context, athleteID, routeID int64, opt query.Opt) (*model.StravaRoute, error) {
+	var r model.StravaRoute
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("id = ?", routeID)
+	if athleteID != 0 {
+		tx = tx.Where("athlete_id = ?", athleteID)
+	}
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (sr *StravaRepo) GetAllRoute(ctx context.Context, athleteID int64, opt query.Opt) ([]*model.StravaRoute, error) {
+	var r []*model.StravaRoute
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("athlete_id = ?", athleteID)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("id").Find(&r).Error
+
+	return r, err
+}
+
+// QueryRoute 分页查询用户的路线
+func (sr *StravaRepo) QueryRoute(ctx context.Context, athleteID int64, params *model.StravaRouteQueryParam,
+	opt query.Opt) (*query.PagingResult, []*model.StravaRoute, error) {
+	var list []*model.StravaRoute
+	db := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaRoute{}).Where("athlete_id = ?", athleteID)
+	if params.Type != nil {
+		db = db.Where("type = ?", *params.Type)
+	}
+	if params.Starred != nil {
+		db = db.Where("starred = ?", *params.Starred)
+	}
+	if len(opt.Fields) > 0 {
+		db = db.Select(opt.Fields)
+	}
+	if params.SortBy != "" {
+		if sortBy := query.ParseOrder(params.SortBy, routeSortFn); sortBy != "" {
+			db = db.Order(sortBy)
+		}
+	}
+
+	pr, err := query.WrapPageQuery(db, params.Param, &list)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pr, list, nil
+}
+
+// DeleteRoutes 软删除路线及路线的 stream
+func (sr *StravaRepo) DeleteRoutes(ctx context.Context, athleteID int64, routeIDs []int64) (int64, error) {
+	if len(routeIDs) == 0 {
+		return 0, nil
+	}
+	db := trans.DB(ctx, sr.db.WithContext(ctx))
+	r := db.Where("id IN ?", routeIDs).Delete(&model.StravaRouteStream{})
+	if r.Error != nil {
+		return 0, r.Error
+	}
+	r = db.Where("athlete_id = ? AND id IN ?", athleteID, routeIDs).Delete(&model.StravaRoute{})
+
+	return r.RowsAffected, r.Error
+}
+
+// UpsertRouteStream 创建或者覆盖路线的 stream
+func (sr *StravaRepo) UpsertRouteStream(ctx context.Context, m *model.StravaRouteStream) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{UpdateAll: true}).Create(m).Error
+
+	return err
+}
+
+func (sr *StravaRepo) GetRouteStream(ctx context.Context, routeID int64, opt query.Opt) (*model.StravaRouteStream, error) {
+	var r model.StravaRouteStream
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("id = ?", routeID)
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// GetRouteStreams 查询多个路线的 stream
+func (sr *StravaRepo) GetRouteStreams(ctx context.Context, routeIDs []int64, opt query.Opt) ([]*model.StravaRouteStream, error) {
+	var r []*model.StravaRouteStream
+	if len(routeIDs) == 0 {
+		return r, nil
+	}
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("id IN ?", routeIDs)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Find(&r).Error
+
+	return r, err
+}
+
+// GetActivityByIDs 查询用户的多个活动, 按开始时间倒序
+func (sr *StravaRepo) GetActivityByIDs(ctx context.Context, athleteID int64, ids []int64,
+	opt query.Opt) ([]*model.StravaActivityDetail, error) {
+	var r []*model.StravaActivityDetail
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("athlete_id = ? AND id IN ?", athleteID, ids)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("start_date_local DESC").Find(&r).Error
+
+	return r, err
+}
+
+// GetActivityWithPolyline 查询有轨迹的指定类型活动, 距离不小于 minDistance, 按开始时间倒序;
+// 活动较多时只查询匹配需要的字段, 如: id, summary_polyline
+func (sr *StravaRepo) GetActivityWithPolyline(ctx context.Context, athleteID int64, activityTypes []string,
+	minDistance float64, opt query.Opt) ([]*model.StravaActivityDetail, error) {
+	var r []*model.StravaActivityDetail
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).
+		Where("athlete_id = ? AND type IN ? AND distance >= ? AND summary_polyline <> ''",
+			athleteID, activityTypes, minDistance)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("start_date_local DESC").Find(&r).Error
+
+	return r, err
+}
+
+// UpsertClub 创建或者更新俱乐部, 不覆盖刷新时间
+func (sr *StravaRepo) UpsertClub(ctx context.Context, m *model.StravaClub) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"name", "sport_type", "city", "country", "private", "member_count", "profile_medium", "cover_photo", "url",
+			"updated_at",
+		}),
+	}).Create(m).Error
+
+	return err
+}
+
+func (sr *StravaRepo) GetClub(ctx context.Context, clubID int64, opt query.Opt) (*model.StravaClub, error) {
+	var r model.StravaClub
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("id = ?", clubID)
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// GetAthleteClubs 用户加入的俱乐部
+func (sr *StravaRepo) GetAthleteClubs(ctx context.Context, athleteID int64, opt query.Opt) ([]*model.StravaClub, error) {
+	var r []*model.StravaClub
+	db := trans.DB(ctx, sr.db.WithContext(ctx))
+	ids := db.Model(&model.StravaClubAthlete{}).Select("club_id").Where("athlete_id = ?", athleteID)
+	tx := db.Where("id IN (?)", ids)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("id").Find(&r).Error
+
+	return r, err
+}
+
+// GetClubsWithAthlete 至少有一个成员使用 iself 的俱乐部, 只有这些俱乐部需要刷新动态
+func (sr *StravaRepo) GetClubsWithAthlete(ctx context.Context, opt query.Opt) ([]*model.StravaClub, error) {
+	var r []*model.StravaClub
+	db := trans.DB(ctx, sr.db.WithContext(ctx))
+	ids := db.Model(&model.StravaClubAthlete{}).Distinct("club_id")
+	tx := db.Where("id IN (?)", ids)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Find(&r).Error
+
+	return r, err
+}
+
+// GetClubAthletes 俱乐部中使用 iself 的成员
+func (sr *StravaRepo) GetClubAthletes(ctx context.Context, clubID int64) ([]int64, error) {
+	var r []int64
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaClubAthlete{}).
+		Where("club_id = ?", clubID).Order("created_at").Pluck("athlete_id", &r).Error
+
+	return r, err
+}
+
+// ReplaceClubAthlete 覆盖用户加入的俱乐部, 不在 clubIDs 中的记录会被删除
+func (sr *StravaRepo) ReplaceClubAthlete(ctx context.Context, athleteID int64, clubIDs []int64) error {
+	db := trans.DB(ctx, sr.db.WithContext(ctx))
+	tx := db.Where("athlete_id = ?", athleteID)
+	if len(clubIDs) > 0 {
+		tx = tx.Where("club_id NOT IN ?", clubIDs)
+	}
+	if err := tx.Delete(&model.StravaClubAthlete{}).Error; err != nil {
+		return err
+	}
+	if len(clubIDs) == 0 {
+		return nil
+	}
+	list := make([]*model.StravaClubAthlete, 0, len(clubIDs))
+	for _, id := range clubIDs {
+		list = append(list, &model.StravaClubAthlete{ClubID: id, AthleteID: athleteID})
+	}
+
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(list).Error
+}
+
+func (sr *StravaRepo) UpdateClubRefreshedAt(ctx context.Context, clubID int64, refreshedAt time.Time) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaClub{})
+	r := tx.Where("id = ?", clubID).Update("refreshed_at", refreshedAt)
+
+	return r.RowsAffected, r.Error
+}
+
+// CreateClubActivities 保存俱乐部动态中的活动, 已经存在的活动忽略, 返回新增的数量
+func (sr *StravaRepo) CreateClubActivities(ctx context.Context, list []*model.StravaClubActivity) (int64, error) {
+	if len(list) == 0 {
+		return 0, nil
+	}
+	r := trans.DB(ctx, sr.db.WithContext(ctx)).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "club_id"}, {Name: "fingerprint"}},
+		DoNothing: true,
+	}).Create(list)
+
+	return r.RowsAffected, r.Error
+}
+
+// QueryClubActivity 分页查询俱乐部动态
+func (sr *StravaRepo) QueryClubActivity(ctx context.Context, clubID int64, params *model.StravaClubActivityQueryParam,
+	opt query.Opt) (*query.PagingResult, []*model.StravaClubActivity, error) {
+	var list []*model.StravaClubActivity
+	db := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaClubActivity{}).Where("club_id = ?", clubID)
+	if len(opt.Fields) > 0 {
+		db = db.Select(opt.Fields)
+	}
+	if params.SortBy != "" {
+		if sortBy := query.ParseOrder(params.SortBy, clubActivitySortFn); sortBy != "" {
+			db = db.Order(sortBy)
+		}
+	}
+
+	pr, err := query.WrapPageQuery(db, params.Param, &list)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pr, list, nil
+}
+
+// GetClubLeaderboard 统计 [start, end) 内第一次出现的活动, 按成员汇总, activityTypes 为空时不限类型
+func (sr *StravaRepo) GetClubLeaderboard(ctx context.Context, clubID int64, activityTypes []string,
+	start, end time.Time) ([]*model.StravaClubLeaderboard, error) {
+	var r []*model.StravaClubLeaderboard
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaClubActivity{}).
+		Select("athlete_name, count(*) AS count, sum(distance) AS distance, sum(moving_time) AS moving_time, "+
+			"sum(total_elevation_gain) AS elevation_gain").
+		Where("club_id = ? AND backfilled = ? AND first_seen_at >= ? AND first_seen_at < ?", clubID, false, start, end)
+	if len(activityTypes) > 0 {
+		tx = tx.Where("type IN ?", activityTypes)
+	}
+	err := tx.Group("athlete_name").Scan(&r).Error
+
+	return r, err
+}
+
+func (sr *StravaRepo) CreateArchive(ctx context.Context, m *model.StravaArchive) error {
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Create(m).Error
+
+	return err
+}
+
+// GetArchive athleteID 为 0 时不限制用户, 供 worker 和签名链接下载使用
+func (sr *StravaRepo) GetArchive(ctx context.Context, id, athleteID int64, opt query.Opt) (*model.StravaArchive, error) {
+	var r model.StravaArchive
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("id = ?", id)
+	if athleteID != 0 {
+		tx = tx.Where("athlete_id = ?", athleteID)
+	}
+	if err := query.Take(tx, opt, &r); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// GetArchiveByStatus 按状态查询导出记录, athleteID 为 0 时不限制用户
+func (sr *StravaRepo) GetArchiveByStatus(ctx context.Context, athleteID int64, status int,
+	opt query.Opt) ([]*model.StravaArchive, error) {
+	var r []*model.StravaArchive
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Where("status = ?", status)
+	if athleteID != 0 {
+		tx = tx.Where("athlete_id = ?", athleteID)
+	}
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Order("id").Find(&r).Error
+
+	return r, err
+}
+
+// CountArchives 用户在 since 之后创建的指定状态的导出数
+func (sr *StravaRepo) CountArchives(ctx context.Context, athleteID int64, status int, since time.Time) (int64, error) {
+	var n int64
+	err := trans.DB(ctx, sr.db.WithContext(ctx)).Model(&model.StravaArchive{}).
+		Where("athlete_id = ? AND status = ? AND created_at > ?", athleteID, status, since).Count(&n).Error
+
+	return n, err
+}
+
+// GetExpiredArchives 下载链接已经过期, 文件还没有删除的导出记录
+func (sr *StravaRepo) GetExpiredArchives(ctx context.Context, now time.Time, opt query.Opt) ([]*model.StravaArchive, error) {
+	var r []*model.StravaArchive
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).
+		Where("status = ? AND expires_at < ?", model.ArchiveReadyStatus, now)
+	if len(opt.Fields) > 0 {
+		tx = tx.Select(opt.Fields)
+	}
+	err := tx.Find(&r).Error
+
+	return r, err
+}
+
+func (sr *StravaRepo) UpdateArchive(ctx context.Context, id int64, params *model.StravaArchiveParam) (int64, error) {
+	tx := trans.DB(ctx, sr.db.WithContext(ctx)).Table((&model.StravaArchive{}).TableName())
+	r := tx.Where("id = ?", id).Updates(params)
+
+	return r.RowsAffected, r.Error
+}
+
+func activitySortFn(key string) string {
+	k := map[string]bool{
+		"id":               true,
+		"start_date_local": true,
+	}
+	if k[key] {
+		return key
+	}
+	return ""
+}
+
+func pushEventSortFn(key string) string {
+	k := map[string]bool{
+		"id":         true,
+		"event_time": true,
+	}
+	if k[key] {
+		return key
+	}
+	return ""
+}
+
+func segmentSortFn(key string) string {
+	k := map[string]bool{
+		"id":       true,
+		"name":     true,
+		"distance": true,
+	}
+	if k[key] {
+		return key
+	}
+	return ""
+}
+
+func uploadSortFn(key string) string {
+	k := map[string]bool{
+		"id":         true,
+		"created_at": true,
+	}
+	if k[key] {
+		return key
+	}
+	return ""
+}
+
+func routeSortFn(key string) string {
+	k := map[string]bool{
+		"id":               true,
+		"name":             true,
+		"distance":         true,
+		"route_created_at": true,
+	}
+	if k[key] {
 		return key
 	}
 	return ""
 }
+
+func clubActivitySortFn(key string) string {
+	k := map[string]bool{
+		"id":            true,
+		"first_seen_at": true,
+		"distance":      true,
+	}
+	if k[key] {
+		return key
+	}
+	return ""
+}
+
+// IsDuplicateKey 是否违反唯一约束, 如: 同一个文件并发导入
+func IsDuplicateKey(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
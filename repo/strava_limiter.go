@@ -0,0 +1,152 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+const (
+	limiterKey      = "strava:ratelimit"
+	shortWindow     = time.Minute * 15
+	dailyWindow     = time.Hour * 24
+	defaultShortCap = 100
+	defaultDailyCap = 1000
+)
+
+// limiterShare 每个优先级可以使用的额度比例, 低优先级的请求给推送等高优先级的请求留出余量
+var limiterShare = map[strava.Priority]float64{
+	strava.PriorityLow:    0.5,
+	strava.PriorityNormal: 0.8,
+	strava.PriorityHigh:   1,
+}
+
+// StravaLimiter 基于 redis 的 strava 请求额度, 所有进程共享
+// strava 的 15 分钟窗口从整点开始每 15 分钟重置, 每天的窗口在 UTC 零点重置
+type StravaLimiter struct {
+	cacher *Cacher
+	now    func() time.Time
+}
+
+func NewStravaLimiter(cacher *Cacher) *StravaLimiter {
+	return &StravaLimiter{
+		cacher: cacher,
+		now:    time.Now,
+	}
+}
+
+// Wait 预留一次请求的额度, 额度不足时等待到下一个窗口; ctx 的截止时间早于窗口重置时间时返回 ErrRateLimited
+func (l *StravaLimiter) Wait(ctx context.Context, p strava.Priority) error {
+	for {
+		wait, err := l.reserve(ctx, p)
+		if err != nil {
+			return err
+		}
+		if wait <= 0 {
+			return nil
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return strava.ErrRateLimited
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Update 使用 strava 返回的用量校准计数, 只会增加不会减少
+func (l *StravaLimiter) Update(ctx context.Context, rl *strava.RateLimit) error {
+	now := l.now()
+	if err := l.cacher.SetObject(ctx, limiterKey+":limit", rl, dailyWindow); err != nil {
+		return err
+	}
+	shortKey, shortReset := l.shortKey(now)
+	if err := l.sync(ctx, shortKey, rl.ShortUsage, shortReset.Sub(now)); err != nil {
+		return err
+	}
+	dailyKey, dailyReset := l.dailyKey(now)
+
+	return l.sync(ctx, dailyKey, rl.DailyUsage, dailyReset.Sub(now))
+}
+
+// reserve 返回 0 表示预留成功, 否则返回需要等待的时间
+func (l *StravaLimiter) reserve(ctx context.Context, p strava.Priority) (time.Duration, error) {
+	now := l.now()
+	limit, err := l.limit(ctx)
+	if err != nil {
+		return 0, err
+	}
+	share := limiterShare[p]
+	shortKey, shortReset := l.shortKey(now)
+	dailyKey, dailyReset := l.dailyKey(now)
+
+	short, err := l.cacher.IncrBy(ctx, shortKey, 1, shortReset.Sub(now))
+	if err != nil {
+		return 0, err
+	}
+	daily, err := l.cacher.IncrBy(ctx, dailyKey, 1, dailyReset.Sub(now))
+	if err != nil {
+		return 0, err
+	}
+	shortOK := float64(short) <= share*float64(limit.ShortLimit)
+	dailyOK := float64(daily) <= share*float64(limit.DailyLimit)
+	if shortOK && dailyOK {
+		return 0, nil
+	}
+
+	// 额度不足, 释放预留的额度
+	if _, err = l.cacher.IncrBy(ctx, shortKey, -1, 0); err != nil {
+		return 0, err
+	}
+	if _, err = l.cacher.IncrBy(ctx, dailyKey, -1, 0); err != nil {
+		return 0, err
+	}
+	if !dailyOK {
+		return dailyReset.Sub(now), nil
+	}
+	return shortReset.Sub(now), nil
+}
+
+func (l *StravaLimiter) limit(ctx context.Context) (*strava.RateLimit, error) {
+	var rl strava.RateLimit
+	err := l.cacher.GetObject(ctx, limiterKey+":limit", &rl)
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if rl.ShortLimit == 0 || rl.DailyLimit == 0 {
+		rl.ShortLimit, rl.DailyLimit = defaultShortCap, defaultDailyCap
+	}
+	return &rl, nil
+}
+
+// sync 其他应用(如: 本地开发)也会使用同一个额度, 以 strava 返回的用量为准
+func (l *StravaLimiter) sync(ctx context.Context, key string, usage int, ex time.Duration) error {
+	v, err := l.cacher.GetString(ctx, key)
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	cur, _ := strconv.Atoi(v)
+	if usage <= cur {
+		return nil
+	}
+	return l.cacher.Set(ctx, key, usage, ex)
+}
+
+func (l *StravaLimiter) shortKey(now time.Time) (string, time.Time) {
+	start := now.Truncate(shortWindow)
+	return fmt.Sprintf("%s:short:%d", limiterKey, start.Unix()), start.Add(shortWindow)
+}
+
+func (l *StravaLimiter) dailyKey(now time.Time) (string, time.Time) {
+	start := now.UTC().Truncate(dailyWindow)
+	return fmt.Sprintf("%s:daily:%d", limiterKey, start.Unix()), start.Add(dailyWindow)
+}
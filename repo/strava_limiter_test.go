@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+var mockLimiterNow = time.Date(2022, 11, 28, 10, 20, 0, 0, time.UTC)
+
+func TestStravaLimiter_Wait(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	shortKey := fmt.Sprintf("strava:ratelimit:short:%d", time.Date(2022, 11, 28, 10, 15, 0, 0, time.UTC).Unix())
+	dailyKey := fmt.Sprintf("strava:ratelimit:daily:%d", time.Date(2022, 11, 28, 0, 0, 0, 0, time.UTC).Unix())
+	mock.ExpectGet("strava:ratelimit:limit").RedisNil()
+	mock.ExpectIncrBy(shortKey, 1).SetVal(1)
+	mock.ExpectExpire(shortKey, time.Minute*10).SetVal(true)
+	mock.ExpectIncrBy(dailyKey, 1).SetVal(10)
+
+	l := NewStravaLimiter(NewCacher(rdb))
+	l.now = func() time.Time { return mockLimiterNow }
+
+	err := l.Wait(context.TODO(), strava.PriorityLow)
+
+	require.NoError(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStravaLimiter_WaitExhausted(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	shortKey := fmt.Sprintf("strava:ratelimit:short:%d", time.Date(2022, 11, 28, 10, 15, 0, 0, time.UTC).Unix())
+	dailyKey := fmt.Sprintf("strava:ratelimit:daily:%d", time.Date(2022, 11, 28, 0, 0, 0, 0, time.UTC).Unix())
+	limit, _ := json.Marshal(&strava.RateLimit{ShortLimit: 100, DailyLimit: 1000})
+	mock.ExpectGet("strava:ratelimit:limit").SetVal(string(limit))
+	mock.ExpectIncrBy(shortKey, 1).SetVal(51)
+	mock.ExpectIncrBy(dailyKey, 1).SetVal(100)
+	mock.ExpectIncrBy(shortKey, -1).SetVal(50)
+	mock.ExpectIncrBy(dailyKey, -1).SetVal(99)
+
+	l := NewStravaLimiter(NewCacher(rdb))
+	l.now = func() time.Time { return mockLimiterNow }
+
+	// 低优先级只能使用一半的额度, 窗口重置前 ctx 已经超时
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Minute)
+	defer cancel()
+	err := l.Wait(ctx, strava.PriorityLow)
+
+	require.ErrorIs(t, err, strava.ErrRateLimited)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,9 +2,12 @@ package repo
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgconn"
 	"github.com/stretchr/testify/require"
 
 	"github.com/happyxhw/pkg/mymock"
@@ -59,3 +62,248 @@ func TestStravaRepo_GetStream(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestStravaRepo_GetPushEvent(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	sql := `SELECT * FROM "strava_push_event" WHERE subscription_id = $1 AND object_type = $2 AND object_id = $3 AND aspect_type = $4 AND event_time = $5 LIMIT 1`
+	e := model.StravaPushEvent{
+		SubscriptionID: 120475,
+		ObjectType:     "activity",
+		ObjectID:       mockAct.ID,
+		AspectType:     "update",
+		EventTime:      1516126040,
+	}
+	mock.ExpectQuery(sql).
+		WithArgs(e.SubscriptionID, e.ObjectType, e.ObjectID, e.AspectType, e.EventTime).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "status"}).
+				AddRow(1, model.EventProcessedStatus),
+		)
+
+	repo := NewStravaRepo(gdb)
+
+	r, err := repo.GetPushEvent(context.TODO(), &e, query.Opt{})
+
+	require.NoError(t, err)
+	require.Equal(t, r.Status, int(model.EventProcessedStatus))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStravaRepo_CreatePushEvent(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	// 活动和用户的 id 可能相同, 冲突判断包含 object_type; 没有返回行表示重复推送
+	sql := `INSERT INTO "strava_push_event" ("subscription_id","aspect_type","event_time","object_id","object_type","owner_id","updates","status","attempts","last_error") ` +
+		`VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) ON CONFLICT ("subscription_id","object_type","object_id","event_time","aspect_type") DO NOTHING RETURNING "created_at","updated_at","id"`
+	e := model.StravaPushEvent{
+		SubscriptionID: 120475,
+		AspectType:     "update",
+		EventTime:      1516126040,
+		ObjectID:       mockAct.ID,
+		ObjectType:     "athlete",
+		OwnerID:        mockAct.ID,
+	}
+	mock.ExpectQuery(sql).
+		WithArgs(e.SubscriptionID, e.AspectType, e.EventTime, e.ObjectID, e.ObjectType, e.OwnerID, "", 0, 0, "").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at", "id"}))
+
+	repo := NewStravaRepo(gdb)
+
+	created, err := repo.CreatePushEvent(context.TODO(), &e)
+
+	require.NoError(t, err)
+	require.False(t, created)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStravaRepo_DeleteDetailedActivity(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	sql := `UPDATE "strava_activity_detail" SET "deleted_at"=$1 WHERE id = $2 AND "strava_activity_detail"."deleted_at" = $3`
+	mock.ExpectExec(sql).
+		WithArgs(sqlmock.AnyArg(), mockAct.ID, 0).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	repo := NewStravaRepo(gdb)
+
+	rows, err := repo.DeleteDetailedActivity(context.TODO(), mockAct.ID)
+
+	require.NoError(t, err)
+	require.Equal(t, rows, int64(1))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStravaRepo_UpsertActivityRaw(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	// 冲突时只更新 data, 已经删除的活动不会被恢复
+	sql := `INSERT INTO "strava_activity_raw" ("data","created_at","deleted_at","id") VALUES ($1,$2,$3,$4) ON CONFLICT ("id") DO UPDATE SET "data"="excluded"."data" RETURNING "id"`
+	mock.ExpectQuery(sql).
+		WithArgs("{}", sqlmock.AnyArg(), 0, mockAct.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(mockAct.ID))
+
+	repo := NewStravaRepo(gdb)
+
+	err := repo.UpsertActivityRaw(context.TODO(), &model.StravaActivityRaw{ID: mockAct.ID, Data: "{}"})
+
+	require.NoError(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStravaRepo_UpsertActivityZones(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	// 旧的区间软删除, 不使用 Unscoped 物理删除
+	sql := `UPDATE "strava_activity_zone" SET "deleted_at"=$1 WHERE activity_id = $2 AND "strava_activity_zone"."deleted_at" = $3`
+	mock.ExpectExec(sql).
+		WithArgs(sqlmock.AnyArg(), mockAct.ID, 0).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	repo := NewStravaRepo(gdb)
+
+	err := repo.UpsertActivityZones(context.TODO(), mockAct.ID, nil)
+
+	require.NoError(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStravaRepo_UpsertSegmentEfforts(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	mock.ExpectExec(`UPDATE "strava_segment_effort" SET "deleted_at"=$1 WHERE activity_id = $2 AND id NOT IN ($3) AND "strava_segment_effort"."deleted_at" = $4`).
+		WithArgs(sqlmock.AnyArg(), mockAct.ID, int64(10), 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 冲突时不更新 deleted_at, 已经删除的成绩不会被恢复
+	sql := `INSERT INTO "strava_segment_effort" ("segment_id","activity_id","athlete_id","name","elapsed_time","moving_time","distance","start_date_local","average_heartrate","max_heartrate","average_watts","device_watts","average_cadence","start_index","end_index","pr_rank","is_pr","hidden","created_at","updated_at","deleted_at","id") ` +
+		`VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22) ` +
+		`ON CONFLICT ("id") DO UPDATE SET "segment_id"="excluded"."segment_id","activity_id"="excluded"."activity_id","athlete_id"="excluded"."athlete_id","name"="excluded"."name","elapsed_time"="excluded"."elapsed_time","moving_time"="excluded"."moving_time","distance"="excluded"."distance","start_date_local"="excluded"."start_date_local","average_heartrate"="excluded"."average_heartrate","max_heartrate"="excluded"."max_heartrate","average_watts"="excluded"."average_watts","device_watts"="excluded"."device_watts","average_cadence"="excluded"."average_cadence","start_index"="excluded"."start_index","end_index"="excluded"."end_index","pr_rank"="excluded"."pr_rank","is_pr"="excluded"."is_pr","hidden"="excluded"."hidden","updated_at"="excluded"."updated_at" RETURNING "id"`
+	mock.ExpectQuery(sql).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+
+	repo := NewStravaRepo(gdb)
+
+	err := repo.UpsertSegmentEfforts(context.TODO(), mockAct.ID, []*model.StravaSegmentEffort{{ID: 10, ActivityID: mockAct.ID}})
+
+	require.NoError(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStravaRepo_IsActivityDeleted(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	sql := `SELECT count(*) FROM "strava_activity_detail" WHERE id = $1 AND deleted_at <> 0`
+	mock.ExpectQuery(sql).
+		WithArgs(mockAct.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	repo := NewStravaRepo(gdb)
+
+	deleted, err := repo.IsActivityDeleted(context.TODO(), mockAct.ID)
+
+	require.NoError(t, err)
+	require.True(t, deleted)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStravaRepo_ScanDetailedActivity(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	sql := `SELECT "id","source" FROM "strava_activity_detail" WHERE (athlete_id = $1 AND id > $2) AND "strava_activity_detail"."deleted_at" = $3 ORDER BY id LIMIT 2`
+	mock.ExpectQuery(sql).
+		WithArgs(mockUser.ID, int64(-5), 0).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "source"}).
+				AddRow(-3, 1).
+				AddRow(mockAct.ID, 0),
+		)
+
+	repo := NewStravaRepo(gdb)
+
+	list, err := repo.ScanDetailedActivity(context.TODO(), mockUser.ID, -5, 2, query.Fields("id", "source"))
+
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, list[0].ID, int64(-3))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStravaRepo_QueryPushEventOnlyCount(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	sql := `SELECT count(*) FROM "strava_push_event" WHERE status = $1 AND owner_id = $2 AND event_time >= $3`
+	status, ownerID := int(model.EventFailedStatus), int64(11)
+	mock.ExpectQuery(sql).
+		WithArgs(status, ownerID, int64(1669000000)).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"count(*)"}).
+				AddRow(3),
+		)
+	repo := NewStravaRepo(gdb)
+	params := model.StravaPushEventQueryParam{
+		Param: query.Param{
+			OnlyCount: true,
+		},
+		Status:  &status,
+		OwnerID: &ownerID,
+		Start:   1669000000,
+	}
+
+	pr, list, err := repo.QueryPushEvent(context.TODO(), &params, query.Opt{})
+
+	require.NoError(t, err)
+	require.Equal(t, pr.Total, int64(3))
+	require.Equal(t, len(list), 0)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestStravaRepo_GetGearStats(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	sql := `SELECT gear_id, sum(distance) AS distance, sum(moving_time) AS moving_time, count(*) AS count FROM "strava_activity_detail" WHERE (athlete_id = $1 AND gear_id IN ($2)) AND "strava_activity_detail"."deleted_at" = $3 GROUP BY "gear_id"`
+	mock.ExpectQuery(sql).
+		WithArgs(mockUser.ID, "g1", 0).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"gear_id", "distance", "moving_time", "count"}).
+				AddRow("g1", 42195.0, 12000, 3),
+		)
+
+	repo := NewStravaRepo(gdb)
+
+	stats, err := repo.GetGearStats(context.TODO(), mockUser.ID, []string{"g1"})
+
+	require.NoError(t, err)
+	require.Equal(t, stats["g1"].Count, 3)
+	require.Equal(t, stats["g1"].Distance, 42195.0)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIsDuplicateKey(t *testing.T) {
+	pgErr := &pgconn.PgError{Code: pgUniqueViolation}
+
+	require.True(t, IsDuplicateKey(pgErr))
+	require.True(t, IsDuplicateKey(fmt.Errorf("create: %w", pgErr)))
+	require.False(t, IsDuplicateKey(&pgconn.PgError{Code: "23503"}))
+	require.False(t, IsDuplicateKey(errors.New("duplicate key")))
+	require.False(t, IsDuplicateKey(nil))
+}
@@ -29,6 +29,14 @@ func (tr *TokenRepo) SaveToken(ctx context.Context, token *oauth2.Token, source
 	return tr.cacher.SetObject(ctx, key, token, 0)
 }
 
+// DeleteToken 删除 token, 如: 用户在 oauth2 来源撤销了授权
+func (tr *TokenRepo) DeleteToken(ctx context.Context, source string, sourceID int64) error {
+	key := fmt.Sprintf("oauth2:%s:%d", source, sourceID)
+	_, err := tr.cacher.Del(ctx, key)
+
+	return err
+}
+
 type Refresher func(context.Context, *oauth2.Token) (*oauth2.Token, error)
 
 func (tr *TokenRepo) GetToken(ctx context.Context, source string, sourceID int64, fn Refresher) (*oauth2.Token, error) {
@@ -59,3 +59,19 @@ func TestTokenRepo_GetToken(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestTokenRepo_DeleteToken(t *testing.T) {
+	rdb, mock := redismock.NewClientMock()
+	key := fmt.Sprintf("oauth2:%s:%d", mockUser.Source, mockUser.ID)
+	mock.ExpectDel(key).SetVal(1)
+
+	tr := NewTokenRepo(NewCacher(rdb))
+
+	err := tr.DeleteToken(context.TODO(), mockUser.Source, mockUser.ID)
+
+	require.NoError(t, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -32,9 +32,9 @@ func TestUser_Create(t *testing.T) {
 	gdb, mock, _ := mymock.MockEqualDB()
 	sql := `
 		INSERT INTO "user" 
-		("name","email","password","avatar_url","role","source","source_id","status","deleted_at","created_at","updated_at") 
+		("name","email","password","avatar_url","role","source","source_id","status","source_status","deleted_at","created_at","updated_at") 
 		VALUES 
-		($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) RETURNING "created_at","updated_at","id"
+		($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) RETURNING "created_at","updated_at","id"
 	`
 
 	user := model.User{
@@ -46,7 +46,7 @@ func TestUser_Create(t *testing.T) {
 		UpdatedAt: time.Now(),
 	}
 	mock.ExpectQuery(sql).
-		WithArgs(mockUser.Name, mockUser.Email, mockUser.Password, "", 0, "", 0, 0, 0, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(mockUser.Name, mockUser.Email, mockUser.Password, "", 0, "", 0, 0, 0, 0, sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"created_at", "updated_at", "id"}).
 				AddRow(time.Now(), time.Now(), 1),
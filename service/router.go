@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -22,7 +24,10 @@ import (
 
 // Serve start web serve
 func Serve() {
-	e := newRouter()
+	// 后台 worker 在 http 服务关闭后退出, 正在处理的任务被中断后由 worker 下次启动时恢复
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	e := newRouter(workerCtx, &wg)
 
 	s := &http.Server{
 		Addr:              viper.GetString("server.addr"),
@@ -39,16 +44,28 @@ func Serve() {
 	}()
 
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	if err := s.Shutdown(ctx); err != nil {
 		log.Error("shutting down the server", zap.Error(err))
 	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Error("shutting down the workers", zap.Error(ctx.Err()))
+	}
 }
 
-func newRouter() *echo.Echo {
+func newRouter(ctx context.Context, wg *sync.WaitGroup) *echo.Echo {
 	e := echo.New()
 	e.Debug = viper.GetBool("server.debug")
 	e.HTTPErrorHandler = ex.ErrHandler(e)
@@ -57,13 +74,13 @@ func newRouter() *echo.Echo {
 
 	initGlobalMiddleware(e)
 
-	initRouter(e)
+	initRouter(ctx, e, wg)
 
 	return e
 }
 
-func initRouter(e *echo.Echo) {
-	userRouter.InitRouter(e)
-	stravaRouter.InitRouter(e)
+func initRouter(ctx context.Context, e *echo.Echo, wg *sync.WaitGroup) {
+	stravaSrv := stravaRouter.InitRouter(ctx, e, wg)
+	userRouter.InitRouter(e, stravaSrv, stravaSrv)
 	weatherRouter.InitRouter(e)
 }
@@ -1,10 +1,12 @@
 package controller
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
 
 	"github.com/happyxhw/iself/model"
 	"github.com/happyxhw/iself/pkg/ex"
@@ -13,17 +15,19 @@ import (
 	"github.com/happyxhw/iself/service/strava/types"
 )
 
-const (
-	verifyToken = "4DpFAupeI7SGSgCCPCub" //nolint:gosec
-)
+// maxUploadSize strava 限制上传文件不超过 25MB
+const maxUploadSize = 25 << 20
 
 type Strava struct {
 	srv *handler.Strava
+
+	verifyToken string // 创建推送订阅时使用的 verify token
 }
 
 func NewStrava(srv *handler.Strava) *Strava {
 	return &Strava{
-		srv: srv,
+		srv:         srv,
+		verifyToken: viper.GetString("strava.verify_token"),
 	}
 }
 
@@ -41,17 +45,56 @@ func (s *Strava) GetActivity(c echo.Context) error {
 	return ex.OK(c, result)
 }
 
+// UpdateActivity 修改活动并写回 strava
+func (s *Strava) UpdateActivity(c echo.Context) error {
+	var req types.UpdateActivityReq
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.ID == 0 {
+		return ex.ErrParam.Msg("wrong activity id")
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.UpdateActivity(ex.NewTraceCtx(c), uc.SourceID, &req)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// CompareLaps 与圈结构相同的活动逐圈对比
+func (s *Strava) CompareLaps(c echo.Context) error {
+	activityID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	if activityID == 0 {
+		return ex.ErrParam.Msg("wrong activity id")
+	}
+	var req types.LapCompareReq
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.CompareLaps(ex.NewTraceCtx(c), activityID, uc.SourceID, &req)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
 func (s *Strava) ListActivity(c echo.Context) error {
 	var req types.ActivityQueryParam
 	if err := ex.Bind(c, &req); err != nil {
 		return err
 	}
 	if req.SortBy == "" {
+		// 导入的活动 id 为负数, 按 id 排序时排在最后, 需要按时间排列时传 sort_by=-start_date_local
 		req.SortBy = "-id"
 	}
 	param := model.StravaActivityParam{
-		Param: req.Param,
-		Type:  req.ActivityType,
+		Param:  req.Param,
+		Type:   req.ActivityType,
+		Source: req.Source,
 	}
 	uc := ex.GetUser(c)
 	results, err := s.srv.ListActivity(ex.NewTraceCtx(c), uc.SourceID, &param)
@@ -90,6 +133,193 @@ func (s *Strava) GetAggStats(c echo.Context) error {
 	return ex.OK(c, result)
 }
 
+// GetZoneStats 以日期为横轴的心率、功率区间时间
+func (s *Strava) GetZoneStats(c echo.Context) error {
+	var req types.ZoneStatsReq
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.GetZoneStats(ex.NewTraceCtx(c), uc.SourceID, &req)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// ExportActivity 导出活动 gpx, tcx
+func (s *Strava) ExportActivity(c echo.Context) error {
+	var req types.ExportActivityReq
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.ID == 0 {
+		return ex.ErrParam.Msg("wrong activity id")
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.ExportActivity(ex.NewTraceCtx(c), uc.SourceID, &req)
+	if err != nil {
+		return err
+	}
+
+	return attachment(c, result)
+}
+
+// GetSocialStats 每月收到的点赞、评论和评论最多的活动
+func (s *Strava) GetSocialStats(c echo.Context) error {
+	var req types.SocialStatsReq
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.GetSocialStats(ex.NewTraceCtx(c), uc.SourceID, &req)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// GetAthleteZones 用户的心率、功率区间设置
+func (s *Strava) GetAthleteZones(c echo.Context) error {
+	uc := ex.GetUser(c)
+	result, err := s.srv.GetAthleteZones(ex.NewTraceCtx(c), uc.SourceID)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// SyncAthleteZones 从 strava 重新同步用户的区间设置
+func (s *Strava) SyncAthleteZones(c echo.Context) error {
+	uc := ex.GetUser(c)
+	result, err := s.srv.SyncAthleteZones(ex.NewTraceCtx(c), uc.SourceID)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// GetAthlete 用户的 strava 资料: ftp, 体重, 装备, strava 统计的累计数据
+func (s *Strava) GetAthlete(c echo.Context) error {
+	uc := ex.GetUser(c)
+	result, err := s.srv.GetAthlete(ex.NewTraceCtx(c), uc.SourceID)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// SyncAthlete 从 strava 重新同步用户资料
+func (s *Strava) SyncAthlete(c echo.Context) error {
+	uc := ex.GetUser(c)
+	ctx := ex.NewTraceCtx(c)
+	if err := s.srv.SyncAthlete(ctx, uc.SourceID); err != nil {
+		return err
+	}
+	result, err := s.srv.GetAthlete(ctx, uc.SourceID)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// ReconcileAthlete 对比 strava 统计的累计数据与已导入的活动
+func (s *Strava) ReconcileAthlete(c echo.Context) error {
+	uc := ex.GetUser(c)
+	result, err := s.srv.ReconcileAthlete(ex.NewTraceCtx(c), uc.SourceID)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// ListGear 装备及累计里程
+func (s *Strava) ListGear(c echo.Context) error {
+	uc := ex.GetUser(c)
+	result, err := s.srv.ListGear(ex.NewTraceCtx(c), uc.SourceID)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, echo.Map{"data": result})
+}
+
+func (s *Strava) GetGear(c echo.Context) error {
+	gearID := c.Param("id")
+	if gearID == "" {
+		return ex.ErrParam.Msg("wrong gear id")
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.GetGear(ex.NewTraceCtx(c), uc.SourceID, gearID)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// UpdateGear 设置装备报废提醒
+func (s *Strava) UpdateGear(c echo.Context) error {
+	var req types.UpdateGearReq
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.ID == "" {
+		return ex.ErrParam.Msg("wrong gear id")
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.UpdateGear(ex.NewTraceCtx(c), uc.SourceID, &req)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// ListSegment 用户有成绩的路段
+func (s *Strava) ListSegment(c echo.Context) error {
+	var req types.SegmentQueryParam
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.SortBy == "" {
+		req.SortBy = "id"
+	}
+	param := model.StravaSegmentParam{
+		Param:        req.Param,
+		ActivityType: req.ActivityType,
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.ListSegment(ex.NewTraceCtx(c), uc.SourceID, &param)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// GetSegmentEfforts 用户在路段上的所有成绩
+func (s *Strava) GetSegmentEfforts(c echo.Context) error {
+	segmentID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	if segmentID == 0 {
+		return ex.ErrParam.Msg("wrong segment id")
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.GetSegmentEfforts(ex.NewTraceCtx(c), uc.SourceID, segmentID)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
 func (s *Strava) CreateGoal(c echo.Context) error {
 	var req types.CreateGoalReq
 	if err := ex.Bind(c, &req); err != nil {
@@ -142,6 +372,321 @@ func (s *Strava) DeleteGoal(c echo.Context) error {
 	return ex.OK(c, nil)
 }
 
+// StartBackfill 开始导入 strava 历史活动
+func (s *Strava) StartBackfill(c echo.Context) error {
+	uc := ex.GetUser(c)
+	err := s.srv.StartBackfill(ex.NewTraceCtx(c), uc.SourceID)
+	if err != nil {
+		return err
+	}
+	return ex.OK(c, nil)
+}
+
+// GetBackfill 查询 strava 历史活动导入进度
+func (s *Strava) GetBackfill(c echo.Context) error {
+	uc := ex.GetUser(c)
+	result, err := s.srv.GetBackfill(ex.NewTraceCtx(c), uc.SourceID)
+	if err != nil {
+		return err
+	}
+	return ex.OK(c, result)
+}
+
+// CreateUpload 上传 fit, tcx, gpx 文件到 strava
+func (s *Strava) CreateUpload(c echo.Context) error {
+	var req types.CreateUploadReq
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return ex.ErrParam.Msg("file required")
+	}
+	if fh.Size > maxUploadSize {
+		return ex.ErrParam.Msg("file too large")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return ex.ErrParam.Wrap(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	uc := ex.GetUser(c)
+	result, err := s.srv.CreateUpload(ex.NewTraceCtx(c), uc.SourceID, &req, fh.Filename, f)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// ImportActivity 本地导入 fit, gpx, tcx 文件, 不上传到 strava
+func (s *Strava) ImportActivity(c echo.Context) error {
+	var req types.ImportActivityReq
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return ex.ErrParam.Msg("file required")
+	}
+	if fh.Size > maxUploadSize {
+		return ex.ErrParam.Msg("file too large")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return ex.ErrParam.Wrap(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	uc := ex.GetUser(c)
+	result, err := s.srv.ImportActivity(ex.NewTraceCtx(c), uc.SourceID, &req, fh.Filename, f)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// ListUpload 上传记录
+func (s *Strava) ListUpload(c echo.Context) error {
+	var req types.UploadQueryParam
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.SortBy == "" {
+		req.SortBy = "-id"
+	}
+	param := model.StravaUploadQueryParam{
+		Param:  req.Param,
+		Status: req.Status,
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.ListUpload(ex.NewTraceCtx(c), uc.SourceID, &param)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// GetUpload 上传进度
+func (s *Strava) GetUpload(c echo.Context) error {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	if id == 0 {
+		return ex.ErrParam.Msg("wrong upload id")
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.GetUpload(ex.NewTraceCtx(c), uc.SourceID, id)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// CreateArchive 导出个人数据, 生成后通过邮件发送下载链接
+func (s *Strava) CreateArchive(c echo.Context) error {
+	uc := ex.GetUser(c)
+	result, err := s.srv.CreateArchive(ex.NewTraceCtx(c), uc.SourceID)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// GetArchive 个人数据导出进度
+func (s *Strava) GetArchive(c echo.Context) error {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	if id == 0 {
+		return ex.ErrParam.Msg("wrong archive id")
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.GetArchive(ex.NewTraceCtx(c), uc.SourceID, id)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// DownloadArchive 通过签名链接下载个人数据
+func (s *Strava) DownloadArchive(c echo.Context) error {
+	var req types.DownloadArchiveReq
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	result, err := s.srv.DownloadArchive(ex.NewTraceCtx(c), &req)
+	if err != nil {
+		return err
+	}
+
+	return c.Attachment(result.Path, result.Name)
+}
+
+// SyncClubs 从 strava 同步加入的俱乐部
+func (s *Strava) SyncClubs(c echo.Context) error {
+	uc := ex.GetUser(c)
+	result, err := s.srv.SyncClubs(ex.NewTraceCtx(c), uc.SourceID)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, echo.Map{"data": result})
+}
+
+// ListClub 加入的俱乐部
+func (s *Strava) ListClub(c echo.Context) error {
+	uc := ex.GetUser(c)
+	result, err := s.srv.ListClub(ex.NewTraceCtx(c), uc.SourceID)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, echo.Map{"data": result})
+}
+
+func (s *Strava) GetClub(c echo.Context) error {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	if id == 0 {
+		return ex.ErrParam.Msg("wrong club id")
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.GetClub(ex.NewTraceCtx(c), uc.SourceID, id)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// ListClubActivity 俱乐部动态
+func (s *Strava) ListClubActivity(c echo.Context) error {
+	var req types.ClubActivityQueryParam
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.ID == 0 {
+		return ex.ErrParam.Msg("wrong club id")
+	}
+	if req.SortBy == "" {
+		req.SortBy = "-id"
+	}
+	param := model.StravaClubActivityQueryParam{
+		Param: req.Param,
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.ListClubActivity(ex.NewTraceCtx(c), uc.SourceID, req.ID, &param)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// GetClubLeaderboard 俱乐部每周距离, 时间排行榜
+func (s *Strava) GetClubLeaderboard(c echo.Context) error {
+	var req types.ClubLeaderboardReq
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.ID == 0 {
+		return ex.ErrParam.Msg("wrong club id")
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.GetClubLeaderboard(ex.NewTraceCtx(c), uc.SourceID, &req)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// SyncRoutes 从 strava 同步路线
+func (s *Strava) SyncRoutes(c echo.Context) error {
+	uc := ex.GetUser(c)
+	result, err := s.srv.SyncRoutes(ex.NewTraceCtx(c), uc.SourceID)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// ListRoute 路线列表
+func (s *Strava) ListRoute(c echo.Context) error {
+	var req types.RouteQueryParam
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.SortBy == "" {
+		req.SortBy = "-route_created_at"
+	}
+	param := model.StravaRouteQueryParam{
+		Param:   req.Param,
+		Type:    req.Type,
+		Starred: req.Starred,
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.ListRoute(ex.NewTraceCtx(c), uc.SourceID, &param)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+func (s *Strava) GetRoute(c echo.Context) error {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	if id == 0 {
+		return ex.ErrParam.Msg("wrong route id")
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.GetRoute(ex.NewTraceCtx(c), uc.SourceID, id)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// ExportRoute 下载路线的 gpx 或者 tcx 文件
+func (s *Strava) ExportRoute(c echo.Context) error {
+	var req types.ExportRouteReq
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.ID == 0 {
+		return ex.ErrParam.Msg("wrong route id")
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.ExportRoute(ex.NewTraceCtx(c), uc.SourceID, &req)
+	if err != nil {
+		return err
+	}
+
+	return attachment(c, result)
+}
+
+// RouteActivities 完成过路线的活动
+func (s *Strava) RouteActivities(c echo.Context) error {
+	var req types.RouteActivitiesReq
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.ID == 0 {
+		return ex.ErrParam.Msg("wrong route id")
+	}
+	uc := ex.GetUser(c)
+	result, err := s.srv.RouteActivities(ex.NewTraceCtx(c), uc.SourceID, &req)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
 // Push Strava push event
 func (s *Strava) Push(c echo.Context) error {
 	var req strava.SubscriptionEvent
@@ -163,7 +708,7 @@ func (s *Strava) VerifyPush(c echo.Context) error {
 	if mode != "subscribe" || challenge == "" {
 		return ex.ErrBadRequest
 	}
-	if token != verifyToken {
+	if s.verifyToken == "" || token != s.verifyToken {
 		return ex.ErrBadRequest.Msg("verify token")
 	}
 
@@ -172,3 +717,58 @@ func (s *Strava) VerifyPush(c echo.Context) error {
 		"hub.challenge": challenge,
 	})
 }
+
+// ListPushEvent 管理员查询推送记录
+func (s *Strava) ListPushEvent(c echo.Context) error {
+	var req types.PushEventQueryParam
+	if err := ex.Bind(c, &req); err != nil {
+		return err
+	}
+	if req.SortBy == "" {
+		req.SortBy = "-id"
+	}
+	param := model.StravaPushEventQueryParam{
+		Param:      req.Param,
+		Status:     req.Status,
+		OwnerID:    req.OwnerID,
+		ObjectType: req.ObjectType,
+		Start:      req.Start,
+		End:        req.End,
+	}
+	result, err := s.srv.ListPushEvent(ex.NewTraceCtx(c), &param)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// ReplayPushEvent 管理员重新处理一个推送事件
+func (s *Strava) ReplayPushEvent(c echo.Context) error {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	if id == 0 {
+		return ex.ErrParam.Msg("wrong push event id")
+	}
+	result, err := s.srv.ReplayPushEvent(ex.NewTraceCtx(c), id)
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// ReplayFailedPushEvent 管理员重新处理所有失败的推送事件
+func (s *Strava) ReplayFailedPushEvent(c echo.Context) error {
+	result, err := s.srv.ReplayFailedPushEvent(ex.NewTraceCtx(c))
+	if err != nil {
+		return err
+	}
+
+	return ex.OK(c, result)
+}
+
+// attachment 以附件的形式返回文件
+func attachment(c echo.Context, f *types.File) error {
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", f.Name))
+	return c.Blob(http.StatusOK, f.ContentType, f.Data)
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// UpdateActivity 修改活动并写回 strava, 成功后直接使用 strava 返回的活动更新本地数据,
+// strava 随后推送的 update 事件会重新拉取活动, 更新装备、区间等关联数据; 本地导入的活动只修改本地数据, 不会写回 strava
+func (s *Strava) UpdateActivity(ctx context.Context, athleteID int64, req *types.UpdateActivityReq) (*types.DetailedActivity, error) {
+	data := newUpdatableActivity(req)
+	if data == nil {
+		return nil, ex.ErrParam.Msg("nothing to update")
+	}
+	detailed, err := s.sr.GetDetailedActivity(ctx, req.ID, athleteID, query.Fields("id", "source", "external_id"))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if detailed == nil {
+		return nil, ex.ErrNotFound.Msg("activity not found")
+	}
+	if isStravaActivity(detailed) {
+		err = s.updateStravaActivity(ctx, athleteID, req.ID, data)
+	} else {
+		_, err = s.sr.UpdateDetailedActivity(ctx, req.ID, localActivityParams(data, time.Now()))
+		if err != nil {
+			err = ex.ErrDB.Wrap(err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	detailed, err = s.sr.GetDetailedActivity(ctx, req.ID, athleteID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if detailed == nil {
+		return nil, ex.ErrNotFound.Msg("activity not found")
+	}
+
+	return types.NewDetailedActivity(detailed), nil
+}
+
+// isStravaActivity 是否为 strava 同步的活动, 本地导入的活动 id 为负数并且有 external_id
+func isStravaActivity(e *model.StravaActivityDetail) bool {
+	return e.Source == int(model.ActivityStravaSource) && e.ID > 0 && e.ExternalID == ""
+}
+
+// updateStravaActivity 写回 strava, 并用 strava 返回的活动更新原始数据和详情
+func (s *Strava) updateStravaActivity(ctx context.Context, athleteID, activityID int64, data *strava.UpdatableActivity) error {
+	stravaCli, err := s.stravaClient(ctx, athleteID)
+	if err != nil {
+		return err
+	}
+	activityData, body, err := stravaCli.Activity.UpdateActivity(ctx, activityID, data)
+	if err != nil {
+		return stravaErr(err)
+	}
+
+	activityRawData := model.StravaActivityRaw{
+		ID:   activityID,
+		Data: string(body),
+	}
+	params := updatedActivityParams(activityData, time.Now())
+	err = s.transRepo.Exec(ctx, func(ctx context.Context) error {
+		if txErr := s.sr.UpsertActivityRaw(ctx, &activityRawData); txErr != nil {
+			return txErr
+		}
+		_, txErr := s.sr.UpdateDetailedActivity(ctx, activityID, params)
+		return txErr
+	})
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+
+	return nil
+}
+
+// newUpdatableActivity 没有需要修改的字段时返回 nil
+func newUpdatableActivity(req *types.UpdateActivityReq) *strava.UpdatableActivity {
+	if req.Name == nil && req.Type == nil && req.Description == nil && req.GearID == nil &&
+		req.Commute == nil && req.Trainer == nil {
+		return nil
+	}
+	return &strava.UpdatableActivity{
+		Commute:     req.Commute,
+		Trainer:     req.Trainer,
+		Description: req.Description,
+		Name:        req.Name,
+		Type:        req.Type,
+		GearId:      req.GearID,
+	}
+}
+
+// updatedActivityParams 以 strava 返回的活动为准, 更新可以修改的字段
+func updatedActivityParams(activityData *strava.DetailedActivity, now time.Time) *model.StravaActivityParam {
+	return &model.StravaActivityParam{
+		Name:        &activityData.Name,
+		Type:        &activityData.Type,
+		Private:     &activityData.Private,
+		Description: &activityData.Description,
+		GearID:      &activityData.GearId,
+		Commute:     &activityData.Commute,
+		Trainer:     &activityData.Trainer,
+		UpdatedAt:   &now,
+	}
+}
+
+// localActivityParams 本地导入的活动只修改请求中的字段, gear_id 为 none 时清除装备
+func localActivityParams(data *strava.UpdatableActivity, now time.Time) *model.StravaActivityParam {
+	params := model.StravaActivityParam{
+		Name:        data.Name,
+		Type:        data.Type,
+		Description: data.Description,
+		GearID:      data.GearId,
+		Commute:     data.Commute,
+		Trainer:     data.Trainer,
+		UpdatedAt:   &now,
+	}
+	if params.GearID != nil && *params.GearID == "none" {
+		params.GearID = new(string)
+	}
+
+	return &params
+}
+
+// staleActivityUpdates 推送事件早于本地最后一次写入, 推送中的 updates 可能会覆盖之后的修改,
+// 如: 连续两次修改活动名称, 第一次修改的推送晚于第二次修改到达
+func staleActivityUpdates(eventTime int64, updatedAt time.Time) bool {
+	return time.Unix(eventTime, 0).Before(updatedAt)
+}
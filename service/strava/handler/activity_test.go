@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+func TestNewUpdatableActivity(t *testing.T) {
+	require.Nil(t, newUpdatableActivity(&types.UpdateActivityReq{ID: 1}))
+
+	trainer := false
+	data := newUpdatableActivity(&types.UpdateActivityReq{ID: 1, Trainer: &trainer})
+	require.NotNil(t, data.Trainer)
+	require.False(t, *data.Trainer)
+	require.Nil(t, data.Name)
+}
+
+func TestUpdatedActivityParams(t *testing.T) {
+	now := time.Now()
+	activityData := strava.DetailedActivity{Name: "Commute", Type: "Ride", Commute: true}
+
+	params := updatedActivityParams(&activityData, now)
+
+	require.Equal(t, *params.Name, "Commute")
+	require.Equal(t, *params.Type, "Ride")
+	require.True(t, *params.Commute)
+	require.False(t, *params.Trainer)
+	require.Equal(t, *params.GearID, "")
+	require.Equal(t, *params.UpdatedAt, now)
+}
+
+func TestLocalActivityParams(t *testing.T) {
+	now := time.Now()
+	name, gearID := "Evening Run", "none"
+
+	params := localActivityParams(&strava.UpdatableActivity{Name: &name, GearId: &gearID}, now)
+
+	require.Equal(t, *params.Name, "Evening Run")
+	require.Equal(t, *params.GearID, "")
+	require.Nil(t, params.Type)
+	require.Nil(t, params.Trainer)
+	require.Equal(t, *params.UpdatedAt, now)
+}
+
+func TestStaleActivityUpdates(t *testing.T) {
+	updatedAt := time.Unix(1669000000, 0)
+
+	require.True(t, staleActivityUpdates(updatedAt.Unix()-1, updatedAt))
+	require.False(t, staleActivityUpdates(updatedAt.Unix(), updatedAt))
+	require.False(t, staleActivityUpdates(updatedAt.Unix()+60, updatedAt))
+}
+
+func TestIsStravaActivity(t *testing.T) {
+	require.True(t, isStravaActivity(&model.StravaActivityDetail{ID: 1, Source: int(model.ActivityStravaSource)}))
+	// 本地导入的活动不会写回 strava
+	require.False(t, isStravaActivity(&model.StravaActivityDetail{ID: -1, Source: int(model.ActivityStravaSource)}))
+	require.False(t, isStravaActivity(&model.StravaActivityDetail{ID: 1, Source: int(model.ActivityStravaSource),
+		ExternalID: "da39a3ee5e6b4b0d3255bfef95601890afd80709"}))
+	require.False(t, isStravaActivity(&model.StravaActivityDetail{ID: -1, Source: int(model.ActivityFITSource)}))
+}
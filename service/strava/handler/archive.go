@@ -0,0 +1,489 @@
+package handler
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/happyxhw/pkg/log"
+	"github.com/happyxhw/pkg/query"
+	"github.com/happyxhw/pkg/util"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/oauth2x"
+	"github.com/happyxhw/iself/pkg/track"
+	"github.com/happyxhw/iself/repo"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// CreateArchive 开始导出用户的个人数据, 已经有生成中的导出时直接返回, 生成后通过邮件发送下载链接;
+// 限制每个用户生成的频率, 避免未过期的导出文件占用过多磁盘
+func (s *Strava) CreateArchive(ctx context.Context, athleteID int64) (*types.Archive, error) {
+	pending, err := s.pendingArchive(ctx, athleteID)
+	if err != nil || pending != nil {
+		return pending, err
+	}
+	n, err := s.sr.CountArchives(ctx, athleteID, int(model.ArchiveReadyStatus), time.Now().Add(-archiveCreateInterval))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if n > 0 {
+		return nil, ex.ErrReachLimit.Msg("archive already created recently, use the existing download link")
+	}
+	a := model.StravaArchive{
+		AthleteID: athleteID,
+		Status:    int(model.ArchivePendingStatus),
+	}
+	if err = s.sr.CreateArchive(ctx, &a); err != nil {
+		// 并发请求, 唯一索引保证只有一个生成中的导出
+		if repo.IsDuplicateKey(err) {
+			pending, err = s.pendingArchive(ctx, athleteID)
+			if err != nil || pending != nil {
+				return pending, err
+			}
+			return nil, ex.ErrConflict.Msg("archive is being created")
+		}
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if err = s.archiveQueue.Push(ctx, a.ID, time.Now()); err != nil {
+		return nil, ex.ErrRedis.Wrap(err)
+	}
+
+	return types.NewArchive(&a), nil
+}
+
+// pendingArchive 用户生成中的导出, 没有时返回 nil
+func (s *Strava) pendingArchive(ctx context.Context, athleteID int64) (*types.Archive, error) {
+	pending, err := s.sr.GetArchiveByStatus(ctx, athleteID, int(model.ArchivePendingStatus), query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	return types.NewArchive(pending[0]), nil
+}
+
+// GetArchive 查询导出进度, 已生成且未过期时返回签名的下载链接
+func (s *Strava) GetArchive(ctx context.Context, athleteID, id int64) (*types.Archive, error) {
+	a, err := s.sr.GetArchive(ctx, id, athleteID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if a == nil {
+		return nil, ex.ErrNotFound.Msg("archive not found")
+	}
+	r := types.NewArchive(a)
+	if a.Status == int(model.ArchiveReadyStatus) && a.ExpiresAt != nil && a.ExpiresAt.After(time.Now()) {
+		r.URL = archiveURL(s.cfg.ArchiveURL, []byte(s.cfg.ArchiveSignKey), a.ID, a.ExpiresAt.Unix())
+	}
+
+	return r, nil
+}
+
+// DownloadArchive 校验链接的签名和有效期, 返回导出文件; 链接在邮件中, 不需要登录
+func (s *Strava) DownloadArchive(ctx context.Context, req *types.DownloadArchiveReq) (*types.ArchiveFile, error) {
+	if !verifyArchiveURL([]byte(s.cfg.ArchiveSignKey), req.ID, req.Expires, req.Signature) {
+		return nil, ex.ErrForbidden.Msg("invalid signature")
+	}
+	if time.Unix(req.Expires, 0).Before(time.Now()) {
+		return nil, ex.ErrForbidden.Msg("link expired")
+	}
+	a, err := s.sr.GetArchive(ctx, req.ID, 0, query.Fields("id", "status", "path", "created_at"))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if a == nil || a.Status != int(model.ArchiveReadyStatus) {
+		return nil, ex.ErrNotFound.Msg("archive not found")
+	}
+	// 文件可能已经被手动清理或者导出目录变更
+	if _, err = os.Stat(a.Path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ex.ErrNotFound.Msg("archive file not found")
+		}
+		return nil, ex.ErrInternal.Wrap(err)
+	}
+
+	return &types.ArchiveFile{
+		Name: fmt.Sprintf("iself_%s.zip", a.CreatedAt.Format("20060102")),
+		Path: a.Path,
+	}, nil
+}
+
+// RunArchiveWorker 生成个人数据导出文件, 并定期删除过期的文件, 阻塞直到 ctx 结束
+func (s *Strava) RunArchiveWorker(ctx context.Context) {
+	pending, err := s.sr.GetArchiveByStatus(ctx, 0, int(model.ArchivePendingStatus), query.Fields("id"))
+	if err != nil {
+		log.Error("recover strava archive", zap.Error(err))
+	}
+	for _, item := range pending {
+		s.requeueArchive(ctx, item.ID, 0)
+	}
+	s.cleanArchives(ctx)
+
+	ticker := time.NewTicker(pushPollInterval)
+	defer ticker.Stop()
+	cleanTicker := time.NewTicker(archiveCleanInterval)
+	defer cleanTicker.Stop()
+	for ctx.Err() == nil {
+		id, popErr := s.archiveQueue.Pop(ctx, time.Now())
+		if popErr != nil {
+			log.Error("pop strava archive", zap.Error(popErr))
+		}
+		if id != 0 {
+			s.buildArchive(ctx, id)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		case <-cleanTicker.C:
+			s.cleanArchives(ctx)
+		}
+	}
+}
+
+// buildArchive 生成一个导出文件, 成功后发送下载链接邮件, 失败后按指数退避重试
+func (s *Strava) buildArchive(ctx context.Context, id int64) {
+	a, err := s.sr.GetArchive(ctx, id, 0, query.Opt{})
+	if err != nil {
+		log.Error("get strava archive", zap.Int64("id", id), zap.Error(err))
+		s.requeueArchive(ctx, id, s.cfg.PushBackoff)
+		return
+	}
+	if a == nil || a.Status != int(model.ArchivePendingStatus) {
+		return
+	}
+
+	a.Attempts++
+	params := model.StravaArchiveParam{Attempts: util.Int(a.Attempts)}
+	path, size, count, err := s.writeArchiveFile(ctx, a)
+	expiresAt := time.Now().Add(s.cfg.ArchiveExpire)
+	switch {
+	case err == nil:
+		params.Status = util.Int(int(model.ArchiveReadyStatus))
+		params.Path = &path
+		params.Size = &size
+		params.Activities = &count
+		params.LastError = util.String("")
+		params.ExpiresAt = &expiresAt
+	case a.Attempts >= maxArchiveAttempts || !retryable(err):
+		log.Error("strava archive failed", zap.Int64("id", id), zap.Error(err))
+		params.Status = util.Int(int(model.ArchiveFailedStatus))
+		params.LastError = util.String(err.Error())
+	default:
+		log.Info("strava archive retrying", zap.Int64("id", id), zap.Int("attempts", a.Attempts), zap.Error(err))
+		params.LastError = util.String(err.Error())
+	}
+	if _, dbErr := s.sr.UpdateArchive(ctx, id, &params); dbErr != nil {
+		log.Error("update strava archive", zap.Int64("id", id), zap.Error(dbErr))
+		s.requeueArchive(ctx, id, s.cfg.PushBackoff)
+		return
+	}
+	if params.Status == nil {
+		s.requeueArchive(ctx, id, pushBackoff(s.cfg.PushBackoff, a.Attempts))
+		return
+	}
+	if err == nil {
+		// 邮件发送失败时用户仍然可以通过导出进度获取下载链接
+		if mailErr := s.sendArchiveEmail(ctx, a.AthleteID, id, expiresAt); mailErr != nil {
+			log.Error("send strava archive email", zap.Int64("id", id), zap.Error(mailErr))
+		}
+	}
+}
+
+// writeArchiveFile 先写入临时文件, 完成后重命名, 返回文件路径, 大小和导出的活动数
+func (s *Strava) writeArchiveFile(ctx context.Context, a *model.StravaArchive) (string, int64, int, error) {
+	if err := os.MkdirAll(s.cfg.ArchiveDir, 0o700); err != nil {
+		return "", 0, 0, ex.ErrInternal.Wrap(err)
+	}
+	f, err := os.CreateTemp(s.cfg.ArchiveDir, fmt.Sprintf("%d-*.zip.tmp", a.ID))
+	if err != nil {
+		return "", 0, 0, ex.ErrInternal.Wrap(err)
+	}
+	count, err := s.writeArchive(ctx, a.AthleteID, f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = ex.ErrInternal.Wrap(closeErr)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", 0, 0, err
+	}
+
+	path := filepath.Join(s.cfg.ArchiveDir, fmt.Sprintf("%d.zip", a.ID))
+	if err = os.Rename(f.Name(), path); err != nil {
+		_ = os.Remove(f.Name())
+		return "", 0, 0, ex.ErrInternal.Wrap(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, 0, ex.ErrInternal.Wrap(err)
+	}
+
+	return path, info.Size(), count, nil
+}
+
+// writeArchive 写入 zip 文件: profile.json, goals.json, push_events.jsonl,
+// 每个活动的 activities/{id}.json 和 activities/{id}.gpx, strava 活动的原始数据 raw/{id}.json;
+// 活动和推送记录分批读取, 逐个写入, 不会一次加载到内存
+func (s *Strava) writeArchive(ctx context.Context, athleteID int64, w io.Writer) (int, error) {
+	zw := zip.NewWriter(w)
+	if err := s.writeArchiveProfile(ctx, zw, athleteID); err != nil {
+		return 0, err
+	}
+	goals, err := s.sr.GetAthleteGoals(ctx, athleteID, query.Opt{})
+	if err != nil {
+		return 0, ex.ErrDB.Wrap(err)
+	}
+	if err = writeArchiveJSON(zw, "goals.json", types.NewGoals(goals)); err != nil {
+		return 0, err
+	}
+	count, err := s.writeArchiveActivities(ctx, zw, athleteID)
+	if err != nil {
+		return 0, err
+	}
+	if err = s.writeArchivePushEvents(ctx, zw, athleteID); err != nil {
+		return 0, err
+	}
+	if err = zw.Close(); err != nil {
+		return 0, ex.ErrInternal.Wrap(err)
+	}
+
+	return count, nil
+}
+
+func (s *Strava) writeArchiveProfile(ctx context.Context, zw *zip.Writer, athleteID int64) error {
+	var profile types.ArchiveProfile
+	user, err := s.ur.GetBySource(ctx, oauth2x.StravaSource, athleteID,
+		query.Fields("id", "name", "email", "avatar_url", "created_at"))
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	if user != nil {
+		profile.Name, profile.Email, profile.AvatarURL, profile.CreatedAt = user.Name, user.Email, user.AvatarURL, user.CreatedAt
+	}
+	athlete, err := s.sr.GetAthlete(ctx, athleteID, query.Opt{})
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	if athlete != nil {
+		profile.Athlete = types.NewAthlete(athlete)
+	}
+	zones, err := s.sr.GetAthleteZones(ctx, athleteID, query.Opt{})
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	if zones != nil {
+		profile.Zones = types.NewAthleteZones(zones)
+	}
+
+	return writeArchiveJSON(zw, "profile.json", &profile)
+}
+
+// writeArchiveActivities 按 id 顺序分批写入所有活动, 返回活动数
+func (s *Strava) writeArchiveActivities(ctx context.Context, zw *zip.Writer, athleteID int64) (int, error) {
+	var count int
+	var after int64 = math.MinInt64 // 导入的活动 id 为负数
+	for {
+		list, err := s.sr.ScanDetailedActivity(ctx, athleteID, after, archivePageSize, query.Opt{})
+		if err != nil {
+			return 0, ex.ErrDB.Wrap(err)
+		}
+		for _, item := range list {
+			if err = s.writeArchiveActivity(ctx, zw, item); err != nil {
+				return 0, err
+			}
+			count++
+		}
+		if len(list) < archivePageSize {
+			return count, nil
+		}
+		after = list[len(list)-1].ID
+	}
+}
+
+func (s *Strava) writeArchiveActivity(ctx context.Context, zw *zip.Writer, detailed *model.StravaActivityDetail) error {
+	stream, err := s.sr.GetStreamSet(ctx, detailed.ID, query.Opt{})
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	activity, err := s.activityRelations(ctx, detailed, stream)
+	if err != nil {
+		return err
+	}
+	if err = writeArchiveJSON(zw, fmt.Sprintf("activities/%d.json", detailed.ID), activity); err != nil {
+		return err
+	}
+
+	start, err := s.activityStart(ctx, detailed)
+	if err != nil {
+		return err
+	}
+	entry, err := createArchiveEntry(zw, fmt.Sprintf("activities/%d.%s", detailed.ID, gpxFormat))
+	if err != nil {
+		return err
+	}
+	if err = track.WriteGPX(entry, activityTrack(detailed, stream, start)); err != nil {
+		return ex.ErrInternal.Wrap(err)
+	}
+
+	if detailed.Source != int(model.ActivityStravaSource) {
+		return nil
+	}
+	raw, err := s.sr.GetActivityRaw(ctx, detailed.ID, query.Opt{})
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	if raw == nil || raw.Data == "" {
+		return nil
+	}
+	entry, err = createArchiveEntry(zw, fmt.Sprintf("raw/%d.json", detailed.ID))
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(entry, raw.Data); err != nil {
+		return ex.ErrInternal.Wrap(err)
+	}
+
+	return nil
+}
+
+// writeArchivePushEvents 推送记录可能很多, 每行一个 json, 逐个写入
+func (s *Strava) writeArchivePushEvents(ctx context.Context, zw *zip.Writer, athleteID int64) error {
+	entry, err := createArchiveEntry(zw, "push_events.jsonl")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(entry)
+	var after int64
+	for {
+		list, err := s.sr.ScanPushEvent(ctx, athleteID, after, archivePageSize, query.Opt{})
+		if err != nil {
+			return ex.ErrDB.Wrap(err)
+		}
+		for _, item := range list {
+			if err = enc.Encode(types.NewPushEvent(item)); err != nil {
+				return ex.ErrInternal.Wrap(err)
+			}
+		}
+		if len(list) < archivePageSize {
+			return nil
+		}
+		after = list[len(list)-1].ID
+	}
+}
+
+// cleanArchives 删除下载链接已过期的文件, 标记为已过期
+func (s *Strava) cleanArchives(ctx context.Context) {
+	expired, err := s.sr.GetExpiredArchives(ctx, time.Now(), query.Fields("id", "path"))
+	if err != nil {
+		log.Error("get expired strava archive", zap.Error(err))
+		return
+	}
+	for _, item := range expired {
+		if err = os.Remove(item.Path); err != nil && !os.IsNotExist(err) {
+			log.Error("remove strava archive", zap.Int64("id", item.ID), zap.Error(err))
+			continue
+		}
+		params := model.StravaArchiveParam{
+			Status: util.Int(int(model.ArchiveExpiredStatus)),
+			Path:   util.String(""),
+		}
+		if _, err = s.sr.UpdateArchive(ctx, item.ID, &params); err != nil {
+			log.Error("update strava archive", zap.Int64("id", item.ID), zap.Error(err))
+		}
+	}
+}
+
+func (s *Strava) sendArchiveEmail(ctx context.Context, athleteID, id int64, expiresAt time.Time) error {
+	user, err := s.ur.GetBySource(ctx, oauth2x.StravaSource, athleteID, query.Fields("id", "email"))
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	if user == nil || user.Email == "" {
+		return nil
+	}
+	subj, body := getArchiveContent(archiveURL(s.cfg.ArchiveURL, []byte(s.cfg.ArchiveSignKey), id, expiresAt.Unix()), expiresAt)
+	if err = s.mailer.Send(user.Email, subj, body); err != nil {
+		return ex.ErrInternal.Wrap(err)
+	}
+	log.Info("strava archive email sent", zap.Int64("athlete_id", athleteID), zap.Int64("id", id), log.CTX(ctx))
+
+	return nil
+}
+
+func (s *Strava) requeueArchive(ctx context.Context, id int64, delay time.Duration) {
+	if err := s.archiveQueue.Push(ctx, id, time.Now().Add(delay)); err != nil {
+		log.Error("requeue strava archive", zap.Int64("id", id), zap.Error(err))
+	}
+}
+
+func getArchiveContent(link string, expiresAt time.Time) (subj, body string) {
+	subj = "Your iself data export is ready"
+	body = fmt.Sprintf("Your data export is ready: <a href=\"%s\">download</a>"+
+		"<p>The link expires at %s.</p>", link, expiresAt.UTC().Format(time.RFC1123))
+	return subj, body
+}
+
+// createArchiveEntry 创建 zip 中的一个压缩文件, 返回的 writer 在创建下一个文件前有效
+func createArchiveEntry(zw *zip.Writer, name string) (io.Writer, error) {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return nil, ex.ErrInternal.Wrap(err)
+	}
+	return w, nil
+}
+
+func writeArchiveJSON(zw *zip.Writer, name string, v interface{}) error {
+	w, err := createArchiveEntry(zw, name)
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(w).Encode(v); err != nil {
+		return ex.ErrInternal.Wrap(err)
+	}
+	return nil
+}
+
+// archiveURL 签名的下载链接, 如: /api/strava/archives/download?expires=1669000000&id=1&signature=...
+func archiveURL(base string, key []byte, id, expires int64) string {
+	v := url.Values{}
+	v.Set("id", strconv.FormatInt(id, 10))
+	v.Set("expires", strconv.FormatInt(expires, 10))
+	v.Set("signature", signArchive(key, id, expires))
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + v.Encode()
+}
+
+// signArchive id 和过期时间的 HMAC-SHA256 签名, 修改任意一个参数都会使签名失效
+func signArchive(key []byte, id, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	_, _ = fmt.Fprintf(mac, "%d:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyArchiveURL 校验签名, 没有配置密钥时所有链接都无效
+func verifyArchiveURL(key []byte, id, expires int64, signature string) bool {
+	if len(key) == 0 {
+		return false
+	}
+	return hmac.Equal([]byte(signArchive(key, id, expires)), []byte(signature))
+}
@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/pkg/util"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/oauth2x"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+func TestArchiveURL(t *testing.T) {
+	key := []byte("secret")
+	expires := int64(1669000000)
+
+	link := archiveURL("https://iself.example.com/api/strava/archives/download", key, 12, expires)
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	require.Equal(t, u.Path, "/api/strava/archives/download")
+	q := u.Query()
+	require.Equal(t, q.Get("id"), "12")
+	require.Equal(t, q.Get("expires"), strconv.FormatInt(expires, 10))
+
+	signature := q.Get("signature")
+	require.True(t, verifyArchiveURL(key, 12, expires, signature))
+	// 修改 id, 过期时间或者使用其他密钥签名都无效
+	require.False(t, verifyArchiveURL(key, 13, expires, signature))
+	require.False(t, verifyArchiveURL(key, 12, expires+3600, signature))
+	require.False(t, verifyArchiveURL([]byte("other"), 12, expires, signature))
+	require.False(t, verifyArchiveURL(nil, 12, expires, signArchive(nil, 12, expires)))
+
+	require.Contains(t, archiveURL("/download?lang=en", key, 12, expires), "/download?lang=en&expires=")
+}
+
+func TestWriteArchiveJSON(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	require.NoError(t, writeArchiveJSON(zw, "goals.json", []*types.Goal{{ID: 1, Type: "run", Value: 100}}))
+	entry, err := createArchiveEntry(zw, "raw/1.json")
+	require.NoError(t, err)
+	_, _ = io.WriteString(entry, `{"id":1}`)
+	require.NoError(t, zw.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+	require.Equal(t, zr.File[0].Name, "goals.json")
+	require.Equal(t, zr.File[0].Method, zip.Deflate)
+
+	f, err := zr.File[0].Open()
+	require.NoError(t, err)
+	data, _ := io.ReadAll(f)
+	require.JSONEq(t, string(data), `[{"id":1,"type":"run","field":"","freq":"","value":100}]`)
+}
+
+func TestConfigArchiveDefault(t *testing.T) {
+	cfg := (&Config{}).withDefault()
+
+	require.Equal(t, cfg.ArchiveExpire, defaultArchiveExpire)
+	require.Empty(t, cfg.ArchiveURL)
+}
+
+func TestConfigValidate(t *testing.T) {
+	// 导出目录, 签名密钥和下载地址没有默认值
+	downloadURL := "https://iself.example.com/api/strava/archives/download"
+	require.Error(t, (&Config{}).Validate())
+	require.Error(t, (&Config{ArchiveDir: "/var/lib/iself/archive", ArchiveURL: downloadURL}).Validate())
+	require.Error(t, (&Config{ArchiveSignKey: "secret", ArchiveURL: downloadURL}).Validate())
+	require.Error(t, (&Config{ArchiveDir: "/var/lib/iself/archive", ArchiveSignKey: "secret"}).Validate())
+	// 相对地址无法在邮件中打开
+	require.Error(t, (&Config{ArchiveDir: "/var/lib/iself/archive", ArchiveSignKey: "secret", ArchiveURL: "/api/strava/archives/download"}).Validate())
+	require.NoError(t, (&Config{ArchiveDir: "/var/lib/iself/archive", ArchiveSignKey: "secret", ArchiveURL: downloadURL}).Validate())
+}
+
+func TestStrava_DownloadArchive(t *testing.T) {
+	s, mock, rmock := newMockStrava(t, nil)
+	s.cfg.ArchiveSignKey = "secret"
+	dir := t.TempDir()
+	path := filepath.Join(dir, "1.zip")
+	require.NoError(t, os.WriteFile(path, []byte("zip"), 0o600))
+	expires := time.Now().Add(time.Hour).Unix()
+	req := types.DownloadArchiveReq{ID: 1, Expires: expires, Signature: signArchive([]byte("secret"), 1, expires)}
+	createdAt := time.Date(2022, 11, 22, 10, 0, 0, 0, time.UTC)
+	sql := `SELECT "id","status","path","created_at" FROM "strava_archive" WHERE id = $1 LIMIT 1`
+	columns := []string{"id", "status", "path", "created_at"}
+	mock.ExpectQuery(sql).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, model.ArchiveReadyStatus, path, createdAt))
+	// 记录已生成但是文件不存在
+	mock.ExpectQuery(sql).WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, model.ArchiveReadyStatus, filepath.Join(dir, "2.zip"), createdAt))
+
+	f, err := s.DownloadArchive(context.TODO(), &req)
+	require.NoError(t, err)
+	require.Equal(t, f.Path, path)
+	require.Equal(t, f.Name, "iself_20221122.zip")
+
+	_, err = s.DownloadArchive(context.TODO(), &req)
+	var e *ex.Error
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, e.Status, ex.ErrNotFound.Status)
+	checkExpectations(t, mock, rmock)
+}
+
+var archiveColumns = []string{"id", "athlete_id", "status", "attempts"}
+
+const (
+	pendingArchiveSQL = `SELECT * FROM "strava_archive" WHERE status = $1 AND athlete_id = $2 ORDER BY id`
+	countArchiveSQL   = `SELECT count(*) FROM "strava_archive" WHERE athlete_id = $1 AND status = $2 AND created_at > $3`
+	scanActivitySQL   = `SELECT * FROM "strava_activity_detail" WHERE (athlete_id = $1 AND id > $2) AND "strava_activity_detail"."deleted_at" = $3 ORDER BY id LIMIT 50`
+	createArchiveSQL  = `INSERT INTO "strava_archive" ("athlete_id","status","path","size","activities","last_error","attempts","expires_at") VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING "created_at","updated_at","id"`
+)
+
+func TestStrava_CreateArchive(t *testing.T) {
+	s, mock, rmock := newMockStrava(t, nil)
+	mock.ExpectQuery(pendingArchiveSQL).
+		WithArgs(int(model.ArchivePendingStatus), mockAthleteID).
+		WillReturnRows(sqlmock.NewRows(archiveColumns))
+	mock.ExpectQuery(countArchiveSQL).
+		WithArgs(mockAthleteID, int(model.ArchiveReadyStatus), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(createArchiveSQL).
+		WithArgs(mockAthleteID, int(model.ArchivePendingStatus), "", int64(0), 0, "", 0, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at", "id"}).AddRow(time.Now(), time.Now(), 3))
+	rmock.CustomMatch(matchMember).ExpectZAddNX(mockArchiveQueueKey, &redis.Z{Member: int64(3)}).SetVal(1)
+
+	a, err := s.CreateArchive(context.TODO(), mockAthleteID)
+
+	require.NoError(t, err)
+	require.Equal(t, a.ID, int64(3))
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_CreateArchiveLimit(t *testing.T) {
+	s, mock, rmock := newMockStrava(t, nil)
+	mock.ExpectQuery(pendingArchiveSQL).
+		WithArgs(int(model.ArchivePendingStatus), mockAthleteID).
+		WillReturnRows(sqlmock.NewRows(archiveColumns))
+	// 间隔内已经生成过, 使用已有的下载链接
+	mock.ExpectQuery(countArchiveSQL).
+		WithArgs(mockAthleteID, int(model.ArchiveReadyStatus), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	_, err := s.CreateArchive(context.TODO(), mockAthleteID)
+
+	var e *ex.Error
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, e.Status, ex.ErrReachLimit.Status)
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_CreateArchiveConflict(t *testing.T) {
+	s, mock, rmock := newMockStrava(t, nil)
+	mock.ExpectQuery(pendingArchiveSQL).
+		WithArgs(int(model.ArchivePendingStatus), mockAthleteID).
+		WillReturnRows(sqlmock.NewRows(archiveColumns))
+	mock.ExpectQuery(countArchiveSQL).
+		WithArgs(mockAthleteID, int(model.ArchiveReadyStatus), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	// 并发请求已经创建了生成中的导出, 返回该导出, 不会重复加入队列
+	mock.ExpectQuery(createArchiveSQL).
+		WithArgs(mockAthleteID, int(model.ArchivePendingStatus), "", int64(0), 0, "", 0, nil).
+		WillReturnError(&pgconn.PgError{Code: "23505"})
+	mock.ExpectQuery(pendingArchiveSQL).
+		WithArgs(int(model.ArchivePendingStatus), mockAthleteID).
+		WillReturnRows(sqlmock.NewRows(archiveColumns).AddRow(2, mockAthleteID, model.ArchivePendingStatus, 0))
+
+	a, err := s.CreateArchive(context.TODO(), mockAthleteID)
+
+	require.NoError(t, err)
+	require.Equal(t, a.ID, int64(2))
+	checkExpectations(t, mock, rmock)
+}
+
+// expectArchiveProfile 用户资料, 区间和目标都为空
+func expectArchiveProfile(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT "id","name","email","avatar_url","created_at" FROM "user" WHERE (source = $1 AND source_id = $2) AND "user"."deleted_at" = $3 LIMIT 1`).
+		WithArgs(oauth2x.StravaSource, mockAthleteID, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email"}).AddRow(1, "happyxhw", "happyxhw@example.com"))
+	mock.ExpectQuery(`SELECT * FROM "strava_athlete" WHERE athlete_id = $1 LIMIT 1`).
+		WithArgs(mockAthleteID).
+		WillReturnRows(sqlmock.NewRows([]string{"athlete_id"}))
+	mock.ExpectQuery(`SELECT * FROM "strava_athlete_zone" WHERE athlete_id = $1 LIMIT 1`).
+		WithArgs(mockAthleteID).
+		WillReturnRows(sqlmock.NewRows([]string{"athlete_id"}))
+	mock.ExpectQuery(`SELECT * FROM "strava_goal" WHERE athlete_id = $1 AND "strava_goal"."deleted_at" = $2 ORDER BY id`).
+		WithArgs(mockAthleteID, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+func TestStrava_WriteArchive(t *testing.T) {
+	s, mock, rmock := newMockStrava(t, nil)
+	expectArchiveProfile(mock)
+	// 一个本地导入的活动, 没有原始数据
+	startDate := time.Date(2022, 11, 22, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(scanActivitySQL).
+		WithArgs(mockAthleteID, int64(math.MinInt64), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "athlete_id", "name", "type", "start_date", "source"}).
+			AddRow(-1, mockAthleteID, "Morning Run", "Run", startDate, model.ActivityGPXSource))
+	mock.ExpectQuery(`SELECT * FROM "strava_activity_stream" WHERE id = $1 AND "strava_activity_stream"."deleted_at" = $2 LIMIT 1`).
+		WithArgs(int64(-1), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT * FROM "strava_activity_lap" WHERE activity_id IN ($1) AND "strava_activity_lap"."deleted_at" = $2 ORDER BY activity_id, lap_index`).
+		WithArgs(int64(-1), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT * FROM "strava_activity_zone" WHERE activity_id = $1 AND "strava_activity_zone"."deleted_at" = $2 ORDER BY type, zone`).
+		WithArgs(int64(-1), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT * FROM "strava_segment_effort" WHERE activity_id = $1 AND "strava_segment_effort"."deleted_at" = $2 ORDER BY start_index, id`).
+		WithArgs(int64(-1), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT * FROM "strava_activity_comment" WHERE activity_id = $1 AND "strava_activity_comment"."deleted_at" = $2 ORDER BY comment_created_at, id`).
+		WithArgs(int64(-1), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT * FROM "strava_activity_kudos" WHERE activity_id = $1 AND "strava_activity_kudos"."deleted_at" = $2 ORDER BY position`).
+		WithArgs(int64(-1), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"athlete_id"}))
+	mock.ExpectQuery(`SELECT * FROM "strava_push_event" WHERE owner_id = $1 AND id > $2 ORDER BY id LIMIT 50`).
+		WithArgs(mockAthleteID, int64(0)).
+		WillReturnRows(sqlmock.NewRows(pushEventColumns).
+			AddRow(10, "create", 1669111200, 1, "activity", mockAthleteID, model.EventProcessedStatus, 1))
+
+	var buf bytes.Buffer
+	count, err := s.writeArchive(context.TODO(), mockAthleteID, &buf)
+
+	require.NoError(t, err)
+	require.Equal(t, count, 1)
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	require.Equal(t, names, []string{"profile.json", "goals.json", "activities/-1.json", "activities/-1.gpx",
+		"push_events.jsonl"})
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_BuildArchive(t *testing.T) {
+	s, mock, rmock := newMockStrava(t, nil)
+	s.cfg.ArchiveDir = t.TempDir()
+	s.cfg.ArchiveSignKey = "secret"
+	mock.ExpectQuery(`SELECT * FROM "strava_archive" WHERE id = $1 LIMIT 1`).
+		WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows(archiveColumns).AddRow(3, mockAthleteID, model.ArchivePendingStatus, 0))
+	expectArchiveProfile(mock)
+	mock.ExpectQuery(scanActivitySQL).
+		WithArgs(mockAthleteID, int64(math.MinInt64), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT * FROM "strava_push_event" WHERE owner_id = $1 AND id > $2 ORDER BY id LIMIT 50`).
+		WithArgs(mockAthleteID, int64(0)).
+		WillReturnRows(sqlmock.NewRows(pushEventColumns))
+	path := filepath.Join(s.cfg.ArchiveDir, "3.zip")
+	mock.ExpectExec(`UPDATE "strava_archive" SET "status"=$1,"path"=$2,"size"=$3,"activities"=$4,"last_error"=$5,"attempts"=$6,"expires_at"=$7,"updated_at"=$8 WHERE id = $9`).
+		WithArgs(int(model.ArchiveReadyStatus), path, sqlmock.AnyArg(), 0, "", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 没有邮箱的用户不发送邮件
+	mock.ExpectQuery(`SELECT "id","email" FROM "user" WHERE (source = $1 AND source_id = $2) AND "user"."deleted_at" = $3 LIMIT 1`).
+		WithArgs(oauth2x.StravaSource, mockAthleteID, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(1, ""))
+
+	s.buildArchive(context.TODO(), 3)
+
+	checkExpectations(t, mock, rmock)
+	_, err := os.Stat(path)
+	require.NoError(t, err)
+	// 临时文件已经重命名
+	files, _ := filepath.Glob(filepath.Join(s.cfg.ArchiveDir, "*.tmp"))
+	require.Empty(t, files)
+}
+
+func TestStrava_BuildArchiveRetry(t *testing.T) {
+	tests := []struct {
+		attempts int
+		status   *int
+	}{
+		// 数据库错误可以重试, 记录次数后按退避时间重新加入队列
+		{0, nil},
+		// 超过最大次数后标记为失败, 不再加入队列
+		{maxArchiveAttempts - 1, util.Int(int(model.ArchiveFailedStatus))},
+	}
+	for _, item := range tests {
+		s, mock, rmock := newMockStrava(t, nil)
+		s.cfg.ArchiveDir = t.TempDir()
+		mock.ExpectQuery(`SELECT * FROM "strava_archive" WHERE id = $1 LIMIT 1`).
+			WithArgs(int64(3)).
+			WillReturnRows(sqlmock.NewRows(archiveColumns).
+				AddRow(3, mockAthleteID, model.ArchivePendingStatus, item.attempts))
+		mock.ExpectQuery(`SELECT "id","name","email","avatar_url","created_at" FROM "user" WHERE (source = $1 AND source_id = $2) AND "user"."deleted_at" = $3 LIMIT 1`).
+			WithArgs(oauth2x.StravaSource, mockAthleteID, 0).
+			WillReturnError(sqlmock.ErrCancelled)
+		if item.status == nil {
+			mock.ExpectExec(`UPDATE "strava_archive" SET "last_error"=$1,"attempts"=$2,"updated_at"=$3 WHERE id = $4`).
+				WithArgs(sqlmock.AnyArg(), item.attempts+1, sqlmock.AnyArg(), int64(3)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			rmock.CustomMatch(matchMember).ExpectZAddNX(mockArchiveQueueKey, &redis.Z{Member: int64(3)}).SetVal(1)
+		} else {
+			mock.ExpectExec(`UPDATE "strava_archive" SET "status"=$1,"last_error"=$2,"attempts"=$3,"updated_at"=$4 WHERE id = $5`).
+				WithArgs(*item.status, sqlmock.AnyArg(), item.attempts+1, sqlmock.AnyArg(), int64(3)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+
+		s.buildArchive(context.TODO(), 3)
+
+		checkExpectations(t, mock, rmock)
+		// 失败时删除临时文件
+		files, _ := os.ReadDir(s.cfg.ArchiveDir)
+		require.Empty(t, files, item.attempts)
+	}
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// 对账的时间范围, 与 strava 的统计一致
+const (
+	recentTotal = "recent" // 最近四周
+	ytdTotal    = "ytd"    // 今年
+	allTotal    = "all"    // 全部
+)
+
+// reconcileTypes strava 统计中每种类型包含的活动类型
+var reconcileTypes = []struct {
+	name  string
+	types []string
+}{
+	{name: Run, types: []string{"Run", "VirtualRun"}},
+	{name: Ride, types: []string{"Ride", "VirtualRide", "EBikeRide"}},
+	{name: Swim, types: []string{"Swim"}},
+}
+
+// GetAthlete 查询用户的 strava 资料, 没有保存过时从 strava 同步
+func (s *Strava) GetAthlete(ctx context.Context, athleteID int64) (*types.Athlete, error) {
+	athlete, err := s.athlete(ctx, athleteID)
+	if err != nil {
+		return nil, err
+	}
+
+	return types.NewAthlete(athlete), nil
+}
+
+// SyncAthlete 从 strava 同步用户资料和 strava 统计的累计数据, 登录和收到用户推送时调用
+func (s *Strava) SyncAthlete(ctx context.Context, athleteID int64) error {
+	_, err := s.syncAthlete(ctx, athleteID)
+
+	return err
+}
+
+// ReconcileAthlete 对比 strava 统计的累计数据与已导入活动的累计数据
+// strava 只统计公开的活动, 私密活动会导致 iself 的数据更多
+func (s *Strava) ReconcileAthlete(ctx context.Context, athleteID int64) (*types.AthleteReconciliation, error) {
+	athlete, err := s.athlete(ctx, athleteID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	r := types.AthleteReconciliation{UpdatedAt: athlete.UpdatedAt}
+	for _, item := range reconcileTypes {
+		for _, period := range []string{recentTotal, ytdTotal, allTotal} {
+			local, dbErr := s.sr.GetActivityTotal(ctx, athleteID, item.types, totalStart(period, now))
+			if dbErr != nil {
+				return nil, ex.ErrDB.Wrap(dbErr)
+			}
+			total := stravaTotal(athlete.StatsJSON, item.name, period)
+			r.Totals = append(r.Totals, types.NewTotalReconciliation(item.name, period, total, local))
+		}
+	}
+
+	return &r, nil
+}
+
+// athlete 查询保存的用户资料, 没有时从 strava 同步
+func (s *Strava) athlete(ctx context.Context, athleteID int64) (*model.StravaAthlete, error) {
+	athlete, err := s.sr.GetAthlete(ctx, athleteID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if athlete == nil {
+		return s.syncAthlete(ctx, athleteID)
+	}
+
+	return athlete, nil
+}
+
+func (s *Strava) syncAthlete(ctx context.Context, athleteID int64) (*model.StravaAthlete, error) {
+	stravaCli, err := s.stravaClient(ctx, athleteID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := stravaCli.Athlete.DetailedAthlete(ctx)
+	if err != nil {
+		return nil, stravaErr(err)
+	}
+	stats, err := stravaCli.Athlete.Stats(ctx, athleteID)
+	if err != nil {
+		return nil, stravaErr(err)
+	}
+	athlete := newAthleteModel(athleteID, data, stats)
+	if err = s.sr.UpsertAthlete(ctx, athlete); err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	return athlete, nil
+}
+
+func newAthleteModel(athleteID int64, data *strava.DetailedAthlete, stats *strava.ActivityStats) *model.StravaAthlete {
+	now := time.Now()
+	return &model.StravaAthlete{
+		AthleteID:             athleteID,
+		Username:              data.Username,
+		Firstname:             data.Firstname,
+		Lastname:              data.Lastname,
+		Profile:               data.Profile,
+		ProfileMedium:         data.ProfileMedium,
+		City:                  data.City,
+		State:                 data.State,
+		Country:               data.Country,
+		Sex:                   data.Sex,
+		Summit:                data.Summit,
+		MeasurementPreference: data.MeasurementPreference,
+		Ftp:                   data.Ftp,
+		Weight:                data.Weight,
+		CreatedAt:             now,
+		UpdatedAt:             now,
+
+		BikesJSON: data.Bikes,
+		ShoesJSON: data.Shoes,
+		StatsJSON: stats,
+	}
+}
+
+// totalStart 统计范围的开始时间, 全部时为空
+func totalStart(period string, now time.Time) time.Time {
+	switch period {
+	case recentTotal:
+		return time.Date(now.Year(), now.Month(), now.Day()-28, 0, 0, 0, 0, now.Location())
+	case ytdTotal:
+		return time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+	}
+	return time.Time{}
+}
+
+// stravaTotal 从 strava 的统计中取出对应类型和范围的数据
+func stravaTotal(stats *strava.ActivityStats, activityType, period string) *strava.ActivityTotal {
+	if stats == nil {
+		return nil
+	}
+	totals := map[string]map[string]*strava.ActivityTotal{
+		Run:  {recentTotal: stats.RecentRunTotals, ytdTotal: stats.YtdRunTotals, allTotal: stats.AllRunTotals},
+		Ride: {recentTotal: stats.RecentRideTotals, ytdTotal: stats.YtdRideTotals, allTotal: stats.AllRideTotals},
+		Swim: {recentTotal: stats.RecentSwimTotals, ytdTotal: stats.YtdSwimTotals, allTotal: stats.AllSwimTotals},
+	}
+
+	return totals[activityType][period]
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+func TestTotalStart(t *testing.T) {
+	now := time.Date(2022, 11, 21, 6, 30, 0, 0, time.UTC)
+
+	require.Equal(t, totalStart(recentTotal, now), time.Date(2022, 10, 24, 0, 0, 0, 0, time.UTC))
+	require.Equal(t, totalStart(ytdTotal, now), time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.True(t, totalStart(allTotal, now).IsZero())
+}
+
+func TestStravaTotal(t *testing.T) {
+	stats := strava.ActivityStats{
+		RecentRunTotals: &strava.ActivityTotal{Count: 1},
+		AllRideTotals:   &strava.ActivityTotal{Count: 2},
+	}
+
+	require.Equal(t, stravaTotal(&stats, Run, recentTotal).Count, 1)
+	require.Equal(t, stravaTotal(&stats, Ride, allTotal).Count, 2)
+	require.Nil(t, stravaTotal(&stats, Swim, ytdTotal))
+	require.Nil(t, stravaTotal(&stats, "hike", allTotal))
+	require.Nil(t, stravaTotal(nil, Run, allTotal))
+}
+
+func TestNewAthleteModel(t *testing.T) {
+	data := strava.DetailedAthlete{
+		Id:     1,
+		Ftp:    250,
+		Weight: 70.5,
+		Bikes:  []*strava.SummaryGear{{Id: "b1", Name: "Road"}},
+	}
+	stats := strava.ActivityStats{AllRunTotals: &strava.ActivityTotal{Count: 3}}
+
+	m := newAthleteModel(1, &data, &stats)
+
+	require.Equal(t, m.AthleteID, int64(1))
+	require.Equal(t, m.Ftp, 250)
+	require.Equal(t, m.Weight, 70.5)
+	require.Len(t, m.BikesJSON, 1)
+	require.Nil(t, m.ShoesJSON)
+	require.Equal(t, m.StatsJSON.AllRunTotals.Count, 3)
+}
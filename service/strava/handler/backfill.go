@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/happyxhw/pkg/log"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/pkg/util"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// StartBackfill 开始导入用户在 strava 上的历史活动, 已经在导入中则忽略, 已完成或失败的从头开始
+func (s *Strava) StartBackfill(ctx context.Context, athleteID int64) error {
+	b, err := s.sr.GetBackfill(ctx, athleteID, query.Fields("status"))
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	if b == nil || b.Status != int(model.BackfillRunningStatus) {
+		b = &model.StravaBackfill{
+			AthleteID: athleteID,
+			Status:    int(model.BackfillRunningStatus),
+		}
+		if err = s.sr.UpsertBackfill(ctx, b); err != nil {
+			return ex.ErrDB.Wrap(err)
+		}
+	}
+	if err = s.backfillQueue.Push(ctx, athleteID, time.Now()); err != nil {
+		return ex.ErrRedis.Wrap(err)
+	}
+
+	return nil
+}
+
+// GetBackfill 查询导入进度
+func (s *Strava) GetBackfill(ctx context.Context, athleteID int64) (*types.Backfill, error) {
+	b, err := s.sr.GetBackfill(ctx, athleteID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if b == nil {
+		return nil, ex.ErrNotFound.Msg("backfill not found")
+	}
+
+	return types.NewBackfill(b), nil
+}
+
+// RunBackfillWorker 导入历史活动, 每次从队列中取出一个用户导入一个活动, 之后重新加入队列, 阻塞直到 ctx 结束
+func (s *Strava) RunBackfillWorker(ctx context.Context) {
+	// 历史活动导入优先级最低, 额度不足时等待下一个窗口
+	ctx = strava.WithPriority(ctx, strava.PriorityLow)
+	running, err := s.sr.GetBackfillByStatus(ctx, int(model.BackfillRunningStatus), query.Fields("athlete_id"))
+	if err != nil {
+		log.Error("recover strava backfill", zap.Error(err))
+	}
+	for _, item := range running {
+		if err = s.backfillQueue.Push(ctx, item.AthleteID, time.Now()); err != nil {
+			log.Error("recover strava backfill", zap.Int64("athlete_id", item.AthleteID), zap.Error(err))
+		}
+	}
+
+	ticker := time.NewTicker(pushPollInterval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		athleteID, popErr := s.backfillQueue.Pop(ctx, time.Now())
+		if popErr != nil {
+			log.Error("pop strava backfill", zap.Error(popErr))
+		}
+		if athleteID != 0 {
+			s.backfillPage(ctx, athleteID)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+// backfillPage 从游标处导入一个新的活动, 已经存在或者已经在本地删除的活动直接跳过;
+// 每处理一个活动都会保存游标, 中断后可以从游标处继续; 导入一个活动后重新加入队列, 间隔 BackfillInterval 后继续, 多个用户的导入交替进行, 不会长时间占用 worker
+func (s *Strava) backfillPage(ctx context.Context, athleteID int64) {
+	b, err := s.sr.GetBackfill(ctx, athleteID, query.Opt{})
+	if err != nil {
+		log.Error("get strava backfill", zap.Int64("athlete_id", athleteID), zap.Error(err))
+		s.requeueBackfill(ctx, athleteID, s.cfg.PushBackoff)
+		return
+	}
+	if b == nil || b.Status != int(model.BackfillRunningStatus) {
+		return
+	}
+	connected, err := s.connected(ctx, athleteID)
+	if err == nil && !connected {
+		s.finishBackfill(ctx, athleteID, model.BackfillFailedStatus, "athlete deauthorized")
+		return
+	}
+
+	before := b.Before
+	if before == 0 {
+		before = time.Now().Unix()
+	}
+	cli, err := s.stravaClient(ctx, athleteID)
+	if err != nil {
+		s.failBackfill(ctx, b, err)
+		return
+	}
+	list, err := cli.Activity.AthleteActivities(ctx, before, 1, s.cfg.BackfillPageSize)
+	if err != nil {
+		s.failBackfill(ctx, b, stravaErr(err))
+		return
+	}
+	if len(list) == 0 {
+		s.finishBackfill(ctx, athleteID, model.BackfillFinishedStatus, "")
+		return
+	}
+
+	for _, item := range list {
+		skip, dbErr := s.backfillSkipped(ctx, athleteID, item.Id)
+		if dbErr != nil {
+			s.failBackfill(ctx, b, ex.ErrDB.Wrap(dbErr))
+			return
+		}
+		if skip {
+			b.Skipped++
+		} else {
+			err = s.syncActivity(ctx, athleteID, item.Id, nil)
+			switch e, ok := err.(*ex.Error); {
+			case err == nil:
+				b.Imported++
+			case ok && e.Code == ErrStravaNotFound.Code:
+				// 活动在导入过程中被删除, 跳过
+				b.Skipped++
+			default:
+				s.failBackfill(ctx, b, err)
+				return
+			}
+		}
+		// before 不包含边界, 同一秒开始的活动可能分在两页, 游标加一秒, 重新拉取到的活动已经存在, 直接跳过
+		cursor := item.StartDate.Unix() + 1
+		params := model.StravaBackfillParam{
+			Before:    &cursor,
+			Imported:  util.Int(b.Imported),
+			Skipped:   util.Int(b.Skipped),
+			Attempts:  util.Int(0),
+			LastError: util.String(""),
+		}
+		if _, dbErr = s.sr.UpdateBackfill(ctx, athleteID, &params); dbErr != nil {
+			s.failBackfill(ctx, b, ex.ErrDB.Wrap(dbErr))
+			return
+		}
+		if !skip {
+			s.requeueBackfill(ctx, athleteID, s.cfg.BackfillInterval)
+			return
+		}
+	}
+	s.requeueBackfill(ctx, athleteID, 0)
+}
+
+// backfillSkipped 活动已经存在或者已经在本地删除时跳过, 不请求 strava
+func (s *Strava) backfillSkipped(ctx context.Context, athleteID, activityID int64) (bool, error) {
+	exists, err := s.sr.GetDetailedActivity(ctx, activityID, athleteID, query.Fields("id"))
+	if err != nil || exists != nil {
+		return exists != nil, err
+	}
+	return s.sr.IsActivityDeleted(ctx, activityID)
+}
+
+// failBackfill 记录错误, 按指数退避重试, 超过最大次数或者重试也不会成功(如: 401, 404)时标记为失败
+func (s *Strava) failBackfill(ctx context.Context, b *model.StravaBackfill, err error) {
+	b.Attempts++
+	params := model.StravaBackfillParam{
+		Attempts:  util.Int(b.Attempts),
+		LastError: util.String(err.Error()),
+	}
+	retry := b.Attempts < maxBackfillAttempts && retryable(err)
+	if retry {
+		log.Info("strava backfill retrying", zap.Int64("athlete_id", b.AthleteID), zap.Int("attempts", b.Attempts),
+			zap.Error(err))
+	} else {
+		log.Error("strava backfill failed", zap.Int64("athlete_id", b.AthleteID), zap.Error(err))
+		params.Status = util.Int(int(model.BackfillFailedStatus))
+	}
+	if _, dbErr := s.sr.UpdateBackfill(ctx, b.AthleteID, &params); dbErr != nil {
+		log.Error("update strava backfill", zap.Int64("athlete_id", b.AthleteID), zap.Error(dbErr))
+		retry = true
+	}
+	if retry {
+		s.requeueBackfill(ctx, b.AthleteID, pushBackoff(s.cfg.PushBackoff, b.Attempts))
+	}
+}
+
+func (s *Strava) finishBackfill(ctx context.Context, athleteID int64, status model.BackfillStatus, lastError string) {
+	params := model.StravaBackfillParam{
+		Status:    util.Int(int(status)),
+		LastError: util.String(lastError),
+	}
+	if _, err := s.sr.UpdateBackfill(ctx, athleteID, &params); err != nil {
+		log.Error("update strava backfill", zap.Int64("athlete_id", athleteID), zap.Error(err))
+		s.requeueBackfill(ctx, athleteID, s.cfg.PushBackoff)
+	}
+}
+
+func (s *Strava) requeueBackfill(ctx context.Context, athleteID int64, delay time.Duration) {
+	if err := s.backfillQueue.Push(ctx, athleteID, time.Now().Add(delay)); err != nil {
+		log.Error("requeue strava backfill", zap.Int64("athlete_id", athleteID), zap.Error(err))
+	}
+}
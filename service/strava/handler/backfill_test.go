@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redismock/v8"
+	"golang.org/x/oauth2"
+
+	"github.com/happyxhw/pkg/mymock"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/oauth2x"
+	"github.com/happyxhw/iself/pkg/strava/stravatest"
+	"github.com/happyxhw/iself/repo"
+)
+
+const (
+	mockBackfillQueueKey = "mockBackfillQueue"
+	mockUploadQueueKey   = "mockUploadQueue"
+	mockRouteQueueKey    = "mockRouteQueue"
+	mockArchiveQueueKey  = "mockArchiveQueue"
+	mockAthleteID        = int64(1001)
+	mockTokenKey         = "oauth2:strava:1001"
+	mockToken            = `{"access_token":"access-1001","token_type":"Bearer"}`
+)
+
+var backfillColumns = []string{"athlete_id", "status", "before", "imported", "skipped", "attempts"}
+
+// newMockStrava 使用 sqlmock, redismock 和 fake strava api 的 handler
+func newMockStrava(t *testing.T, server *stravatest.Server) (*Strava, sqlmock.Sqlmock, redismock.ClientMock) {
+	gdb, mock, err := mymock.MockEqualDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdb, rmock := redismock.NewClientMock()
+	cacher := repo.NewCacher(rdb)
+	s := Strava{
+		sr:            repo.NewStravaRepo(gdb),
+		ur:            repo.NewUserRepo(gdb),
+		tr:            repo.NewTokenRepo(cacher),
+		cacher:        cacher,
+		pushQueue:     repo.NewQueue(rdb, mockPushQueueKey),
+		backfillQueue: repo.NewQueue(rdb, mockBackfillQueueKey),
+		uploadQueue:   repo.NewQueue(rdb, mockUploadQueueKey),
+		routeQueue:    repo.NewQueue(rdb, mockRouteQueueKey),
+		archiveQueue:  repo.NewQueue(rdb, mockArchiveQueueKey),
+		auth:          oauth2x.NewStrava(&oauth2.Config{}, ""),
+		cfg:           (&Config{}).withDefault(),
+	}
+	if server != nil {
+		s.auth = oauth2x.NewStrava(&oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: server.URL + "/oauth/token"}},
+			server.APIURL())
+		s.cfg.BaseURL = server.APIURL()
+	}
+
+	return &s, mock, rmock
+}
+
+func expectBackfill(mock sqlmock.Sqlmock, attempts int) {
+	mock.ExpectQuery(`SELECT * FROM "strava_backfill" WHERE athlete_id = $1 LIMIT 1`).
+		WithArgs(mockAthleteID).
+		WillReturnRows(
+			sqlmock.NewRows(backfillColumns).
+				AddRow(mockAthleteID, model.BackfillRunningStatus, 0, 3, 1, attempts),
+		)
+	mock.ExpectQuery(`SELECT "id","source_status" FROM "user" WHERE (source = $1 AND source_id = $2) AND "user"."deleted_at" = $3 LIMIT 1`).
+		WithArgs(oauth2x.StravaSource, mockAthleteID, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "source_status"}).AddRow(1, model.SourceConnectedStatus))
+}
+
+func checkExpectations(t *testing.T, mock sqlmock.Sqlmock, rmock redismock.ClientMock) {
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err := rmock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStrava_BackfillPageRetry(t *testing.T) {
+	s, mock, rmock := newMockStrava(t, nil)
+	expectBackfill(mock, 1)
+	// token 读取失败可以重试, 记录次数后按退避时间重新加入队列
+	rmock.ExpectGet(mockTokenKey).SetErr(redis.ErrClosed)
+	mock.ExpectExec(`UPDATE "strava_backfill" SET "attempts"=$1,"last_error"=$2,"updated_at"=$3 WHERE athlete_id = $4`).
+		WithArgs(2, sqlmock.AnyArg(), sqlmock.AnyArg(), mockAthleteID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	rmock.CustomMatch(matchMember).ExpectZAddNX(mockBackfillQueueKey, &redis.Z{Member: mockAthleteID}).SetVal(1)
+
+	s.backfillPage(context.TODO(), mockAthleteID)
+
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_BackfillPageMaxAttempts(t *testing.T) {
+	s, mock, rmock := newMockStrava(t, nil)
+	expectBackfill(mock, maxBackfillAttempts-1)
+	// 超过最大次数后标记为失败, 不再加入队列
+	rmock.ExpectGet(mockTokenKey).SetErr(redis.ErrClosed)
+	mock.ExpectExec(`UPDATE "strava_backfill" SET "status"=$1,"attempts"=$2,"last_error"=$3,"updated_at"=$4 WHERE athlete_id = $5`).
+		WithArgs(int(model.BackfillFailedStatus), maxBackfillAttempts, sqlmock.AnyArg(), sqlmock.AnyArg(), mockAthleteID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s.backfillPage(context.TODO(), mockAthleteID)
+
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_BackfillPageUnauthorized(t *testing.T) {
+	server := stravatest.NewServer(nil)
+	defer server.Close()
+	server.InjectError("/athlete/activities", 401, 1)
+
+	s, mock, rmock := newMockStrava(t, server)
+	expectBackfill(mock, 0)
+	// 401 重试也不会成功, 第一次失败就标记为失败
+	rmock.ExpectGet(mockTokenKey).SetVal(mockToken)
+	mock.ExpectExec(`UPDATE "strava_backfill" SET "status"=$1,"attempts"=$2,"last_error"=$3,"updated_at"=$4 WHERE athlete_id = $5`).
+		WithArgs(int(model.BackfillFailedStatus), 1, sqlmock.AnyArg(), sqlmock.AnyArg(), mockAthleteID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s.backfillPage(context.TODO(), mockAthleteID)
+
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_BackfillPageSkip(t *testing.T) {
+	server := stravatest.NewServer(nil)
+	defer server.Close()
+
+	s, mock, rmock := newMockStrava(t, server)
+	expectBackfill(mock, 2)
+	rmock.ExpectGet(mockTokenKey).SetVal(mockToken)
+	// 最新的活动 2002 已经在本地删除, 不再导入, 计为跳过, 游标加一秒, 同一秒开始的活动不会遗漏
+	mock.ExpectQuery(`SELECT "id" FROM "strava_activity_detail" WHERE (id = $1 AND athlete_id = $2) AND "strava_activity_detail"."deleted_at" = $3 LIMIT 1`).
+		WithArgs(int64(2002), mockAthleteID, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(`SELECT count(*) FROM "strava_activity_detail" WHERE id = $1 AND deleted_at <> 0`).
+		WithArgs(int64(2002)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	cursor := time.Date(2022, 11, 22, 10, 0, 0, 0, time.UTC).Unix() + 1
+	mock.ExpectExec(`UPDATE "strava_backfill" SET "before"=$1,"imported"=$2,"skipped"=$3,"attempts"=$4,"last_error"=$5,"updated_at"=$6 WHERE athlete_id = $7`).
+		WithArgs(cursor, 3, 2, 0, "", sqlmock.AnyArg(), mockAthleteID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 跳过的活动没有请求 strava, 继续处理同一页中的 2001, 已经存在
+	mock.ExpectQuery(`SELECT "id" FROM "strava_activity_detail" WHERE (id = $1 AND athlete_id = $2) AND "strava_activity_detail"."deleted_at" = $3 LIMIT 1`).
+		WithArgs(int64(2001), mockAthleteID, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2001))
+	cursor = time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC).Unix() + 1
+	mock.ExpectExec(`UPDATE "strava_backfill" SET "before"=$1,"imported"=$2,"skipped"=$3,"attempts"=$4,"last_error"=$5,"updated_at"=$6 WHERE athlete_id = $7`).
+		WithArgs(cursor, 3, 3, 0, "", sqlmock.AnyArg(), mockAthleteID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 这一页处理完后立即继续下一页
+	rmock.CustomMatch(matchMember).ExpectZAddNX(mockBackfillQueueKey, &redis.Z{Member: mockAthleteID}).SetVal(1)
+
+	s.backfillPage(context.TODO(), mockAthleteID)
+
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_BackfillPageYield(t *testing.T) {
+	server := stravatest.NewServer(nil)
+	defer server.Close()
+	server.InjectError("/activities/2002", 404, 1)
+
+	s, mock, rmock := newMockStrava(t, server)
+	expectBackfill(mock, 2)
+	rmock.ExpectGet(mockTokenKey).SetVal(mockToken)
+	mock.ExpectQuery(`SELECT "id" FROM "strava_activity_detail" WHERE (id = $1 AND athlete_id = $2) AND "strava_activity_detail"."deleted_at" = $3 LIMIT 1`).
+		WithArgs(int64(2002), mockAthleteID, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	// 导入前和 syncActivity 中各检查一次是否已经删除
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery(`SELECT count(*) FROM "strava_activity_detail" WHERE id = $1 AND deleted_at <> 0`).
+			WithArgs(int64(2002)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	}
+	rmock.ExpectGet(mockTokenKey).SetVal(mockToken)
+	// 活动在导入过程中被删除, 计为跳过; 已经请求了 strava, 保存游标后重新加入队列, 不再处理同一页中的 2001
+	cursor := time.Date(2022, 11, 22, 10, 0, 0, 0, time.UTC).Unix() + 1
+	mock.ExpectExec(`UPDATE "strava_backfill" SET "before"=$1,"imported"=$2,"skipped"=$3,"attempts"=$4,"last_error"=$5,"updated_at"=$6 WHERE athlete_id = $7`).
+		WithArgs(cursor, 3, 2, 0, "", sqlmock.AnyArg(), mockAthleteID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	rmock.CustomMatch(matchMember).ExpectZAddNX(mockBackfillQueueKey, &redis.Z{Member: mockAthleteID}).SetVal(1)
+
+	s.backfillPage(context.TODO(), mockAthleteID)
+
+	checkExpectations(t, mock, rmock)
+}
@@ -0,0 +1,349 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/happyxhw/pkg/log"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// SyncClubs 从 strava 同步用户加入的俱乐部, 新的俱乐部立即刷新动态
+func (s *Strava) SyncClubs(ctx context.Context, athleteID int64) ([]*types.Club, error) {
+	stravaCli, err := s.stravaClient(ctx, athleteID)
+	if err != nil {
+		return nil, err
+	}
+	var clubs []*model.StravaClub
+	for page := 1; ; page++ {
+		list, apiErr := stravaCli.Clubs.AthleteClubs(ctx, page, clubPageSize)
+		if apiErr != nil {
+			return nil, stravaErr(apiErr)
+		}
+		for _, item := range list {
+			clubs = append(clubs, newClubModel(item))
+		}
+		if len(list) < clubPageSize {
+			break
+		}
+	}
+
+	ids := make([]int64, 0, len(clubs))
+	err = s.transRepo.Exec(ctx, func(ctx context.Context) error {
+		for _, item := range clubs {
+			if txErr := s.sr.UpsertClub(ctx, item); txErr != nil {
+				return txErr
+			}
+			ids = append(ids, item.ID)
+		}
+		return s.sr.ReplaceClubAthlete(ctx, athleteID, ids)
+	})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	r, err := s.sr.GetAthleteClubs(ctx, athleteID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	for _, item := range r {
+		if item.RefreshedAt.IsZero() {
+			s.requeueClub(ctx, item.ID, 0)
+		}
+	}
+
+	return types.NewClubList(r), nil
+}
+
+func (s *Strava) ListClub(ctx context.Context, athleteID int64) ([]*types.Club, error) {
+	r, err := s.sr.GetAthleteClubs(ctx, athleteID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	return types.NewClubList(r), nil
+}
+
+func (s *Strava) GetClub(ctx context.Context, athleteID, clubID int64) (*types.Club, error) {
+	club, err := s.club(ctx, athleteID, clubID)
+	if err != nil {
+		return nil, err
+	}
+
+	return types.NewClub(club), nil
+}
+
+// ListClubActivity 已保存的俱乐部动态, 只有俱乐部成员可以查看
+func (s *Strava) ListClubActivity(ctx context.Context, athleteID, clubID int64,
+	req *model.StravaClubActivityQueryParam) (*types.ClubActivityQueryResult, error) {
+	if _, err := s.club(ctx, athleteID, clubID); err != nil {
+		return nil, err
+	}
+	p, r, err := s.sr.QueryClubActivity(ctx, clubID, req, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	return &types.ClubActivityQueryResult{
+		PageResult: p,
+		Data:       types.NewClubActivityList(r),
+	}, nil
+}
+
+// GetClubLeaderboard 俱乐部成员一周的距离和时间排行, 周一开始
+func (s *Strava) GetClubLeaderboard(ctx context.Context, athleteID int64, req *types.ClubLeaderboardReq) (*types.ClubLeaderboard, error) {
+	club, err := s.club(ctx, athleteID, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	day := time.Now()
+	if req.Date != "" {
+		if day, err = time.ParseInLocation("2006-01-02", req.Date, time.Local); err != nil {
+			return nil, ex.ErrParam.Wrap(err)
+		}
+	}
+	start := weekStart(day)
+	end := start.AddDate(0, 0, 7)
+	var activityTypes []string
+	for _, item := range reconcileTypes {
+		if item.name == req.Type {
+			activityTypes = item.types
+		}
+	}
+	rows, err := s.sr.GetClubLeaderboard(ctx, club.ID, activityTypes, start, end)
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	return &types.ClubLeaderboard{
+		Club:      types.NewClub(club),
+		WeekStart: start,
+		WeekEnd:   end,
+		Distance: rankLeaderboard(rows, func(m *model.StravaClubLeaderboard) float64 {
+			return m.Distance
+		}),
+		MovingTime: rankLeaderboard(rows, func(m *model.StravaClubLeaderboard) float64 {
+			return float64(m.MovingTime)
+		}),
+	}, nil
+}
+
+// RunClubWorker 定时刷新有 iself 用户的俱乐部的动态, 阻塞直到 ctx 结束
+func (s *Strava) RunClubWorker(ctx context.Context) {
+	// 俱乐部动态优先级最低, 额度不足时等待下一个窗口
+	ctx = strava.WithPriority(ctx, strava.PriorityLow)
+	clubs, err := s.sr.GetClubsWithAthlete(ctx, query.Fields("id", "refreshed_at"))
+	if err != nil {
+		log.Error("recover strava club", zap.Error(err))
+	}
+	for _, item := range clubs {
+		s.requeueClub(ctx, item.ID, time.Until(item.RefreshedAt.Add(s.cfg.ClubRefreshInterval)))
+	}
+
+	ticker := time.NewTicker(pushPollInterval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		id, popErr := s.clubQueue.Pop(ctx, time.Now())
+		if popErr != nil {
+			log.Error("pop strava club", zap.Error(popErr))
+		}
+		if id != 0 {
+			s.refreshClub(ctx, id)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshClub 使用俱乐部中任一成员的 token 拉取动态, 没有成员时不再刷新
+func (s *Strava) refreshClub(ctx context.Context, clubID int64) {
+	club, err := s.sr.GetClub(ctx, clubID, query.Fields("id", "refreshed_at"))
+	if err != nil {
+		log.Error("get strava club", zap.Int64("club_id", clubID), zap.Error(err))
+		s.requeueClub(ctx, clubID, s.cfg.PushBackoff)
+		return
+	}
+	athleteIDs, err := s.sr.GetClubAthletes(ctx, clubID)
+	if err != nil {
+		log.Error("get strava club athletes", zap.Int64("club_id", clubID), zap.Error(err))
+		s.requeueClub(ctx, clubID, s.cfg.PushBackoff)
+		return
+	}
+	if club == nil || len(athleteIDs) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, athleteID := range athleteIDs {
+		var created int64
+		if created, err = s.refreshClubFeed(ctx, athleteID, club, now); err == nil {
+			log.Info("strava club refreshed", zap.Int64("club_id", clubID), zap.Int64("created", created))
+			break
+		}
+		// token 失效或者已经退出俱乐部时换一个成员
+		log.Info("strava club refresh failed", zap.Int64("club_id", clubID), zap.Int64("athlete_id", athleteID),
+			zap.Error(err))
+	}
+	delay := s.cfg.ClubRefreshInterval
+	switch {
+	case err == nil:
+		if _, err = s.sr.UpdateClubRefreshedAt(ctx, clubID, now); err != nil {
+			log.Error("update strava club", zap.Int64("club_id", clubID), zap.Error(err))
+		}
+	case retryable(err):
+		delay = s.cfg.PushBackoff
+	}
+	s.requeueClub(ctx, clubID, delay)
+}
+
+// refreshClubFeed 从最新的动态开始拉取, 遇到已经保存过的活动后停止,
+// 第一次刷新时已经存在的活动无法确定时间, 标记为 backfilled 不计入排行榜
+func (s *Strava) refreshClubFeed(ctx context.Context, athleteID int64, club *model.StravaClub, now time.Time) (int64, error) {
+	stravaCli, err := s.stravaClient(ctx, athleteID)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for page := 1; page <= maxClubFeedPages; page++ {
+		list, apiErr := stravaCli.Clubs.ClubActivities(ctx, club.ID, page, clubPageSize)
+		if apiErr != nil {
+			return total, stravaErr(apiErr)
+		}
+		activities := newClubActivities(club.ID, list, club.RefreshedAt.IsZero(), now)
+		created, dbErr := s.sr.CreateClubActivities(ctx, activities)
+		if dbErr != nil {
+			return total, ex.ErrDB.Wrap(dbErr)
+		}
+		total += created
+		if created < int64(len(activities)) || len(list) < clubPageSize {
+			break
+		}
+	}
+
+	return total, nil
+}
+
+func (s *Strava) requeueClub(ctx context.Context, clubID int64, delay time.Duration) {
+	if err := s.clubQueue.Push(ctx, clubID, time.Now().Add(delay)); err != nil {
+		log.Error("requeue strava club", zap.Int64("club_id", clubID), zap.Error(err))
+	}
+}
+
+// club 只有俱乐部成员可以查看
+func (s *Strava) club(ctx context.Context, athleteID, clubID int64) (*model.StravaClub, error) {
+	clubs, err := s.sr.GetAthleteClubs(ctx, athleteID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	for _, item := range clubs {
+		if item.ID == clubID {
+			return item, nil
+		}
+	}
+
+	return nil, ex.ErrNotFound.Msg("club not found")
+}
+
+func newClubModel(data *strava.SummaryClub) *model.StravaClub {
+	return &model.StravaClub{
+		ID:            data.Id,
+		Name:          data.Name,
+		SportType:     data.SportType,
+		City:          data.City,
+		Country:       data.Country,
+		Private:       data.Private,
+		MemberCount:   data.MemberCount,
+		ProfileMedium: data.ProfileMedium,
+		CoverPhoto:    data.CoverPhoto,
+		URL:           data.Url,
+	}
+}
+
+// newClubActivities 同一批次中指纹相同的活动只保留一个
+func newClubActivities(clubID int64, list []*strava.ClubActivity, backfilled bool, now time.Time) []*model.StravaClubActivity {
+	r := make([]*model.StravaClubActivity, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	for _, item := range list {
+		name := clubAthleteName(item.Athlete)
+		fingerprint := clubActivityFingerprint(name, item)
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+		r = append(r, &model.StravaClubActivity{
+			ClubID:             clubID,
+			Fingerprint:        fingerprint,
+			AthleteName:        name,
+			Name:               item.Name,
+			Type:               item.Type,
+			Distance:           item.Distance,
+			MovingTime:         item.MovingTime,
+			ElapsedTime:        item.ElapsedTime,
+			TotalElevationGain: item.TotalElevationGain,
+			Backfilled:         backfilled,
+			FirstSeenAt:        now,
+		})
+	}
+
+	return r
+}
+
+func clubAthleteName(a *strava.ClubAthlete) string {
+	if a == nil {
+		return ""
+	}
+	return athleteName(a.Firstname, a.Lastname)
+}
+
+// clubActivityFingerprint 不包含活动名称, 用户修改名称后不会被当作新的活动
+func clubActivityFingerprint(athleteName string, a *strava.ClubActivity) string {
+	h := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%.1f|%d|%d|%.1f", athleteName, a.Type, a.Distance,
+		a.MovingTime, a.ElapsedTime, a.TotalElevationGain)))
+	return hex.EncodeToString(h[:])
+}
+
+// rankLeaderboard 按 value 倒序排名, 数值相同时排名相同
+func rankLeaderboard(rows []*model.StravaClubLeaderboard,
+	value func(m *model.StravaClubLeaderboard) float64) []*types.LeaderboardEntry {
+	sorted := make([]*model.StravaClubLeaderboard, len(rows))
+	copy(sorted, rows)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if value(sorted[i]) != value(sorted[j]) {
+			return value(sorted[i]) > value(sorted[j])
+		}
+		return sorted[i].AthleteName < sorted[j].AthleteName
+	})
+	r := make([]*types.LeaderboardEntry, 0, len(sorted))
+	for i, item := range sorted {
+		entry := types.NewLeaderboardEntry(item)
+		entry.Rank = i + 1
+		if i > 0 && value(item) == value(sorted[i-1]) {
+			entry.Rank = r[i-1].Rank
+		}
+		r = append(r, entry)
+	}
+
+	return r
+}
+
+// weekStart t 所在周的周一零点
+func weekStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+func TestWeekStart(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+
+	require.Equal(t, weekStart(time.Date(2022, 11, 23, 18, 30, 0, 0, loc)), time.Date(2022, 11, 21, 0, 0, 0, 0, loc))
+	require.Equal(t, weekStart(time.Date(2022, 11, 21, 0, 0, 0, 0, loc)), time.Date(2022, 11, 21, 0, 0, 0, 0, loc))
+	require.Equal(t, weekStart(time.Date(2022, 11, 27, 23, 59, 0, 0, loc)), time.Date(2022, 11, 21, 0, 0, 0, 0, loc))
+}
+
+func TestNewClubActivities(t *testing.T) {
+	now := time.Now()
+	run := strava.ClubActivity{
+		Athlete:    &strava.ClubAthlete{Firstname: "Jane", Lastname: "D."},
+		Name:       "Lunch Run",
+		Type:       "Run",
+		Distance:   8020.5,
+		MovingTime: 2580,
+	}
+	renamed := run
+	renamed.Name = "Tempo"
+	other := run
+	other.Athlete = &strava.ClubAthlete{Firstname: "Bob"}
+
+	list := newClubActivities(5001, []*strava.ClubActivity{&run, &renamed, &other}, true, now)
+
+	require.Len(t, list, 2)
+	require.Equal(t, list[0].AthleteName, "Jane D.")
+	require.Equal(t, list[1].AthleteName, "Bob")
+	require.NotEqual(t, list[0].Fingerprint, list[1].Fingerprint)
+	require.True(t, list[0].Backfilled)
+	require.Equal(t, list[0].FirstSeenAt, now)
+	require.Equal(t, clubActivityFingerprint("Jane D.", &renamed), list[0].Fingerprint)
+}
+
+func TestRankLeaderboard(t *testing.T) {
+	rows := []*model.StravaClubLeaderboard{
+		{AthleteName: "Bob", Distance: 5000, MovingTime: 3600},
+		{AthleteName: "Jane", Distance: 8000, MovingTime: 2400},
+		{AthleteName: "Amy", Distance: 5000, MovingTime: 1200},
+	}
+
+	distance := rankLeaderboard(rows, func(m *model.StravaClubLeaderboard) float64 { return m.Distance })
+	require.Equal(t, distance[0].AthleteName, "Jane")
+	require.Equal(t, distance[0].Rank, 1)
+	require.Equal(t, distance[1].AthleteName, "Amy")
+	require.Equal(t, distance[1].Rank, 2)
+	require.Equal(t, distance[2].Rank, 2)
+
+	movingTime := rankLeaderboard(rows, func(m *model.StravaClubLeaderboard) float64 { return float64(m.MovingTime) })
+	require.Equal(t, movingTime[0].AthleteName, "Bob")
+	require.Equal(t, movingTime[2].Rank, 3)
+	// 不修改原来的顺序
+	require.Equal(t, rows[0].AthleteName, "Bob")
+}
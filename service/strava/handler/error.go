@@ -1,12 +1,28 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
 )
 
 var (
-	ErrStravaAPI   = ex.NewError(http.StatusServiceUnavailable, 240001, "strava api error")
-	ErrStravaToken = ex.NewError(http.StatusServiceUnavailable, 240002, "strava oauth2 token error")
+	ErrStravaAPI      = ex.NewError(http.StatusServiceUnavailable, 240001, "strava api error")
+	ErrStravaToken    = ex.NewError(http.StatusServiceUnavailable, 240002, "strava oauth2 token error")
+	ErrStravaNotFound = ex.NewError(http.StatusNotFound, 240003, "strava resource not found")
+	ErrStravaAuth     = ex.NewError(http.StatusUnauthorized, 240004, "strava unauthorized")
 )
+
+// stravaErr 将 strava api 的错误转换为 ex.Error, 不存在和未授权的错误重试也不会成功
+func stravaErr(err error) *ex.Error {
+	switch {
+	case errors.Is(err, strava.ErrNotFound):
+		return ErrStravaNotFound.Wrap(err)
+	case errors.Is(err, strava.ErrUnauthorized):
+		return ErrStravaAuth.Wrap(err)
+	default:
+		return ErrStravaAPI.Wrap(err)
+	}
+}
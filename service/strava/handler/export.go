@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/happyxhw/pkg/log"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/track"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// ExportActivity 使用保存的数据流导出活动 gpx, tcx, 没有 gps 的活动 gpx 只包含活动信息
+func (s *Strava) ExportActivity(ctx context.Context, athleteID int64, req *types.ExportActivityReq) (*types.File, error) {
+	detailed, err := s.sr.GetDetailedActivity(ctx, req.ID, athleteID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if detailed == nil {
+		return nil, ex.ErrNotFound.Msg("activity not found")
+	}
+	stream, err := s.sr.GetStreamSet(ctx, detailed.ID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	start, err := s.activityStart(ctx, detailed)
+	if err != nil {
+		return nil, err
+	}
+
+	t := activityTrack(detailed, stream, start)
+
+	var buf bytes.Buffer
+	file := types.File{Name: fmt.Sprintf("activity_%d.%s", detailed.ID, req.Format)}
+	switch req.Format {
+	case tcxFormat:
+		laps, lapErr := s.sr.GetLaps(ctx, []int64{detailed.ID}, query.Opt{})
+		if lapErr != nil {
+			return nil, ex.ErrDB.Wrap(lapErr)
+		}
+		t.Type = tcxSport(detailed.Type)
+		t.Laps = activityLaps(detailed, laps, stream, start)
+		file.ContentType = tcxContentType
+		err = track.WriteTCXActivity(&buf, t)
+	default:
+		file.Name = fmt.Sprintf("activity_%d.%s", detailed.ID, gpxFormat)
+		file.ContentType = gpxContentType
+		err = track.WriteGPX(&buf, t)
+	}
+	if err != nil {
+		return nil, ex.ErrInternal.Wrap(err)
+	}
+	file.Data = buf.Bytes()
+
+	return &file, nil
+}
+
+// activityStart 活动的 utc 开始时间, start_date_local 是当地时间, 优先使用 start_date, 其次是原始数据中的 start_date
+func (s *Strava) activityStart(ctx context.Context, detailed *model.StravaActivityDetail) (time.Time, error) {
+	if detailed.StartDate != nil && !detailed.StartDate.IsZero() {
+		return *detailed.StartDate, nil
+	}
+	raw, err := s.sr.GetActivityRaw(ctx, detailed.ID, query.Opt{})
+	if err != nil {
+		return time.Time{}, ex.ErrDB.Wrap(err)
+	}
+	if raw != nil && raw.Data != "" {
+		var data struct {
+			StartDate time.Time `json:"start_date"`
+		}
+		if err = json.Unmarshal([]byte(raw.Data), &data); err != nil {
+			log.Error("parse strava activity raw", zap.Int64("id", detailed.ID), zap.Error(err), log.CTX(ctx))
+		} else if !data.StartDate.IsZero() {
+			return data.StartDate, nil
+		}
+	}
+
+	return detailed.StartDateLocal, nil
+}
+
+// activityTrack 以时间流为准逐点组合数据流, 长度不一致的数据流被忽略
+func activityTrack(detailed *model.StravaActivityDetail, stream *model.StravaActivityStream, start time.Time) *track.Track {
+	t := track.Track{
+		Name:        detailed.Name,
+		Description: detailed.Description,
+		Type:        detailed.Type,
+		Time:        start,
+	}
+	if stream == nil || stream.TimeStream == nil {
+		return &t
+	}
+	n := len(stream.TimeStream.Data)
+	for i, offset := range stream.TimeStream.Data {
+		p := track.Point{Time: start.Add(time.Duration(offset) * time.Second)}
+		if stream.LatlngStream != nil && len(stream.LatlngStream.Data) == n {
+			if item := stream.LatlngStream.Data[i]; item != nil && len(*item) == 2 {
+				p.Position = &track.LatLng{Lat: (*item)[0], Lng: (*item)[1]}
+			}
+		}
+		if stream.AltitudeStream != nil && len(stream.AltitudeStream.Data) == n {
+			p.Ele = &stream.AltitudeStream.Data[i]
+		}
+		if stream.DistanceStream != nil && len(stream.DistanceStream.Data) == n {
+			p.Distance = &stream.DistanceStream.Data[i]
+		}
+		if stream.HeartrateStream != nil && len(stream.HeartrateStream.Data) == n {
+			p.HeartRate = &stream.HeartrateStream.Data[i]
+		}
+		if stream.CadenceStream != nil && len(stream.CadenceStream.Data) == n {
+			p.Cadence = &stream.CadenceStream.Data[i]
+		}
+		if stream.WattsStream != nil && len(stream.WattsStream.Data) == n {
+			p.Power = &stream.WattsStream.Data[i]
+		}
+		if stream.TempStream != nil && len(stream.TempStream.Data) == n {
+			temp := float64(stream.TempStream.Data[i])
+			p.Temp = &temp
+		}
+		t.Points = append(t.Points, &p)
+	}
+
+	return &t
+}
+
+// activityLaps tcx 的圈: 优先使用活动的圈数据, 其次是每公里数据, 都没有时整个活动为一圈, 卡路里按用时分配到每圈
+func activityLaps(detailed *model.StravaActivityDetail, laps []*model.StravaActivityLap,
+	stream *model.StravaActivityStream, start time.Time) []*track.Lap {
+	var times []int
+	var distance []float64
+	if stream != nil && stream.TimeStream != nil {
+		times = stream.TimeStream.Data
+		if stream.DistanceStream != nil && len(stream.DistanceStream.Data) == len(times) {
+			distance = stream.DistanceStream.Data
+		}
+	}
+	n := len(times)
+
+	var r []*track.Lap
+	switch {
+	case len(laps) > 0:
+		for _, item := range laps {
+			r = append(r, &track.Lap{
+				Start:     minInt(item.StartIndex, n),
+				End:       minInt(item.EndIndex+1, n),
+				TotalTime: float64(item.ElapsedTime),
+				Distance:  item.Distance,
+			})
+		}
+	case len(detailed.SplitsMetricJSON) > 0:
+		// 按累计距离确定每段的点, 没有距离数据流时按累计用时, 都没有时每段都不包含点
+		var index int
+		var totalDistance, totalTime float64
+		for _, item := range detailed.SplitsMetricJSON {
+			lap := track.Lap{Start: index, TotalTime: float64(item.ElapsedTime), Distance: item.Distance}
+			totalDistance += item.Distance
+			totalTime += float64(item.ElapsedTime)
+			if distance != nil {
+				for index < n && distance[index] < totalDistance {
+					index++
+				}
+			} else {
+				for index < n && float64(times[index]) < totalTime {
+					index++
+				}
+			}
+			lap.End = index
+			r = append(r, &lap)
+		}
+		// 最后一段距离的误差
+		r[len(r)-1].End = n
+	default:
+		return nil
+	}
+
+	var offset, elapsed, cumulative float64
+	for _, item := range r {
+		elapsed += item.TotalTime
+	}
+	var assigned int
+	for i, item := range r {
+		if item.Start < item.End {
+			offset = float64(times[item.Start])
+		}
+		item.Time = start.Add(time.Duration(offset) * time.Second)
+		offset += item.TotalTime
+		// 按累计用时分配, 保证每圈之和等于总卡路里
+		cumulative += item.TotalTime
+		calories := detailed.Calories
+		if i < len(r)-1 {
+			calories = 0
+			if elapsed > 0 {
+				calories = detailed.Calories * cumulative / elapsed
+			}
+		}
+		item.Calories = int(math.Round(calories)) - assigned
+		assigned += item.Calories
+	}
+
+	return r
+}
+
+// tcxSport tcx 只区分跑步和骑行
+func tcxSport(activityType string) string {
+	switch strings.ToLower(activityType) {
+	case Run, "virtualrun", "trailrun":
+		return track.SportRunning
+	case Ride, VirtualRide, "ebikeride", "mountainbikeride", "gravelride", "handcycle", "velomobile":
+		return track.SportBiking
+	}
+	return track.SportOther
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
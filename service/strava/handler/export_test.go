@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/pkg/track"
+)
+
+func TestActivityTrack(t *testing.T) {
+	start := time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)
+	detailed := model.StravaActivityDetail{ID: 2001, Name: "Morning Run", Type: "Run"}
+	stream := model.StravaActivityStream{
+		TimeStream:      &strava.TimeStream{Data: []int{0, 1, 3}},
+		LatlngStream:    &strava.LatLngStream{Data: []*strava.LatLng{{31.2304, 121.4737}, {31.23043, 121.47373}, {31.23046, 121.47376}}},
+		AltitudeStream:  &strava.AltitudeStream{Data: []float64{5.1, 5.2, 5.2}},
+		HeartrateStream: &strava.HeartrateStream{Data: []int{120, 125, 131}},
+		WattsStream:     &strava.PowerStream{Data: []int{200, 210}},
+		TempStream:      &strava.TemperatureStream{Data: []int{21, 21, 22}},
+	}
+
+	tr := activityTrack(&detailed, &stream, start)
+
+	require.Len(t, tr.Points, 3)
+	require.Equal(t, tr.Points[2].Time, start.Add(3*time.Second))
+	require.Equal(t, tr.Points[1].Position.Lat, 31.23043)
+	require.Equal(t, *tr.Points[2].HeartRate, 131)
+	require.Equal(t, *tr.Points[2].Temp, 22.0)
+	require.Nil(t, tr.Points[0].Power)
+	require.Nil(t, tr.Points[0].Cadence)
+
+	var buf bytes.Buffer
+	require.NoError(t, track.WriteGPX(&buf, tr))
+	require.Contains(t, buf.String(), "<gpxtpx:hr>131</gpxtpx:hr>")
+}
+
+func TestActivityTrack_Indoor(t *testing.T) {
+	start := time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)
+	detailed := model.StravaActivityDetail{ID: 2003, Name: "Treadmill", Type: "Run"}
+	stream := model.StravaActivityStream{
+		TimeStream:      &strava.TimeStream{Data: []int{0, 1}},
+		HeartrateStream: &strava.HeartrateStream{Data: []int{120, 125}},
+	}
+
+	tr := activityTrack(&detailed, &stream, start)
+	require.Len(t, tr.Points, 2)
+	require.Nil(t, tr.Points[0].Position)
+
+	require.Empty(t, activityTrack(&detailed, nil, start).Points)
+
+	var buf bytes.Buffer
+	require.NoError(t, track.WriteGPX(&buf, tr))
+	require.Contains(t, buf.String(), "<name>Treadmill</name>")
+	require.NotContains(t, buf.String(), "<trkpt")
+}
+
+func TestActivityLaps(t *testing.T) {
+	start := time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)
+	detailed := model.StravaActivityDetail{
+		ID:       2001,
+		Calories: 100,
+		SplitsMetricJSON: []*strava.Split{
+			{Distance: 1000, ElapsedTime: 300},
+			{Distance: 1000, ElapsedTime: 310},
+			{Distance: 500, ElapsedTime: 150},
+		},
+	}
+	stream := model.StravaActivityStream{
+		TimeStream:     &strava.TimeStream{Data: []int{0, 300, 610, 760}},
+		DistanceStream: &strava.DistanceStream{Data: []float64{0, 1000, 2000, 2500}},
+	}
+
+	laps := activityLaps(&detailed, nil, &stream, start)
+
+	require.Len(t, laps, 3)
+	require.Equal(t, laps[0].Start, 0)
+	require.Equal(t, laps[0].End, 1)
+	require.Equal(t, laps[1].Start, 1)
+	require.Equal(t, laps[1].End, 2)
+	require.Equal(t, laps[2].End, 4)
+	require.Equal(t, laps[1].Time, start.Add(300*time.Second))
+	require.Equal(t, laps[0].Calories+laps[1].Calories+laps[2].Calories, 100)
+	require.Equal(t, laps[0].Calories, 39)
+
+	lapData := []*model.StravaActivityLap{
+		{StartIndex: 0, EndIndex: 1, ElapsedTime: 300, Distance: 1000},
+		{StartIndex: 2, EndIndex: 3, ElapsedTime: 460, Distance: 1500},
+	}
+	laps = activityLaps(&detailed, lapData, &stream, start)
+	require.Len(t, laps, 2)
+	require.Equal(t, laps[1].Start, 2)
+	require.Equal(t, laps[1].End, 4)
+	require.Equal(t, laps[1].Time, start.Add(610*time.Second))
+
+	// 没有数据流时按用时累加, 每圈都不包含点
+	laps = activityLaps(&detailed, lapData, nil, start)
+	require.Equal(t, laps[1].Time, start.Add(300*time.Second))
+	for _, item := range laps {
+		require.Equal(t, item.Start, item.End)
+	}
+
+	// 没有距离数据流时按累计用时确定每公里的点
+	stream.DistanceStream = nil
+	laps = activityLaps(&detailed, nil, &stream, start)
+	require.Len(t, laps, 3)
+	require.Equal(t, laps[0].End, 1)
+	require.Equal(t, laps[1].Start, 1)
+	require.Equal(t, laps[1].End, 2)
+	require.Equal(t, laps[2].Start, 2)
+	require.Equal(t, laps[2].End, 4)
+	require.Equal(t, laps[2].Time, start.Add(610*time.Second))
+
+	require.Nil(t, activityLaps(&model.StravaActivityDetail{}, nil, &stream, start))
+}
+
+func TestTCXSport(t *testing.T) {
+	require.Equal(t, tcxSport("Run"), track.SportRunning)
+	require.Equal(t, tcxSport("VirtualRide"), track.SportBiking)
+	require.Equal(t, tcxSport("Swim"), track.SportOther)
+}
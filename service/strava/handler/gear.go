@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/happyxhw/pkg/log"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/oauth2x"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// ListGear 用户的装备及已导入活动的累计距离, 时间
+func (s *Strava) ListGear(ctx context.Context, athleteID int64) ([]*types.Gear, error) {
+	gears, err := s.sr.GetAllGear(ctx, athleteID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	ids := make([]string, 0, len(gears))
+	for _, item := range gears {
+		ids = append(ids, item.ID)
+	}
+	stats, err := s.sr.GetGearStats(ctx, athleteID, ids)
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	list := types.NewGearList(gears, stats)
+	for i, item := range gears {
+		list[i].Retire = gearExceeded(item, stats[item.ID])
+	}
+
+	return list, nil
+}
+
+func (s *Strava) GetGear(ctx context.Context, athleteID int64, gearID string) (*types.Gear, error) {
+	gear, stats, err := s.gearWithStats(ctx, athleteID, gearID)
+	if err != nil {
+		return nil, err
+	}
+	r := types.NewGear(gear, stats)
+	r.Retire = gearExceeded(gear, stats)
+
+	return r, nil
+}
+
+// UpdateGear 设置报废提醒, 重新设置后重置提醒标记, 设置时已经超过的由 checkGearAlert 发送提醒
+func (s *Strava) UpdateGear(ctx context.Context, athleteID int64, req *types.UpdateGearReq) (*types.Gear, error) {
+	gear, stats, err := s.gearWithStats(ctx, athleteID, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	gear.RetireDistance = req.RetireDistance
+	gear.RetireTime = req.RetireTime
+	gear.Alerted = false
+
+	now := time.Now()
+	params := model.StravaGearParam{
+		RetireDistance: &gear.RetireDistance,
+		RetireTime:     &gear.RetireTime,
+		Alerted:        &gear.Alerted,
+		UpdatedAt:      &now,
+	}
+	if _, err = s.sr.UpdateGear(ctx, athleteID, gear.ID, &params); err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	// 提醒邮件发送失败不影响设置, 下次导入活动时重新检查
+	if err = s.checkGearAlert(ctx, athleteID, gear.ID); err != nil {
+		log.Error("check strava gear alert", zap.String("gear_id", gear.ID), zap.Error(err), log.CTX(ctx))
+	}
+	r := types.NewGear(gear, stats)
+	r.Retire = gearExceeded(gear, stats)
+
+	return r, nil
+}
+
+func (s *Strava) gearWithStats(ctx context.Context, athleteID int64, gearID string) (*model.StravaGear, *model.StravaGearStats, error) {
+	gear, err := s.sr.GetGear(ctx, athleteID, gearID, query.Opt{})
+	if err != nil {
+		return nil, nil, ex.ErrDB.Wrap(err)
+	}
+	if gear == nil {
+		return nil, nil, ex.ErrNotFound.Msg("gear not found")
+	}
+	stats, err := s.sr.GetGearStats(ctx, athleteID, []string{gearID})
+	if err != nil {
+		return nil, nil, ex.ErrDB.Wrap(err)
+	}
+
+	return gear, stats[gearID], nil
+}
+
+// newGear 活动使用的装备还没有保存, 或者保存的时间超过 gearRefreshInterval 时从 strava 拉取,
+// 更新名称, strava 上的累计距离等, 最近刷新过的装备不再重复请求
+func (s *Strava) newGear(ctx context.Context, cli *strava.Client, athleteID int64, gearID string) (*model.StravaGear, error) {
+	if gearID == "" {
+		return nil, nil
+	}
+	gear, err := s.sr.GetGear(ctx, athleteID, gearID, query.Fields("id", "updated_at"))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if gear != nil && time.Since(gear.UpdatedAt) < gearRefreshInterval {
+		return nil, nil
+	}
+	data, err := cli.Gear.Gear(ctx, gearID)
+	if err != nil {
+		var apiErr *strava.APIError
+		if errors.As(err, &apiErr) && !apiErr.Temporary() {
+			log.Info("strava gear unavailable", zap.String("gear_id", gearID), zap.Error(err), log.CTX(ctx))
+			return nil, nil
+		}
+		return nil, stravaErr(err)
+	}
+
+	return &model.StravaGear{
+		ID:          gearID,
+		AthleteID:   athleteID,
+		Name:        data.Name,
+		BrandName:   data.BrandName,
+		ModelName:   data.ModelName,
+		Description: data.Description,
+		FrameType:   data.FrameType,
+		Primary:     data.Primary,
+		Distance:    data.Distance,
+	}, nil
+}
+
+// checkGearAlert 装备累计距离或者时间超过报废提醒设置时发送邮件, 每次设置只提醒一次
+func (s *Strava) checkGearAlert(ctx context.Context, athleteID int64, gearID string) error {
+	gear, err := s.sr.GetGear(ctx, athleteID, gearID, query.Opt{})
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	if gear == nil || gear.Alerted || (gear.RetireDistance <= 0 && gear.RetireTime <= 0) {
+		return nil
+	}
+	stats, err := s.sr.GetGearStats(ctx, athleteID, []string{gearID})
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	if !gearExceeded(gear, stats[gearID]) {
+		return nil
+	}
+	user, err := s.ur.GetBySource(ctx, oauth2x.StravaSource, athleteID, query.Fields("id", "email"))
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	if user == nil || user.Email == "" {
+		return nil
+	}
+	claimed, err := s.sr.ClaimGearAlert(ctx, athleteID, gearID)
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	if !claimed {
+		return nil
+	}
+
+	subj, body := getGearAlertContent(gear, stats[gearID])
+	if err = s.mailer.Send(user.Email, subj, body); err != nil {
+		// 发送失败时取消标记, 下次导入活动时重新发送
+		alerted := false
+		if _, dbErr := s.sr.UpdateGear(ctx, athleteID, gearID, &model.StravaGearParam{Alerted: &alerted}); dbErr != nil {
+			log.Error("reset strava gear alert", zap.String("gear_id", gearID), zap.Error(dbErr), log.CTX(ctx))
+		}
+		return ex.ErrInternal.Wrap(err)
+	}
+	log.Info("strava gear alert sent", zap.Int64("athlete_id", athleteID), zap.String("gear_id", gearID), log.CTX(ctx))
+
+	return nil
+}
+
+// gearExceeded 累计距离或者时间是否达到报废提醒设置
+func gearExceeded(gear *model.StravaGear, stats *model.StravaGearStats) bool {
+	if stats == nil {
+		return false
+	}
+	if gear.RetireDistance > 0 && stats.Distance >= gear.RetireDistance {
+		return true
+	}
+	if gear.RetireTime > 0 && stats.MovingTime >= gear.RetireTime {
+		return true
+	}
+	return false
+}
+
+func getGearAlertContent(gear *model.StravaGear, stats *model.StravaGearStats) (subj, body string) {
+	subj = fmt.Sprintf("Time to retire your gear: %s", gear.Name)
+	body = fmt.Sprintf("Your gear <b>%s</b> has been used for %.1f km and %s in %d activities.",
+		gear.Name, stats.Distance/1000, time.Duration(stats.MovingTime)*time.Second, stats.Count)
+	if gear.RetireDistance > 0 {
+		body += fmt.Sprintf("<p>Retirement distance: %.1f km</p>", gear.RetireDistance/1000)
+	}
+	if gear.RetireTime > 0 {
+		body += fmt.Sprintf("<p>Retirement time: %s</p>", time.Duration(gear.RetireTime)*time.Second)
+	}
+
+	return subj, body
+}
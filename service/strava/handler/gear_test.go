@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/model"
+)
+
+func TestGearExceeded(t *testing.T) {
+	stats := model.StravaGearStats{Distance: 800000, MovingTime: 3600 * 70, Count: 90}
+
+	require.False(t, gearExceeded(&model.StravaGear{}, &stats))
+	require.False(t, gearExceeded(&model.StravaGear{RetireDistance: 800000}, nil))
+	require.True(t, gearExceeded(&model.StravaGear{RetireDistance: 800000}, &stats))
+	require.False(t, gearExceeded(&model.StravaGear{RetireDistance: 900000}, &stats))
+	require.True(t, gearExceeded(&model.StravaGear{RetireDistance: 900000, RetireTime: 3600 * 60}, &stats))
+}
+
+func TestGetGearAlertContent(t *testing.T) {
+	gear := model.StravaGear{Name: "Pegasus", RetireDistance: 800000}
+	stats := model.StravaGearStats{Distance: 801234, MovingTime: 3600 * 70, Count: 90}
+
+	subj, body := getGearAlertContent(&gear, &stats)
+
+	require.Contains(t, subj, "Pegasus")
+	require.Contains(t, body, "801.2 km")
+	require.Contains(t, body, "70h0m0s")
+	require.Contains(t, body, "Retirement distance: 800.0 km")
+	require.NotContains(t, body, "Retirement time")
+}
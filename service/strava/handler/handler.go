@@ -1,9 +1,170 @@
 package handler
 
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+// Mailer 发送邮件, 如: 装备报废提醒
+type Mailer interface {
+	Send(to, subj, body string) error
+}
+
+// Config strava 服务配置
+type Config struct {
+	PurgeOnDeauthorize  bool          `mapstructure:"purge_on_deauthorize"`  // 用户撤销授权后是否删除其 strava 数据
+	PushWorkers         int           `mapstructure:"push_workers"`          // 处理推送事件的 worker 数量
+	PushMaxAttempts     int           `mapstructure:"push_max_attempts"`     // 推送事件最多处理次数, 超过后标记为失败
+	PushBackoff         time.Duration `mapstructure:"push_backoff"`          // 重试退避时间基数, 每次失败后翻倍
+	BackfillInterval    time.Duration `mapstructure:"backfill_interval"`     // 同一个用户导入两个活动之间的间隔, 避免超过 strava 的频率限制
+	BackfillPageSize    int           `mapstructure:"backfill_page_size"`    // 历史活动导入每页的活动数
+	SubscriptionID      int64         `mapstructure:"subscription_id"`       // 推送订阅 id, 为空时在后台通过 strava api 查询
+	UploadPollInterval  time.Duration `mapstructure:"upload_poll_interval"`  // 查询上传处理状态的间隔
+	ClubRefreshInterval time.Duration `mapstructure:"club_refresh_interval"` // 刷新俱乐部动态的间隔
+	ArchiveDir          string        `mapstructure:"archive_dir"`           // 个人数据导出文件的保存目录, 必填
+	ArchiveExpire       time.Duration `mapstructure:"archive_expire"`        // 导出文件下载链接的有效期, 过期后删除文件
+	ArchiveURL          string        `mapstructure:"archive_url"`           // 下载链接的绝对地址, 必填, 如: https://iself.example.com/api/strava/archives/download
+	ArchiveSignKey      string        `mapstructure:"archive_sign_key"`      // 下载链接的签名密钥, 必填, 不要与其他密钥共用
+	BaseURL             string        `mapstructure:"-"`                     // strava api 地址, 与 oauth2 配置中的 base_url 一致
+}
+
+// Validate 检查必填的配置, 启动时调用
+func (c *Config) Validate() error {
+	if c.ArchiveDir == "" {
+		return errors.New("strava.archive_dir is required")
+	}
+	if c.ArchiveSignKey == "" {
+		return errors.New("strava.archive_sign_key is required")
+	}
+	// 下载链接会通过邮件发送, 必须是带域名的绝对地址
+	if u, err := url.Parse(c.ArchiveURL); err != nil || !u.IsAbs() || u.Host == "" {
+		return errors.New("strava.archive_url must be an absolute url")
+	}
+	return nil
+}
+
+func (c *Config) withDefault() *Config {
+	r := *c
+	if r.PushWorkers <= 0 {
+		r.PushWorkers = defaultPushWorkers
+	}
+	if r.PushMaxAttempts <= 0 {
+		r.PushMaxAttempts = defaultPushMaxAttempts
+	}
+	if r.PushBackoff <= 0 {
+		r.PushBackoff = defaultPushBackoff
+	}
+	if r.BackfillInterval <= 0 {
+		r.BackfillInterval = defaultBackfillInterval
+	}
+	if r.BackfillPageSize <= 0 {
+		r.BackfillPageSize = defaultBackfillPageSize
+	}
+	if r.UploadPollInterval <= 0 {
+		r.UploadPollInterval = defaultUploadPollInterval
+	}
+	if r.ClubRefreshInterval <= 0 {
+		r.ClubRefreshInterval = defaultClubRefreshInterval
+	}
+	if r.ArchiveExpire <= 0 {
+		r.ArchiveExpire = defaultArchiveExpire
+	}
+	if r.BaseURL == "" {
+		r.BaseURL = strava.BaseURL
+	}
+	return &r
+}
+
+const (
+	defaultPushWorkers     = 4
+	defaultPushMaxAttempts = 5
+	defaultPushBackoff     = time.Second * 30
+
+	// strava 默认限制: 每 15 分钟 100 次, 每天 1000 次, 历史活动导入是低优先级, 最多使用一半的额度, 其余留给推送;
+	// 导入一个活动需要: 活动列表, 详情, 数据流, 区间, 评论, 点赞各一次, 装备每天最多一次, 约 7 次请求
+	backfillActivityRequests = 7
+	defaultBackfillInterval  = time.Minute * 15 * backfillActivityRequests / 50
+	defaultBackfillPageSize  = 30
+	maxBackfillAttempts      = 5
+
+	// strava 建议上传后每隔几秒查询一次处理状态, 通常几秒到一分钟内完成
+	defaultUploadPollInterval = time.Second * 5
+	maxUploadAttempts         = 120
+
+	// 俱乐部动态只返回最近的活动, 没有时间, 刷新间隔越短, 活动时间越准确
+	defaultClubRefreshInterval = time.Hour
+	clubPageSize               = 100
+	maxClubFeedPages           = 5
+
+	// 装备的名称, 累计距离等可能在 strava 上修改, 同步活动时超过间隔重新拉取
+	gearRefreshInterval = time.Hour * 24
+
+	maxPushBackoff   = time.Hour
+	pushPollInterval = time.Second
+	pushTimeout      = time.Minute * 2
+	pushLockTTL      = pushTimeout + time.Minute // 处理超时后锁自动释放
+
+	subscriptionTimeout       = time.Second * 30
+	subscriptionRetryInterval = time.Minute // 查询推送订阅失败后的重试间隔
+)
+
 const (
 	notExistsLabel = "--"
 )
 
+const (
+	socialPageSize       = 200 // strava 评论和点赞列表每页最多 200 个
+	maxSocialPages       = 5
+	socialMonths         = 12
+	defaultCommentedSize = 10
+)
+
+const (
+	gpxFormat      = "gpx"
+	tcxFormat      = "tcx"
+	fitFormat      = "fit"
+	gpxContentType = "application/gpx+xml"
+	tcxContentType = "application/vnd.garmin.tcx+xml"
+
+	routePageSize = 100 // strava 路线列表每页最多 200 个
+
+	defaultRouteActivitySize = 20
+	maxRouteActivitySize     = 100
+
+	// 完成路线的判断: 活动距离不少于路线的 80%, 路线上 90% 的点在活动轨迹 100 米以内
+	routeMinDistanceRatio = 0.8
+	routeMatchTolerance   = 100.0
+	routeMatchCoverage    = 0.9
+	routeMatchSamples     = 200
+
+	// 路线没有预计用时时使用的速度, 单位 m/s
+	defaultRideSpeed = 25 / 3.6
+	defaultRunSpeed  = 10 / 3.6
+)
+
+const (
+	maxImportFileSize     = 100 << 20 // 导入的文件解压后的大小限制
+	summaryPolylinePoints = 200       // 导入活动的 summary polyline 最多的点数
+	splitDistance         = 1000.0    // 每公里数据, 单位米
+
+	// 导入活动的数据流不降采样, 以时间为序列
+	streamResolution = "high"
+	streamSeriesType = "time"
+)
+
+const (
+	defaultArchiveExpire = time.Hour * 24 * 7
+	archiveCleanInterval = time.Hour // 删除过期导出文件的间隔
+	archivePageSize      = 50        // 导出时每次读取的活动数
+	maxArchiveAttempts   = 3
+
+	// 每个用户两次导出的最小间隔, 下载链接有效期内最多保留 archive_expire / 间隔 个文件
+	archiveCreateInterval = time.Hour * 24
+)
+
 var unitMap = map[string]string{
 	"distance":    "km",
 	"moving_time": "s",
@@ -24,6 +185,7 @@ const (
 	All         = "all"
 	Run         = "run"
 	Ride        = "ride"
+	Swim        = "swim"
 	VirtualRide = "virtualride"
 )
 
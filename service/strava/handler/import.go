@@ -0,0 +1,732 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1" //nolint:gosec // 只用于判断是否重复导入
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/fit"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/pkg/track"
+	"github.com/happyxhw/iself/repo"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// importDataTypes 支持本地导入的文件类型
+var importDataTypes = []string{fitFormat, gpxFormat, tcxFormat}
+
+// importSources 导入的文件类型对应的活动来源
+var importSources = map[string]model.ActivitySource{
+	fitFormat: model.ActivityFITSource,
+	gpxFormat: model.ActivityGPXSource,
+	tcxFormat: model.ActivityTCXSource,
+}
+
+// trackActivityTypes gpx 的 type, tcx 的 Sport 转换为 strava 的活动类型, 键为小写
+var trackActivityTypes = map[string]string{
+	"run":             "Run",
+	"running":         "Run",
+	"trail_running":   "Run",
+	"virtualrun":      "VirtualRun",
+	"ride":            "Ride",
+	"biking":          "Ride",
+	"cycling":         "Ride",
+	"road_biking":     "Ride",
+	"mountain_biking": "Ride",
+	"virtualride":     "VirtualRide",
+	"ebikeride":       "EBikeRide",
+	"e_biking":        "EBikeRide",
+	"walk":            "Walk",
+	"walking":         "Walk",
+	"hike":            "Hike",
+	"hiking":          "Hike",
+	"swim":            "Swim",
+	"swimming":        "Swim",
+}
+
+var errImportTooLarge = errors.New("file too large")
+
+// ImportActivity 本地解析活动文件并导入, 不经过 strava, 生成的活动 id 为负数; 同一个文件只能导入一次
+func (s *Strava) ImportActivity(ctx context.Context, athleteID int64, req *types.ImportActivityReq,
+	filename string, file io.Reader) (*types.DetailedActivity, error) {
+	format, gzipped := importFormat(filename)
+	if format == "" {
+		return nil, ex.ErrParam.Msg("unsupported file type, fit, gpx, tcx and gzipped files are supported")
+	}
+	data, err := readImportFile(file, gzipped)
+	if err != nil {
+		return nil, ex.ErrParam.Wrap(err)
+	}
+	sum := sha1.Sum(data) //nolint:gosec
+	externalID := hex.EncodeToString(sum[:])
+	existed, err := s.sr.GetActivityByExternalID(ctx, athleteID, externalID, query.Fields("id"))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if existed != nil {
+		return nil, ex.ErrConflict.Msg(fmt.Sprintf("file already imported as activity %d", existed.ID))
+	}
+
+	activityData, streamSet, err := readImportActivity(athleteID, format, data)
+	if err != nil {
+		return nil, err
+	}
+	applyImportReq(activityData, req)
+
+	ids, err := s.sr.NextLocalIDs(ctx, len(activityData.Laps)+1)
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	activityID := ids[0]
+	for i, item := range activityData.Laps {
+		item.Id = ids[i+1]
+	}
+	detailedActivityData := newDetailedActivityModel(activityID, activityData)
+	detailedActivityData.ExternalID = externalID
+	detailedActivityData.Source = int(importSources[format])
+	streamData := newStreamSetModel(activityID, streamSet)
+	lapData := newLapModels(activityID, athleteID, activityData.Laps)
+
+	err = s.transRepo.Exec(ctx, func(ctx context.Context) error {
+		if txErr := s.sr.CreateDetailedActivity(ctx, detailedActivityData); txErr != nil {
+			return txErr
+		}
+		if txErr := s.sr.CreateStreamSet(ctx, streamData); txErr != nil {
+			return txErr
+		}
+		return s.sr.UpsertLaps(ctx, activityID, lapData)
+	})
+	if err != nil {
+		// 并发导入同一个文件, 唯一索引冲突
+		if repo.IsDuplicateKey(err) {
+			return nil, ex.ErrConflict.Msg("file already imported")
+		}
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	return types.NewDetailedActivity(detailedActivityData), nil
+}
+
+// importFormat 根据文件扩展名判断导入的文件类型, 如: run.fit.gz -> fit, true, 不支持时返回空
+func importFormat(filename string) (string, bool) {
+	dataType := uploadDataType(filename)
+	format := strings.TrimSuffix(dataType, ".gz")
+	for _, item := range importDataTypes {
+		if format == item {
+			return format, format != dataType
+		}
+	}
+	return "", false
+}
+
+// readImportFile 读取文件内容, gzip 压缩的文件解压后读取, 解压后超过 maxImportFileSize 时返回错误
+func readImportFile(file io.Reader, gzipped bool) ([]byte, error) {
+	r := file
+	if gzipped {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = zr.Close() }()
+		r = zr
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxImportFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportFileSize {
+		return nil, errImportTooLarge
+	}
+	return data, nil
+}
+
+// readImportActivity 解析文件, 生成与 strava 格式相同的活动和数据流
+func readImportActivity(athleteID int64, format string, data []byte) (*strava.DetailedActivity, *strava.StreamSet, error) {
+	var t *track.Track
+	var err error
+	switch format {
+	case fitFormat:
+		f, decodeErr := fit.Decode(bytes.NewReader(data))
+		if decodeErr != nil {
+			return nil, nil, ex.ErrParam.Wrap(decodeErr)
+		}
+		return newFITActivity(athleteID, f)
+	case gpxFormat:
+		t, err = track.ReadGPX(bytes.NewReader(data))
+	default:
+		t, err = track.ReadTCX(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, nil, ex.ErrParam.Wrap(err)
+	}
+	return newTrackActivity(athleteID, t)
+}
+
+// applyImportReq 请求中的名称, 描述覆盖文件中的值, trainer 为 true 时覆盖文件中的运动类型
+func applyImportReq(activityData *strava.DetailedActivity, req *types.ImportActivityReq) {
+	if req.Name != "" {
+		activityData.Name = req.Name
+	}
+	if req.Description != "" {
+		activityData.Description = req.Description
+	}
+	activityData.Trainer = activityData.Trainer || req.Trainer
+	activityData.Commute = req.Commute
+}
+
+// newFITActivity 生成与 strava 格式相同的活动和数据流, session 中没有的统计数据由 record 计算;
+// 多项运动的文件有多个 session, 统计数据都由 record 计算, 活动类型使用第一个 session
+func newFITActivity(athleteID int64, f *fit.File) (*strava.DetailedActivity, *strava.StreamSet, error) {
+	points := fitPoints(f.Records)
+	if len(points) == 0 && len(f.Sessions) == 0 {
+		return nil, nil, ex.ErrParam.Msg("no activity data in file")
+	}
+	var session *fit.Session
+	var fs *fit.Summary
+	if len(f.Sessions) > 0 {
+		session = f.Sessions[0]
+	}
+	if len(f.Sessions) == 1 {
+		fs = &session.Summary
+	}
+
+	start := fitStart(f, session, points)
+	offset := fitLocalOffset(f)
+	activityType, trainer := fitActivityType(session)
+
+	activityData, streamSet := newImportedActivity(athleteID, points, fitSummary(fs, points), activityType, start, offset)
+	activityData.DeviceName = fitDeviceName(f)
+	activityData.Trainer = trainer
+	activityData.Laps = newFITLaps(f.Laps, points, offset)
+
+	return activityData, streamSet, nil
+}
+
+// newTrackActivity gpx, tcx 的轨迹生成活动, 统计数据由轨迹点计算, tcx 的圈使用文件中的用时, 距离和卡路里;
+// 文件中没有时区, 当地时间按起点的经度估算
+func newTrackActivity(athleteID int64, t *track.Track) (*strava.DetailedActivity, *strava.StreamSet, error) {
+	points := t.Points
+	if len(points) == 0 {
+		return nil, nil, ex.ErrParam.Msg("no track points in file")
+	}
+	for _, p := range points {
+		if p.Time.IsZero() {
+			return nil, nil, ex.ErrParam.Msg("track points without time are not supported")
+		}
+	}
+
+	start := points[0].Time
+	offset := longitudeOffset(points)
+	summary := track.Summarize(points)
+	var calories int
+	for _, item := range t.Laps {
+		calories += item.Calories
+	}
+	if calories > 0 {
+		summary.Calories = float64(calories)
+	}
+
+	activityData, streamSet := newImportedActivity(athleteID, points, summary, trackActivityType(t.Type), start, offset)
+	if t.Name != "" {
+		activityData.Name = t.Name
+	}
+	activityData.Description = t.Description
+	activityData.Laps = newTrackLaps(t.Laps, points, offset)
+
+	return activityData, streamSet, nil
+}
+
+// newImportedActivity 由统计数据和轨迹点生成活动的基本信息, 地图, 每公里数据和数据流, 设备, 圈等由调用方设置
+func newImportedActivity(athleteID int64, points []*track.Point, summary *track.Summary, activityType string,
+	start time.Time, offset time.Duration) (*strava.DetailedActivity, *strava.StreamSet) {
+	distances := track.Distances(points)
+	moving := track.Moving(points, distances)
+
+	activityData := strava.DetailedActivity{
+		Athlete:            &strava.MetaAthlete{ID: athleteID},
+		Name:               importName(activityType, start.Add(offset)),
+		Type:               activityType,
+		Distance:           summary.Distance,
+		MovingTime:         summary.MovingTime,
+		ElapsedTime:        summary.ElapsedTime,
+		TotalElevationGain: summary.ElevationGain,
+		StartDate:          start,
+		StartDateLocal:     start.Add(offset),
+		AverageSpeed:       summary.AverageSpeed,
+		MaxSpeed:           summary.MaxSpeed,
+		AverageHeartrate:   summary.AverageHeartRate,
+		MaxHeartrate:       summary.MaxHeartRate,
+		ElevHigh:           summary.ElevHigh,
+		ElevLow:            summary.ElevLow,
+		Calories:           summary.Calories,
+		AverageWatts:       summary.AverageWatts,
+		SplitsMetric:       newSplits(points, distances, moving),
+	}
+	var positions []track.LatLng
+	for _, p := range points {
+		if p.Position != nil {
+			positions = append(positions, *p.Position)
+		}
+	}
+	if len(positions) > 0 {
+		activityData.Map = &strava.PolylineMap{
+			Polyline:        track.EncodePolyline(positions),
+			SummaryPolyline: track.EncodePolyline(samplePositions(positions, summaryPolylinePoints)),
+		}
+	}
+
+	return &activityData, newTrackStreamSet(points, start, distances, moving)
+}
+
+// fitPoints record 转换为轨迹点, 没有时间的 record 被忽略
+func fitPoints(records []*fit.Record) []*track.Point {
+	r := make([]*track.Point, 0, len(records))
+	for _, item := range records {
+		if item.Timestamp.IsZero() {
+			continue
+		}
+		p := track.Point{
+			Time:      item.Timestamp,
+			Ele:       item.Altitude,
+			Distance:  item.Distance,
+			Speed:     item.Speed,
+			HeartRate: item.HeartRate,
+			Cadence:   item.Cadence,
+			Power:     item.Power,
+		}
+		if item.Lat != nil && item.Lng != nil {
+			p.Position = &track.LatLng{Lat: *item.Lat, Lng: *item.Lng}
+		}
+		if item.Temperature != nil {
+			temp := float64(*item.Temperature)
+			p.Temp = &temp
+		}
+		r = append(r, &p)
+	}
+	return r
+}
+
+// fitStart 开始时间: session 的开始时间, 第一个 record 的时间, 文件的创建时间
+func fitStart(f *fit.File, session *fit.Session, points []*track.Point) time.Time {
+	switch {
+	case session != nil && !session.StartTime.IsZero():
+		return session.StartTime
+	case len(points) > 0:
+		return points[0].Time
+	case f.FileID != nil:
+		return f.FileID.TimeCreated
+	}
+	return time.Time{}
+}
+
+// fitLocalOffset activity 消息中当地时间与 utc 的差, 取整到 15 分钟, 没有时为 0
+func fitLocalOffset(f *fit.File) time.Duration {
+	if f.Activity == nil || f.Activity.Timestamp.IsZero() || f.Activity.LocalTimestamp.IsZero() {
+		return 0
+	}
+	return f.Activity.LocalTimestamp.Sub(f.Activity.Timestamp).Round(time.Minute * 15)
+}
+
+// fitActivityType fit 的运动类型转换为 strava 的活动类型, 跑步机, 骑行台和虚拟活动标记为 trainer
+func fitActivityType(session *fit.Session) (string, bool) {
+	if session == nil {
+		return "Workout", false
+	}
+	switch session.Sport {
+	case fit.SportRunning:
+		switch session.SubSport {
+		case fit.SubSportVirtualActivity:
+			return "VirtualRun", true
+		case fit.SubSportTreadmill:
+			return "Run", true
+		}
+		return "Run", false
+	case fit.SportCycling:
+		switch session.SubSport {
+		case fit.SubSportVirtualActivity:
+			return "VirtualRide", true
+		case fit.SubSportIndoorCycling:
+			return "Ride", true
+		}
+		return "Ride", false
+	case fit.SportEBiking:
+		return "EBikeRide", false
+	case fit.SportSwimming:
+		return "Swim", false
+	case fit.SportWalking:
+		return "Walk", false
+	case fit.SportHiking:
+		return "Hike", false
+	case fit.SportRowing:
+		return "Rowing", false
+	case fit.SportCrossCountrySkiing:
+		return "NordicSki", false
+	case fit.SportAlpineSkiing:
+		return "AlpineSki", false
+	}
+	return "Workout", false
+}
+
+// fitSummary session 或者 lap 中的统计数据优先, 没有的字段使用由 record 计算的值
+//
+//nolint:gocyclo
+func fitSummary(fs *fit.Summary, points []*track.Point) *track.Summary {
+	s := track.Summarize(points)
+	if fs == nil {
+		return s
+	}
+	if fs.TotalDistance != nil {
+		s.Distance = *fs.TotalDistance
+	}
+	if fs.TotalElapsedTime != nil {
+		s.ElapsedTime = int(math.Round(*fs.TotalElapsedTime))
+	}
+	if fs.TotalTimerTime != nil {
+		s.MovingTime = int(math.Round(*fs.TotalTimerTime))
+	}
+	if s.MovingTime > 0 {
+		s.AverageSpeed = s.Distance / float64(s.MovingTime)
+	}
+	if fs.AvgSpeed != nil {
+		s.AverageSpeed = *fs.AvgSpeed
+	}
+	if fs.MaxSpeed != nil {
+		s.MaxSpeed = *fs.MaxSpeed
+	}
+	if fs.TotalAscent != nil {
+		s.ElevationGain = float64(*fs.TotalAscent)
+	}
+	if fs.AvgHeartRate != nil {
+		s.AverageHeartRate = float64(*fs.AvgHeartRate)
+	}
+	if fs.MaxHeartRate != nil {
+		s.MaxHeartRate = float64(*fs.MaxHeartRate)
+	}
+	if fs.AvgCadence != nil {
+		s.AverageCadence = float64(*fs.AvgCadence)
+	}
+	if fs.AvgPower != nil {
+		s.AverageWatts = float64(*fs.AvgPower)
+	}
+	if fs.TotalCalories != nil {
+		s.Calories = float64(*fs.TotalCalories)
+	}
+	return s
+}
+
+// newFITLaps 按时间找到每圈在数据流中的范围, 圈中没有的统计数据由范围内的 record 计算
+func newFITLaps(laps []*fit.Lap, points []*track.Point, offset time.Duration) []*strava.Lap {
+	r := make([]*strava.Lap, 0, len(laps))
+	for i, item := range laps {
+		start := sort.Search(len(points), func(j int) bool { return !points[j].Time.Before(item.StartTime) })
+		end := len(points)
+		if !item.Timestamp.IsZero() {
+			end = sort.Search(len(points), func(j int) bool { return points[j].Time.After(item.Timestamp) })
+		}
+		if end < start {
+			end = start
+		}
+		summary := fitSummary(&item.Summary, points[start:end])
+		startDate := item.StartTime
+		if startDate.IsZero() && start < len(points) {
+			startDate = points[start].Time
+		}
+		r = append(r, newImportedLap(i, summary, start, end, startDate, offset))
+	}
+	return r
+}
+
+// newTrackLaps 圈的统计数据由 Points[Start:End] 计算, 文件中有用时, 距离时使用文件中的值
+func newTrackLaps(laps []*track.Lap, points []*track.Point, offset time.Duration) []*strava.Lap {
+	r := make([]*strava.Lap, 0, len(laps))
+	for i, item := range laps {
+		start := minInt(maxInt(item.Start, 0), len(points))
+		end := minInt(maxInt(item.End, start), len(points))
+		summary := track.Summarize(points[start:end])
+		if item.TotalTime > 0 {
+			summary.ElapsedTime = int(math.Round(item.TotalTime))
+		}
+		if item.Distance > 0 {
+			summary.Distance = item.Distance
+			if summary.MovingTime > 0 {
+				summary.AverageSpeed = summary.Distance / float64(summary.MovingTime)
+			}
+		}
+		startDate := item.Time
+		if startDate.IsZero() && start < len(points) {
+			startDate = points[start].Time
+		}
+		r = append(r, newImportedLap(i, summary, start, end, startDate, offset))
+	}
+	return r
+}
+
+// newImportedLap 第 i 圈, 数据流中的范围为 [start, end)
+func newImportedLap(i int, summary *track.Summary, start, end int, startDate time.Time, offset time.Duration) *strava.Lap {
+	return &strava.Lap{
+		LapIndex:           i + 1,
+		Name:               fmt.Sprintf("Lap %d", i+1),
+		Distance:           summary.Distance,
+		MovingTime:         summary.MovingTime,
+		ElapsedTime:        summary.ElapsedTime,
+		TotalElevationGain: summary.ElevationGain,
+		AverageSpeed:       summary.AverageSpeed,
+		MaxSpeed:           summary.MaxSpeed,
+		AverageHeartrate:   summary.AverageHeartRate,
+		MaxHeartrate:       summary.MaxHeartRate,
+		AverageCadence:     summary.AverageCadence,
+		AverageWatts:       summary.AverageWatts,
+		StartIndex:         start,
+		EndIndex:           maxInt(end-1, start),
+		StartDate:          startDate,
+		StartDateLocal:     startDate.Add(offset),
+	}
+}
+
+// longitudeOffset 按第一个有位置的点的经度估算当地时间与 utc 的差, 每 15 度一小时, 没有位置时为 0
+func longitudeOffset(points []*track.Point) time.Duration {
+	for _, p := range points {
+		if p.Position != nil {
+			return time.Duration(math.Round(p.Position.Lng/15)) * time.Hour
+		}
+	}
+	return 0
+}
+
+// trackActivityType gpx, tcx 中的运动类型转换为 strava 的活动类型, 不支持的类型为 Workout
+func trackActivityType(s string) string {
+	if activityType, ok := trackActivityTypes[strings.ToLower(s)]; ok {
+		return activityType
+	}
+	return "Workout"
+}
+
+// fitDeviceName 设备名称, 如: Garmin Forerunner 955, 部分设备的文件中只有厂商
+func fitDeviceName(f *fit.File) string {
+	var manufacturer *int
+	var product string
+	if d := f.Creator(); d != nil {
+		manufacturer, product = d.Manufacturer, d.ProductName
+	}
+	if manufacturer == nil && f.FileID != nil {
+		manufacturer = f.FileID.Manufacturer
+	}
+	var name string
+	if manufacturer != nil {
+		name = fit.ManufacturerName(*manufacturer)
+	}
+	switch {
+	case product == "":
+		return name
+	case name == "" || strings.HasPrefix(product, name):
+		return product
+	}
+	return name + " " + product
+}
+
+// importName 与 strava 相同的默认名称, 如: Morning Run, Afternoon Virtual Ride
+func importName(activityType string, local time.Time) string {
+	var period string
+	switch h := local.Hour(); {
+	case h >= 4 && h < 11:
+		period = "Morning"
+	case h >= 11 && h < 13:
+		period = "Lunch"
+	case h >= 13 && h < 17:
+		period = "Afternoon"
+	case h >= 17 && h < 21:
+		period = "Evening"
+	default:
+		period = "Night"
+	}
+
+	var b strings.Builder
+	b.WriteString(period)
+	for i, c := range activityType {
+		if i == 0 || (unicode.IsUpper(c) && unicode.IsLower(rune(activityType[i-1]))) {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// newTrackStreamSet 由轨迹点生成数据流, 时间为相对开始时间的秒数; 点上没有速度时由距离计算速度, 有海拔和距离时计算坡度;
+// 与 strava 的数据流一样没有空值, 没有数据的点使用前一个点的值, 开头没有数据的点使用第一个值
+//
+//nolint:gocyclo,funlen
+func newTrackStreamSet(points []*track.Point, start time.Time, distances []float64, moving []bool) *strava.StreamSet {
+	var set strava.StreamSet
+	n := len(points)
+	if n == 0 {
+		return &set
+	}
+
+	times := make([]int, n)
+	for i, p := range points {
+		times[i] = int(math.Round(p.Time.Sub(start).Seconds()))
+	}
+	set.Time = &strava.TimeStream{OriginalSize: n, Resolution: streamResolution,
+		SeriesType: streamSeriesType, Data: times}
+	set.Moving = &strava.MovingStream{OriginalSize: n, Resolution: streamResolution,
+		SeriesType: streamSeriesType, Data: moving}
+	if distances[n-1] > 0 {
+		set.Distance = &strava.DistanceStream{OriginalSize: n, Resolution: streamResolution,
+			SeriesType: streamSeriesType, Data: distances}
+	}
+	if idx := fillIndex(n, func(i int) bool { return points[i].Position != nil }); idx != nil {
+		data := make([]*strava.LatLng, n)
+		for i, j := range idx {
+			data[i] = &strava.LatLng{points[j].Position.Lat, points[j].Position.Lng}
+		}
+		set.Latlng = &strava.LatLngStream{OriginalSize: n, Resolution: streamResolution,
+			SeriesType: streamSeriesType, Data: data}
+	}
+	if idx := fillIndex(n, func(i int) bool { return points[i].Ele != nil }); idx != nil {
+		data := make([]float64, n)
+		for i, j := range idx {
+			data[i] = *points[j].Ele
+		}
+		set.Altitude = &strava.AltitudeStream{OriginalSize: n, Resolution: streamResolution,
+			SeriesType: streamSeriesType, Data: data}
+	}
+	if idx := fillIndex(n, func(i int) bool { return points[i].Speed != nil }); idx != nil {
+		data := make([]float64, n)
+		for i, j := range idx {
+			data[i] = *points[j].Speed
+		}
+		set.VelocitySmooth = &strava.SmoothVelocityStream{OriginalSize: n, Resolution: streamResolution,
+			SeriesType: streamSeriesType, Data: data}
+	} else if set.Distance != nil {
+		set.VelocitySmooth = &strava.SmoothVelocityStream{OriginalSize: n, Resolution: streamResolution,
+			SeriesType: streamSeriesType, Data: track.SmoothVelocity(points, distances)}
+	}
+	if set.Altitude != nil && set.Distance != nil {
+		set.GradeSmooth = &strava.SmoothGradeStream{OriginalSize: n, Resolution: streamResolution,
+			SeriesType: streamSeriesType, Data: track.SmoothGrade(set.Altitude.Data, distances)}
+	}
+	if idx := fillIndex(n, func(i int) bool { return points[i].HeartRate != nil }); idx != nil {
+		data := make([]int, n)
+		for i, j := range idx {
+			data[i] = *points[j].HeartRate
+		}
+		set.Heartrate = &strava.HeartrateStream{OriginalSize: n, Resolution: streamResolution,
+			SeriesType: streamSeriesType, Data: data}
+	}
+	if idx := fillIndex(n, func(i int) bool { return points[i].Cadence != nil }); idx != nil {
+		data := make([]int, n)
+		for i, j := range idx {
+			data[i] = *points[j].Cadence
+		}
+		set.Cadence = &strava.CadenceStream{OriginalSize: n, Resolution: streamResolution,
+			SeriesType: streamSeriesType, Data: data}
+	}
+	if idx := fillIndex(n, func(i int) bool { return points[i].Power != nil }); idx != nil {
+		data := make([]int, n)
+		for i, j := range idx {
+			data[i] = *points[j].Power
+		}
+		set.Watts = &strava.PowerStream{OriginalSize: n, Resolution: streamResolution,
+			SeriesType: streamSeriesType, Data: data}
+	}
+	if idx := fillIndex(n, func(i int) bool { return points[i].Temp != nil }); idx != nil {
+		data := make([]int, n)
+		for i, j := range idx {
+			data[i] = int(math.Round(*points[j].Temp))
+		}
+		set.Temp = &strava.TemperatureStream{OriginalSize: n, Resolution: streamResolution,
+			SeriesType: streamSeriesType, Data: data}
+	}
+
+	return &set
+}
+
+// fillIndex 每个点使用的数据的下标: 没有数据的点使用前一个有数据的点, 开头没有数据的点使用第一个有数据的点, 都没有数据时返回 nil
+func fillIndex(n int, has func(i int) bool) []int {
+	first := -1
+	for i := 0; i < n; i++ {
+		if has(i) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return nil
+	}
+	r := make([]int, n)
+	last := first
+	for i := range r {
+		if has(i) {
+			last = i
+		}
+		r[i] = last
+	}
+	return r
+}
+
+// newSplits 每公里的数据, 最后不足一公里的部分也作为一段, 与 strava 的 splits_metric 一致, 没有距离时为空
+func newSplits(points []*track.Point, distances []float64, moving []bool) []*strava.Split {
+	if len(points) < 2 || distances[len(distances)-1] == 0 {
+		return nil
+	}
+	var r []*strava.Split
+	var movingTime float64
+	start := 0
+	for i := 1; i < len(points); i++ {
+		if moving[i] {
+			movingTime += points[i].Time.Sub(points[i-1].Time).Seconds()
+		}
+		d := distances[i] - distances[start]
+		if d < splitDistance && i < len(points)-1 {
+			continue
+		}
+		split := strava.Split{
+			Split:       len(r) + 1,
+			Distance:    d,
+			ElapsedTime: int(math.Round(points[i].Time.Sub(points[start].Time).Seconds())),
+			MovingTime:  int(math.Round(movingTime)),
+		}
+		if split.MovingTime > 0 {
+			split.AverageSpeed = d / float64(split.MovingTime)
+		}
+		if points[i].Ele != nil && points[start].Ele != nil {
+			split.ElevationDifference = *points[i].Ele - *points[start].Ele
+		}
+		r = append(r, &split)
+		start, movingTime = i, 0
+	}
+	return r
+}
+
+// samplePositions 等间隔取最多 n 个点, 包含第一个和最后一个点
+func samplePositions(positions []track.LatLng, n int) []track.LatLng {
+	if len(positions) <= n {
+		return positions
+	}
+	r := make([]track.LatLng, 0, n)
+	for i := 0; i < n; i++ {
+		r = append(r, positions[i*(len(positions)-1)/(n-1)])
+	}
+	return r
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/pkg/fit"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/pkg/track"
+)
+
+func TestNewFITActivity(t *testing.T) {
+	start := time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)
+	intp := func(v int) *int { return &v }
+	floatp := func(v float64) *float64 { return &v }
+	f := fit.File{
+		FileID:   &fit.FileID{Manufacturer: intp(1)},
+		Activity: &fit.Activity{Timestamp: start.Add(30 * time.Second), LocalTimestamp: start.Add(8*time.Hour + 30*time.Second)},
+		Records: []*fit.Record{
+			{Timestamp: start, Lat: floatp(31.2300), Lng: floatp(121.47), Altitude: floatp(5), HeartRate: intp(120)},
+			{Timestamp: start.Add(10 * time.Second), Lat: floatp(31.2303), Lng: floatp(121.47), Altitude: floatp(6), HeartRate: intp(124)},
+			{Timestamp: start.Add(20 * time.Second), HeartRate: intp(130), Temperature: intp(21)},
+			{Timestamp: start.Add(30 * time.Second), Lat: floatp(31.2309), Lng: floatp(121.47), Altitude: floatp(8), HeartRate: intp(126)},
+			{Lat: floatp(31.2309), Lng: floatp(121.47)},
+		},
+		Laps: []*fit.Lap{
+			{Summary: fit.Summary{StartTime: start, Timestamp: start.Add(30 * time.Second), TotalDistance: floatp(100),
+				TotalCalories: intp(10)}},
+		},
+		Sessions: []*fit.Session{
+			{Summary: fit.Summary{StartTime: start, TotalTimerTime: floatp(30), AvgHeartRate: intp(125)},
+				Sport: fit.SportRunning, SubSport: fit.SubSportTreadmill},
+		},
+		Devices: []*fit.DeviceInfo{{DeviceIndex: intp(0), ProductName: "Forerunner 955"}},
+	}
+
+	activityData, streamSet, err := newFITActivity(2, &f)
+	require.NoError(t, err)
+
+	require.Equal(t, activityData.Athlete.ID, int64(2))
+	require.Equal(t, activityData.Type, "Run")
+	require.True(t, activityData.Trainer)
+	require.Equal(t, activityData.Name, "Morning Run")
+	require.Equal(t, activityData.StartDate, start)
+	require.Equal(t, activityData.StartDateLocal, start.Add(8*time.Hour))
+	require.Equal(t, activityData.DeviceName, "Garmin Forerunner 955")
+	// session 中没有距离, 由位置计算
+	require.InDelta(t, 100, activityData.Distance, 1)
+	require.Equal(t, activityData.MovingTime, 30)
+	require.Equal(t, activityData.ElapsedTime, 30)
+	require.InDelta(t, 3.33, activityData.AverageSpeed, 0.05)
+	require.Equal(t, activityData.AverageHeartrate, 125.0)
+	require.Equal(t, activityData.MaxHeartrate, 130.0)
+	require.Equal(t, activityData.TotalElevationGain, 3.0)
+	require.Len(t, track.DecodePolyline(activityData.Map.Polyline), 3)
+	require.Len(t, activityData.SplitsMetric, 1)
+
+	require.Len(t, activityData.Laps, 1)
+	lap := activityData.Laps[0]
+	require.Equal(t, lap.LapIndex, 1)
+	require.Equal(t, lap.StartIndex, 0)
+	require.Equal(t, lap.EndIndex, 3)
+	require.Equal(t, lap.Distance, 100.0)
+	require.Equal(t, lap.AverageHeartrate, 125.0)
+	require.Equal(t, lap.StartDateLocal, start.Add(8*time.Hour))
+
+	require.Equal(t, streamSet.Time.Data, []int{0, 10, 20, 30})
+	require.Equal(t, *streamSet.Latlng.Data[2], strava.LatLng{31.2303, 121.47})
+	require.Equal(t, streamSet.Altitude.Data, []float64{5, 6, 6, 8})
+	require.Equal(t, streamSet.Temp.Data, []int{21, 21, 21, 21})
+	require.Equal(t, streamSet.Moving.Data, []bool{false, true, false, true})
+	require.Nil(t, streamSet.Watts)
+	// record 中没有速度, 由距离计算
+	require.InDelta(t, 3.34, streamSet.VelocitySmooth.Data[0], 0.01)
+	require.Len(t, streamSet.GradeSmooth.Data, 4)
+
+	detailed := newDetailedActivityModel(-1, activityData)
+	require.Equal(t, *detailed.StartDate, start)
+	require.Equal(t, detailed.Polyline, activityData.Map.Polyline)
+
+	_, _, err = newFITActivity(2, &fit.File{})
+	require.Error(t, err)
+}
+
+func TestNewTrackActivity(t *testing.T) {
+	start := time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)
+	var points []*track.Point
+	for i := 0; i <= 20; i++ {
+		ele := 10 + float64(i)/2
+		points = append(points, &track.Point{
+			Time:     start.Add(time.Duration(i*10) * time.Second),
+			Position: &track.LatLng{Lat: 31.23 + float64(i)*0.0003, Lng: 121.47},
+			Ele:      &ele,
+		})
+	}
+	tr := track.Track{
+		Type:   "running",
+		Points: points,
+		Laps: []*track.Lap{
+			{Start: 0, End: 11, Time: start, TotalTime: 100, Distance: 333, Calories: 20},
+			{Start: 11, End: 21, Time: start.Add(110 * time.Second), TotalTime: 100, Distance: 330, Calories: 22},
+		},
+	}
+
+	activityData, streamSet, err := newTrackActivity(2, &tr)
+	require.NoError(t, err)
+
+	require.Equal(t, activityData.Type, "Run")
+	require.Equal(t, activityData.Name, "Morning Run")
+	require.Equal(t, activityData.StartDateLocal, start.Add(8*time.Hour))
+	require.InDelta(t, 667, activityData.Distance, 1)
+	require.Equal(t, activityData.ElapsedTime, 200)
+	require.Equal(t, activityData.Calories, 42.0)
+	require.Len(t, activityData.Laps, 2)
+	require.Equal(t, activityData.Laps[1].StartIndex, 11)
+	require.Equal(t, activityData.Laps[1].EndIndex, 20)
+	require.Equal(t, activityData.Laps[1].Distance, 330.0)
+	require.Equal(t, activityData.Laps[1].ElapsedTime, 100)
+
+	require.InDelta(t, 3.34, streamSet.VelocitySmooth.Data[10], 0.01)
+	require.InDelta(t, 1.5, streamSet.GradeSmooth.Data[10], 0.1)
+
+	tr.Points[3].Time = time.Time{}
+	_, _, err = newTrackActivity(2, &tr)
+	require.Error(t, err)
+	_, _, err = newTrackActivity(2, &track.Track{})
+	require.Error(t, err)
+}
+
+func TestTrackActivityType(t *testing.T) {
+	require.Equal(t, trackActivityType("Run"), "Run")
+	require.Equal(t, trackActivityType("Biking"), "Ride")
+	require.Equal(t, trackActivityType("mountain_biking"), "Ride")
+	require.Equal(t, trackActivityType("VirtualRide"), "VirtualRide")
+	require.Equal(t, trackActivityType("Other"), "Workout")
+	require.Equal(t, trackActivityType(""), "Workout")
+}
+
+func TestLongitudeOffset(t *testing.T) {
+	require.Equal(t, longitudeOffset([]*track.Point{{}, {Position: &track.LatLng{Lat: 31.23, Lng: 121.47}}}), 8*time.Hour)
+	require.Equal(t, longitudeOffset([]*track.Point{{Position: &track.LatLng{Lat: 40.71, Lng: -74.0}}}), -5*time.Hour)
+	require.Equal(t, longitudeOffset([]*track.Point{{}}), time.Duration(0))
+}
+
+func TestFITActivityType(t *testing.T) {
+	tests := []struct {
+		sport    fit.Sport
+		subSport fit.SubSport
+		want     string
+		trainer  bool
+	}{
+		{fit.SportRunning, fit.SubSportGeneric, "Run", false},
+		{fit.SportRunning, fit.SubSportVirtualActivity, "VirtualRun", true},
+		{fit.SportCycling, fit.SubSportIndoorCycling, "Ride", true},
+		{fit.SportCycling, fit.SubSportVirtualActivity, "VirtualRide", true},
+		{fit.SportSwimming, fit.SubSportLapSwimming, "Swim", false},
+		{fit.SportTraining, fit.SubSportInvalid, "Workout", false},
+	}
+	for _, item := range tests {
+		activityType, trainer := fitActivityType(&fit.Session{Sport: item.sport, SubSport: item.subSport})
+		require.Equal(t, activityType, item.want)
+		require.Equal(t, trainer, item.trainer)
+	}
+	activityType, _ := fitActivityType(nil)
+	require.Equal(t, activityType, "Workout")
+}
+
+func TestImportName(t *testing.T) {
+	day := time.Date(2022, 11, 21, 0, 0, 0, 0, time.UTC)
+
+	require.Equal(t, importName("Run", day.Add(6*time.Hour)), "Morning Run")
+	require.Equal(t, importName("Run", day.Add(12*time.Hour)), "Lunch Run")
+	require.Equal(t, importName("VirtualRide", day.Add(15*time.Hour)), "Afternoon Virtual Ride")
+	require.Equal(t, importName("Walk", day.Add(20*time.Hour)), "Evening Walk")
+	require.Equal(t, importName("Swim", day.Add(2*time.Hour)), "Night Swim")
+}
+
+func TestImportFormat(t *testing.T) {
+	format, gzipped := importFormat("run.fit")
+	require.Equal(t, format, "fit")
+	require.False(t, gzipped)
+
+	format, gzipped = importFormat("/tmp/Run.FIT.gz")
+	require.Equal(t, format, "fit")
+	require.True(t, gzipped)
+
+	format, gzipped = importFormat("run.gpx.gz")
+	require.Equal(t, format, "gpx")
+	require.True(t, gzipped)
+
+	format, _ = importFormat("run.zip")
+	require.Empty(t, format)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte(".FIT"))
+	require.NoError(t, zw.Close())
+	data, err := readImportFile(&buf, true)
+	require.NoError(t, err)
+	require.Equal(t, data, []byte(".FIT"))
+
+	_, err = readImportFile(strings.NewReader(".FIT"), true)
+	require.Error(t, err)
+}
+
+func TestNewSplits(t *testing.T) {
+	start := time.Date(2022, 11, 20, 22, 30, 0, 0, time.UTC)
+	var points []*track.Point
+	var distances []float64
+	var moving []bool
+	for i := 0; i <= 10; i++ {
+		ele := float64(i)
+		points = append(points, &track.Point{Time: start.Add(time.Duration(i) * time.Minute), Ele: &ele})
+		distances = append(distances, float64(i)*250)
+		moving = append(moving, i > 0)
+	}
+
+	splits := newSplits(points, distances, moving)
+
+	require.Len(t, splits, 3)
+	require.Equal(t, splits[0].Distance, 1000.0)
+	require.Equal(t, splits[0].ElapsedTime, 240)
+	require.Equal(t, splits[0].ElevationDifference, 4.0)
+	require.Equal(t, splits[2].Split, 3)
+	require.Equal(t, splits[2].Distance, 500.0)
+	require.Nil(t, newSplits(points, make([]float64, len(points)), moving))
+}
+
+func TestFillIndex(t *testing.T) {
+	values := []*int{nil, new(int), nil, nil, new(int)}
+
+	require.Equal(t, fillIndex(len(values), func(i int) bool { return values[i] != nil }), []int{1, 1, 1, 1, 4})
+	require.Nil(t, fillIndex(len(values), func(i int) bool { return false }))
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+const (
+	defaultLapCompareSize = 10
+	maxLapCompareSize     = 50
+
+	// 圈距离取整的精度, 同样的训练每次的圈距离会有几米的误差
+	lapStructurePrecision = 100
+)
+
+// CompareLaps 与之前圈结构相同的活动逐圈对比配速, 心率, 步频, 功率
+func (s *Strava) CompareLaps(ctx context.Context, activityID, athleteID int64, req *types.LapCompareReq) (*types.LapComparison, error) {
+	detailed, err := s.sr.GetDetailedActivity(ctx, activityID, athleteID,
+		query.Fields("id", "type", "start_date_local", "lap_structure"))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if detailed == nil {
+		return nil, ex.ErrNotFound.Msg("activity not found")
+	}
+	if detailed.LapStructure == "" {
+		return nil, ex.ErrParam.Msg("activity has no laps to compare")
+	}
+	size := req.Size
+	if size <= 0 {
+		size = defaultLapCompareSize
+	}
+	if size > maxLapCompareSize {
+		size = maxLapCompareSize
+	}
+
+	activities, err := s.sr.GetActivityByLapStructure(ctx, athleteID, detailed.Type, detailed.LapStructure,
+		detailed.StartDateLocal, size, query.Fields("id", "name", "start_date_local"))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	ids := make([]int64, 0, len(activities))
+	for _, item := range activities {
+		ids = append(ids, item.ID)
+	}
+	laps, err := s.sr.GetLaps(ctx, ids, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	return newLapComparison(detailed, activities, laps), nil
+}
+
+func newLapComparison(detailed *model.StravaActivityDetail, activities []*model.StravaActivityDetail,
+	laps []*model.StravaActivityLap) *types.LapComparison {
+	activityType := strings.ToLower(detailed.Type)
+	lapMap := make(map[int64][]*model.StravaActivityLap, len(activities))
+	for _, item := range laps {
+		lapMap[item.ActivityID] = append(lapMap[item.ActivityID], item)
+	}
+
+	r := types.LapComparison{
+		LapStructure: detailed.LapStructure,
+		Activities:   make([]*types.LapActivity, 0, len(activities)),
+	}
+	stats := make(map[int]*lapAccumulator)
+	for _, a := range activities {
+		la := types.LapActivity{ID: a.ID, Name: a.Name, StartDateLocal: a.StartDateLocal}
+		for _, item := range lapMap[a.ID] {
+			acc := stats[item.LapIndex]
+			if acc == nil {
+				acc = &lapAccumulator{}
+				stats[item.LapIndex] = acc
+			}
+			acc.add(item)
+
+			l := types.NewLap(item)
+			l.AverageSpeed = transformVelocity(item.AverageSpeed, activityType)
+			l.MaxSpeed = transformVelocity(item.MaxSpeed, activityType)
+			la.Laps = append(la.Laps, l)
+		}
+		r.Activities = append(r.Activities, &la)
+	}
+	// 按 lap_index 对齐, 序号不一定从 1 开始或者连续
+	indexes := make([]int, 0, len(stats))
+	for i := range stats {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		r.Laps = append(r.Laps, stats[i].stats(i, activityType))
+	}
+
+	return &r
+}
+
+// lapAccumulator 统计同一圈在多个活动中的数据, 没有传感器数据(为 0)的不参与平均
+type lapAccumulator struct {
+	speed, heartrate, cadence, watts mean
+	bestSpeed                        float64
+}
+
+func (a *lapAccumulator) add(l *model.StravaActivityLap) {
+	a.speed.add(l.AverageSpeed)
+	a.heartrate.add(l.AverageHeartrate)
+	a.cadence.add(l.AverageCadence)
+	a.watts.add(l.AverageWatts)
+	a.bestSpeed = math.Max(a.bestSpeed, l.AverageSpeed)
+}
+
+func (a *lapAccumulator) stats(lapIndex int, activityType string) *types.LapStats {
+	return &types.LapStats{
+		LapIndex:         lapIndex,
+		AverageSpeed:     transformVelocity(a.speed.value(), activityType),
+		BestSpeed:        transformVelocity(a.bestSpeed, activityType),
+		AverageHeartrate: a.heartrate.value(),
+		AverageCadence:   a.cadence.value(),
+		AverageWatts:     a.watts.value(),
+	}
+}
+
+type mean struct {
+	sum   float64
+	count int
+}
+
+func (m *mean) add(v float64) {
+	if v > 0 {
+		m.sum += v
+		m.count++
+	}
+}
+
+func (m *mean) value() float64 {
+	if m.count == 0 {
+		return 0
+	}
+	return m.sum / float64(m.count)
+}
+
+// lapStructure 圈结构, 圈数和每圈取整后的距离, 如: "6:2000,800,400,800,400,1000";
+// 少于两圈或者自动分圈时不参与对比
+func lapStructure(laps []*strava.Lap) string {
+	if len(laps) < 2 {
+		return ""
+	}
+	distances := make([]int, 0, len(laps))
+	parts := make([]string, 0, len(laps))
+	for _, item := range laps {
+		d := int(math.Round(item.Distance/lapStructurePrecision)) * lapStructurePrecision
+		distances = append(distances, d)
+		parts = append(parts, strconv.Itoa(d))
+	}
+	if autoLaps(distances) {
+		return ""
+	}
+	return fmt.Sprintf("%d:%s", len(laps), strings.Join(parts, ","))
+}
+
+// autoLaps 设备按固定距离自动分圈(如: 每公里一圈), 除最后一圈外距离都相同, 最后一圈不超过前面的圈,
+// 只有两圈时要求距离相同, 避免把 "2000,800" 这样的训练当成自动分圈
+func autoLaps(distances []int) bool {
+	n := len(distances)
+	for _, d := range distances[:n-1] {
+		if d != distances[0] {
+			return false
+		}
+	}
+	if n == 2 {
+		return distances[1] == distances[0]
+	}
+	return distances[n-1] <= distances[0]
+}
+
+func newLapModels(activityID, athleteID int64, laps []*strava.Lap) []*model.StravaActivityLap {
+	list := make([]*model.StravaActivityLap, 0, len(laps))
+	for _, item := range laps {
+		list = append(list, &model.StravaActivityLap{
+			ID:                 item.Id,
+			ActivityID:         activityID,
+			AthleteID:          athleteID,
+			LapIndex:           item.LapIndex,
+			Name:               item.Name,
+			Distance:           item.Distance,
+			MovingTime:         item.MovingTime,
+			ElapsedTime:        item.ElapsedTime,
+			TotalElevationGain: item.TotalElevationGain,
+			AverageSpeed:       item.AverageSpeed,
+			MaxSpeed:           item.MaxSpeed,
+			AverageHeartrate:   item.AverageHeartrate,
+			MaxHeartrate:       item.MaxHeartrate,
+			AverageCadence:     item.AverageCadence,
+			AverageWatts:       item.AverageWatts,
+			StartIndex:         item.StartIndex,
+			EndIndex:           item.EndIndex,
+			StartDateLocal:     item.StartDateLocal,
+		})
+	}
+	return list
+}
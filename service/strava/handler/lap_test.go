@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+func TestLapStructure(t *testing.T) {
+	require.Equal(t, lapStructure(nil), "")
+	require.Equal(t, lapStructure([]*strava.Lap{{Distance: 5000}}), "")
+	require.Equal(t, lapStructure([]*strava.Lap{
+		{Distance: 2013.5}, {Distance: 801.2}, {Distance: 396.4}, {Distance: 798.9},
+	}), "4:2000,800,400,800")
+	require.Equal(t, lapStructure([]*strava.Lap{{Distance: 2000}, {Distance: 800}}), "2:2000,800")
+	// 自动分圈
+	require.Equal(t, lapStructure([]*strava.Lap{{Distance: 1000}, {Distance: 1000}}), "")
+	require.Equal(t, lapStructure([]*strava.Lap{
+		{Distance: 1001.2}, {Distance: 998.7}, {Distance: 1000.4}, {Distance: 432.1},
+	}), "")
+	require.Equal(t, lapStructure([]*strava.Lap{
+		{Distance: 1609.3}, {Distance: 1609.3}, {Distance: 1609.3},
+	}), "")
+	require.Equal(t, lapStructure([]*strava.Lap{
+		{Distance: 1000}, {Distance: 1000}, {Distance: 2000},
+	}), "3:1000,1000,2000")
+}
+
+func TestNewLapComparison(t *testing.T) {
+	now := time.Now()
+	detailed := &model.StravaActivityDetail{ID: 2, Type: "Ride", LapStructure: "2:1000,800"}
+	activities := []*model.StravaActivityDetail{
+		{ID: 2, StartDateLocal: now},
+		{ID: 1, StartDateLocal: now.AddDate(0, 0, -7)},
+	}
+	laps := []*model.StravaActivityLap{
+		{ActivityID: 1, LapIndex: 1, AverageSpeed: 10, AverageHeartrate: 140},
+		{ActivityID: 1, LapIndex: 2, AverageSpeed: 8, AverageHeartrate: 150},
+		{ActivityID: 2, LapIndex: 1, AverageSpeed: 12},
+		{ActivityID: 2, LapIndex: 2, AverageSpeed: 10, AverageHeartrate: 160},
+	}
+
+	r := newLapComparison(detailed, activities, laps)
+
+	require.Len(t, r.Activities, 2)
+	require.Equal(t, r.Activities[0].ID, int64(2))
+	require.InDelta(t, r.Activities[0].Laps[0].AverageSpeed, 43.2, 0.001)
+	require.Len(t, r.Laps, 2)
+	require.InDelta(t, r.Laps[0].AverageSpeed, 39.6, 0.001)
+	require.InDelta(t, r.Laps[0].BestSpeed, 43.2, 0.001)
+	// 没有心率数据的圈不参与平均
+	require.Equal(t, r.Laps[0].AverageHeartrate, float64(140))
+	require.Equal(t, r.Laps[1].AverageHeartrate, float64(155))
+}
+
+func TestNewLapComparisonIndex(t *testing.T) {
+	detailed := &model.StravaActivityDetail{ID: 2, Type: "Ride", LapStructure: "2:1000,800"}
+	activities := []*model.StravaActivityDetail{{ID: 2}, {ID: 1}}
+	// 序号从 0 开始, 或者中间缺少某一圈
+	laps := []*model.StravaActivityLap{
+		{ActivityID: 1, LapIndex: 0, AverageSpeed: 10},
+		{ActivityID: 1, LapIndex: 2, AverageSpeed: 8},
+		{ActivityID: 2, LapIndex: 2, AverageSpeed: 10},
+		{ActivityID: 2, LapIndex: 3, AverageSpeed: 12},
+	}
+
+	r := newLapComparison(detailed, activities, laps)
+
+	require.Len(t, r.Laps, 3)
+	require.Equal(t, r.Laps[0].LapIndex, 0)
+	require.Equal(t, r.Laps[1].LapIndex, 2)
+	require.InDelta(t, r.Laps[1].AverageSpeed, 32.4, 0.001)
+	require.Equal(t, r.Laps[2].LapIndex, 3)
+}
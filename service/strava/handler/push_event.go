@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/happyxhw/pkg/log"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/pkg/util"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// ListPushEvent 查询推送记录, 管理员排查推送失败的原因
+func (s *Strava) ListPushEvent(ctx context.Context, req *model.StravaPushEventQueryParam) (*types.PushEventQueryResult, error) {
+	p, r, err := s.sr.QueryPushEvent(ctx, req, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	return &types.PushEventQueryResult{PageResult: p, Data: types.NewPushEventList(r)}, nil
+}
+
+// ReplayPushEvent 重置处理次数后重新加入队列, 由 worker 处理, 返回重置后的记录;
+// 只能重新处理已经处理完成或者失败的事件, 待处理和等待重试的事件已经在队列中, 避免与 worker 同时处理
+func (s *Strava) ReplayPushEvent(ctx context.Context, id int64) (*types.PushEvent, error) {
+	e, err := s.sr.GetPushEventByID(ctx, id, query.Fields("id"))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if e == nil {
+		return nil, ex.ErrNotFound.Msg("push event not found")
+	}
+	reset, err := s.resetPushEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !reset {
+		return nil, ex.ErrConflict.Msg("push event is being processed")
+	}
+	if err = s.pushQueue.Push(ctx, id, time.Now()); err != nil {
+		return nil, ex.ErrRedis.Wrap(err)
+	}
+
+	e, err = s.sr.GetPushEventByID(ctx, id, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if e == nil {
+		return nil, ex.ErrNotFound.Msg("push event not found")
+	}
+
+	return types.NewPushEvent(e), nil
+}
+
+// ReplayFailedPushEvent 将所有处理失败的推送事件重新加入队列, 由 worker 异步处理
+func (s *Strava) ReplayFailedPushEvent(ctx context.Context) (*types.ReplayResult, error) {
+	events, err := s.sr.GetPushEventByStatus(ctx, []int{int(model.EventFailedStatus)}, query.Fields("id"))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	var total int
+	for _, item := range events {
+		reset, resetErr := s.resetPushEvent(ctx, item.ID)
+		if resetErr != nil {
+			log.Error("replay strava push event", zap.Int64("id", item.ID), zap.Error(resetErr))
+			continue
+		}
+		if !reset {
+			continue
+		}
+		if err = s.pushQueue.Push(ctx, item.ID, time.Now()); err != nil {
+			log.Error("replay strava push event", zap.Int64("id", item.ID), zap.Error(err))
+			continue
+		}
+		total++
+	}
+
+	return &types.ReplayResult{Total: total}, nil
+}
+
+// resetPushEvent 将处理完成或者失败的事件重置为待处理状态, 重新计算处理次数; 事件仍在处理中时返回 false
+func (s *Strava) resetPushEvent(ctx context.Context, id int64) (bool, error) {
+	params := model.StravaPushEventParam{
+		Status:    util.Int(int(model.EventProcessingStatus)),
+		Attempts:  util.Int(0),
+		LastError: util.String(""),
+	}
+	status := []int{int(model.EventProcessedStatus), int(model.EventFailedStatus)}
+	rows, err := s.sr.UpdatePushEventByStatus(ctx, id, status, &params)
+	if err != nil {
+		return false, ex.ErrDB.Wrap(err)
+	}
+	return rows > 0, nil
+}
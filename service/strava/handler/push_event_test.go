@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/pkg/mymock"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/repo"
+)
+
+const resetPushEventSQL = `UPDATE "strava_push_event" SET "status"=$1,"attempts"=$2,"last_error"=$3,"updated_at"=$4 WHERE id = $5 AND status IN ($6,$7)`
+
+func TestStrava_ReplayPushEvent(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	rdb, rmock := redismock.NewClientMock()
+	mock.ExpectQuery(`SELECT "id" FROM "strava_push_event" WHERE id = $1 LIMIT 1`).
+		WithArgs(int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectExec(resetPushEventSQL).
+		WithArgs(int(model.EventProcessingStatus), 0, "", sqlmock.AnyArg(), int64(10),
+			int(model.EventProcessedStatus), int(model.EventFailedStatus)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 重置后加入队列, 由 worker 处理
+	rmock.CustomMatch(matchMember).ExpectZAddNX(mockPushQueueKey, &redis.Z{Member: int64(10)}).SetVal(1)
+	mock.ExpectQuery(`SELECT * FROM "strava_push_event" WHERE id = $1 LIMIT 1`).
+		WithArgs(int64(10)).
+		WillReturnRows(sqlmock.NewRows(pushEventColumns).
+			AddRow(10, "update", 1516126040, 1, "activity", 2, model.EventProcessingStatus, 0))
+
+	s := Strava{sr: repo.NewStravaRepo(gdb), pushQueue: repo.NewQueue(rdb, mockPushQueueKey)}
+
+	e, err := s.ReplayPushEvent(context.TODO(), 10)
+
+	require.NoError(t, err)
+	require.Equal(t, e.Status, int(model.EventProcessingStatus))
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_ReplayPushEventProcessing(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	rdb, rmock := redismock.NewClientMock()
+	mock.ExpectQuery(`SELECT "id" FROM "strava_push_event" WHERE id = $1 LIMIT 1`).
+		WithArgs(int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	// 事件待处理或者等待重试, 或者查询之后被 worker 取走重新处理, 状态不是已完成或者失败, 不会加入队列
+	mock.ExpectExec(resetPushEventSQL).
+		WithArgs(int(model.EventProcessingStatus), 0, "", sqlmock.AnyArg(), int64(10),
+			int(model.EventProcessedStatus), int(model.EventFailedStatus)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	s := Strava{sr: repo.NewStravaRepo(gdb), pushQueue: repo.NewQueue(rdb, mockPushQueueKey)}
+
+	_, err := s.ReplayPushEvent(context.TODO(), 10)
+
+	var e *ex.Error
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, e.Status, ex.ErrConflict.Status)
+	checkExpectations(t, mock, rmock)
+}
@@ -0,0 +1,410 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/happyxhw/pkg/log"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/pkg/track"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// SyncRoutes 从 strava 同步用户的路线, 路线信息每次都覆盖, 新增或者修改过的路线加入队列由 worker 获取 stream,
+// strava 上已经删除的路线同时删除
+func (s *Strava) SyncRoutes(ctx context.Context, athleteID int64) (*types.RouteSync, error) {
+	stravaCli, err := s.stravaClient(ctx, athleteID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.sr.GetAllRoute(ctx, athleteID, query.Fields("id"))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	ids := make([]int64, 0, len(existing))
+	for _, item := range existing {
+		ids = append(ids, item.ID)
+	}
+	streams, err := s.sr.GetRouteStreams(ctx, ids, query.Fields("id", "updated_at"))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	streamUpdatedAt := make(map[int64]time.Time, len(streams))
+	for _, item := range streams {
+		streamUpdatedAt[item.ID] = item.UpdatedAt
+	}
+
+	var r types.RouteSync
+	seen := make(map[int64]bool)
+	for page := 1; ; page++ {
+		routes, apiErr := stravaCli.Routes.AthleteRoutes(ctx, athleteID, page, routePageSize)
+		if apiErr != nil {
+			return nil, stravaErr(apiErr)
+		}
+		for _, item := range routes {
+			if seen[item.Id] {
+				continue
+			}
+			seen[item.Id] = true
+			r.Total++
+			if err = s.sr.UpsertRoute(ctx, newRouteModel(athleteID, item)); err != nil {
+				return nil, ex.ErrDB.Wrap(err)
+			}
+			// stream 获取失败时时间不会更新, 下次同步时重新加入队列
+			last, ok := streamUpdatedAt[item.Id]
+			if !ok || last.Before(item.UpdatedAt) {
+				s.requeueRoute(ctx, item.Id, 0)
+				r.Updated++
+			}
+		}
+		if len(routes) < routePageSize {
+			break
+		}
+	}
+
+	var deleted []int64
+	for _, item := range existing {
+		if !seen[item.ID] {
+			deleted = append(deleted, item.ID)
+		}
+	}
+	if _, err = s.sr.DeleteRoutes(ctx, athleteID, deleted); err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	r.Deleted = len(deleted)
+
+	return &r, nil
+}
+
+// RunRouteWorker 获取新增或者修改过的路线的 stream, 阻塞直到 ctx 结束
+func (s *Strava) RunRouteWorker(ctx context.Context) {
+	ticker := time.NewTicker(pushPollInterval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		id, popErr := s.routeQueue.Pop(ctx, time.Now())
+		if popErr != nil {
+			log.Error("pop strava route", zap.Error(popErr))
+		}
+		if id != 0 {
+			s.refreshRouteStream(ctx, id)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshRouteStream 获取路线的 stream, 可以重试的错误重新加入队列, 其他错误等下次同步路线时重新加入
+func (s *Strava) refreshRouteStream(ctx context.Context, id int64) {
+	route, err := s.sr.GetRoute(ctx, 0, id, query.Fields("id", "athlete_id", "route_updated_at"))
+	if err != nil {
+		log.Error("get strava route", zap.Int64("id", id), zap.Error(err))
+		s.requeueRoute(ctx, id, s.cfg.PushBackoff)
+		return
+	}
+	if route == nil {
+		return
+	}
+	if err = s.saveRouteStream(ctx, route); err != nil {
+		if retryable(err) {
+			log.Info("strava route stream retrying", zap.Int64("id", id), zap.Error(err))
+			s.requeueRoute(ctx, id, s.cfg.PushBackoff)
+			return
+		}
+		log.Error("strava route stream failed", zap.Int64("id", id), zap.Error(err))
+	}
+}
+
+// saveRouteStream 已经保存的 stream 晚于路线的修改时间时不再重复请求
+func (s *Strava) saveRouteStream(ctx context.Context, route *model.StravaRoute) error {
+	stream, err := s.sr.GetRouteStream(ctx, route.ID, query.Fields("id", "updated_at"))
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	if stream != nil && !stream.UpdatedAt.Before(route.RouteUpdatedAt) {
+		return nil
+	}
+	stravaCli, err := s.stravaClient(ctx, route.AthleteID)
+	if err != nil {
+		return err
+	}
+	streams, err := stravaCli.Routes.RouteStream(ctx, route.ID)
+	if err != nil {
+		return stravaErr(err)
+	}
+	m := model.StravaRouteStream{
+		ID:             route.ID,
+		LatlngStream:   streams.Latlng,
+		DistanceStream: streams.Distance,
+		AltitudeStream: streams.Altitude,
+	}
+	if err = s.sr.UpsertRouteStream(ctx, &m); err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+
+	return nil
+}
+
+func (s *Strava) requeueRoute(ctx context.Context, id int64, delay time.Duration) {
+	if err := s.routeQueue.Push(ctx, id, time.Now().Add(delay)); err != nil {
+		log.Error("requeue strava route", zap.Int64("id", id), zap.Error(err))
+	}
+}
+
+func (s *Strava) ListRoute(ctx context.Context, athleteID int64, req *model.StravaRouteQueryParam) (*types.RouteQueryResult, error) {
+	p, r, err := s.sr.QueryRoute(ctx, athleteID, req, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	return &types.RouteQueryResult{
+		PageResult: p,
+		Data:       types.NewRouteList(r),
+	}, nil
+}
+
+func (s *Strava) GetRoute(ctx context.Context, athleteID, routeID int64) (*types.Route, error) {
+	route, err := s.route(ctx, athleteID, routeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return types.NewRoute(route), nil
+}
+
+// ExportRoute 导出路线文件, 用于导入码表导航, tcx 的时间根据 strava 预计的用时生成
+func (s *Strava) ExportRoute(ctx context.Context, athleteID int64, req *types.ExportRouteReq) (*types.File, error) {
+	route, err := s.route(ctx, athleteID, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := s.sr.GetRouteStream(ctx, route.ID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	var buf bytes.Buffer
+	file := types.File{Name: fmt.Sprintf("route_%d.%s", route.ID, req.Format)}
+	switch req.Format {
+	case tcxFormat:
+		file.ContentType = tcxContentType
+		err = track.WriteTCXCourse(&buf, routeTrack(route, stream, time.Now().UTC().Truncate(time.Second)))
+	default:
+		file.Name = fmt.Sprintf("route_%d.%s", route.ID, gpxFormat)
+		file.ContentType = gpxContentType
+		err = track.WriteGPX(&buf, routeTrack(route, stream, time.Time{}))
+	}
+	if err != nil {
+		return nil, ex.ErrInternal.Wrap(err)
+	}
+	file.Data = buf.Bytes()
+
+	return &file, nil
+}
+
+// RouteActivities 完成过路线的活动: 类型一致, 距离不短于路线太多, 且路线上大部分的点都在活动轨迹附近;
+// 匹配时只查询 id 和简化的轨迹, 匹配后只查询当前页的活动
+func (s *Strava) RouteActivities(ctx context.Context, athleteID int64, req *types.RouteActivitiesReq) (*types.RouteActivities, error) {
+	route, err := s.route(ctx, athleteID, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := s.sr.GetRouteStream(ctx, route.ID, query.Fields("id", "latlng"))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	page, size := req.Page, req.Size
+	if page <= 0 {
+		page = 1
+	}
+	if size <= 0 {
+		size = defaultRouteActivitySize
+	}
+	if size > maxRouteActivitySize {
+		size = maxRouteActivitySize
+	}
+	r := types.RouteActivities{
+		Route:      types.NewRoute(route),
+		PageResult: &query.PagingResult{Page: page, Size: size},
+		Data:       []*types.DetailedActivity{},
+	}
+	points := routeLatLng(route, stream)
+	activityTypes := routeActivityTypes(route.Type)
+	if len(points) == 0 || len(activityTypes) == 0 {
+		return &r, nil
+	}
+	candidates, err := s.sr.GetActivityWithPolyline(ctx, athleteID, activityTypes,
+		route.Distance*routeMinDistanceRatio, query.Fields("id", "summary_polyline"))
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	var ids []int64
+	for _, item := range candidates {
+		if matchRoute(points, item.SummaryPolyline) {
+			ids = append(ids, item.ID)
+		}
+	}
+	r.PageResult.Total = int64(len(ids))
+	start := (page - 1) * size
+	if start >= len(ids) {
+		return &r, nil
+	}
+	ids = ids[start:minInt(start+size, len(ids))]
+	activities, err := s.sr.GetActivityByIDs(ctx, athleteID, ids, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	for _, item := range activities {
+		r.Data = append(r.Data, types.NewDetailedActivity(item))
+	}
+
+	return &r, nil
+}
+
+func (s *Strava) route(ctx context.Context, athleteID, routeID int64) (*model.StravaRoute, error) {
+	route, err := s.sr.GetRoute(ctx, athleteID, routeID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if route == nil {
+		return nil, ex.ErrNotFound.Msg("route not found")
+	}
+
+	return route, nil
+}
+
+func newRouteModel(athleteID int64, data *strava.Route) *model.StravaRoute {
+	m := model.StravaRoute{
+		ID:                  data.Id,
+		AthleteID:           athleteID,
+		Name:                data.Name,
+		Description:         data.Description,
+		Type:                data.Type,
+		SubType:             data.SubType,
+		Distance:            data.Distance,
+		ElevationGain:       data.ElevationGain,
+		EstimatedMovingTime: data.EstimatedMovingTime,
+		Private:             data.Private,
+		Starred:             data.Starred,
+		RouteCreatedAt:      data.CreatedAt,
+		RouteUpdatedAt:      data.UpdatedAt,
+	}
+	if data.Map != nil {
+		m.Polyline = data.Map.Polyline
+		m.SummaryPolyline = data.Map.SummaryPolyline
+	}
+
+	return &m
+}
+
+// routeActivityTypes 路线类型对应的活动类型, 与 strava 统计的分类一致
+func routeActivityTypes(routeType int) []string {
+	name := ""
+	switch model.RouteType(routeType) {
+	case model.RouteRideType:
+		name = Ride
+	case model.RouteRunType:
+		name = Run
+	}
+	for _, item := range reconcileTypes {
+		if item.name == name {
+			return item.types
+		}
+	}
+	return nil
+}
+
+// routeLatLng 优先使用 stream 中的坐标, 没有时解码路线的 polyline
+func routeLatLng(route *model.StravaRoute, stream *model.StravaRouteStream) []track.LatLng {
+	if stream != nil && stream.LatlngStream != nil && len(stream.LatlngStream.Data) > 0 {
+		points := make([]track.LatLng, 0, len(stream.LatlngStream.Data))
+		for _, item := range stream.LatlngStream.Data {
+			if item != nil && len(*item) == 2 {
+				points = append(points, track.LatLng{Lat: (*item)[0], Lng: (*item)[1]})
+			}
+		}
+		return points
+	}
+	if route.Polyline != "" {
+		return track.DecodePolyline(route.Polyline)
+	}
+	return track.DecodePolyline(route.SummaryPolyline)
+}
+
+// matchRoute 活动轨迹与路线范围重叠, 且路线上足够多的点在轨迹附近
+func matchRoute(points []track.LatLng, polyline string) bool {
+	path := track.DecodePolyline(polyline)
+	if len(path) == 0 {
+		return false
+	}
+	if !track.NewBounds(path).Intersects(track.NewBounds(points), routeMatchTolerance) {
+		return false
+	}
+	return track.Coverage(points, path, routeMatchTolerance, routeMatchSamples) >= routeMatchCoverage
+}
+
+// routeTrack 路线转换为轨迹, start 不为空时按预计用时平均分配每个点的时间
+func routeTrack(route *model.StravaRoute, stream *model.StravaRouteStream, start time.Time) *track.Track {
+	t := track.Track{
+		Name:        route.Name,
+		Description: route.Description,
+		Time:        start,
+	}
+	switch model.RouteType(route.Type) {
+	case model.RouteRideType:
+		t.Type = Ride
+	case model.RouteRunType:
+		t.Type = Run
+	}
+	points := routeLatLng(route, stream)
+	var distance []float64
+	var altitude []float64
+	if stream != nil && stream.LatlngStream != nil && len(stream.LatlngStream.Data) == len(points) {
+		if stream.DistanceStream != nil && len(stream.DistanceStream.Data) == len(points) {
+			distance = stream.DistanceStream.Data
+		}
+		if stream.AltitudeStream != nil && len(stream.AltitudeStream.Data) == len(points) {
+			altitude = stream.AltitudeStream.Data
+		}
+	}
+	if distance == nil {
+		distance = make([]float64, len(points))
+		for i := 1; i < len(points); i++ {
+			distance[i] = distance[i-1] + track.Distance(points[i-1], points[i])
+		}
+	}
+
+	var speed float64
+	if n := len(distance); n > 0 && distance[n-1] > 0 {
+		if route.EstimatedMovingTime > 0 {
+			speed = distance[n-1] / float64(route.EstimatedMovingTime)
+		} else if route.Type == int(model.RouteRideType) {
+			speed = defaultRideSpeed
+		} else {
+			speed = defaultRunSpeed
+		}
+	}
+	for i := range points {
+		p := track.Point{Position: &points[i], Distance: &distance[i]}
+		if altitude != nil {
+			p.Ele = &altitude[i]
+		}
+		if !start.IsZero() && speed > 0 {
+			p.Time = start.Add(time.Duration(distance[i] / speed * float64(time.Second))).Truncate(time.Second)
+		}
+		t.Points = append(t.Points, &p)
+	}
+
+	return &t
+}
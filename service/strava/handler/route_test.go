@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/pkg/strava/stravatest"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+func TestRouteActivityTypes(t *testing.T) {
+	require.Contains(t, routeActivityTypes(int(model.RouteRideType)), "VirtualRide")
+	require.Equal(t, routeActivityTypes(int(model.RouteRunType)), []string{"Run", "VirtualRun"})
+	require.Nil(t, routeActivityTypes(0))
+}
+
+func TestMatchRoute(t *testing.T) {
+	route := &model.StravaRoute{Polyline: "_ur}DsildVgEgEgEgEgEgE"}
+	points := routeLatLng(route, nil)
+
+	require.Len(t, points, 4)
+	require.True(t, matchRoute(points, route.Polyline))
+	// 只经过了路线的起点
+	require.False(t, matchRoute(points, "_ur}DsildV"))
+	require.False(t, matchRoute(points, ""))
+}
+
+func TestRouteTrack(t *testing.T) {
+	route := &model.StravaRoute{
+		Name:                "Riverside Loop",
+		Type:                int(model.RouteRunType),
+		EstimatedMovingTime: 150,
+		Polyline:            "_ur}DsildVgEgEgEgEgEgE",
+	}
+	stream := &model.StravaRouteStream{
+		LatlngStream: &strava.LatLngStream{Data: []*strava.LatLng{
+			{31.2304, 121.4737}, {31.2314, 121.4747}, {31.2324, 121.4757}, {31.2334, 121.4767},
+		}},
+		DistanceStream: &strava.DistanceStream{Data: []float64{0, 146.3, 292.6, 438.9}},
+		AltitudeStream: &strava.AltitudeStream{Data: []float64{5.1, 5.6, 6.3, 6.0}},
+	}
+	start := time.Date(2022, 11, 20, 0, 0, 0, 0, time.UTC)
+
+	tr := routeTrack(route, stream, start)
+	require.Equal(t, tr.Type, Run)
+	require.Len(t, tr.Points, 4)
+	require.Equal(t, *tr.Points[3].Ele, 6.0)
+	require.Equal(t, tr.Points[0].Time, start)
+	require.Equal(t, tr.Points[3].Time, start.Add(150*time.Second))
+
+	// 没有 stream 时使用 polyline 计算距离, 不需要时间
+	tr = routeTrack(route, nil, time.Time{})
+	require.Len(t, tr.Points, 4)
+	require.Nil(t, tr.Points[0].Ele)
+	require.InDelta(t, 438.9, *tr.Points[3].Distance, 5)
+	require.True(t, tr.Points[3].Time.IsZero())
+}
+
+func TestStrava_RouteActivities(t *testing.T) {
+	s, mock, rmock := newMockStrava(t, nil)
+	polyline := "_ur}DsildVgEgEgEgEgEgE"
+	mock.ExpectQuery(`SELECT * FROM "strava_route" WHERE id = $1 AND athlete_id = $2 AND "strava_route"."deleted_at" = $3 LIMIT 1`).
+		WithArgs(int64(10), mockAthleteID, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "distance", "polyline"}).
+			AddRow(10, model.RouteRunType, 1000, polyline))
+	mock.ExpectQuery(`SELECT "id","latlng" FROM "strava_route_stream" WHERE id = $1 AND "strava_route_stream"."deleted_at" = $2 LIMIT 1`).
+		WithArgs(int64(10), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "latlng"}))
+	// 匹配时只查询 id 和简化的轨迹
+	mock.ExpectQuery(`SELECT "id","summary_polyline" FROM "strava_activity_detail" WHERE (athlete_id = $1 AND type IN ($2,$3) AND distance >= $4 AND summary_polyline <> '') AND "strava_activity_detail"."deleted_at" = $5 ORDER BY start_date_local DESC`).
+		WithArgs(mockAthleteID, "Run", "VirtualRun", float64(800), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "summary_polyline"}).
+			AddRow(3, polyline).AddRow(2, "_ur}DsildV").AddRow(1, polyline))
+	// 第二页只有最早的一个活动
+	mock.ExpectQuery(`SELECT * FROM "strava_activity_detail" WHERE (athlete_id = $1 AND id IN ($2)) AND "strava_activity_detail"."deleted_at" = $3 ORDER BY start_date_local DESC`).
+		WithArgs(mockAthleteID, int64(1), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type"}).AddRow(1, "Run"))
+
+	r, err := s.RouteActivities(context.TODO(), mockAthleteID, &types.RouteActivitiesReq{ID: 10, Page: 2, Size: 1})
+
+	require.NoError(t, err)
+	require.Equal(t, r.PageResult.Total, int64(2))
+	require.Len(t, r.Data, 1)
+	require.Equal(t, r.Data[0].ID, int64(1))
+	checkExpectations(t, mock, rmock)
+}
+
+func expectRouteStream(mock sqlmock.Sqlmock, routeUpdatedAt, streamUpdatedAt time.Time) {
+	mock.ExpectQuery(`SELECT "id","athlete_id","route_updated_at" FROM "strava_route" WHERE id = $1 AND "strava_route"."deleted_at" = $2 LIMIT 1`).
+		WithArgs(int64(10), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "athlete_id", "route_updated_at"}).
+			AddRow(10, mockAthleteID, routeUpdatedAt))
+	mock.ExpectQuery(`SELECT "id","updated_at" FROM "strava_route_stream" WHERE id = $1 AND "strava_route_stream"."deleted_at" = $2 LIMIT 1`).
+		WithArgs(int64(10), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow(10, streamUpdatedAt))
+}
+
+func TestStrava_RefreshRouteStreamFresh(t *testing.T) {
+	s, mock, rmock := newMockStrava(t, nil)
+	// stream 晚于路线的修改时间, 不再请求 strava
+	now := time.Now()
+	expectRouteStream(mock, now.Add(-time.Hour), now)
+
+	s.refreshRouteStream(context.TODO(), 10)
+
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_RefreshRouteStreamRetry(t *testing.T) {
+	server := stravatest.NewServer(nil)
+	defer server.Close()
+	server.InjectError("/routes/10/streams", 500, 1)
+
+	s, mock, rmock := newMockStrava(t, server)
+	now := time.Now()
+	expectRouteStream(mock, now, now.Add(-time.Hour))
+	rmock.ExpectGet(mockTokenKey).SetVal(mockToken)
+	// strava 服务错误可以重试, 重新加入队列
+	rmock.CustomMatch(matchMember).ExpectZAddNX(mockRouteQueueKey, &redis.Z{Member: int64(10)}).SetVal(1)
+	// 截止时间内不够等待重试, strava client 直接返回错误
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*500)
+	defer cancel()
+
+	s.refreshRouteStream(ctx, 10)
+
+	checkExpectations(t, mock, rmock)
+}
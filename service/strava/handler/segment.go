@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// ListSegment 用户有成绩的路段, 包括成绩数, 最好成绩和最近一次的日期
+func (s *Strava) ListSegment(ctx context.Context, athleteID int64, req *model.StravaSegmentParam) (*types.SegmentQueryResult, error) {
+	p, r, err := s.sr.QueryAthleteSegment(ctx, athleteID, req, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	ids := make([]int64, 0, len(r))
+	for _, item := range r {
+		ids = append(ids, item.ID)
+	}
+	stats, err := s.sr.GetSegmentStats(ctx, athleteID, ids)
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	return &types.SegmentQueryResult{PageResult: p, Data: types.NewSegmentList(r, stats)}, nil
+}
+
+// GetSegmentEfforts 用户在路段上的所有成绩: 时间, 心率, 功率, 日期
+func (s *Strava) GetSegmentEfforts(ctx context.Context, athleteID, segmentID int64) (*types.SegmentHistory, error) {
+	segment, err := s.sr.GetSegment(ctx, segmentID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if segment == nil {
+		return nil, ex.ErrNotFound.Msg("segment not found")
+	}
+	efforts, err := s.sr.GetSegmentEfforts(ctx, athleteID, segmentID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if len(efforts) == 0 {
+		return nil, ex.ErrNotFound.Msg("segment not found")
+	}
+
+	var best *model.StravaSegmentEffort
+	for _, item := range efforts {
+		if item.ElapsedTime > 0 && (best == nil || item.ElapsedTime < best.ElapsedTime) {
+			best = item
+		}
+	}
+	stats := model.StravaSegmentStats{
+		SegmentID:      segmentID,
+		EffortCount:    len(efforts),
+		LastEffortDate: efforts[len(efforts)-1].StartDateLocal,
+	}
+	r := types.SegmentHistory{Efforts: types.NewSegmentEffortList(efforts)}
+	if best != nil {
+		stats.BestTime = best.ElapsedTime
+		r.Best = types.NewSegmentEffort(best)
+	}
+	r.Segment = types.NewSegment(segment, &stats)
+
+	return &r, nil
+}
+
+// upsertSegmentEfforts 保存活动的路段和成绩, 并重新计算涉及的路段的个人最好成绩, 需要在事务中调用
+func (s *Strava) upsertSegmentEfforts(ctx context.Context, detailed *model.StravaActivityDetail,
+	segments []*model.StravaSegment, efforts []*model.StravaSegmentEffort) error {
+	// 活动更新后不再包含的路段也需要重新计算
+	old, err := s.sr.GetActivitySegmentEfforts(ctx, detailed.ID, query.Fields("segment_id"))
+	if err != nil {
+		return err
+	}
+	if err = s.sr.UpsertSegments(ctx, segments); err != nil {
+		return err
+	}
+	if err = s.sr.UpsertSegmentEfforts(ctx, detailed.ID, efforts); err != nil {
+		return err
+	}
+
+	return s.refreshSegmentPr(ctx, detailed.AthleteID, append(effortSegmentIDs(old), effortSegmentIDs(efforts)...))
+}
+
+// refreshSegmentPr 按时间顺序重新计算用户在路段上的个人最好成绩, 历史活动导入的顺序是从新到旧
+func (s *Strava) refreshSegmentPr(ctx context.Context, athleteID int64, segmentIDs []int64) error {
+	seen := make(map[int64]bool, len(segmentIDs))
+	for _, segmentID := range segmentIDs {
+		if seen[segmentID] {
+			continue
+		}
+		seen[segmentID] = true
+		efforts, err := s.sr.GetSegmentEfforts(ctx, athleteID, segmentID, query.Fields("id", "elapsed_time", "is_pr"))
+		if err != nil {
+			return err
+		}
+		pr, notPr := markSegmentPr(efforts)
+		if _, err = s.sr.UpdateSegmentEffortPr(ctx, pr, true); err != nil {
+			return err
+		}
+		if _, err = s.sr.UpdateSegmentEffortPr(ctx, notPr, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markSegmentPr efforts 按时间排列, 比之前所有成绩都快的为个人最好成绩, 第一次成绩不算,
+// 返回需要标记和取消标记的成绩 id
+func markSegmentPr(efforts []*model.StravaSegmentEffort) (pr, notPr []int64) {
+	best := 0
+	for _, item := range efforts {
+		if item.ElapsedTime <= 0 {
+			continue
+		}
+		isPr := best > 0 && item.ElapsedTime < best
+		if best == 0 || item.ElapsedTime < best {
+			best = item.ElapsedTime
+		}
+		switch {
+		case isPr && !item.IsPr:
+			pr = append(pr, item.ID)
+		case !isPr && item.IsPr:
+			notPr = append(notPr, item.ID)
+		}
+	}
+
+	return pr, notPr
+}
+
+func effortSegmentIDs(efforts []*model.StravaSegmentEffort) []int64 {
+	ids := make([]int64, 0, len(efforts))
+	for _, item := range efforts {
+		ids = append(ids, item.SegmentID)
+	}
+	return ids
+}
+
+// newSegmentModels 活动详情中的路段成绩, 同一个路段在一个活动中可能出现多次
+func newSegmentModels(detailed *model.StravaActivityDetail,
+	efforts []*strava.DetailedSegmentEffort) ([]*model.StravaSegment, []*model.StravaSegmentEffort) {
+	segmentMap := make(map[int64]bool)
+	var segments []*model.StravaSegment
+	var list []*model.StravaSegmentEffort
+	for _, item := range efforts {
+		if item == nil || item.Segment == nil {
+			continue
+		}
+		if !segmentMap[item.Segment.Id] {
+			segmentMap[item.Segment.Id] = true
+			segments = append(segments, newSegmentModel(item.Segment))
+		}
+		list = append(list, &model.StravaSegmentEffort{
+			ID:               item.Id,
+			SegmentID:        item.Segment.Id,
+			ActivityID:       detailed.ID,
+			AthleteID:        detailed.AthleteID,
+			Name:             item.Name,
+			ElapsedTime:      item.ElapsedTime,
+			MovingTime:       item.MovingTime,
+			Distance:         item.Distance,
+			StartDateLocal:   item.StartDateLocal,
+			AverageHeartrate: item.AverageHeartrate,
+			MaxHeartrate:     item.MaxHeartrate,
+			AverageWatts:     item.AverageWatts,
+			DeviceWatts:      item.DeviceWatts,
+			AverageCadence:   item.AverageCadence,
+			StartIndex:       item.StartIndex,
+			EndIndex:         item.EndIndex,
+			PrRank:           item.PrRank,
+			Hidden:           item.Hidden,
+		})
+	}
+
+	return segments, list
+}
+
+func newSegmentModel(segment *strava.SummarySegment) *model.StravaSegment {
+	m := model.StravaSegment{
+		ID:            segment.Id,
+		Name:          segment.Name,
+		ActivityType:  segment.ActivityType,
+		Distance:      segment.Distance,
+		AverageGrade:  segment.AverageGrade,
+		MaximumGrade:  segment.MaximumGrade,
+		ElevationHigh: segment.ElevationHigh,
+		ElevationLow:  segment.ElevationLow,
+		ClimbCategory: segment.ClimbCategory,
+		City:          segment.City,
+		State:         segment.State,
+		Country:       segment.Country,
+		Private:       segment.Private,
+	}
+	if segment.StartLatlng != nil && len(*segment.StartLatlng) == 2 {
+		m.StartLat, m.StartLng = (*segment.StartLatlng)[0], (*segment.StartLatlng)[1]
+	}
+	if segment.EndLatlng != nil && len(*segment.EndLatlng) == 2 {
+		m.EndLat, m.EndLng = (*segment.EndLatlng)[0], (*segment.EndLatlng)[1]
+	}
+
+	return &m
+}
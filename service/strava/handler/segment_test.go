@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+func TestMarkSegmentPr(t *testing.T) {
+	efforts := []*model.StravaSegmentEffort{
+		{ID: 1, ElapsedTime: 300},
+		{ID: 2, ElapsedTime: 290, IsPr: true},
+		{ID: 3, ElapsedTime: 295, IsPr: true},
+		{ID: 4, ElapsedTime: 0},
+		{ID: 5, ElapsedTime: 280},
+		{ID: 6, ElapsedTime: 280},
+	}
+
+	pr, notPr := markSegmentPr(efforts)
+
+	require.Equal(t, pr, []int64{5})
+	require.Equal(t, notPr, []int64{3})
+
+	pr, notPr = markSegmentPr([]*model.StravaSegmentEffort{{ID: 1, ElapsedTime: 300, IsPr: true}})
+	require.Empty(t, pr)
+	require.Equal(t, notPr, []int64{1})
+}
+
+func TestNewSegmentModels(t *testing.T) {
+	detailed := model.StravaActivityDetail{ID: 1, AthleteID: 2}
+	start := strava.LatLng{31.2, 121.4}
+	segment := strava.SummarySegment{Id: 10, Name: "Hill", StartLatlng: &start}
+	now := time.Now()
+	efforts := []*strava.DetailedSegmentEffort{
+		{Id: 100, Segment: &segment, ElapsedTime: 300, StartDateLocal: now, AverageHeartrate: 160},
+		{Id: 101, Segment: &segment, ElapsedTime: 290, StartDateLocal: now.Add(time.Hour)},
+		{Id: 102},
+	}
+
+	segments, list := newSegmentModels(&detailed, efforts)
+
+	require.Len(t, segments, 1)
+	require.Equal(t, segments[0].StartLat, 31.2)
+	require.Equal(t, segments[0].EndLat, 0.0)
+	require.Len(t, list, 2)
+	require.Equal(t, list[0].SegmentID, int64(10))
+	require.Equal(t, list[0].AthleteID, int64(2))
+	require.Equal(t, list[0].AverageHeartrate, 160.0)
+	require.Equal(t, effortSegmentIDs(list), []int64{10, 10})
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// GetSocialStats 最近 socialMonths 个月每月收到的点赞和评论, 没有活动的月份为 0
+func (s *Strava) GetSocialStats(ctx context.Context, athleteID int64, req *types.SocialStatsReq) (*types.SocialStats, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultCommentedSize
+	}
+	start := socialStart(time.Now())
+	stats, err := s.sr.GetSocialStats(ctx, athleteID, start)
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	activities, err := s.sr.GetMostCommentedActivity(ctx, athleteID, limit, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	return &types.SocialStats{
+		Months:        socialMonthList(stats, start),
+		MostCommented: types.NewDetailedActivityList(activities),
+	}, nil
+}
+
+// activitySocial 获取活动的评论和点赞用户, 数量为 0 时不请求
+func activitySocial(ctx context.Context, cli *strava.Client, activityID int64,
+	activity *strava.DetailedActivity) ([]*strava.Comment, []*strava.SummaryAthlete, error) {
+	var comments []*strava.Comment
+	for page := 1; activity.CommentCount > 0 && page <= maxSocialPages; page++ {
+		list, err := cli.Activity.ActivityComments(ctx, activityID, page, socialPageSize)
+		if err != nil {
+			return nil, nil, stravaErr(err)
+		}
+		comments = append(comments, list...)
+		if len(list) < socialPageSize {
+			break
+		}
+	}
+	var kudoers []*strava.SummaryAthlete
+	for page := 1; activity.KudosCount > 0 && page <= maxSocialPages; page++ {
+		list, err := cli.Activity.ActivityKudoers(ctx, activityID, page, socialPageSize)
+		if err != nil {
+			return nil, nil, stravaErr(err)
+		}
+		kudoers = append(kudoers, list...)
+		if len(list) < socialPageSize {
+			break
+		}
+	}
+
+	return comments, kudoers, nil
+}
+
+func newCommentModels(activityID, athleteID int64, comments []*strava.Comment) []*model.StravaActivityComment {
+	list := make([]*model.StravaActivityComment, 0, len(comments))
+	for _, item := range comments {
+		m := model.StravaActivityComment{
+			ID:               item.Id,
+			ActivityID:       activityID,
+			AthleteID:        athleteID,
+			Text:             item.Text,
+			CommentCreatedAt: item.CreatedAt,
+		}
+		if item.Athlete != nil {
+			m.CommenterID = item.Athlete.Id
+			m.CommenterName = athleteName(item.Athlete.Firstname, item.Athlete.Lastname)
+		}
+		list = append(list, &m)
+	}
+
+	return list
+}
+
+func newKudosModels(activityID, athleteID int64, kudoers []*strava.SummaryAthlete) []*model.StravaActivityKudos {
+	list := make([]*model.StravaActivityKudos, 0, len(kudoers))
+	for i, item := range kudoers {
+		list = append(list, &model.StravaActivityKudos{
+			ActivityID: activityID,
+			AthleteID:  athleteID,
+			Position:   i,
+			Firstname:  item.Firstname,
+			Lastname:   item.Lastname,
+		})
+	}
+
+	return list
+}
+
+func athleteName(firstname, lastname string) string {
+	if lastname == "" {
+		return firstname
+	}
+	return firstname + " " + lastname
+}
+
+// socialStart 包含本月在内的 socialMonths 个月的第一天
+func socialStart(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month()-socialMonths+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func socialMonthList(stats []*model.StravaSocialStats, start time.Time) []*types.SocialMonth {
+	statsMap := make(map[string]*model.StravaSocialStats, len(stats))
+	for _, item := range stats {
+		statsMap[item.Month.Format("2006-01")] = item
+	}
+	list := make([]*types.SocialMonth, 0, socialMonths)
+	for i := 0; i < socialMonths; i++ {
+		month := start.AddDate(0, i, 0).Format("2006-01")
+		m := types.SocialMonth{Month: month}
+		if item, ok := statsMap[month]; ok {
+			m.Count = item.Count
+			m.Kudos = item.Kudos
+			m.Comments = item.Comments
+		}
+		list = append(list, &m)
+	}
+
+	return list
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/pkg/strava/stravatest"
+)
+
+func TestActivitySocial(t *testing.T) {
+	s := stravatest.NewServer(nil)
+	defer s.Close()
+	cli := s.Client("access-1001")
+
+	comments, kudoers, err := activitySocial(context.TODO(), cli, 2001, &strava.DetailedActivity{KudosCount: 2, CommentCount: 1})
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	require.Len(t, kudoers, 2)
+
+	usage := s.Usage()
+	comments, kudoers, err = activitySocial(context.TODO(), cli, 2002, &strava.DetailedActivity{})
+	require.NoError(t, err)
+	require.Empty(t, comments)
+	require.Empty(t, kudoers)
+	require.Equal(t, s.Usage(), usage)
+}
+
+func TestNewCommentModels(t *testing.T) {
+	createdAt := time.Date(2022, 11, 21, 1, 10, 0, 0, time.UTC)
+	comments := []*strava.Comment{
+		{Id: 6001, Text: "Nice pace!", Athlete: &strava.SummaryAthlete{Id: 1002, Firstname: "Jane", Lastname: "D."}, CreatedAt: createdAt},
+		{Id: 6002, Text: "Thanks!"},
+	}
+
+	list := newCommentModels(2001, 1001, comments)
+
+	require.Len(t, list, 2)
+	require.Equal(t, list[0].CommenterName, "Jane D.")
+	require.Equal(t, list[0].CommenterID, int64(1002))
+	require.Equal(t, list[0].CommentCreatedAt, createdAt)
+	require.Equal(t, list[1].CommenterName, "")
+	require.Equal(t, list[1].AthleteID, int64(1001))
+
+	kudos := newKudosModels(2001, 1001, []*strava.SummaryAthlete{{Firstname: "Jane"}, {Firstname: "Bob"}})
+	require.Equal(t, kudos[1].Position, 1)
+	require.Equal(t, kudos[1].Firstname, "Bob")
+}
+
+func TestSocialMonthList(t *testing.T) {
+	start := socialStart(time.Date(2022, 11, 23, 18, 30, 0, 0, time.Local))
+	require.Equal(t, start, time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC))
+
+	stats := []*model.StravaSocialStats{
+		{Month: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC), Count: 3, Kudos: 12, Comments: 2},
+		{Month: time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC), Count: 1, Kudos: 2, Comments: 1},
+	}
+
+	list := socialMonthList(stats, start)
+
+	require.Len(t, list, socialMonths)
+	require.Equal(t, list[0].Month, "2021-12")
+	require.Equal(t, list[0].Kudos, 0)
+	require.Equal(t, list[2].Month, "2022-02")
+	require.Equal(t, list[2].Kudos, 12)
+	require.Equal(t, list[11].Month, "2022-11")
+	require.Equal(t, list[11].Comments, 1)
+}
@@ -25,19 +25,48 @@ import (
 )
 
 type Strava struct {
-	sr        *repo.StravaRepo
-	tr        *repo.TokenRepo
-	transRepo *trans.Trans
-
-	auth oauth2x.Oauth2x
+	sr            *repo.StravaRepo
+	tr            *repo.TokenRepo
+	ur            *repo.UserRepo
+	transRepo     *trans.Trans
+	cacher        *repo.Cacher
+	pushQueue     *repo.Queue
+	backfillQueue *repo.Queue
+	uploadQueue   *repo.Queue
+	clubQueue     *repo.Queue
+	archiveQueue  *repo.Queue
+	routeQueue    *repo.Queue
+
+	auth    oauth2x.Oauth2x
+	limiter strava.Limiter
+	mailer  Mailer
+
+	cfg *Config
+
+	subscriptionID int64 // 已注册的推送订阅 id, 后台查询, 使用 atomic 读写
 }
 
-func NewStrava(sr *repo.StravaRepo, tr *repo.TokenRepo, transRepo *trans.Trans, auth oauth2x.Oauth2x) *Strava {
+func NewStrava(sr *repo.StravaRepo, tr *repo.TokenRepo, ur *repo.UserRepo, transRepo *trans.Trans, cacher *repo.Cacher,
+	pushQueue, backfillQueue, uploadQueue, clubQueue, archiveQueue, routeQueue *repo.Queue, auth oauth2x.Oauth2x,
+	limiter strava.Limiter, mailer Mailer, cfg *Config) *Strava {
 	return &Strava{
-		sr:        sr,
-		tr:        tr,
-		auth:      auth,
-		transRepo: transRepo,
+		sr:            sr,
+		tr:            tr,
+		ur:            ur,
+		auth:          auth,
+		limiter:       limiter,
+		mailer:        mailer,
+		transRepo:     transRepo,
+		cacher:        cacher,
+		pushQueue:     pushQueue,
+		backfillQueue: backfillQueue,
+		uploadQueue:   uploadQueue,
+		clubQueue:     clubQueue,
+		archiveQueue:  archiveQueue,
+		routeQueue:    routeQueue,
+		cfg:           cfg.withDefault(),
+
+		subscriptionID: cfg.SubscriptionID,
 	}
 }
 
@@ -53,9 +82,41 @@ func (s *Strava) GetActivity(ctx context.Context, activityID, athleteID int64) (
 	if err != nil {
 		return nil, ex.ErrDB.Wrap(err)
 	}
+
+	return s.activityRelations(ctx, detailed, streamSet)
+}
+
+// activityRelations 查询活动的圈, 区间, 路段成绩, 评论和点赞, 与详情和数据流组合
+func (s *Strava) activityRelations(ctx context.Context, detailed *model.StravaActivityDetail,
+	streamSet *model.StravaActivityStream) (*types.Activity, error) {
+	laps, err := s.sr.GetLaps(ctx, []int64{detailed.ID}, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	zones, err := s.sr.GetActivityZones(ctx, detailed.ID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	efforts, err := s.sr.GetActivitySegmentEfforts(ctx, detailed.ID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	comments, err := s.sr.GetActivityComments(ctx, detailed.ID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	kudos, err := s.sr.GetActivityKudos(ctx, detailed.ID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
 	return &types.Activity{
 		DetailedActivity: types.NewDetailedActivity(detailed),
 		StreamSet:        types.NewStreamSet(streamSet),
+		Laps:             types.NewLapList(laps),
+		Zones:            types.NewZoneList(zones),
+		SegmentEfforts:   types.NewSegmentEffortList(efforts),
+		Comments:         types.NewCommentList(comments),
+		Kudoers:          types.NewKudoerList(kudos),
 	}, nil
 }
 
@@ -181,37 +242,52 @@ func (s *Strava) GetAggStats(ctx context.Context, athleteID int64, req *types.Ag
 	return &r, nil
 }
 
+// Push 保存推送事件并加入队列, 由 worker 异步处理, 避免 strava api 过慢导致推送超时
 func (s *Strava) Push(ctx context.Context, event *strava.SubscriptionEvent) error {
+	if err := s.verifySubscription(ctx, event.SubscriptionID); err != nil {
+		return err
+	}
 	ups, err := json.Marshal(event.Updates)
 	if err != nil {
 		return ex.ErrBadRequest.Wrap(err)
 	}
 
-	data, err := s.sr.GetPushEvent(ctx, event.ObjectID, query.Fields("id", "status"))
+	pushEvent := model.StravaPushEvent{
+		SubscriptionID: event.SubscriptionID,
+		OwnerID:        event.OwnerID,
+		AspectType:     event.AspectType,
+		EventTime:      event.EventTime,
+		ObjectID:       event.ObjectID,
+		ObjectType:     event.ObjectType,
+		Updates:        string(ups),
+	}
+
+	return s.enqueuePushEvent(ctx, &pushEvent)
+}
+
+// enqueuePushEvent 保存推送事件并加入队列, 重复的事件命中唯一索引, 已经处理完时直接忽略
+func (s *Strava) enqueuePushEvent(ctx context.Context, pushEvent *model.StravaPushEvent) error {
+	created, err := s.sr.CreatePushEvent(ctx, pushEvent)
 	if err != nil {
 		return ex.ErrDB.Wrap(err)
 	}
-	if data == nil {
-		newPush := model.StravaPushEvent{
-			OwnerID:    event.OwnerID,
-			AspectType: event.AspectType,
-			EventTime:  event.EventTime,
-			ObjectID:   event.ObjectID,
-			ObjectType: event.ObjectType,
-			Updates:    string(ups),
-		}
-		if txErr := s.sr.CreatePushEvent(ctx, &newPush); txErr != nil {
+	data := pushEvent
+	// strava 会重复推送同一个事件, 已经处理完的事件直接忽略
+	if !created {
+		data, err = s.sr.GetPushEvent(ctx, pushEvent, query.Fields("id", "status"))
+		if err != nil {
 			return ex.ErrDB.Wrap(err)
 		}
-	}
-
-	if data == nil || data.Status != int(model.EventProcessedStatus) {
-		err = s.push(ctx, event)
-		if err != nil {
-			log.Error("strava push", zap.Int64("object_id", event.ObjectID), log.CTX(ctx))
-			return err
+		if data == nil {
+			return nil
 		}
 	}
+	if data.Status == int(model.EventProcessedStatus) || data.Status == int(model.EventFailedStatus) {
+		return nil
+	}
+	if err = s.pushQueue.Push(ctx, data.ID, time.Now()); err != nil {
+		return ex.ErrRedis.Wrap(err)
+	}
 
 	return nil
 }
@@ -221,6 +297,18 @@ func (s *Strava) push(ctx context.Context, event *strava.SubscriptionEvent) erro
 	log.Info("strava push",
 		zap.Int64("object_id", event.ObjectID), zap.Int64("owner_id", event.OwnerID),
 		zap.String("aspect_type", event.AspectType), zap.String("object_type", event.ObjectType))
+	// 用户已撤销授权, 除了撤销授权和删除活动的事件, 不再调用 strava api
+	if !deauthorizeEvent(event) && event.AspectType != "delete" {
+		connected, err := s.connected(ctx, event.OwnerID)
+		if err != nil {
+			return err
+		}
+		if !connected {
+			log.Info("strava push ignored, athlete deauthorized",
+				zap.Int64("object_id", event.ObjectID), zap.Int64("owner_id", event.OwnerID), log.CTX(ctx))
+			return nil
+		}
+	}
 	switch event.ObjectType {
 	case "athlete":
 		return s.athletePush(ctx, event)
@@ -235,37 +323,250 @@ func (s *Strava) activityPush(ctx context.Context, event *strava.SubscriptionEve
 	case "create":
 		return s.activityCreate(ctx, event)
 	case "update":
-		return ex.ErrBadRequest.Msg("unknown aspect type")
+		return s.activityUpdate(ctx, event)
+	case "delete":
+		return s.activityDelete(ctx, event)
 	}
 	return ex.ErrBadRequest.Msg("unknown aspect type")
 }
 
+// athletePush 撤销授权事件: {"authorized": "false"}, 其它事件同步用户资料
 func (s *Strava) athletePush(ctx context.Context, event *strava.SubscriptionEvent) error {
+	if deauthorizeEvent(event) {
+		return s.athleteDeauthorize(ctx, event.OwnerID)
+	}
+	return s.SyncAthlete(ctx, event.OwnerID)
+}
+
+// deauthorizeEvent 用户在 strava 撤销授权的推送
+func deauthorizeEvent(event *strava.SubscriptionEvent) bool {
+	v, ok := event.Updates["authorized"]
+	return ok && event.ObjectType == "athlete" && fmt.Sprint(v) == "false"
+}
+
+// athleteDeauthorize 删除 token, 标记用户为未授权, 可选删除该用户的 strava 数据
+func (s *Strava) athleteDeauthorize(ctx context.Context, athleteID int64) error {
+	if err := s.tr.DeleteToken(ctx, oauth2x.StravaSource, athleteID); err != nil {
+		return ex.ErrRedis.Wrap(err)
+	}
+	user, err := s.ur.GetBySource(ctx, oauth2x.StravaSource, athleteID, query.Fields("id"))
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	err = s.transRepo.Exec(ctx, func(ctx context.Context) error {
+		if user != nil {
+			params := model.UserParam{SourceStatus: util.Int(int(model.SourceDisconnectedStatus))}
+			if _, txErr := s.ur.Update(ctx, user.ID, &params); txErr != nil {
+				return txErr
+			}
+		}
+		if s.cfg.PurgeOnDeauthorize {
+			if _, txErr := s.sr.DeleteAthleteActivity(ctx, athleteID); txErr != nil {
+				return txErr
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+
 	return nil
 }
 
+// connected 用户是否仍然授权访问 strava, 未注册的用户视为已授权
+func (s *Strava) connected(ctx context.Context, athleteID int64) (bool, error) {
+	user, err := s.ur.GetBySource(ctx, oauth2x.StravaSource, athleteID, query.Fields("id", "source_status"))
+	if err != nil {
+		return false, ex.ErrDB.Wrap(err)
+	}
+
+	return user == nil || user.SourceStatus != int(model.SourceDisconnectedStatus), nil
+}
+
 func (s *Strava) activityCreate(ctx context.Context, event *strava.SubscriptionEvent) error {
-	token, err := s.tr.GetToken(ctx, "strava", event.OwnerID, s.auth.Refresh)
+	return s.syncActivity(ctx, event.OwnerID, event.ObjectID, nil)
+}
+
+// activityUpdate 活动更新: 重新拉取活动和 stream, 并应用推送中的 updates(title, type, private),
+// 本地已经有更新的写入(如: 在 iself 中修改活动)时以重新拉取的数据为准
+func (s *Strava) activityUpdate(ctx context.Context, event *strava.SubscriptionEvent) error {
+	updates := newActivityUpdates(event.Updates)
+	if updates != nil {
+		detailed, err := s.sr.GetDetailedActivity(ctx, event.ObjectID, event.OwnerID, query.Fields("updated_at"))
+		if err != nil {
+			return ex.ErrDB.Wrap(err)
+		}
+		if detailed != nil && staleActivityUpdates(event.EventTime, detailed.UpdatedAt) {
+			log.Info("strava push updates ignored, activity updated locally",
+				zap.Int64("object_id", event.ObjectID), zap.Int64("owner_id", event.OwnerID), log.CTX(ctx))
+			updates = nil
+		}
+	}
+	return s.syncActivity(ctx, event.OwnerID, event.ObjectID, updates)
+}
+
+// activityDelete 活动删除: 软删除 detail, raw, stream, lap, zone, comment, kudos, segment effort, 统计数据随之不再包含该活动
+func (s *Strava) activityDelete(ctx context.Context, event *strava.SubscriptionEvent) error {
+	err := s.transRepo.Exec(ctx, func(ctx context.Context) error {
+		if _, txErr := s.sr.DeleteActivityRaw(ctx, event.ObjectID); txErr != nil {
+			return txErr
+		}
+		if _, txErr := s.sr.DeleteDetailedActivity(ctx, event.ObjectID); txErr != nil {
+			return txErr
+		}
+		if _, txErr := s.sr.DeleteStreamSet(ctx, event.ObjectID); txErr != nil {
+			return txErr
+		}
+		if _, txErr := s.sr.DeleteLaps(ctx, event.ObjectID); txErr != nil {
+			return txErr
+		}
+		if _, txErr := s.sr.DeleteActivityZones(ctx, event.ObjectID); txErr != nil {
+			return txErr
+		}
+		if _, txErr := s.sr.DeleteActivityComments(ctx, event.ObjectID); txErr != nil {
+			return txErr
+		}
+		if _, txErr := s.sr.DeleteActivityKudos(ctx, event.ObjectID); txErr != nil {
+			return txErr
+		}
+		// 删除的成绩之后的成绩可能成为个人最好成绩
+		efforts, txErr := s.sr.GetActivitySegmentEfforts(ctx, event.ObjectID, query.Fields("segment_id"))
+		if txErr != nil {
+			return txErr
+		}
+		if _, txErr = s.sr.DeleteSegmentEfforts(ctx, event.ObjectID); txErr != nil {
+			return txErr
+		}
+
+		return s.refreshSegmentPr(ctx, event.OwnerID, effortSegmentIDs(efforts))
+	})
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+
+	return nil
+}
+
+// syncActivity 从 strava 拉取活动详情, stream, 区间和装备, 写入 detail, raw, stream, lap, zone, gear, segment 表
+func (s *Strava) syncActivity(ctx context.Context, ownerID, activityID int64, updates *model.StravaActivityParam) error {
+	// 推送可能乱序到达, 已经删除的活动不再因为之前的 create, update 推送恢复
+	deleted, err := s.sr.IsActivityDeleted(ctx, activityID)
 	if err != nil {
-		return ErrStravaToken.Wrap(err)
+		return ex.ErrDB.Wrap(err)
+	}
+	if deleted {
+		log.Info("strava activity sync ignored, activity deleted",
+			zap.Int64("activity_id", activityID), zap.Int64("owner_id", ownerID), log.CTX(ctx))
+		return nil
 	}
-	stravaCli := strava.NewClient(s.auth.Client(ctx, token))
-	activityData, body, err := stravaCli.Activity.Activity(ctx, event.ObjectID)
+	stravaCli, err := s.stravaClient(ctx, ownerID)
 	if err != nil {
-		return ErrStravaAPI.Wrap(err)
+		return err
+	}
+	activityData, body, err := stravaCli.Activity.Activity(ctx, activityID)
+	if err != nil {
+		return stravaErr(err)
 	}
 	activityRawData := model.StravaActivityRaw{
-		ID:   event.ObjectID,
+		ID:   activityID,
 		Data: string(body),
 	}
 
-	streamSet, err := stravaCli.Activity.ActivityStream(ctx, event.ObjectID)
+	streamSet, err := stravaCli.Activity.ActivityStream(ctx, activityID)
+	if err != nil {
+		return stravaErr(err)
+	}
+	zones, err := activityZones(ctx, stravaCli, activityID)
+	if err != nil {
+		return err
+	}
+	gear, err := s.newGear(ctx, stravaCli, ownerID, activityData.GearId)
+	if err != nil {
+		return err
+	}
+	comments, kudoers, err := activitySocial(ctx, stravaCli, activityID, activityData)
+	if err != nil {
+		return err
+	}
+
+	detailedActivityData := newDetailedActivityModel(activityID, activityData)
+	streamData := newStreamSetModel(activityID, streamSet)
+	lapData := newLapModels(activityID, detailedActivityData.AthleteID, activityData.Laps)
+	zoneData := newZoneModels(detailedActivityData, zones)
+	segmentData, effortData := newSegmentModels(detailedActivityData, activityData.SegmentEfforts)
+	commentData := newCommentModels(activityID, detailedActivityData.AthleteID, comments)
+	kudosData := newKudosModels(activityID, detailedActivityData.AthleteID, kudoers)
+
+	err = s.transRepo.Exec(ctx, func(ctx context.Context) error {
+		if txErr := s.sr.UpsertActivityRaw(ctx, &activityRawData); txErr != nil {
+			return txErr
+		}
+		if txErr := s.sr.UpsertDetailedActivity(ctx, detailedActivityData); txErr != nil {
+			return txErr
+		}
+		if txErr := s.sr.UpsertStreamSet(ctx, streamData); txErr != nil {
+			return txErr
+		}
+		if txErr := s.sr.UpsertLaps(ctx, activityID, lapData); txErr != nil {
+			return txErr
+		}
+		if txErr := s.sr.UpsertActivityZones(ctx, activityID, zoneData); txErr != nil {
+			return txErr
+		}
+		if txErr := s.sr.UpsertActivityComments(ctx, activityID, commentData); txErr != nil {
+			return txErr
+		}
+		if txErr := s.sr.UpsertActivityKudos(ctx, activityID, kudosData); txErr != nil {
+			return txErr
+		}
+		if gear != nil {
+			if txErr := s.sr.UpsertGear(ctx, gear); txErr != nil {
+				return txErr
+			}
+		}
+		if txErr := s.upsertSegmentEfforts(ctx, detailedActivityData, segmentData, effortData); txErr != nil {
+			return txErr
+		}
+		if updates != nil {
+			if _, txErr := s.sr.UpdateDetailedActivity(ctx, activityID, updates); txErr != nil {
+				return txErr
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return ex.ErrDB.Wrap(err)
+	}
+	// 提醒失败不影响活动导入, 下次导入该装备的活动时重新检查
+	if detailedActivityData.GearID != "" {
+		if err = s.checkGearAlert(ctx, ownerID, detailedActivityData.GearID); err != nil {
+			log.Error("check strava gear alert", zap.Int64("athlete_id", ownerID),
+				zap.String("gear_id", detailedActivityData.GearID), zap.Error(err), log.CTX(ctx))
+		}
+	}
+
+	return nil
+}
+
+// stravaClient 使用用户的 oauth2 token 创建 strava client
+func (s *Strava) stravaClient(ctx context.Context, athleteID int64) (*strava.Client, error) {
+	token, err := s.tr.GetToken(ctx, oauth2x.StravaSource, athleteID, s.auth.Refresh)
 	if err != nil {
-		return ErrStravaAPI.Wrap(err)
+		return nil, ErrStravaToken.Wrap(err)
 	}
 
-	detailedActivityData := model.StravaActivityDetail{
-		ID:                 event.ObjectID,
+	cli := strava.NewClient(s.auth.Client(ctx, token))
+	cli.BaseURL = s.cfg.BaseURL
+	cli.Limiter = s.limiter
+
+	return cli, nil
+}
+
+func newDetailedActivityModel(activityID int64, activityData *strava.DetailedActivity) *model.StravaActivityDetail {
+	m := model.StravaActivityDetail{
+		ID:                 activityID,
 		AthleteID:          activityData.Athlete.ID,
 		Name:               activityData.Name,
 		Type:               activityData.Type,
@@ -283,16 +584,31 @@ func (s *Strava) activityCreate(ctx context.Context, event *strava.SubscriptionE
 		ElevLow:          activityData.ElevLow,
 		Calories:         activityData.Calories,
 		DeviceName:       activityData.DeviceName,
+		Private:          activityData.Private,
 		SplitsMetricJSON: activityData.SplitsMetric,
 		BestEffortsJSON:  activityData.BestEfforts,
+		LapStructure:     lapStructure(activityData.Laps),
+		GearID:           activityData.GearId,
+		Description:      activityData.Description,
+		Commute:          activityData.Commute,
+		Trainer:          activityData.Trainer,
+		KudosCount:       activityData.KudosCount,
+		CommentCount:     activityData.CommentCount,
+	}
+	if !activityData.StartDate.IsZero() {
+		m.StartDate = &activityData.StartDate
 	}
 	if activityData.Map != nil {
-		detailedActivityData.SummaryPolyline = activityData.Map.SummaryPolyline
-		detailedActivityData.Polyline = activityData.Map.Polyline
+		m.SummaryPolyline = activityData.Map.SummaryPolyline
+		m.Polyline = activityData.Map.Polyline
 	}
 
-	streamData := model.StravaActivityStream{
-		ID:                   detailedActivityData.ID,
+	return &m
+}
+
+func newStreamSetModel(activityID int64, streamSet *strava.StreamSet) *model.StravaActivityStream {
+	return &model.StravaActivityStream{
+		ID:                   activityID,
 		TimeStream:           streamSet.Time,
 		DistanceStream:       streamSet.Distance,
 		LatlngStream:         streamSet.Latlng,
@@ -305,29 +621,30 @@ func (s *Strava) activityCreate(ctx context.Context, event *strava.SubscriptionE
 		MovingStream:         streamSet.Moving,
 		GradeSmoothStream:    streamSet.GradeSmooth,
 	}
+}
 
-	err = s.transRepo.Exec(ctx, func(ctx context.Context) error {
-		if txErr := s.sr.CreateActivityRaw(ctx, &activityRawData); txErr != nil {
-			return txErr
-		}
-		if txErr := s.sr.CreateDetailedActivity(ctx, &detailedActivityData); txErr != nil {
-			return txErr
-		}
-		if txErr := s.sr.CreateStreamSet(ctx, &streamData); txErr != nil {
-			return txErr
-		}
-		updateParams := &model.StravaPushEventParam{Status: util.Int(int(model.EventProcessedStatus))}
-		if _, txErr := s.sr.UpdatePushEvent(ctx, event.ObjectID, updateParams); txErr != nil {
-			return txErr
-		}
-
+// newActivityUpdates 解析 update 推送中的 updates, 如: {"title": "Messy", "type": "Run", "private": "true"}
+func newActivityUpdates(updates map[string]interface{}) *model.StravaActivityParam {
+	var params model.StravaActivityParam
+	var changed bool
+	if v, ok := updates["title"].(string); ok {
+		params.Name = &v
+		changed = true
+	}
+	if v, ok := updates["type"].(string); ok {
+		params.Type = &v
+		changed = true
+	}
+	if v, ok := updates["private"]; ok {
+		private := fmt.Sprint(v) == "true"
+		params.Private = &private
+		changed = true
+	}
+	if !changed {
 		return nil
-	})
-	if err != nil {
-		return ex.ErrDB.Wrap(err)
 	}
 
-	return nil
+	return &params
 }
 
 func (s *Strava) CreateGoal(ctx context.Context, athleteID int64, req *types.CreateGoalReq) error {
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/happyxhw/pkg/log"
+
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/oauth2x"
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+// ResolveSubscription 确定已注册的推送订阅 id, 未配置 subscription_id 时通过 strava api 查询,
+// 推送接口只与该 id 比较, 不会调用 strava api
+func (s *Strava) ResolveSubscription(ctx context.Context, c *oauth2x.ClientConfig) error {
+	if atomic.LoadInt64(&s.subscriptionID) != 0 {
+		return nil
+	}
+	if c == nil {
+		return ex.ErrForbidden.Msg("strava client not configured")
+	}
+	ctx, cancel := context.WithTimeout(ctx, subscriptionTimeout)
+	defer cancel()
+	cli := strava.NewClient(&http.Client{Timeout: subscriptionTimeout})
+	cli.BaseURL = s.cfg.BaseURL
+	cli.Limiter = s.limiter
+	subs, err := cli.Subscription.View(ctx, c.ClientID, c.ClientSecret)
+	if err != nil {
+		return stravaErr(err)
+	}
+	if len(subs) == 0 {
+		return ex.ErrForbidden.Msg("no subscription registered")
+	}
+	atomic.StoreInt64(&s.subscriptionID, subs[0].ID)
+
+	return nil
+}
+
+// RunSubscriptionWorker 在后台查询推送订阅, 失败后定期重试, 查询到之前拒绝所有推送;
+// strava 不可用时不影响服务启动, 阻塞直到查询成功或者 ctx 结束
+func (s *Strava) RunSubscriptionWorker(ctx context.Context, c *oauth2x.ClientConfig) {
+	ticker := time.NewTicker(subscriptionRetryInterval)
+	defer ticker.Stop()
+	for {
+		err := s.ResolveSubscription(ctx, c)
+		if err == nil {
+			log.Info("strava subscription resolved", zap.Int64("subscription_id", atomic.LoadInt64(&s.subscriptionID)))
+			return
+		}
+		log.GetLogger().Warn("resolve strava subscription, push events are rejected until resolved, "+
+			"set strava.subscription_id or create one", zap.Error(err))
+		// 没有配置 strava client 时重试也不会成功
+		if c == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// verifySubscription 校验推送事件是否来自已注册的订阅, 订阅还没有查询到时返回 503, strava 稍后重新推送
+func (s *Strava) verifySubscription(_ context.Context, subscriptionID int64) error {
+	registered := atomic.LoadInt64(&s.subscriptionID)
+	if registered == 0 {
+		return ErrStravaAPI.Msg("subscription not resolved")
+	}
+	if subscriptionID == 0 || subscriptionID != registered {
+		log.Error("unknown subscription", zap.Int64("subscription_id", subscriptionID),
+			zap.Int64("registered", registered))
+		return ex.ErrForbidden.Msg("unknown subscription")
+	}
+	return nil
+}
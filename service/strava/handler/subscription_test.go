@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/oauth2x"
+	"github.com/happyxhw/iself/pkg/strava/stravatest"
+)
+
+func TestVerifySubscription(t *testing.T) {
+	s := NewStrava(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, &Config{SubscriptionID: 120475})
+
+	require.NoError(t, s.ResolveSubscription(context.TODO(), nil))
+	require.NoError(t, s.verifySubscription(context.TODO(), 120475))
+
+	err := s.verifySubscription(context.TODO(), 1)
+	var e *ex.Error
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, e.Status, ex.ErrForbidden.Status)
+}
+
+func TestResolveSubscription(t *testing.T) {
+	server := stravatest.NewServer(nil)
+	defer server.Close()
+
+	s := NewStrava(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, &Config{BaseURL: server.APIURL()})
+	// 没有查询到订阅时, 推送接口返回 503 拒绝所有推送, strava 稍后重新推送, 不会调用 strava api
+	err := s.ResolveSubscription(context.TODO(), &oauth2x.ClientConfig{ClientID: "1", ClientSecret: "secret"})
+	require.Error(t, err)
+	usage := server.Usage()
+	err = s.verifySubscription(context.TODO(), 0)
+	var e *ex.Error
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, e.Status, ErrStravaAPI.Status)
+	require.Error(t, s.verifySubscription(context.TODO(), 120475))
+	require.Equal(t, server.Usage(), usage)
+}
+
+func TestRunSubscriptionWorker(t *testing.T) {
+	s := NewStrava(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, &Config{})
+	// 没有配置 strava client 时不重试, 直接返回
+	done := make(chan struct{})
+	go func() {
+		s.RunSubscriptionWorker(context.TODO(), nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscription worker not returned")
+	}
+	require.Error(t, s.verifySubscription(context.TODO(), 120475))
+
+	// ctx 结束后退出
+	server := stravatest.NewServer(nil)
+	defer server.Close()
+	s = NewStrava(nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, &Config{BaseURL: server.APIURL()})
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Millisecond*100)
+	defer cancel()
+	s.RunSubscriptionWorker(ctx, &oauth2x.ClientConfig{ClientID: "1", ClientSecret: "secret"})
+	require.Error(t, s.verifySubscription(context.TODO(), 120475))
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/happyxhw/pkg/log"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/pkg/util"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// uploadDataTypes strava 支持的文件类型
+var uploadDataTypes = []string{"fit", "tcx", "gpx"}
+
+// CreateUpload 上传活动文件到 strava, strava 异步处理, worker 查询处理状态, 生成的活动由推送导入
+func (s *Strava) CreateUpload(ctx context.Context, athleteID int64, req *types.CreateUploadReq,
+	filename string, file io.Reader) (*types.Upload, error) {
+	dataType := uploadDataType(filename)
+	if dataType == "" {
+		return nil, ex.ErrParam.Msg("unsupported file type, fit, tcx, gpx and gzipped files are supported")
+	}
+	stravaCli, err := s.stravaClient(ctx, athleteID)
+	if err != nil {
+		return nil, err
+	}
+	param := strava.UploadParam{
+		DataType:    dataType,
+		Name:        req.Name,
+		Description: req.Description,
+		Trainer:     req.Trainer,
+		Commute:     req.Commute,
+		ExternalID:  req.ExternalID,
+	}
+	data, err := stravaCli.Uploads.Create(ctx, filename, file, &param)
+	if err != nil {
+		return nil, stravaErr(err)
+	}
+	upload := model.StravaUpload{
+		ID:           data.Id,
+		AthleteID:    athleteID,
+		Filename:     filepath.Base(filename),
+		DataType:     dataType,
+		ExternalID:   data.ExternalId,
+		Status:       int(model.UploadProcessingStatus),
+		StravaStatus: data.Status,
+		LastError:    data.Error,
+		ActivityID:   data.ActivityId,
+	}
+	if data.Error != "" {
+		upload.Status = int(model.UploadFailedStatus)
+	}
+	if err = s.sr.CreateUpload(ctx, &upload); err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if upload.Status == int(model.UploadProcessingStatus) {
+		s.requeueUpload(ctx, upload.ID, s.cfg.UploadPollInterval)
+	}
+
+	return types.NewUpload(&upload), nil
+}
+
+func (s *Strava) GetUpload(ctx context.Context, athleteID, id int64) (*types.Upload, error) {
+	upload, err := s.sr.GetUpload(ctx, id, athleteID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if upload == nil {
+		return nil, ex.ErrNotFound.Msg("upload not found")
+	}
+
+	return types.NewUpload(upload), nil
+}
+
+func (s *Strava) ListUpload(ctx context.Context, athleteID int64, req *model.StravaUploadQueryParam) (*types.UploadQueryResult, error) {
+	p, r, err := s.sr.QueryUpload(ctx, athleteID, req, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	return &types.UploadQueryResult{
+		PageResult: p,
+		Data:       types.NewUploadList(r),
+	}, nil
+}
+
+// RunUploadWorker 查询上传的处理状态, 记录生成的活动, 阻塞直到 ctx 结束
+func (s *Strava) RunUploadWorker(ctx context.Context) {
+	processing, err := s.sr.GetUploadByStatus(ctx, int(model.UploadProcessingStatus), query.Fields("id"))
+	if err != nil {
+		log.Error("recover strava upload", zap.Error(err))
+	}
+	for _, item := range processing {
+		s.requeueUpload(ctx, item.ID, 0)
+	}
+
+	ticker := time.NewTicker(pushPollInterval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		id, popErr := s.uploadQueue.Pop(ctx, time.Now())
+		if popErr != nil {
+			log.Error("pop strava upload", zap.Error(popErr))
+		}
+		if id != 0 {
+			s.pollUpload(ctx, id)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollUpload 查询一次处理状态, strava 处理完成后记录生成的活动 id, 并与创建活动的推送一样加入推送队列导入,
+// 不依赖 strava 的推送, 订阅不可用或者推送丢失时活动也会导入
+func (s *Strava) pollUpload(ctx context.Context, id int64) {
+	upload, err := s.sr.GetUpload(ctx, id, 0, query.Opt{})
+	if err != nil {
+		log.Error("get strava upload", zap.Int64("id", id), zap.Error(err))
+		s.requeueUpload(ctx, id, s.cfg.PushBackoff)
+		return
+	}
+	if upload == nil || upload.Status != int(model.UploadProcessingStatus) {
+		return
+	}
+
+	upload.Attempts++
+	err = s.refreshUpload(ctx, upload)
+	if err == nil && upload.ActivityID != 0 {
+		err = s.enqueueUploadActivity(ctx, upload)
+	}
+	params := model.StravaUploadParam{
+		Attempts:     util.Int(upload.Attempts),
+		StravaStatus: util.String(upload.StravaStatus),
+		ActivityID:   &upload.ActivityID,
+	}
+
+	delay := s.cfg.UploadPollInterval
+	switch {
+	case err == nil && upload.ActivityID != 0:
+		params.Status = util.Int(int(model.UploadReadyStatus))
+		params.LastError = util.String("")
+	case err == nil && upload.LastError != "":
+		// strava 处理失败, 如: 文件格式错误, 重复的活动
+		params.Status = util.Int(int(model.UploadFailedStatus))
+		params.LastError = util.String(upload.LastError)
+	case err == nil && upload.Attempts >= maxUploadAttempts:
+		params.Status = util.Int(int(model.UploadFailedStatus))
+		params.LastError = util.String("strava processing timeout")
+	case err != nil && (upload.Attempts >= maxUploadAttempts || !retryable(err)):
+		log.Error("strava upload failed", zap.Int64("id", id), zap.Error(err))
+		params.Status = util.Int(int(model.UploadFailedStatus))
+		params.LastError = util.String(err.Error())
+	case err != nil:
+		log.Info("strava upload retrying", zap.Int64("id", id), zap.Int("attempts", upload.Attempts), zap.Error(err))
+		params.LastError = util.String(err.Error())
+		delay = pushBackoff(s.cfg.PushBackoff, upload.Attempts)
+	}
+	if _, dbErr := s.sr.UpdateUpload(ctx, id, &params); dbErr != nil {
+		log.Error("update strava upload", zap.Int64("id", id), zap.Error(dbErr))
+		s.requeueUpload(ctx, id, s.cfg.PushBackoff)
+		return
+	}
+	if params.Status == nil {
+		s.requeueUpload(ctx, id, delay)
+	}
+}
+
+// enqueueUploadActivity 生成一个创建活动的推送事件, 由推送 worker 导入; 事件时间使用上传时间,
+// 重复查询时命中唯一索引不会重复加入, strava 的推送到达时重新导入同一个活动, 结果相同
+func (s *Strava) enqueueUploadActivity(ctx context.Context, upload *model.StravaUpload) error {
+	pushEvent := model.StravaPushEvent{
+		SubscriptionID: atomic.LoadInt64(&s.subscriptionID),
+		OwnerID:        upload.AthleteID,
+		AspectType:     "create",
+		EventTime:      upload.CreatedAt.Unix(),
+		ObjectID:       upload.ActivityID,
+		ObjectType:     "activity",
+		Updates:        "{}",
+	}
+
+	return s.enqueuePushEvent(ctx, &pushEvent)
+}
+
+// refreshUpload 从 strava 查询处理状态, 处理失败时记录在 upload.LastError 中
+func (s *Strava) refreshUpload(ctx context.Context, upload *model.StravaUpload) error {
+	stravaCli, err := s.stravaClient(ctx, upload.AthleteID)
+	if err != nil {
+		return err
+	}
+	data, err := stravaCli.Uploads.Get(ctx, upload.ID)
+	if err != nil {
+		return stravaErr(err)
+	}
+	upload.StravaStatus = data.Status
+	upload.LastError = data.Error
+	upload.ActivityID = data.ActivityId
+
+	return nil
+}
+
+func (s *Strava) requeueUpload(ctx context.Context, id int64, delay time.Duration) {
+	if err := s.uploadQueue.Push(ctx, id, time.Now().Add(delay)); err != nil {
+		log.Error("requeue strava upload", zap.Int64("id", id), zap.Error(err))
+	}
+}
+
+// uploadDataType 根据文件扩展名判断文件类型, 如: run.fit.gz -> fit.gz, 不支持时返回空
+func uploadDataType(filename string) string {
+	name := strings.ToLower(filepath.Base(filename))
+	suffix := ""
+	if strings.HasSuffix(name, ".gz") {
+		name, suffix = strings.TrimSuffix(name, ".gz"), ".gz"
+	}
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	for _, item := range uploadDataTypes {
+		if ext == item {
+			return ext + suffix
+		}
+	}
+	return ""
+}
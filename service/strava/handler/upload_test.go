@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/pkg/strava/stravatest"
+)
+
+var (
+	uploadColumns   = []string{"id", "athlete_id", "status", "attempts", "activity_id", "created_at"}
+	uploadCreatedAt = time.Date(2022, 11, 22, 10, 0, 0, 0, time.UTC)
+)
+
+func TestUploadDataType(t *testing.T) {
+	require.Equal(t, uploadDataType("morning.fit"), "fit")
+	require.Equal(t, uploadDataType("/tmp/Morning.GPX"), "gpx")
+	require.Equal(t, uploadDataType("morning.tcx.gz"), "tcx.gz")
+	require.Equal(t, uploadDataType("morning.gz"), "")
+	require.Equal(t, uploadDataType("morning.csv"), "")
+	require.Equal(t, uploadDataType("fit"), "")
+}
+
+// createFakeUpload 在 fake strava 上传文件, 返回 upload id
+func createFakeUpload(t *testing.T, server *stravatest.Server, externalID string) int64 {
+	param := strava.UploadParam{DataType: "gpx", ExternalID: externalID}
+	upload, err := server.Client("access-1001").Uploads.Create(context.TODO(), externalID, strings.NewReader("<gpx/>"), &param)
+	require.NoError(t, err)
+	return upload.Id
+}
+
+func expectUpload(mock sqlmock.Sqlmock, id int64, attempts int) {
+	mock.ExpectQuery(`SELECT * FROM "strava_upload" WHERE id = $1 LIMIT 1`).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(uploadColumns).
+			AddRow(id, mockAthleteID, model.UploadProcessingStatus, attempts, 0, uploadCreatedAt))
+}
+
+const createPushEventSQL = `INSERT INTO "strava_push_event" ("subscription_id","aspect_type","event_time","object_id","object_type","owner_id","updates","status","attempts","last_error") ` +
+	`VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) ON CONFLICT ("subscription_id","object_type","object_id","event_time","aspect_type") DO NOTHING RETURNING "created_at","updated_at","id"`
+
+// expectUploadActivity 生成创建活动的推送事件, 加入推送队列
+func expectUploadActivity(mock sqlmock.Sqlmock, rmock redismock.ClientMock, activityID int64) {
+	mock.ExpectQuery(createPushEventSQL).
+		WithArgs(int64(0), "create", uploadCreatedAt.Unix(), activityID, "activity", mockAthleteID, "{}", 0, 0, "").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at", "id"}).AddRow(time.Now(), time.Now(), 10))
+	rmock.CustomMatch(matchMember).ExpectZAddNX(mockPushQueueKey, &redis.Z{Member: int64(10)}).SetVal(1)
+}
+
+func TestStrava_PollUploadReady(t *testing.T) {
+	server := stravatest.NewServer(nil)
+	defer server.Close()
+	id := createFakeUpload(t, server, "track.gpx")
+
+	s, mock, rmock := newMockStrava(t, server)
+	// 第一次查询仍在处理, 记录次数后重新加入队列
+	expectUpload(mock, id, 0)
+	rmock.ExpectGet(mockTokenKey).SetVal(mockToken)
+	mock.ExpectExec(`UPDATE "strava_upload" SET "strava_status"=$1,"activity_id"=$2,"attempts"=$3,"updated_at"=$4 WHERE id = $5`).
+		WithArgs("Your activity is still being processed.", int64(0), 1, sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	rmock.CustomMatch(matchMember).ExpectZAddNX(mockUploadQueueKey, &redis.Z{Member: id}).SetVal(1)
+	// 生成活动后与创建活动的推送一样加入推送队列, 由推送 worker 导入, 不依赖 strava 的推送
+	expectUpload(mock, id, 1)
+	rmock.ExpectGet(mockTokenKey).SetVal(mockToken)
+	expectUploadActivity(mock, rmock, uploadActivityID(id))
+	mock.ExpectExec(`UPDATE "strava_upload" SET "status"=$1,"strava_status"=$2,"last_error"=$3,"activity_id"=$4,"attempts"=$5,"updated_at"=$6 WHERE id = $7`).
+		WithArgs(int(model.UploadReadyStatus), "Your activity is ready.", "", sqlmock.AnyArg(), 2, sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s.pollUpload(context.TODO(), id)
+	s.pollUpload(context.TODO(), id)
+
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_PollUploadDuplicate(t *testing.T) {
+	server := stravatest.NewServer(nil)
+	defer server.Close()
+	createFakeUpload(t, server, "track.gpx")
+	id := createFakeUpload(t, server, "track.gpx")
+
+	s, mock, rmock := newMockStrava(t, server)
+	// strava 处理失败, 如: 重复的活动, 不再重试
+	expectUpload(mock, id, 0)
+	rmock.ExpectGet(mockTokenKey).SetVal(mockToken)
+	mock.ExpectExec(`UPDATE "strava_upload" SET "status"=$1,"strava_status"=$2,"last_error"=$3,"activity_id"=$4,"attempts"=$5,"updated_at"=$6 WHERE id = $7`).
+		WithArgs(int(model.UploadFailedStatus), "There was an error processing your activity.",
+			"track.gpx duplicate of activity 0", int64(0), 1, sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s.pollUpload(context.TODO(), id)
+
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_PollUploadError(t *testing.T) {
+	server := stravatest.NewServer(nil)
+	defer server.Close()
+	id := createFakeUpload(t, server, "track.gpx")
+	server.InjectError("/uploads", 401, 1)
+
+	s, mock, rmock := newMockStrava(t, server)
+	// 授权错误重试也不会成功, 标记为失败
+	expectUpload(mock, id, 0)
+	rmock.ExpectGet(mockTokenKey).SetVal(mockToken)
+	mock.ExpectExec(`UPDATE "strava_upload" SET "status"=$1,"strava_status"=$2,"last_error"=$3,"activity_id"=$4,"attempts"=$5,"updated_at"=$6 WHERE id = $7`).
+		WithArgs(int(model.UploadFailedStatus), "", sqlmock.AnyArg(), int64(0), 1, sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s.pollUpload(context.TODO(), id)
+
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_PollUploadTimeout(t *testing.T) {
+	server := stravatest.NewServer(nil)
+	defer server.Close()
+	id := createFakeUpload(t, server, "track.gpx")
+
+	s, mock, rmock := newMockStrava(t, server)
+	// 超过最大次数仍在处理, 标记为超时失败
+	expectUpload(mock, id, maxUploadAttempts-1)
+	rmock.ExpectGet(mockTokenKey).SetVal(mockToken)
+	mock.ExpectExec(`UPDATE "strava_upload" SET "status"=$1,"strava_status"=$2,"last_error"=$3,"activity_id"=$4,"attempts"=$5,"updated_at"=$6 WHERE id = $7`).
+		WithArgs(int(model.UploadFailedStatus), "Your activity is still being processed.", "strava processing timeout",
+			int64(0), maxUploadAttempts, sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s.pollUpload(context.TODO(), id)
+
+	checkExpectations(t, mock, rmock)
+}
+
+func TestStrava_PollUploadUpdateFailed(t *testing.T) {
+	server := stravatest.NewServer(nil)
+	defer server.Close()
+	id := createFakeUpload(t, server, "track.gpx")
+	// fake strava 第一次查询仍在处理, 第二次生成活动
+	_, err := server.Client("access-1001").Uploads.Get(context.TODO(), id)
+	require.NoError(t, err)
+
+	s, mock, rmock := newMockStrava(t, server)
+	expectUpload(mock, id, 1)
+	rmock.ExpectGet(mockTokenKey).SetVal(mockToken)
+	expectUploadActivity(mock, rmock, uploadActivityID(id))
+	// 保存状态失败时仍在处理中, 退避后重新查询, 推送事件命中唯一索引不会重复导入
+	mock.ExpectExec(`UPDATE "strava_upload" SET "status"=$1,"strava_status"=$2,"last_error"=$3,"activity_id"=$4,"attempts"=$5,"updated_at"=$6 WHERE id = $7`).
+		WithArgs(int(model.UploadReadyStatus), "Your activity is ready.", "", uploadActivityID(id), 2, sqlmock.AnyArg(), id).
+		WillReturnError(sqlmock.ErrCancelled)
+	rmock.CustomMatch(matchMember).ExpectZAddNX(mockUploadQueueKey, &redis.Z{Member: id}).SetVal(1)
+
+	s.pollUpload(context.TODO(), id)
+
+	checkExpectations(t, mock, rmock)
+}
+
+// uploadActivityID fake strava 上传生成的活动 id
+func uploadActivityID(uploadID int64) int64 {
+	return 1000000 + uploadID
+}
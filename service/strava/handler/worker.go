@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/happyxhw/pkg/log"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/pkg/util"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+// RunPushWorker 启动 worker 处理队列中的推送事件, 阻塞直到 ctx 结束
+func (s *Strava) RunPushWorker(ctx context.Context) {
+	s.recoverPushEvent(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.cfg.PushWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.pushWorker(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// recoverPushEvent 进程退出时正在处理的事件已经不在队列中, 启动时重新加入队列
+func (s *Strava) recoverPushEvent(ctx context.Context) {
+	status := []int{int(model.EventProcessingStatus), int(model.EventRetryingStatus)}
+	events, err := s.sr.GetPushEventByStatus(ctx, status, query.Fields("id"))
+	if err != nil {
+		log.Error("recover strava push event", zap.Error(err))
+		return
+	}
+	for _, item := range events {
+		if err = s.pushQueue.Push(ctx, item.ID, time.Now()); err != nil {
+			log.Error("recover strava push event", zap.Int64("id", item.ID), zap.Error(err))
+		}
+	}
+}
+
+func (s *Strava) pushWorker(ctx context.Context) {
+	ticker := time.NewTicker(pushPollInterval)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		id, err := s.pushQueue.Pop(ctx, time.Now())
+		if err != nil {
+			log.Error("pop strava push event", zap.Error(err))
+		}
+		// 队列中有任务时连续处理, 没有任务时等待下一次轮询
+		if id != 0 {
+			s.handlePushEvent(ctx, id)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+// handlePushEvent 处理一个推送事件, 失败后按指数退避重新加入队列, 超过最大次数后标记为失败
+func (s *Strava) handlePushEvent(ctx context.Context, id int64) {
+	e, err := s.sr.GetPushEventByID(ctx, id, query.Opt{})
+	if err != nil {
+		log.Error("get strava push event", zap.Int64("id", id), zap.Error(err))
+		s.requeuePushEvent(ctx, id, s.cfg.PushBackoff)
+		return
+	}
+	if e == nil || e.Status == int(model.EventProcessedStatus) || e.Status == int(model.EventFailedStatus) {
+		return
+	}
+	// 同一个 object 的推送同时只由一个 worker 处理, 其它 worker 取到时稍后重新加入队列
+	key := pushLockKey(e)
+	locked, err := s.cacher.SetNX(ctx, key, id, pushLockTTL)
+	if err != nil {
+		log.Error("lock strava push object", zap.Int64("id", id), zap.Error(err))
+		s.requeuePushEvent(ctx, id, s.cfg.PushBackoff)
+		return
+	}
+	if !locked {
+		s.requeuePushEvent(ctx, id, pushPollInterval)
+		return
+	}
+	// 处理超过 pushLockTTL 时锁可能已经被其它 worker 持有, 只释放自己的锁
+	defer func() {
+		if _, delErr := s.cacher.DelIfEqual(ctx, key, id); delErr != nil {
+			log.Error("unlock strava push object", zap.Int64("id", id), zap.Error(delErr))
+		}
+	}()
+
+	event, err := newSubscriptionEvent(e)
+	if err == nil {
+		pushCtx, cancel := context.WithTimeout(strava.WithPriority(ctx, strava.PriorityHigh), pushTimeout)
+		err = s.push(pushCtx, event)
+		cancel()
+	}
+
+	attempts := e.Attempts + 1
+	params := model.StravaPushEventParam{Attempts: &attempts, LastError: util.String("")}
+	switch {
+	case err == nil:
+		params.Status = util.Int(int(model.EventProcessedStatus))
+	case attempts >= s.cfg.PushMaxAttempts || !retryable(err):
+		log.Error("strava push failed", zap.Int64("id", id), zap.Int64("object_id", e.ObjectID), zap.Error(err))
+		params.Status = util.Int(int(model.EventFailedStatus))
+		params.LastError = util.String(err.Error())
+	default:
+		log.Info("strava push retrying", zap.Int64("id", id), zap.Int64("object_id", e.ObjectID),
+			zap.Int("attempts", attempts), zap.Error(err))
+		params.Status = util.Int(int(model.EventRetryingStatus))
+		params.LastError = util.String(err.Error())
+	}
+	if _, dbErr := s.sr.UpdatePushEvent(ctx, id, &params); dbErr != nil {
+		log.Error("update strava push event", zap.Int64("id", id), zap.Error(dbErr))
+	}
+	if *params.Status == int(model.EventRetryingStatus) {
+		s.requeuePushEvent(ctx, id, pushBackoff(s.cfg.PushBackoff, attempts))
+	}
+}
+
+// pushLockKey 推送 object 的锁, athlete 和 activity 的 id 可能相同
+func pushLockKey(e *model.StravaPushEvent) string {
+	return fmt.Sprintf("strava:push:lock:%s:%d", e.ObjectType, e.ObjectID)
+}
+
+func (s *Strava) requeuePushEvent(ctx context.Context, id int64, delay time.Duration) {
+	if err := s.pushQueue.Push(ctx, id, time.Now().Add(delay)); err != nil {
+		log.Error("requeue strava push event", zap.Int64("id", id), zap.Error(err))
+	}
+}
+
+// pushBackoff 第 n 次失败后的等待时间: base * 2^(n-1), 最大 maxPushBackoff
+func pushBackoff(base time.Duration, attempts int) time.Duration {
+	d := base
+	for i := 1; i < attempts && d < maxPushBackoff; i++ {
+		d *= 2
+	}
+	if d > maxPushBackoff {
+		d = maxPushBackoff
+	}
+	return d
+}
+
+// retryable 客户端错误(如未知的事件类型)重试也不会成功
+func retryable(err error) bool {
+	if e, ok := err.(*ex.Error); ok {
+		return e.Status >= 500
+	}
+	return true
+}
+
+func newSubscriptionEvent(e *model.StravaPushEvent) (*strava.SubscriptionEvent, error) {
+	event := strava.SubscriptionEvent{
+		AspectType: e.AspectType,
+		EventTime:  e.EventTime,
+		ObjectID:   e.ObjectID,
+		ObjectType: e.ObjectType,
+		OwnerID:    e.OwnerID,
+	}
+	if e.Updates != "" {
+		if err := json.Unmarshal([]byte(e.Updates), &event.Updates); err != nil {
+			return nil, ex.ErrBadRequest.Wrap(err)
+		}
+	}
+	return &event, nil
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis/v8"
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/pkg/mymock"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/oauth2x"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/repo"
+)
+
+const mockPushQueueKey = "mockPushQueue"
+
+func TestPushBackoff(t *testing.T) {
+	base := time.Second * 30
+
+	require.Equal(t, pushBackoff(base, 1), base)
+	require.Equal(t, pushBackoff(base, 2), base*2)
+	require.Equal(t, pushBackoff(base, 4), base*8)
+	require.Equal(t, pushBackoff(base, 20), maxPushBackoff)
+}
+
+func TestRetryable(t *testing.T) {
+	require.True(t, retryable(errors.New("timeout")))
+	require.True(t, retryable(ErrStravaAPI))
+	require.True(t, retryable(ex.ErrDB.Wrap(errors.New("conn"))))
+	require.False(t, retryable(ex.ErrBadRequest.Msg("unknown aspect type")))
+	require.False(t, retryable(stravaErr(fmt.Errorf("get activity: %w", strava.ErrNotFound))))
+	require.False(t, retryable(stravaErr(strava.ErrUnauthorized)))
+	require.True(t, retryable(stravaErr(strava.ErrRateLimited)))
+}
+
+func TestNewSubscriptionEvent(t *testing.T) {
+	e := model.StravaPushEvent{
+		AspectType: "update",
+		ObjectID:   1,
+		ObjectType: "activity",
+		OwnerID:    2,
+		Updates:    `{"title":"Messy","private":"true"}`,
+	}
+
+	event, err := newSubscriptionEvent(&e)
+
+	require.NoError(t, err)
+	require.Equal(t, event.Updates["title"], "Messy")
+	require.Equal(t, event.OwnerID, e.OwnerID)
+
+	params := newActivityUpdates(event.Updates)
+	require.Equal(t, *params.Name, "Messy")
+	require.True(t, *params.Private)
+	require.Nil(t, params.Type)
+}
+
+func TestDeauthorizeEvent(t *testing.T) {
+	require.True(t, deauthorizeEvent(&strava.SubscriptionEvent{
+		ObjectType: "athlete", Updates: map[string]interface{}{"authorized": "false"},
+	}))
+	require.False(t, deauthorizeEvent(&strava.SubscriptionEvent{
+		ObjectType: "athlete", Updates: map[string]interface{}{"name": "Messy"},
+	}))
+	require.False(t, deauthorizeEvent(&strava.SubscriptionEvent{
+		ObjectType: "activity", Updates: map[string]interface{}{"authorized": "false"},
+	}))
+}
+
+func TestStrava_PushDeauthorized(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	sql := `SELECT "id","source_status" FROM "user" WHERE (source = $1 AND source_id = $2) AND "user"."deleted_at" = $3 LIMIT 1`
+	// 已撤销授权的用户的 activity, athlete 推送都不再处理, sr 为 nil, 调用 strava 或写入数据时会 panic
+	events := []*strava.SubscriptionEvent{
+		{ObjectType: "activity", AspectType: "create", ObjectID: 1, OwnerID: 2},
+		{ObjectType: "activity", AspectType: "update", ObjectID: 1, OwnerID: 2},
+		{ObjectType: "athlete", AspectType: "update", ObjectID: 2, OwnerID: 2},
+	}
+	for range events {
+		mock.ExpectQuery(sql).
+			WithArgs(oauth2x.StravaSource, int64(2), 0).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "source_status"}).
+					AddRow(1, model.SourceDisconnectedStatus),
+			)
+	}
+
+	s := Strava{ur: repo.NewUserRepo(gdb), cfg: (&Config{}).withDefault()}
+
+	for _, event := range events {
+		require.NoError(t, s.push(context.TODO(), event))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+var pushEventColumns = []string{"id", "aspect_type", "event_time", "object_id", "object_type", "owner_id", "status", "attempts"}
+
+// matchMember 只比较 ZADDNX 的 member, score 为按当前时间计算的执行时间
+func matchMember(expected, actual []interface{}) error {
+	if fmt.Sprint(expected[len(expected)-1]) != fmt.Sprint(actual[len(actual)-1]) {
+		return fmt.Errorf("member not match, expectation '%+v', but call to cmd '%+v'", expected, actual)
+	}
+	return nil
+}
+
+// matchEvalArgs 只比较 EVAL 的 key 和参数, 不比较脚本
+func matchEvalArgs(expected, actual []interface{}) error {
+	if len(expected) != len(actual) || fmt.Sprint(expected[2:]) != fmt.Sprint(actual[2:]) {
+		return fmt.Errorf("eval args not match, expectation '%+v', but call to cmd '%+v'", expected, actual)
+	}
+	return nil
+}
+
+func TestStrava_HandlePushEventLocked(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	rdb, rmock := redismock.NewClientMock()
+	sql := `SELECT * FROM "strava_push_event" WHERE id = $1 LIMIT 1`
+	mock.ExpectQuery(sql).
+		WithArgs(int64(10)).
+		WillReturnRows(
+			sqlmock.NewRows(pushEventColumns).
+				AddRow(10, "update", 1516126040, 1, "activity", 2, model.EventProcessingStatus, 0),
+		)
+	// 同一个活动的另一个推送正在处理, 稍后重新加入队列, 不增加处理次数
+	rmock.ExpectSetNX("strava:push:lock:activity:1", int64(10), pushLockTTL).SetVal(false)
+	rmock.CustomMatch(matchMember).ExpectZAddNX(mockPushQueueKey, &redis.Z{Member: int64(10)}).SetVal(1)
+
+	s := Strava{
+		sr:        repo.NewStravaRepo(gdb),
+		cacher:    repo.NewCacher(rdb),
+		pushQueue: repo.NewQueue(rdb, mockPushQueueKey),
+		cfg:       (&Config{}).withDefault(),
+	}
+
+	s.handlePushEvent(context.TODO(), 10)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err := rmock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStrava_HandlePushEventAfterDelete(t *testing.T) {
+	gdb, mock, _ := mymock.MockEqualDB()
+	rdb, rmock := redismock.NewClientMock()
+	mock.ExpectQuery(`SELECT * FROM "strava_push_event" WHERE id = $1 LIMIT 1`).
+		WithArgs(int64(10)).
+		WillReturnRows(
+			sqlmock.NewRows(pushEventColumns).
+				AddRow(10, "update", 1516126040, 1, "activity", 2, model.EventRetryingStatus, 1),
+		)
+	rmock.ExpectSetNX("strava:push:lock:activity:1", int64(10), pushLockTTL).SetVal(true)
+	mock.ExpectQuery(`SELECT "id","source_status" FROM "user" WHERE (source = $1 AND source_id = $2) AND "user"."deleted_at" = $3 LIMIT 1`).
+		WithArgs(oauth2x.StravaSource, int64(2), 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "source_status"}))
+	// 删除推送已经先处理, 重试的 update 推送不再拉取 strava, 也不恢复活动
+	mock.ExpectQuery(`SELECT count(*) FROM "strava_activity_detail" WHERE id = $1 AND deleted_at <> 0`).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec(`UPDATE "strava_push_event" SET "status"=$1,"attempts"=$2,"last_error"=$3,"updated_at"=$4 WHERE id = $5`).
+		WithArgs(int(model.EventProcessedStatus), 2, "", sqlmock.AnyArg(), int64(10)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 只释放自己持有的锁
+	rmock.CustomMatch(matchEvalArgs).ExpectEval("", []string{"strava:push:lock:activity:1"}, int64(10)).SetVal(int64(1))
+
+	s := Strava{
+		sr:        repo.NewStravaRepo(gdb),
+		ur:        repo.NewUserRepo(gdb),
+		cacher:    repo.NewCacher(rdb),
+		pushQueue: repo.NewQueue(rdb, mockPushQueueKey),
+		cfg:       (&Config{}).withDefault(),
+	}
+
+	s.handlePushEvent(context.TODO(), 10)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if err := rmock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
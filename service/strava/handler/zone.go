@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/happyxhw/pkg/log"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/service/strava/types"
+)
+
+// GetAthleteZones 查询用户保存的区间设置, 没有同步过时返回空的区间, 只在 SyncAthleteZones 中请求 strava
+func (s *Strava) GetAthleteZones(ctx context.Context, athleteID int64) (*types.AthleteZones, error) {
+	zones, err := s.sr.GetAthleteZones(ctx, athleteID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	if zones == nil {
+		return &types.AthleteZones{}, nil
+	}
+
+	return types.NewAthleteZones(zones), nil
+}
+
+// SyncAthleteZones 从 strava 同步用户的区间设置
+func (s *Strava) SyncAthleteZones(ctx context.Context, athleteID int64) (*types.AthleteZones, error) {
+	stravaCli, err := s.stravaClient(ctx, athleteID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := stravaCli.Athlete.Zones(ctx)
+	if err != nil {
+		return nil, stravaErr(err)
+	}
+	zones := model.StravaAthleteZone{
+		AthleteID:     athleteID,
+		HeartRateJSON: data.HeartRate,
+		PowerJSON:     data.Power,
+		UpdatedAt:     time.Now(),
+	}
+	if err = s.sr.UpsertAthleteZones(ctx, &zones); err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+
+	return types.NewAthleteZones(&zones), nil
+}
+
+// GetZoneStats 以日期为横轴统计每个区间的时间: by week || month || year
+func (s *Strava) GetZoneStats(ctx context.Context, athleteID int64, req *types.ZoneStatsReq) (*types.ZoneStats, error) {
+	now := time.Now()
+	aggReq := types.AggStatsReq{Type: req.Type, Freq: req.Freq, Size: req.Size}
+	startDate, start := findStartDate(&aggReq, now)
+
+	val, err := s.sr.GetZoneAggStats(ctx, athleteID, req.Type, req.ZoneType, startDate, req.Freq)
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	athleteZones, err := s.sr.GetAthleteZones(ctx, athleteID, query.Opt{})
+	if err != nil {
+		return nil, ex.ErrDB.Wrap(err)
+	}
+	ranges := zoneRanges(athleteZones, req.ZoneType)
+
+	// 区间数量以用户当前设置为准, 历史活动可能使用了更多的区间
+	n := len(ranges)
+	for zone := range val {
+		if zone+1 > n {
+			n = zone + 1
+		}
+	}
+
+	date, _ := makeChartData(&aggReq, nil, start, now)
+	if len(date) > aggReq.Size {
+		date = date[len(date)-aggReq.Size:]
+	}
+	r := types.ZoneStats{Time: date, Zones: make([]*types.ZoneSeries, 0, n)}
+	for zone := 0; zone < n; zone++ {
+		_, value := makeChartData(&aggReq, val[zone], start, now)
+		if len(value) > aggReq.Size {
+			value = value[len(value)-aggReq.Size:]
+		}
+		series := types.ZoneSeries{Zone: zone, Value: value}
+		if zone < len(ranges) && ranges[zone] != nil {
+			series.Min, series.Max = ranges[zone].Min, ranges[zone].Max
+		}
+		r.Zones = append(r.Zones, &series)
+	}
+
+	return &r, nil
+}
+
+// activityZones 拉取活动的区间数据, 区间是 strava 订阅用户的功能, 404 时视为没有区间, 授权错误正常返回
+func activityZones(ctx context.Context, cli *strava.Client, activityID int64) ([]*strava.ActivityZone, error) {
+	zones, err := cli.Activity.ActivityZones(ctx, activityID)
+	if err != nil {
+		if errors.Is(err, strava.ErrNotFound) {
+			log.Info("strava activity zones unavailable", zap.Int64("activity_id", activityID),
+				zap.Error(err), log.CTX(ctx))
+			return nil, nil
+		}
+		return nil, stravaErr(err)
+	}
+
+	return zones, nil
+}
+
+// newZoneModels 每个区间一行, 冗余活动类型和开始时间方便按日期统计
+func newZoneModels(detailed *model.StravaActivityDetail, zones []*strava.ActivityZone) []*model.StravaActivityZone {
+	var list []*model.StravaActivityZone
+	for _, item := range zones {
+		if item == nil || item.DistributionBuckets == nil {
+			continue
+		}
+		if item.Type != model.HeartrateZone && item.Type != model.PowerZone {
+			continue
+		}
+		for i, bucket := range *item.DistributionBuckets {
+			if bucket == nil {
+				continue
+			}
+			list = append(list, &model.StravaActivityZone{
+				ActivityID:     detailed.ID,
+				AthleteID:      detailed.AthleteID,
+				ActivityType:   detailed.Type,
+				Type:           item.Type,
+				Zone:           i,
+				Min:            bucket.Min,
+				Max:            bucket.Max,
+				Time:           bucket.Time,
+				SensorBased:    item.SensorBased,
+				StartDateLocal: detailed.StartDateLocal,
+			})
+		}
+	}
+
+	return list
+}
+
+// zoneRanges 用户当前的心率或功率区间
+func zoneRanges(m *model.StravaAthleteZone, zoneType string) strava.ZoneRanges {
+	if m == nil {
+		return nil
+	}
+	var ranges *strava.ZoneRanges
+	switch zoneType {
+	case model.HeartrateZone:
+		if m.HeartRateJSON != nil {
+			ranges = m.HeartRateJSON.Zones
+		}
+	case model.PowerZone:
+		if m.PowerJSON != nil {
+			ranges = m.PowerJSON.Zones
+		}
+	}
+	if ranges == nil {
+		return nil
+	}
+
+	return *ranges
+}
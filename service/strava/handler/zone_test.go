@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/ex"
+	"github.com/happyxhw/iself/pkg/strava"
+	"github.com/happyxhw/iself/pkg/strava/stravatest"
+)
+
+func TestNewZoneModels(t *testing.T) {
+	detailed := model.StravaActivityDetail{
+		ID:             1,
+		AthleteID:      2,
+		Type:           "Run",
+		StartDateLocal: time.Date(2022, 11, 21, 6, 30, 0, 0, time.UTC),
+	}
+	buckets := strava.TimedZoneDistribution{
+		{Min: 0, Max: 123, Time: 180},
+		{Min: 123, Max: -1, Time: 960},
+	}
+	zones := []*strava.ActivityZone{
+		{Type: "heartrate", SensorBased: true, DistributionBuckets: &buckets},
+		{Type: "pace", DistributionBuckets: &buckets},
+		{Type: "power"},
+	}
+
+	list := newZoneModels(&detailed, zones)
+
+	require.Len(t, list, 2)
+	require.Equal(t, list[1].Zone, 1)
+	require.Equal(t, list[1].Time, 960)
+	require.Equal(t, list[1].Max, -1)
+	require.Equal(t, list[1].ActivityType, "Run")
+	require.Equal(t, list[1].StartDateLocal, detailed.StartDateLocal)
+	require.True(t, list[0].SensorBased)
+}
+
+func TestZoneRanges(t *testing.T) {
+	ranges := strava.ZoneRanges{{Min: 0, Max: 150}, {Min: 150, Max: -1}}
+	m := model.StravaAthleteZone{HeartRateJSON: &strava.HeartRateZoneRanges{Zones: &ranges}}
+
+	require.Len(t, zoneRanges(&m, model.HeartrateZone), 2)
+	require.Nil(t, zoneRanges(&m, model.PowerZone))
+	require.Nil(t, zoneRanges(nil, model.HeartrateZone))
+}
+
+func TestActivityZones(t *testing.T) {
+	server := stravatest.NewServer(nil)
+	defer server.Close()
+	cli := server.Client("access-1001")
+
+	zones, err := activityZones(context.TODO(), cli, 2001)
+	require.NoError(t, err)
+	require.Len(t, zones, 1)
+
+	// 没有区间数据
+	server.InjectError("/activities/2001/zones", http.StatusNotFound, 1)
+	zones, err = activityZones(context.TODO(), cli, 2001)
+	require.NoError(t, err)
+	require.Nil(t, zones)
+
+	// 授权错误需要返回, 不能当成没有区间
+	server.InjectError("/activities/2001/zones", http.StatusUnauthorized, 1)
+	_, err = activityZones(context.TODO(), cli, 2001)
+	var e *ex.Error
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, e.Status, ErrStravaAuth.Status)
+}
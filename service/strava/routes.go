@@ -1,49 +1,152 @@
 package strava
 
 import (
+	"context"
+	"sync"
+
 	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
 
 	"github.com/happyxhw/pkg/godb"
 
 	"github.com/happyxhw/pkg/goredis"
 
+	"github.com/happyxhw/pkg/log"
+
+	"github.com/happyxhw/pkg/mailer"
+
 	"github.com/happyxhw/pkg/trans"
 
+	"github.com/happyxhw/iself/model"
 	"github.com/happyxhw/iself/pkg/ex"
 	"github.com/happyxhw/iself/pkg/oauth2x"
+	"github.com/happyxhw/iself/pkg/strava"
 	"github.com/happyxhw/iself/repo"
 	"github.com/happyxhw/iself/service/strava/controller"
 	"github.com/happyxhw/iself/service/strava/handler"
 )
 
-// InitRouter 初始化用户路由
-func InitRouter(e *echo.Echo) {
+const (
+	pushQueueKey     = "strava:push:queue"
+	backfillQueueKey = "strava:backfill:queue"
+	uploadQueueKey   = "strava:upload:queue"
+	clubQueueKey     = "strava:club:queue"
+	archiveQueueKey  = "strava:archive:queue"
+	routeQueueKey    = "strava:route:queue"
+)
+
+// InitRouter 初始化 strava 路由并启动后台 worker, ctx 结束后 worker 退出, wg 用于等待 worker 退出;
+// 返回的 handler 供其他服务使用, 如: 用户首次登录后导入历史活动
+func InitRouter(ctx context.Context, e *echo.Echo, wg *sync.WaitGroup) *handler.Strava {
 	g := e.Group("/api/strava")
 
 	transRepo := trans.NewTrans(godb.DefaultDB())
 	sr := repo.NewStravaRepo(godb.DefaultDB())
 	cacher := repo.NewCacher(goredis.DefaultRDB())
 	tr := repo.NewTokenRepo(cacher)
+	ur := repo.NewUserRepo(godb.DefaultDB())
+	pushQueue := repo.NewQueue(goredis.DefaultRDB(), pushQueueKey)
+	backfillQueue := repo.NewQueue(goredis.DefaultRDB(), backfillQueueKey)
+	uploadQueue := repo.NewQueue(goredis.DefaultRDB(), uploadQueueKey)
+	clubQueue := repo.NewQueue(goredis.DefaultRDB(), clubQueueKey)
+	archiveQueue := repo.NewQueue(goredis.DefaultRDB(), archiveQueueKey)
+	routeQueue := repo.NewQueue(goredis.DefaultRDB(), routeQueueKey)
 	auth := oauth2x.Provider()[oauth2x.StravaSource]
-	srv := handler.NewStrava(sr, tr, transRepo, auth)
+	limiter := repo.NewStravaLimiter(cacher)
+	var cfg handler.Config
+	_ = viper.UnmarshalKey("strava", &cfg)
+	if c := oauth2x.GetClientConfig(oauth2x.StravaSource); c != nil {
+		cfg.BaseURL = strava.APIURL(c.BaseURL)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("invalid strava config", zap.Error(err))
+	}
+	srv := handler.NewStrava(sr, tr, ur, transRepo, cacher, pushQueue, backfillQueue, uploadQueue, clubQueue, archiveQueue,
+		routeQueue, auth, limiter, mailer.DefaultMailer(), &cfg)
 	s := controller.NewStrava(srv)
 
+	// 推送接口只校验订阅 id, 后台查询已注册的订阅, strava 不可用时不影响其他服务启动, 查询到之前拒绝推送
+	client := oauth2x.GetClientConfig(oauth2x.StravaSource)
+	// 异步处理 strava 推送, 历史活动导入, 上传, 俱乐部动态刷新, 个人数据导出, 路线 stream 获取和推送订阅查询
+	workers := []func(context.Context){
+		srv.RunPushWorker, srv.RunBackfillWorker, srv.RunUploadWorker, srv.RunClubWorker, srv.RunArchiveWorker,
+		srv.RunRouteWorker, func(ctx context.Context) { srv.RunSubscriptionWorker(ctx, client) },
+	}
+	for _, run := range workers {
+		wg.Add(1)
+		go func(run func(context.Context)) {
+			defer wg.Done()
+			run(ctx)
+		}(run)
+	}
+
 	router(g, s)
+
+	return srv
 }
 
 func router(g *echo.Group, s *controller.Strava) {
 	g.POST("/push", s.Push)      // 注册
 	g.GET("/push", s.VerifyPush) // verify push
 
+	g.GET("/archives/download", s.DownloadArchive) // 下载个人数据, 使用邮件中的签名链接, 不需要登录
+
 	g.Use(ex.AuthRequired())
 	g.GET("/activities/:id", s.GetActivity)
+	g.PUT("/activities/:id", s.UpdateActivity)           // 修改活动并写回 strava
+	g.GET("/activities/:id/laps/compare", s.CompareLaps) // 逐圈对比
+	g.GET("/activities/:id/export", s.ExportActivity)    // 导出 gpx, tcx
 	g.GET("/activities", s.ListActivity)
+	g.POST("/activities/import", s.ImportActivity) // 本地导入 fit, gpx, tcx 文件
 
 	g.GET("/activities/progress", s.GetProgressStats)
 	g.GET("/activities/agg", s.GetAggStats)
+	g.GET("/activities/zones", s.GetZoneStats)    // 区间时间统计
+	g.GET("/activities/social", s.GetSocialStats) // 每月点赞、评论统计
+
+	g.GET("/athlete", s.GetAthlete)                   // strava 资料
+	g.POST("/athlete/sync", s.SyncAthlete)            // 从 strava 同步资料
+	g.GET("/athlete/reconcile", s.ReconcileAthlete)   // 与 strava 统计对账
+	g.GET("/athlete/zones", s.GetAthleteZones)        // 区间设置
+	g.POST("/athlete/zones/sync", s.SyncAthleteZones) // 从 strava 同步区间设置
+
+	g.POST("/backfill", s.StartBackfill) // 导入历史活动
+	g.GET("/backfill", s.GetBackfill)    // 导入进度
+
+	g.POST("/uploads", s.CreateUpload) // 上传活动文件到 strava
+	g.GET("/uploads", s.ListUpload)    // 上传记录
+	g.GET("/uploads/:id", s.GetUpload) // 上传进度
+
+	g.POST("/routes/sync", s.SyncRoutes)               // 从 strava 同步路线
+	g.GET("/routes", s.ListRoute)                      // 路线列表
+	g.GET("/routes/:id", s.GetRoute)                   // 路线详情
+	g.GET("/routes/:id/export", s.ExportRoute)         // 导出 gpx, tcx
+	g.GET("/routes/:id/activities", s.RouteActivities) // 完成过路线的活动
+
+	g.POST("/clubs/sync", s.SyncClubs)                    // 从 strava 同步加入的俱乐部
+	g.GET("/clubs", s.ListClub)                           // 加入的俱乐部
+	g.GET("/clubs/:id", s.GetClub)                        // 俱乐部详情
+	g.GET("/clubs/:id/activities", s.ListClubActivity)    // 俱乐部动态
+	g.GET("/clubs/:id/leaderboard", s.GetClubLeaderboard) // 每周距离, 时间排行榜
+
+	g.GET("/gears", s.ListGear)       // 装备及累计里程
+	g.GET("/gears/:id", s.GetGear)    // 装备详情
+	g.PUT("/gears/:id", s.UpdateGear) // 设置报废提醒
+
+	g.POST("/archives", s.CreateArchive) // 导出个人数据, 生成后发送下载链接邮件
+	g.GET("/archives/:id", s.GetArchive) // 导出进度
+
+	g.GET("/segments", s.ListSegment)                   // 有成绩的路段
+	g.GET("/segments/:id/efforts", s.GetSegmentEfforts) // 路段的历史成绩
 
 	g.POST("/goals", s.CreateGoal)
 	g.GET("/goals", s.QueryGoal)
 	g.PUT("/goals/:id", s.UpdateGoal)
 	g.DELETE("/goals/:id", s.DeleteGoal)
+
+	admin := g.Group("/admin", ex.RoleRequired(int(model.AdminRole)))
+	admin.GET("/push", s.ListPushEvent)                 // 推送记录
+	admin.POST("/push/replay", s.ReplayFailedPushEvent) // 重新处理所有失败的推送
+	admin.POST("/push/:id/replay", s.ReplayPushEvent)   // 重新处理一个推送
 }
@@ -12,10 +12,16 @@ import (
 type Activity struct {
 	DetailedActivity *DetailedActivity `json:"detailed_activity"`
 	StreamSet        *StreamSet        `json:"stream_set"`
+	Laps             []*Lap            `json:"laps"`
+	Zones            []*Zone           `json:"zones"`
+	SegmentEfforts   []*SegmentEffort  `json:"segment_efforts"`
+	Comments         []*Comment        `json:"comments"`
+	Kudoers          []*Kudoer         `json:"kudoers"`
 }
 
 type DetailedActivity struct {
 	*strava.DetailedActivity
+	Source int `json:"source"` // 活动来源: 0 strava, 1 fit, 2 gpx, 3 tcx
 }
 
 func NewDetailedActivity(m *model.StravaActivityDetail) *DetailedActivity {
@@ -42,6 +48,32 @@ func NewDetailedActivityList(s []*model.StravaActivityDetail) []*DetailedActivit
 type ActivityQueryParam struct {
 	query.Param
 	ActivityType *string `query:"type"`
+	Source       *int    `query:"source" validate:"omitempty,min=0,max=3"`
+}
+
+// UpdateActivityReq 修改活动, 为空的字段不修改, gear_id 为 none 时清除装备
+type UpdateActivityReq struct {
+	ID          int64   `param:"id"`
+	Name        *string `json:"name" validate:"omitempty,max=128"`
+	Type        *string `json:"type" validate:"omitempty,strava_activity"`
+	Description *string `json:"description"`
+	GearID      *string `json:"gear_id" validate:"omitempty,max=32"`
+	Commute     *bool   `json:"commute"`
+	Trainer     *bool   `json:"trainer"`
+}
+
+// ExportActivityReq 导出活动, format: gpx, tcx
+type ExportActivityReq struct {
+	ID     int64  `param:"id"`
+	Format string `query:"format" validate:"omitempty,oneof=gpx tcx"`
+}
+
+// ImportActivityReq 本地导入活动文件, 文件通过 multipart 的 file 字段上传, 名称为空时按开始时间和活动类型生成
+type ImportActivityReq struct {
+	Name        string `form:"name" validate:"max=128"`
+	Description string `form:"description"`
+	Trainer     bool   `form:"trainer"`
+	Commute     bool   `form:"commute"`
 }
 
 type ActivityQueryResult struct {
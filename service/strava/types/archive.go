@@ -0,0 +1,56 @@
+package types
+
+import (
+	"time"
+
+	"github.com/happyxhw/iself/model"
+)
+
+// Archive 个人数据导出进度, status: 0 生成中, 1 已生成, 2 生成失败, 3 已过期
+type Archive struct {
+	ID         int64      `json:"id"`
+	Status     int        `json:"status"`
+	Size       int64      `json:"size,omitempty"`
+	Activities int        `json:"activities"`
+	LastError  string     `json:"last_error,omitempty"`
+	URL        string     `json:"url,omitempty"` // 签名的下载链接, 已生成且未过期时返回
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func NewArchive(m *model.StravaArchive) *Archive {
+	return &Archive{
+		ID:         m.ID,
+		Status:     m.Status,
+		Size:       m.Size,
+		Activities: m.Activities,
+		LastError:  m.LastError,
+		ExpiresAt:  m.ExpiresAt,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}
+}
+
+// DownloadArchiveReq 下载链接中的参数, expires 为过期时间(unix 秒), signature 为 id 和 expires 的签名
+type DownloadArchiveReq struct {
+	ID        int64  `query:"id"`
+	Expires   int64  `query:"expires"`
+	Signature string `query:"signature" validate:"required"`
+}
+
+// ArchiveFile 已生成的导出文件, 下载时直接读取文件, 不加载到内存
+type ArchiveFile struct {
+	Name string
+	Path string
+}
+
+// ArchiveProfile 导出文件中的用户资料, 不包含密码等敏感信息
+type ArchiveProfile struct {
+	Name      string        `json:"name"`
+	Email     string        `json:"email"`
+	AvatarURL string        `json:"avatar_url"`
+	CreatedAt time.Time     `json:"created_at"`
+	Athlete   *Athlete      `json:"athlete,omitempty"`
+	Zones     *AthleteZones `json:"zones,omitempty"`
+}
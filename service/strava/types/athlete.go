@@ -0,0 +1,118 @@
+package types
+
+import (
+	"math"
+	"time"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+// Athlete 用户的 strava 资料, 体重单位千克, ftp 单位瓦
+type Athlete struct {
+	ID                    int64                 `json:"id"`
+	Username              string                `json:"username"`
+	Firstname             string                `json:"firstname"`
+	Lastname              string                `json:"lastname"`
+	Profile               string                `json:"profile"`
+	ProfileMedium         string                `json:"profile_medium"`
+	City                  string                `json:"city"`
+	State                 string                `json:"state"`
+	Country               string                `json:"country"`
+	Sex                   string                `json:"sex"`
+	Summit                bool                  `json:"summit"`
+	MeasurementPreference string                `json:"measurement_preference"`
+	Ftp                   int                   `json:"ftp"`
+	Weight                float64               `json:"weight"`
+	FtpPerKg              float64               `json:"ftp_per_kg"` // 功率体重比, 缺少 ftp 或体重时为 0
+	Bikes                 []*strava.SummaryGear `json:"bikes"`
+	Shoes                 []*strava.SummaryGear `json:"shoes"`
+	Stats                 *strava.ActivityStats `json:"stats"`
+	UpdatedAt             time.Time             `json:"updated_at"`
+}
+
+func NewAthlete(m *model.StravaAthlete) *Athlete {
+	a := Athlete{
+		ID:                    m.AthleteID,
+		Username:              m.Username,
+		Firstname:             m.Firstname,
+		Lastname:              m.Lastname,
+		Profile:               m.Profile,
+		ProfileMedium:         m.ProfileMedium,
+		City:                  m.City,
+		State:                 m.State,
+		Country:               m.Country,
+		Sex:                   m.Sex,
+		Summit:                m.Summit,
+		MeasurementPreference: m.MeasurementPreference,
+		Ftp:                   m.Ftp,
+		Weight:                m.Weight,
+		Bikes:                 m.BikesJSON,
+		Shoes:                 m.ShoesJSON,
+		Stats:                 m.StatsJSON,
+		UpdatedAt:             m.UpdatedAt,
+	}
+	if m.Ftp > 0 && m.Weight > 0 {
+		a.FtpPerKg = math.Round(float64(m.Ftp)/m.Weight*100) / 100
+	}
+	return &a
+}
+
+// AthleteReconciliation strava 统计与已导入活动的累计数据对比, UpdatedAt 为 strava 统计的同步时间
+type AthleteReconciliation struct {
+	UpdatedAt time.Time              `json:"updated_at"`
+	Totals    []*TotalReconciliation `json:"totals"`
+}
+
+// TotalReconciliation 一种类型在一个范围内的对比, Diff = Local - Strava
+type TotalReconciliation struct {
+	Type   string `json:"type"`   // run, ride, swim
+	Period string `json:"period"` // recent: 最近四周, ytd: 今年, all: 全部
+	Strava *Total `json:"strava"`
+	Local  *Total `json:"local"`
+	Diff   *Total `json:"diff"`
+	Match  bool   `json:"match"` // 活动数量是否一致
+}
+
+// Total 累计数据, 距离、爬升单位米, 时间单位秒
+type Total struct {
+	Count         int     `json:"count"`
+	Distance      float64 `json:"distance"`
+	MovingTime    int     `json:"moving_time"`
+	ElapsedTime   int     `json:"elapsed_time"`
+	ElevationGain float64 `json:"elevation_gain"`
+}
+
+func NewTotalReconciliation(activityType, period string, s *strava.ActivityTotal,
+	local *model.StravaActivityTotal) *TotalReconciliation {
+	r := TotalReconciliation{
+		Type:   activityType,
+		Period: period,
+		Strava: &Total{},
+		Local: &Total{
+			Count:         local.Count,
+			Distance:      local.Distance,
+			MovingTime:    local.MovingTime,
+			ElapsedTime:   local.ElapsedTime,
+			ElevationGain: local.ElevationGain,
+		},
+	}
+	if s != nil {
+		r.Strava = &Total{
+			Count:         s.Count,
+			Distance:      s.Distance,
+			MovingTime:    s.MovingTime,
+			ElapsedTime:   s.ElapsedTime,
+			ElevationGain: s.ElevationGain,
+		}
+	}
+	r.Diff = &Total{
+		Count:         r.Local.Count - r.Strava.Count,
+		Distance:      r.Local.Distance - r.Strava.Distance,
+		MovingTime:    r.Local.MovingTime - r.Strava.MovingTime,
+		ElapsedTime:   r.Local.ElapsedTime - r.Strava.ElapsedTime,
+		ElevationGain: r.Local.ElevationGain - r.Strava.ElevationGain,
+	}
+	r.Match = r.Diff.Count == 0
+	return &r
+}
@@ -0,0 +1,32 @@
+package types
+
+import (
+	"time"
+
+	"github.com/happyxhw/iself/model"
+)
+
+// Backfill 历史活动导入进度
+type Backfill struct {
+	Status    int        `json:"status"`
+	Before    *time.Time `json:"before,omitempty"` // 已导入到该时间之前的活动
+	Imported  int        `json:"imported"`
+	Skipped   int        `json:"skipped"`
+	LastError string     `json:"last_error,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func NewBackfill(m *model.StravaBackfill) *Backfill {
+	b := Backfill{
+		Status:    m.Status,
+		Imported:  m.Imported,
+		Skipped:   m.Skipped,
+		LastError: m.LastError,
+		UpdatedAt: m.UpdatedAt,
+	}
+	if m.Before != 0 {
+		before := time.Unix(m.Before, 0)
+		b.Before = &before
+	}
+	return &b
+}
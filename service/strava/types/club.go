@@ -0,0 +1,123 @@
+package types
+
+import (
+	"time"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+)
+
+type ClubActivityQueryParam struct {
+	query.Param
+	ID int64 `param:"id"`
+}
+
+// ClubLeaderboardReq date 为周内的任意一天, 为空时为本周, type 为空时统计所有类型
+type ClubLeaderboardReq struct {
+	ID   int64  `param:"id"`
+	Date string `query:"date" validate:"omitempty,datetime=2006-01-02"`
+	Type string `query:"type" validate:"omitempty,oneof=run ride swim"`
+}
+
+type Club struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	SportType     string    `json:"sport_type"`
+	City          string    `json:"city"`
+	Country       string    `json:"country"`
+	Private       bool      `json:"private"`
+	MemberCount   int       `json:"member_count"`
+	ProfileMedium string    `json:"profile_medium"`
+	CoverPhoto    string    `json:"cover_photo"`
+	URL           string    `json:"url"`
+	RefreshedAt   time.Time `json:"refreshed_at"`
+}
+
+type ClubActivity struct {
+	ID                 int64     `json:"id"`
+	AthleteName        string    `json:"athlete_name"`
+	Name               string    `json:"name"`
+	Type               string    `json:"type"`
+	Distance           float64   `json:"distance"`
+	MovingTime         int       `json:"moving_time"`
+	ElapsedTime        int       `json:"elapsed_time"`
+	TotalElevationGain float64   `json:"total_elevation_gain"`
+	FirstSeenAt        time.Time `json:"first_seen_at"`
+}
+
+type ClubActivityQueryResult struct {
+	PageResult *query.PagingResult `json:"page"`
+	Data       []*ClubActivity     `json:"data"`
+}
+
+// ClubLeaderboard 俱乐部成员一周的距离和时间排行, 数据来自俱乐部动态
+type ClubLeaderboard struct {
+	Club       *Club               `json:"club"`
+	WeekStart  time.Time           `json:"week_start"`
+	WeekEnd    time.Time           `json:"week_end"`
+	Distance   []*LeaderboardEntry `json:"distance"`
+	MovingTime []*LeaderboardEntry `json:"moving_time"`
+}
+
+// LeaderboardEntry 数值相同时排名相同
+type LeaderboardEntry struct {
+	Rank          int     `json:"rank"`
+	AthleteName   string  `json:"athlete_name"`
+	Count         int     `json:"count"`
+	Distance      float64 `json:"distance"`
+	MovingTime    int     `json:"moving_time"`
+	ElevationGain float64 `json:"elevation_gain"`
+}
+
+func NewClub(m *model.StravaClub) *Club {
+	return &Club{
+		ID:            m.ID,
+		Name:          m.Name,
+		SportType:     m.SportType,
+		City:          m.City,
+		Country:       m.Country,
+		Private:       m.Private,
+		MemberCount:   m.MemberCount,
+		ProfileMedium: m.ProfileMedium,
+		CoverPhoto:    m.CoverPhoto,
+		URL:           m.URL,
+		RefreshedAt:   m.RefreshedAt,
+	}
+}
+
+func NewClubList(from []*model.StravaClub) []*Club {
+	to := make([]*Club, 0, len(from))
+	for _, item := range from {
+		to = append(to, NewClub(item))
+	}
+	return to
+}
+
+func NewClubActivityList(from []*model.StravaClubActivity) []*ClubActivity {
+	to := make([]*ClubActivity, 0, len(from))
+	for _, m := range from {
+		to = append(to, &ClubActivity{
+			ID:                 m.ID,
+			AthleteName:        m.AthleteName,
+			Name:               m.Name,
+			Type:               m.Type,
+			Distance:           m.Distance,
+			MovingTime:         m.MovingTime,
+			ElapsedTime:        m.ElapsedTime,
+			TotalElevationGain: m.TotalElevationGain,
+			FirstSeenAt:        m.FirstSeenAt,
+		})
+	}
+	return to
+}
+
+func NewLeaderboardEntry(m *model.StravaClubLeaderboard) *LeaderboardEntry {
+	return &LeaderboardEntry{
+		AthleteName:   m.AthleteName,
+		Count:         m.Count,
+		Distance:      m.Distance,
+		MovingTime:    m.MovingTime,
+		ElevationGain: m.ElevationGain,
+	}
+}
@@ -0,0 +1,58 @@
+package types
+
+import "github.com/happyxhw/iself/model"
+
+type Gear struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	BrandName   string `json:"brand_name"`
+	ModelName   string `json:"model_name"`
+	Description string `json:"description"`
+	FrameType   int    `json:"frame_type"`
+	Primary     bool   `json:"primary"`
+
+	StravaDistance float64 `json:"strava_distance"` // strava 统计的总距离, 包括没有导入的活动
+	Distance       float64 `json:"distance"`        // 已导入活动的累计距离, 单位米
+	MovingTime     int     `json:"moving_time"`     // 已导入活动的累计时间, 单位秒
+	ActivityCount  int     `json:"activity_count"`
+
+	RetireDistance float64 `json:"retire_distance"`
+	RetireTime     int     `json:"retire_time"`
+	Retire         bool    `json:"retire"` // 是否已经达到报废提醒的距离或者时间
+}
+
+func NewGear(m *model.StravaGear, stats *model.StravaGearStats) *Gear {
+	g := Gear{
+		ID:             m.ID,
+		Name:           m.Name,
+		BrandName:      m.BrandName,
+		ModelName:      m.ModelName,
+		Description:    m.Description,
+		FrameType:      m.FrameType,
+		Primary:        m.Primary,
+		StravaDistance: m.Distance,
+		RetireDistance: m.RetireDistance,
+		RetireTime:     m.RetireTime,
+	}
+	if stats != nil {
+		g.Distance = stats.Distance
+		g.MovingTime = stats.MovingTime
+		g.ActivityCount = stats.Count
+	}
+	return &g
+}
+
+func NewGearList(ms []*model.StravaGear, stats map[string]*model.StravaGearStats) []*Gear {
+	list := make([]*Gear, 0, len(ms))
+	for _, item := range ms {
+		list = append(list, NewGear(item, stats[item.ID]))
+	}
+	return list
+}
+
+// UpdateGearReq 报废提醒设置, 距离单位米, 时间单位秒, 0 表示不提醒
+type UpdateGearReq struct {
+	ID             string  `param:"id"`
+	RetireDistance float64 `json:"retire_distance" validate:"gte=0"`
+	RetireTime     int     `json:"retire_time" validate:"gte=0"`
+}
@@ -0,0 +1,69 @@
+package types
+
+import (
+	"time"
+
+	"github.com/jinzhu/copier"
+
+	"github.com/happyxhw/iself/model"
+)
+
+type Lap struct {
+	ID                 int64     `json:"id"`
+	LapIndex           int       `json:"lap_index"`
+	Name               string    `json:"name"`
+	Distance           float64   `json:"distance"`
+	MovingTime         int       `json:"moving_time"`
+	ElapsedTime        int       `json:"elapsed_time"`
+	TotalElevationGain float64   `json:"total_elevation_gain"`
+	AverageSpeed       float64   `json:"average_speed"`
+	MaxSpeed           float64   `json:"max_speed"`
+	AverageHeartrate   float64   `json:"average_heartrate"`
+	MaxHeartrate       float64   `json:"max_heartrate"`
+	AverageCadence     float64   `json:"average_cadence"`
+	AverageWatts       float64   `json:"average_watts"`
+	StartIndex         int       `json:"start_index"`
+	EndIndex           int       `json:"end_index"`
+	StartDateLocal     time.Time `json:"start_date_local"`
+}
+
+func NewLap(m *model.StravaActivityLap) *Lap {
+	var l Lap
+	_ = copier.Copy(&l, m)
+	return &l
+}
+
+func NewLapList(s []*model.StravaActivityLap) []*Lap {
+	list := make([]*Lap, 0, len(s))
+	for _, item := range s {
+		list = append(list, NewLap(item))
+	}
+	return list
+}
+
+type LapCompareReq struct {
+	Size int `query:"size"` // 对比的活动数, 包括当前活动
+}
+
+// LapComparison 圈结构相同的活动逐圈对比, 速度已经转换: 跑步为配速 min/km, 骑行为 km/h
+type LapComparison struct {
+	LapStructure string         `json:"lap_structure"`
+	Activities   []*LapActivity `json:"activities"` // 按开始时间倒序, 第一个为当前活动
+	Laps         []*LapStats    `json:"laps"`       // 每圈在所有活动中的统计
+}
+
+type LapActivity struct {
+	ID             int64     `json:"id"`
+	Name           string    `json:"name"`
+	StartDateLocal time.Time `json:"start_date_local"`
+	Laps           []*Lap    `json:"laps"`
+}
+
+type LapStats struct {
+	LapIndex         int     `json:"lap_index"`
+	AverageSpeed     float64 `json:"average_speed"`
+	BestSpeed        float64 `json:"best_speed"`
+	AverageHeartrate float64 `json:"average_heartrate"`
+	AverageCadence   float64 `json:"average_cadence"`
+	AverageWatts     float64 `json:"average_watts"`
+}
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"time"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+)
+
+type PushEventQueryParam struct {
+	query.Param
+	Status     *int    `query:"status"`
+	OwnerID    *int64  `query:"owner_id"`
+	ObjectType *string `query:"object_type"`
+	Start      int64   `query:"start"` // event_time 范围, unix 秒
+	End        int64   `query:"end"`
+}
+
+type PushEvent struct {
+	ID         int64     `json:"id"`
+	AspectType string    `json:"aspect_type"`
+	EventTime  int64     `json:"event_time"`
+	ObjectID   int64     `json:"object_id"`
+	ObjectType string    `json:"object_type"`
+	OwnerID    int64     `json:"owner_id"`
+	Updates    string    `json:"updates,omitempty"`
+	Status     int       `json:"status"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"last_error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type PushEventQueryResult struct {
+	PageResult *query.PagingResult `json:"page"`
+	Data       []*PushEvent        `json:"data"`
+}
+
+type ReplayResult struct {
+	Total int `json:"total"`
+}
+
+func NewPushEvent(m *model.StravaPushEvent) *PushEvent {
+	return &PushEvent{
+		ID:         m.ID,
+		AspectType: m.AspectType,
+		EventTime:  m.EventTime,
+		ObjectID:   m.ObjectID,
+		ObjectType: m.ObjectType,
+		OwnerID:    m.OwnerID,
+		Updates:    m.Updates,
+		Status:     m.Status,
+		Attempts:   m.Attempts,
+		LastError:  m.LastError,
+		CreatedAt:  m.CreatedAt,
+		UpdatedAt:  m.UpdatedAt,
+	}
+}
+
+func NewPushEventList(from []*model.StravaPushEvent) []*PushEvent {
+	to := make([]*PushEvent, 0, len(from))
+	for _, item := range from {
+		to = append(to, NewPushEvent(item))
+	}
+	return to
+}
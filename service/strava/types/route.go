@@ -0,0 +1,97 @@
+package types
+
+import (
+	"time"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+)
+
+type RouteQueryParam struct {
+	query.Param
+	Type    *int  `query:"type" validate:"omitempty,oneof=1 2"`
+	Starred *bool `query:"starred"`
+}
+
+// ExportRouteReq 导出路线, format: gpx, tcx
+type ExportRouteReq struct {
+	ID     int64  `param:"id"`
+	Format string `query:"format" validate:"omitempty,oneof=gpx tcx"`
+}
+
+// Route 路线, type: 1 骑行, 2 跑步
+type Route struct {
+	ID                  int64     `json:"id"`
+	Name                string    `json:"name"`
+	Description         string    `json:"description"`
+	Type                int       `json:"type"`
+	SubType             int       `json:"sub_type"`
+	Distance            float64   `json:"distance"`
+	ElevationGain       float64   `json:"elevation_gain"`
+	EstimatedMovingTime int       `json:"estimated_moving_time"`
+	Private             bool      `json:"private"`
+	Starred             bool      `json:"starred"`
+	SummaryPolyline     string    `json:"summary_polyline"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+type RouteQueryResult struct {
+	PageResult *query.PagingResult `json:"page"`
+	Data       []*Route            `json:"data"`
+}
+
+// RouteSync 同步结果: 路线总数, 新增或者修改的数量, 删除的数量
+type RouteSync struct {
+	Total   int `json:"total"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+// RouteActivitiesReq 完成过路线的活动, 分页查询
+type RouteActivitiesReq struct {
+	ID   int64 `param:"id"`
+	Page int   `query:"page"`
+	Size int   `query:"size"`
+}
+
+// RouteActivities 完成过路线的活动, 按开始时间倒序
+type RouteActivities struct {
+	Route      *Route              `json:"route"`
+	PageResult *query.PagingResult `json:"page"`
+	Data       []*DetailedActivity `json:"data"`
+}
+
+// File 导出的文件
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+func NewRoute(m *model.StravaRoute) *Route {
+	return &Route{
+		ID:                  m.ID,
+		Name:                m.Name,
+		Description:         m.Description,
+		Type:                m.Type,
+		SubType:             m.SubType,
+		Distance:            m.Distance,
+		ElevationGain:       m.ElevationGain,
+		EstimatedMovingTime: m.EstimatedMovingTime,
+		Private:             m.Private,
+		Starred:             m.Starred,
+		SummaryPolyline:     m.SummaryPolyline,
+		CreatedAt:           m.RouteCreatedAt,
+		UpdatedAt:           m.RouteUpdatedAt,
+	}
+}
+
+func NewRouteList(from []*model.StravaRoute) []*Route {
+	to := make([]*Route, 0, len(from))
+	for _, item := range from {
+		to = append(to, NewRoute(item))
+	}
+	return to
+}
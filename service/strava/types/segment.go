@@ -0,0 +1,102 @@
+package types
+
+import (
+	"time"
+
+	"github.com/jinzhu/copier"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+)
+
+type Segment struct {
+	ID            int64   `json:"id"`
+	Name          string  `json:"name"`
+	ActivityType  string  `json:"activity_type"`
+	Distance      float64 `json:"distance"`
+	AverageGrade  float64 `json:"average_grade"`
+	MaximumGrade  float64 `json:"maximum_grade"`
+	ElevationHigh float64 `json:"elevation_high"`
+	ElevationLow  float64 `json:"elevation_low"`
+	ClimbCategory int     `json:"climb_category"`
+	City          string  `json:"city"`
+	State         string  `json:"state"`
+	Country       string  `json:"country"`
+	Private       bool    `json:"private"`
+
+	EffortCount    int        `json:"effort_count"`
+	BestTime       int        `json:"best_time"` // 个人最好成绩, 单位秒
+	LastEffortDate *time.Time `json:"last_effort_date"`
+}
+
+func NewSegment(m *model.StravaSegment, stats *model.StravaSegmentStats) *Segment {
+	var r Segment
+	_ = copier.Copy(&r, m)
+	if stats != nil {
+		r.EffortCount = stats.EffortCount
+		r.BestTime = stats.BestTime
+		r.LastEffortDate = &stats.LastEffortDate
+	}
+	return &r
+}
+
+func NewSegmentList(ms []*model.StravaSegment, stats map[int64]*model.StravaSegmentStats) []*Segment {
+	list := make([]*Segment, 0, len(ms))
+	for _, item := range ms {
+		list = append(list, NewSegment(item, stats[item.ID]))
+	}
+	return list
+}
+
+type SegmentEffort struct {
+	ID               int64     `json:"id"`
+	SegmentID        int64     `json:"segment_id"`
+	ActivityID       int64     `json:"activity_id"`
+	Name             string    `json:"name"`
+	ElapsedTime      int       `json:"elapsed_time"`
+	MovingTime       int       `json:"moving_time"`
+	Distance         float64   `json:"distance"`
+	StartDateLocal   time.Time `json:"start_date_local"`
+	AverageHeartrate float64   `json:"average_heartrate"`
+	MaxHeartrate     float64   `json:"max_heartrate"`
+	AverageWatts     float64   `json:"average_watts"`
+	DeviceWatts      bool      `json:"device_watts"`
+	AverageCadence   float64   `json:"average_cadence"`
+	StartIndex       int       `json:"start_index"`
+	EndIndex         int       `json:"end_index"`
+	PrRank           int       `json:"pr_rank"`
+	IsPr             bool      `json:"is_pr"` // 是否打破了之前的个人最好成绩
+	Hidden           bool      `json:"hidden"`
+}
+
+func NewSegmentEffort(m *model.StravaSegmentEffort) *SegmentEffort {
+	var r SegmentEffort
+	_ = copier.Copy(&r, m)
+	return &r
+}
+
+func NewSegmentEffortList(ms []*model.StravaSegmentEffort) []*SegmentEffort {
+	list := make([]*SegmentEffort, 0, len(ms))
+	for _, item := range ms {
+		list = append(list, NewSegmentEffort(item))
+	}
+	return list
+}
+
+type SegmentQueryParam struct {
+	query.Param
+	ActivityType *string `query:"type"`
+}
+
+type SegmentQueryResult struct {
+	PageResult *query.PagingResult `json:"page"`
+	Data       []*Segment          `json:"data"`
+}
+
+// SegmentHistory 用户在路段上的所有成绩, 按开始时间排列
+type SegmentHistory struct {
+	Segment *Segment         `json:"segment"`
+	Best    *SegmentEffort   `json:"best"`
+	Efforts []*SegmentEffort `json:"efforts"`
+}
@@ -0,0 +1,66 @@
+package types
+
+import (
+	"time"
+
+	"github.com/happyxhw/iself/model"
+)
+
+// SocialStatsReq limit 为评论最多的活动数量, 为空时为 10
+type SocialStatsReq struct {
+	Limit int `query:"limit" validate:"omitempty,min=1,max=50"`
+}
+
+type Comment struct {
+	ID            int64     `json:"id"`
+	CommenterID   int64     `json:"commenter_id"`
+	CommenterName string    `json:"commenter_name"`
+	Text          string    `json:"text"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type Kudoer struct {
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+}
+
+// SocialStats 最近 12 个月每月收到的点赞和评论, 以及评论最多的活动
+type SocialStats struct {
+	Months        []*SocialMonth      `json:"months"`
+	MostCommented []*DetailedActivity `json:"most_commented"`
+}
+
+type SocialMonth struct {
+	Month    string `json:"month"`
+	Count    int    `json:"count"`
+	Kudos    int    `json:"kudos"`
+	Comments int    `json:"comments"`
+}
+
+func NewComment(m *model.StravaActivityComment) *Comment {
+	return &Comment{
+		ID:            m.ID,
+		CommenterID:   m.CommenterID,
+		CommenterName: m.CommenterName,
+		Text:          m.Text,
+		CreatedAt:     m.CommentCreatedAt,
+	}
+}
+
+func NewCommentList(s []*model.StravaActivityComment) []*Comment {
+	list := make([]*Comment, 0, len(s))
+	for _, item := range s {
+		list = append(list, NewComment(item))
+	}
+
+	return list
+}
+
+func NewKudoerList(s []*model.StravaActivityKudos) []*Kudoer {
+	list := make([]*Kudoer, 0, len(s))
+	for _, item := range s {
+		list = append(list, &Kudoer{Firstname: item.Firstname, Lastname: item.Lastname})
+	}
+
+	return list
+}
@@ -11,7 +11,11 @@ type StreamSet struct {
 	ID int64
 }
 
+// NewStreamSet 没有数据流的活动返回 nil, 如: 手动创建的活动
 func NewStreamSet(m *model.StravaActivityStream) *StreamSet {
+	if m == nil {
+		return nil
+	}
 	return &StreamSet{
 		ID: m.ID,
 		StreamSet: &strava.StreamSet{
@@ -0,0 +1,65 @@
+package types
+
+import (
+	"time"
+
+	"github.com/happyxhw/pkg/query"
+
+	"github.com/happyxhw/iself/model"
+)
+
+// CreateUploadReq 上传活动文件, 文件通过 multipart 的 file 字段上传
+type CreateUploadReq struct {
+	Name        string `form:"name" validate:"max=128"`
+	Description string `form:"description"`
+	Trainer     bool   `form:"trainer"`
+	Commute     bool   `form:"commute"`
+	ExternalID  string `form:"external_id" validate:"max=255"`
+}
+
+type UploadQueryParam struct {
+	query.Param
+	Status *int `query:"status"`
+}
+
+// Upload 上传进度, status: 0 处理中, 1 已生成活动, 与创建活动的推送一样导入, 2 上传失败
+type Upload struct {
+	ID           int64     `json:"id"`
+	Filename     string    `json:"filename"`
+	DataType     string    `json:"data_type"`
+	ExternalID   string    `json:"external_id"`
+	Status       int       `json:"status"`
+	StravaStatus string    `json:"strava_status"`
+	LastError    string    `json:"last_error,omitempty"`
+	ActivityID   int64     `json:"activity_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type UploadQueryResult struct {
+	PageResult *query.PagingResult `json:"page"`
+	Data       []*Upload           `json:"data"`
+}
+
+func NewUpload(m *model.StravaUpload) *Upload {
+	return &Upload{
+		ID:           m.ID,
+		Filename:     m.Filename,
+		DataType:     m.DataType,
+		ExternalID:   m.ExternalID,
+		Status:       m.Status,
+		StravaStatus: m.StravaStatus,
+		LastError:    m.LastError,
+		ActivityID:   m.ActivityID,
+		CreatedAt:    m.CreatedAt,
+		UpdatedAt:    m.UpdatedAt,
+	}
+}
+
+func NewUploadList(from []*model.StravaUpload) []*Upload {
+	to := make([]*Upload, 0, len(from))
+	for _, item := range from {
+		to = append(to, NewUpload(item))
+	}
+	return to
+}
@@ -0,0 +1,69 @@
+package types
+
+import (
+	"time"
+
+	"github.com/jinzhu/copier"
+
+	"github.com/happyxhw/iself/model"
+	"github.com/happyxhw/iself/pkg/strava"
+)
+
+type Zone struct {
+	Type        string `json:"type"`
+	Zone        int    `json:"zone"`
+	Min         int    `json:"min"`
+	Max         int    `json:"max"`
+	Time        int    `json:"time"`
+	SensorBased bool   `json:"sensor_based"`
+}
+
+func NewZone(m *model.StravaActivityZone) *Zone {
+	var z Zone
+	_ = copier.Copy(&z, m)
+	return &z
+}
+
+func NewZoneList(s []*model.StravaActivityZone) []*Zone {
+	list := make([]*Zone, 0, len(s))
+	for _, item := range s {
+		list = append(list, NewZone(item))
+	}
+	return list
+}
+
+// AthleteZones 用户设置的心率、功率区间
+type AthleteZones struct {
+	HeartRate *strava.HeartRateZoneRanges `json:"heart_rate"`
+	Power     *strava.PowerZoneRanges     `json:"power"`
+	UpdatedAt time.Time                   `json:"updated_at"`
+}
+
+func NewAthleteZones(m *model.StravaAthleteZone) *AthleteZones {
+	return &AthleteZones{
+		HeartRate: m.HeartRateJSON,
+		Power:     m.PowerJSON,
+		UpdatedAt: m.UpdatedAt,
+	}
+}
+
+type ZoneStatsReq struct {
+	Type     string `query:"type" validate:"activity"`
+	ZoneType string `query:"zone_type" validate:"oneof=heartrate power"`
+	Freq     string `query:"freq" validate:"oneof=week month year"`
+	Size     int    `query:"size"`
+}
+
+// ZoneStats 以日期为横轴, 每个区间的时间(秒)
+type ZoneStats struct {
+	Time  []string      `json:"time"`
+	Zones []*ZoneSeries `json:"zones"`
+}
+
+// ZoneSeries 一个区间的统计数据, 区间范围来自用户当前的区间设置, 没有设置时为 0
+type ZoneSeries struct {
+	Zone  int       `json:"zone"`
+	Min   int       `json:"min"`
+	Max   int       `json:"max"`
+	Value []float64 `json:"value"`
+}
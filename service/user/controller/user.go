@@ -226,7 +226,7 @@ func (u *User) Oauth2Callback(c echo.Context) error {
 	if err != nil {
 		return err
 	}
-	u.setSession(c, &types.User{SourceID: user.SourceID, Source: user.Source, Email: user.Email}, true)
+	u.setSession(c, &types.User{SourceID: user.SourceID, Source: user.Source, Email: user.Email, Role: user.Role}, true)
 
 	return c.Redirect(http.StatusPermanentRedirect, url)
 }
@@ -251,6 +251,7 @@ func (u *User) setSession(c echo.Context, user *types.User, rememberMe bool) {
 		"source_id": user.SourceID,
 		"source":    user.Source,
 		"status":    user.Status,
+		"role":      user.Role,
 	}
 	sess.Options = &sessions.Options{
 		Path:     u.sessConfig.Path,
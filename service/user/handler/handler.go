@@ -47,10 +47,22 @@ type Mailer interface {
 	Send(to, subj, body string) error
 }
 
+//go:generate mockgen -destination=./mocks/mock_backfiller.go -package=mocks . Backfiller
+type Backfiller interface {
+	StartBackfill(ctx context.Context, athleteID int64) error
+}
+
+//go:generate mockgen -destination=./mocks/mock_athlete_syncer.go -package=mocks . AthleteSyncer
+type AthleteSyncer interface {
+	SyncAthlete(ctx context.Context, athleteID int64) error
+}
+
 const (
 	emailExpire   = time.Minute * 2 // 邮件发送频率限制
 	tokenExpire   = time.Minute * 30
 	oauth2Timeout = time.Minute * 1
+
+	syncAthleteTimeout = time.Minute * 1 // 登录后在后台同步 strava 资料的超时
 )
 
 const (
@@ -0,0 +1,49 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/happyxhw/iself/service/user/handler (interfaces: AthleteSyncer)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockAthleteSyncer is a mock of AthleteSyncer interface.
+type MockAthleteSyncer struct {
+	ctrl     *gomock.Controller
+	recorder *MockAthleteSyncerMockRecorder
+}
+
+// MockAthleteSyncerMockRecorder is the mock recorder for MockAthleteSyncer.
+type MockAthleteSyncerMockRecorder struct {
+	mock *MockAthleteSyncer
+}
+
+// NewMockAthleteSyncer creates a new mock instance.
+func NewMockAthleteSyncer(ctrl *gomock.Controller) *MockAthleteSyncer {
+	mock := &MockAthleteSyncer{ctrl: ctrl}
+	mock.recorder = &MockAthleteSyncerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAthleteSyncer) EXPECT() *MockAthleteSyncerMockRecorder {
+	return m.recorder
+}
+
+// SyncAthlete mocks base method.
+func (m *MockAthleteSyncer) SyncAthlete(arg0 context.Context, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SyncAthlete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SyncAthlete indicates an expected call of SyncAthlete.
+func (mr *MockAthleteSyncerMockRecorder) SyncAthlete(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SyncAthlete", reflect.TypeOf((*MockAthleteSyncer)(nil).SyncAthlete), arg0, arg1)
+}
@@ -0,0 +1,49 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/happyxhw/iself/service/user/handler (interfaces: Backfiller)
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockBackfiller is a mock of Backfiller interface.
+type MockBackfiller struct {
+	ctrl     *gomock.Controller
+	recorder *MockBackfillerMockRecorder
+}
+
+// MockBackfillerMockRecorder is the mock recorder for MockBackfiller.
+type MockBackfillerMockRecorder struct {
+	mock *MockBackfiller
+}
+
+// NewMockBackfiller creates a new mock instance.
+func NewMockBackfiller(ctrl *gomock.Controller) *MockBackfiller {
+	mock := &MockBackfiller{ctrl: ctrl}
+	mock.recorder = &MockBackfillerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBackfiller) EXPECT() *MockBackfillerMockRecorder {
+	return m.recorder
+}
+
+// StartBackfill mocks base method.
+func (m *MockBackfiller) StartBackfill(arg0 context.Context, arg1 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartBackfill", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StartBackfill indicates an expected call of StartBackfill.
+func (mr *MockBackfillerMockRecorder) StartBackfill(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartBackfill", reflect.TypeOf((*MockBackfiller)(nil).StartBackfill), arg0, arg1)
+}
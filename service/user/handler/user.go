@@ -30,20 +30,25 @@ import (
 type User struct {
 	aesKey []byte
 
-	ur     UserRepo
-	tr     TokenRepo
-	mailer Mailer
-	cacher Cacher
+	ur         UserRepo
+	tr         TokenRepo
+	mailer     Mailer
+	cacher     Cacher
+	backfiller Backfiller
+	syncer     AthleteSyncer
 }
 
-func NewUserSrv(ur UserRepo, tr TokenRepo, mailer Mailer, cacher Cacher, aesKey []byte) *User {
+func NewUserSrv(ur UserRepo, tr TokenRepo, mailer Mailer, cacher Cacher, backfiller Backfiller,
+	syncer AthleteSyncer, aesKey []byte) *User {
 	return &User{
 		aesKey: aesKey,
 
-		ur:     ur,
-		tr:     tr,
-		mailer: mailer,
-		cacher: cacher,
+		ur:         ur,
+		tr:         tr,
+		mailer:     mailer,
+		cacher:     cacher,
+		backfiller: backfiller,
+		syncer:     syncer,
 	}
 }
 
@@ -139,7 +144,7 @@ func (u *User) SignInByOauth2(ctx context.Context, source, code string, auth oau
 		return nil, ex.ErrDB.Wrap(err)
 	}
 	if user != nil {
-		return types.NewUser(user), nil
+		return u.reconnect(ctx, user)
 	}
 	// 	2. 用户可能已经绑定过邮箱(用户绑定邮箱后，email 字段会替换为真实的 email)
 	user, err = u.ur.GetBySource(ctx, source, oauth2User.SourceID, query.Opt{})
@@ -147,7 +152,7 @@ func (u *User) SignInByOauth2(ctx context.Context, source, code string, auth oau
 		return nil, ex.ErrDB.Wrap(err)
 	}
 	if user != nil {
-		return types.NewUser(user), nil
+		return u.reconnect(ctx, user)
 	}
 	// 用户不存在, 创建, email 为: source@source_id, oauth2 用户不需要激活
 	oauth2User.Email = email
@@ -156,6 +161,45 @@ func (u *User) SignInByOauth2(ctx context.Context, source, code string, auth oau
 	if err != nil {
 		return nil, ex.ErrDB.Wrap(err)
 	}
+	// 首次登录, 导入 strava 历史活动, 忽略错误, 用户可以手动开始导入
+	if source == oauth2x.StravaSource {
+		if err = u.backfiller.StartBackfill(ctx, user.SourceID); err != nil {
+			userLogger.Error("start strava backfill", zap.Error(err), log.CTX(ctx))
+		}
+	}
+	u.syncAthlete(ctx, user)
+
+	return types.NewUser(user), nil
+}
+
+// syncAthlete 每次通过 strava 登录时在后台同步用户资料, 不阻塞登录, 失败时记录日志, 用户可以手动同步
+func (u *User) syncAthlete(ctx context.Context, user *model.User) {
+	if user.Source != oauth2x.StravaSource {
+		return
+	}
+	athleteID := user.SourceID
+	go func() {
+		// 请求返回后 ctx 会被取消, 使用单独的超时
+		syncCtx, cancel := context.WithTimeout(context.Background(), syncAthleteTimeout)
+		defer cancel()
+		if err := u.syncer.SyncAthlete(syncCtx, athleteID); err != nil {
+			userLogger.Error("sync strava athlete", zap.Int64("athlete_id", athleteID), zap.Error(err), log.CTX(ctx))
+		}
+	}()
+}
+
+// reconnect 用户撤销授权后重新通过 oauth2 登录, 恢复授权状态
+func (u *User) reconnect(ctx context.Context, user *model.User) (*types.User, error) {
+	if user.SourceStatus == int(model.SourceDisconnectedStatus) {
+		params := model.UserParam{
+			SourceStatus: util.Int(int(model.SourceConnectedStatus)),
+		}
+		if _, err := u.ur.Update(ctx, user.ID, &params); err != nil {
+			return nil, ex.ErrDB.Wrap(err)
+		}
+		user.SourceStatus = int(model.SourceConnectedStatus)
+	}
+	u.syncAthlete(ctx, user)
 
 	return types.NewUser(user), nil
 }
@@ -2,9 +2,11 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
@@ -197,15 +199,20 @@ func TestUser_SignInByOauth2(t *testing.T) {
 	userRepo := mocks.NewMockUserRepo(ctrl)
 	tokenRepo := mocks.NewMockTokenRepo(ctrl)
 	oauth2Provider := mocks.NewMockOauth2x(ctrl)
+	backfiller := mocks.NewMockBackfiller(ctrl)
+	syncer := mocks.NewMockAthleteSyncer(ctrl)
 
 	h := User{
-		ur: userRepo,
-		tr: tokenRepo,
+		ur:         userRepo,
+		tr:         tokenRepo,
+		backfiller: backfiller,
+		syncer:     syncer,
 	}
 
 	mockCode := "mockCode"
 	email := fmt.Sprintf("%d@%s", mockUser.SourceID, mockUser.Source)
 
+	synced := make(chan struct{})
 	gomock.InOrder(
 		oauth2Provider.EXPECT().Exchange(ctx, mockCode).Return(&mockOauth2Token, nil),
 		oauth2Provider.EXPECT().GetUser(ctx, &mockOauth2Token).Return(&mockUser, nil),
@@ -214,14 +221,111 @@ func TestUser_SignInByOauth2(t *testing.T) {
 		userRepo.EXPECT().GetByEmail(ctx, email, query.Opt{}).Return(nil, nil),
 		userRepo.EXPECT().GetBySource(ctx, mockUser.Source, mockUser.SourceID, query.Opt{}).Return(nil, nil),
 		userRepo.EXPECT().Create(ctx, gomock.Any()).Return(&mockUser, nil),
+		backfiller.EXPECT().StartBackfill(ctx, mockUser.SourceID).Return(nil),
+		syncCall(syncer, nil, synced),
 	)
 
 	u, err := h.SignInByOauth2(ctx, mockUser.Source, mockCode, oauth2Provider)
 
 	require.NoError(t, err)
+	waitSynced(t, synced)
 	require.Equal(t, u.ID, mockUser.ID)
 }
 
+func TestUser_SignInByOauth2Reconnect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.TODO()
+
+	userRepo := mocks.NewMockUserRepo(ctrl)
+	tokenRepo := mocks.NewMockTokenRepo(ctrl)
+	oauth2Provider := mocks.NewMockOauth2x(ctrl)
+	syncer := mocks.NewMockAthleteSyncer(ctrl)
+
+	h := User{
+		ur:     userRepo,
+		tr:     tokenRepo,
+		syncer: syncer,
+	}
+
+	mockCode := "mockCode"
+	email := fmt.Sprintf("%d@%s", mockUser.SourceID, mockUser.Source)
+	disconnected := mockUser
+	disconnected.SourceStatus = int(model.SourceDisconnectedStatus)
+	var savedToken *oauth2.Token
+	var updated *model.UserParam
+
+	synced := make(chan struct{})
+	gomock.InOrder(
+		oauth2Provider.EXPECT().Exchange(ctx, mockCode).Return(&mockOauth2Token, nil),
+		oauth2Provider.EXPECT().GetUser(ctx, &mockOauth2Token).Return(&mockUser, nil),
+		tokenRepo.EXPECT().SaveToken(ctx, gomock.Any(), mockUser.Source, mockUser.SourceID).
+			DoAndReturn(func(_ context.Context, token *oauth2.Token, _ string, _ int64) error {
+				savedToken = token
+				return nil
+			}),
+
+		userRepo.EXPECT().GetByEmail(ctx, email, query.Opt{}).Return(&disconnected, nil),
+		userRepo.EXPECT().Update(ctx, mockUser.ID, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ int64, params *model.UserParam) (int64, error) {
+				updated = params
+				return 1, nil
+			}),
+		syncCall(syncer, errors.New("strava unavailable"), synced),
+	)
+
+	u, err := h.SignInByOauth2(ctx, mockUser.Source, mockCode, oauth2Provider)
+
+	require.NoError(t, err)
+	waitSynced(t, synced)
+	// 重新授权后保存新的 token, 并且把用户从撤销授权恢复为已授权
+	require.Equal(t, savedToken.AccessToken, mockOauth2Token.AccessToken)
+	require.NotNil(t, updated)
+	require.Equal(t, *updated.SourceStatus, int(model.SourceConnectedStatus))
+	require.Equal(t, disconnected.SourceStatus, int(model.SourceConnectedStatus))
+	require.Equal(t, u.SourceStatus, int(model.SourceConnectedStatus))
+}
+
+func TestUser_SignInByOauth2Connected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.TODO()
+
+	userRepo := mocks.NewMockUserRepo(ctrl)
+	tokenRepo := mocks.NewMockTokenRepo(ctrl)
+	oauth2Provider := mocks.NewMockOauth2x(ctrl)
+	syncer := mocks.NewMockAthleteSyncer(ctrl)
+
+	h := User{
+		ur:     userRepo,
+		tr:     tokenRepo,
+		syncer: syncer,
+	}
+
+	mockCode := "mockCode"
+	email := fmt.Sprintf("%d@%s", mockUser.SourceID, mockUser.Source)
+	connected := mockUser
+	connected.SourceStatus = int(model.SourceConnectedStatus)
+
+	// 已授权的用户登录不会更新授权状态, 没有 Update 的调用
+	synced := make(chan struct{})
+	gomock.InOrder(
+		oauth2Provider.EXPECT().Exchange(ctx, mockCode).Return(&mockOauth2Token, nil),
+		oauth2Provider.EXPECT().GetUser(ctx, &mockOauth2Token).Return(&mockUser, nil),
+		tokenRepo.EXPECT().SaveToken(ctx, &mockOauth2Token, mockUser.Source, mockUser.SourceID).Return(nil),
+		userRepo.EXPECT().GetByEmail(ctx, email, query.Opt{}).Return(&connected, nil),
+		syncCall(syncer, nil, synced),
+	)
+
+	u, err := h.SignInByOauth2(ctx, mockUser.Source, mockCode, oauth2Provider)
+
+	require.NoError(t, err)
+	waitSynced(t, synced)
+	require.Equal(t, u.SourceStatus, int(model.SourceConnectedStatus))
+}
+
 func TestUser_ChangePassword(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -360,3 +464,20 @@ func TestUser_SendEmail(t *testing.T) {
 
 	require.NoError(t, err)
 }
+
+// syncCall 登录后在后台同步 strava 资料, 调用时关闭 synced
+func syncCall(syncer *mocks.MockAthleteSyncer, err error, synced chan struct{}) *gomock.Call {
+	return syncer.EXPECT().SyncAthlete(gomock.Any(), mockUser.SourceID).
+		DoAndReturn(func(context.Context, int64) error {
+			close(synced)
+			return err
+		})
+}
+
+func waitSynced(t *testing.T, synced chan struct{}) {
+	select {
+	case <-synced:
+	case <-time.After(time.Second):
+		t.Fatal("strava athlete not synced")
+	}
+}
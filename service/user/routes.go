@@ -18,7 +18,7 @@ import (
 )
 
 // InitRouter 初始化用户路由
-func InitRouter(e *echo.Echo) {
+func InitRouter(e *echo.Echo, backfiller handler.Backfiller, syncer handler.AthleteSyncer) {
 	ag := e.Group("/api/auth")
 	ug := e.Group("/api/user")
 	ug.Use(ex.AuthRequired())
@@ -29,7 +29,7 @@ func InitRouter(e *echo.Echo) {
 	aesKey := viper.GetString("secure.key")
 
 	srv := handler.NewUserSrv(
-		userRepo, tokenRepo, mailer.DefaultMailer(), cacher, []byte(aesKey),
+		userRepo, tokenRepo, mailer.DefaultMailer(), cacher, backfiller, syncer, []byte(aesKey),
 	)
 	u := controller.NewUser(srv, oauth2x.Provider())
 
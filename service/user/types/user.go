@@ -20,6 +20,8 @@ type User struct {
 	Role   int `json:"role,omitempty"`
 	Status int `json:"status,omitempty"`
 
+	SourceStatus int `json:"source_status"` // oauth2 授权状态: 0 已授权, 1 已撤销授权
+
 	CreatedAt *time.Time `json:"created_at,omitempty"`
 }
 
@@ -10,6 +10,7 @@ CREATE TABLE strava_activity_detail
     elapsed_time         integer                  NOT NULL DEFAULT 0,
     total_elevation_gain float                    NOT NULL DEFAULT 0.0,
     start_date_local     timestamp                NOT NULL,
+    start_date           timestamp WITH TIME ZONE,
     polyline             text                     NOT NULL DEFAULT '',
     summary_polyline     text                     NOT NULL DEFAULT '',
     average_speed        float                    NOT NULL DEFAULT 0.0,
@@ -22,6 +23,16 @@ CREATE TABLE strava_activity_detail
     splits_metric        jsonb,
     best_efforts         jsonb,
     device_name          varchar(50),
+    private              boolean                  NOT NULL DEFAULT false,
+    lap_structure        text                     NOT NULL DEFAULT '',
+    gear_id              varchar(32)              NOT NULL DEFAULT '',
+    description          text                     NOT NULL DEFAULT '',
+    commute              boolean                  NOT NULL DEFAULT false,
+    trainer              boolean                  NOT NULL DEFAULT false,
+    kudos_count          integer                  NOT NULL DEFAULT 0,
+    comment_count        integer                  NOT NULL DEFAULT 0,
+    external_id          varchar(64)              NOT NULL DEFAULT '',
+    source               smallint                 NOT NULL DEFAULT 0,
 
     created_at           timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at           timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
@@ -31,10 +42,17 @@ CREATE TABLE strava_activity_detail
 -- where id = athlete_id order by start_date_local
 CREATE INDEX strava_activity_idx_athelete ON strava_activity_detail (athlete_id, "type", start_date_local);
 CREATE INDEX strava_activity_idx_athelete_date ON strava_activity_detail (athlete_id, start_date_local);
+CREATE INDEX strava_activity_idx_athelete_lap ON strava_activity_detail (athlete_id, lap_structure);
+CREATE INDEX strava_activity_idx_athelete_gear ON strava_activity_detail (athlete_id, gear_id);
+CREATE UNIQUE INDEX strava_activity_idx_athelete_external ON strava_activity_detail (athlete_id, external_id) WHERE external_id <> '' AND deleted_at = 0;
+
+-- 导入的活动和圈的 id 取负数, 不会与 strava 的 id 冲突
+DROP SEQUENCE IF EXISTS strava_local_id_seq;
+CREATE SEQUENCE strava_local_id_seq;
 
 COMMENT ON TABLE strava_activity_detail IS '活动详情表';
 
-COMMENT ON COLUMN strava_activity_detail.id IS '活动id, 是strava返回的活动id';
+COMMENT ON COLUMN strava_activity_detail.id IS '活动id, 是strava返回的活动id, 导入的活动为负数';
 COMMENT ON COLUMN strava_activity_detail.athlete_id IS 'strava用户id';
 COMMENT ON COLUMN strava_activity_detail.name IS '活动名称';
 COMMENT ON COLUMN strava_activity_detail.type IS '活动类型';
@@ -43,6 +61,7 @@ COMMENT ON COLUMN strava_activity_detail.moving_time IS '实际运动时间，
 COMMENT ON COLUMN strava_activity_detail.elapsed_time IS '经过时间，单位秒';
 COMMENT ON COLUMN strava_activity_detail.total_elevation_gain IS '总高度增益';
 COMMENT ON COLUMN strava_activity_detail.start_date_local IS '开始时间';
+COMMENT ON COLUMN strava_activity_detail.start_date IS 'utc 开始时间';
 COMMENT ON COLUMN strava_activity_detail.polyline IS '编码后的地图';
 COMMENT ON COLUMN strava_activity_detail.summary_polyline IS '编码后的地图，压缩版';
 COMMENT ON COLUMN strava_activity_detail.average_speed IS '均速';
@@ -55,3 +74,13 @@ COMMENT ON COLUMN strava_activity_detail.calories IS '卡路里';
 COMMENT ON COLUMN strava_activity_detail.splits_metric IS '每公里数据，json 列表';
 COMMENT ON COLUMN strava_activity_detail.best_efforts IS '最佳，json 列表';
 COMMENT ON COLUMN strava_activity_detail.device_name IS '设备名称';
+COMMENT ON COLUMN strava_activity_detail.private IS '是否为私密活动';
+COMMENT ON COLUMN strava_activity_detail.lap_structure IS '圈结构, 圈数和每圈距离(取整到100米), 如: 6:2000,800,400,800,400,1000, 少于两圈或者自动分圈时为空';
+COMMENT ON COLUMN strava_activity_detail.gear_id IS '装备id, 没有装备时为空';
+COMMENT ON COLUMN strava_activity_detail.description IS '活动描述';
+COMMENT ON COLUMN strava_activity_detail.commute IS '是否为通勤';
+COMMENT ON COLUMN strava_activity_detail.trainer IS '是否在骑行台、跑步机等训练器械上完成';
+COMMENT ON COLUMN strava_activity_detail.kudos_count IS '点赞数';
+COMMENT ON COLUMN strava_activity_detail.comment_count IS '评论数';
+COMMENT ON COLUMN strava_activity_detail.external_id IS '导入文件的 sha1, 用于避免重复导入, 同一个用户未删除的活动中唯一';
+COMMENT ON COLUMN strava_activity_detail.source IS '活动来源: 0 strava, 1 导入的 fit, 2 导入的 gpx, 3 导入的 tcx';
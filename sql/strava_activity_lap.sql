@@ -0,0 +1,50 @@
+-- https://developers.strava.com/docs/reference/#api-models-Lap
+DROP TABLE IF EXISTS strava_activity_lap;
+CREATE TABLE strava_activity_lap
+(
+    id                   bigint                   NOT NULL PRIMARY KEY,
+    activity_id          bigint                   NOT NULL,
+    athlete_id           bigint                   NOT NULL,
+    lap_index            integer                  NOT NULL,
+    "name"               varchar(128)             NOT NULL DEFAULT '',
+    distance             float                    NOT NULL DEFAULT 0.0,
+    moving_time          integer                  NOT NULL DEFAULT 0,
+    elapsed_time         integer                  NOT NULL DEFAULT 0,
+    total_elevation_gain float                    NOT NULL DEFAULT 0.0,
+    average_speed        float                    NOT NULL DEFAULT 0.0,
+    max_speed            float                    NOT NULL DEFAULT 0.0,
+    average_heartrate    float                    NOT NULL DEFAULT 0.0,
+    max_heartrate        float                    NOT NULL DEFAULT 0.0,
+    average_cadence      float                    NOT NULL DEFAULT 0.0,
+    average_watts        float                    NOT NULL DEFAULT 0.0,
+    start_index          integer                  NOT NULL DEFAULT 0,
+    end_index            integer                  NOT NULL DEFAULT 0,
+    start_date_local     timestamp                NOT NULL,
+
+    created_at           timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at           timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at           bigint                   NOT NULL DEFAULT 0
+);
+
+CREATE INDEX strava_activity_lap_idx_activity ON strava_activity_lap (activity_id, lap_index);
+
+COMMENT ON TABLE strava_activity_lap IS '活动圈数据';
+
+COMMENT ON COLUMN strava_activity_lap.id IS '圈id, 是strava返回的圈id';
+COMMENT ON COLUMN strava_activity_lap.activity_id IS '活动id';
+COMMENT ON COLUMN strava_activity_lap.athlete_id IS 'strava用户id';
+COMMENT ON COLUMN strava_activity_lap.lap_index IS '第几圈, 从1开始';
+COMMENT ON COLUMN strava_activity_lap.name IS '名称';
+COMMENT ON COLUMN strava_activity_lap.distance IS '距离';
+COMMENT ON COLUMN strava_activity_lap.moving_time IS '实际运动时间，单位秒';
+COMMENT ON COLUMN strava_activity_lap.elapsed_time IS '经过时间，单位秒';
+COMMENT ON COLUMN strava_activity_lap.total_elevation_gain IS '总高度增益';
+COMMENT ON COLUMN strava_activity_lap.average_speed IS '均速';
+COMMENT ON COLUMN strava_activity_lap.max_speed IS '最大速';
+COMMENT ON COLUMN strava_activity_lap.average_heartrate IS '平均心率';
+COMMENT ON COLUMN strava_activity_lap.max_heartrate IS '最大心率';
+COMMENT ON COLUMN strava_activity_lap.average_cadence IS '平均步频、踏频';
+COMMENT ON COLUMN strava_activity_lap.average_watts IS '平均功率';
+COMMENT ON COLUMN strava_activity_lap.start_index IS '在 stream 中的开始位置';
+COMMENT ON COLUMN strava_activity_lap.end_index IS '在 stream 中的结束位置';
+COMMENT ON COLUMN strava_activity_lap.start_date_local IS '开始时间';
@@ -0,0 +1,53 @@
+-- https://developers.strava.com/docs/reference/#api-models-Comment
+DROP TABLE IF EXISTS strava_activity_comment;
+CREATE TABLE strava_activity_comment
+(
+    id                 bigint                   NOT NULL PRIMARY KEY,
+    activity_id        bigint                   NOT NULL,
+    athlete_id         bigint                   NOT NULL,
+    commenter_id       bigint                   NOT NULL DEFAULT 0,
+    commenter_name     varchar(255)             NOT NULL DEFAULT '',
+    "text"             text                     NOT NULL DEFAULT '',
+    comment_created_at timestamp WITH TIME ZONE NOT NULL,
+
+    created_at         timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at         timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at         bigint                   NOT NULL DEFAULT 0
+);
+
+CREATE INDEX strava_activity_comment_idx_activity ON strava_activity_comment (activity_id);
+CREATE INDEX strava_activity_comment_idx_athlete ON strava_activity_comment (athlete_id);
+
+COMMENT ON TABLE strava_activity_comment IS '活动评论';
+
+COMMENT ON COLUMN strava_activity_comment.id IS 'strava 返回的评论id';
+COMMENT ON COLUMN strava_activity_comment.activity_id IS '活动id';
+COMMENT ON COLUMN strava_activity_comment.athlete_id IS '活动所属的strava用户id';
+COMMENT ON COLUMN strava_activity_comment.commenter_id IS '评论用户id, strava 不返回时为 0';
+COMMENT ON COLUMN strava_activity_comment.commenter_name IS '评论用户名字';
+COMMENT ON COLUMN strava_activity_comment.comment_created_at IS '评论时间';
+
+DROP TABLE IF EXISTS strava_activity_kudos;
+CREATE TABLE strava_activity_kudos
+(
+    id          bigserial                NOT NULL PRIMARY KEY,
+    activity_id bigint                   NOT NULL,
+    athlete_id  bigint                   NOT NULL,
+    "position"  integer                  NOT NULL,
+    firstname   varchar(128)             NOT NULL DEFAULT '',
+    lastname    varchar(128)             NOT NULL DEFAULT '',
+
+    created_at  timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at  bigint                   NOT NULL DEFAULT 0
+);
+
+CREATE INDEX strava_activity_kudos_idx_activity ON strava_activity_kudos (activity_id);
+CREATE INDEX strava_activity_kudos_idx_athlete ON strava_activity_kudos (athlete_id);
+
+COMMENT ON TABLE strava_activity_kudos IS '活动点赞用户';
+
+COMMENT ON COLUMN strava_activity_kudos.activity_id IS '活动id';
+COMMENT ON COLUMN strava_activity_kudos.athlete_id IS '活动所属的strava用户id';
+COMMENT ON COLUMN strava_activity_kudos.position IS 'strava 返回的顺序';
+COMMENT ON COLUMN strava_activity_kudos.lastname IS '姓, strava 只返回首字母';
@@ -0,0 +1,32 @@
+DROP TABLE IF EXISTS strava_archive;
+CREATE TABLE strava_archive
+(
+    id          bigserial    NOT NULL PRIMARY KEY,
+    athlete_id  bigint       NOT NULL,
+    status      integer      NOT NULL DEFAULT 0,
+    path        varchar(255) NOT NULL DEFAULT '',
+    size        bigint       NOT NULL DEFAULT 0,
+    activities  integer      NOT NULL DEFAULT 0,
+    last_error  text         NOT NULL DEFAULT '',
+    attempts    integer      NOT NULL DEFAULT 0,
+    expires_at  timestamptz,
+
+    created_at  timestamptz           DEFAULT CURRENT_TIMESTAMP,
+    updated_at  timestamptz           DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX strava_archive_idx_athlete ON strava_archive (athlete_id, id);
+CREATE INDEX strava_archive_idx_status ON strava_archive (status, expires_at);
+-- 每个用户同时只能有一个生成中的导出
+CREATE UNIQUE INDEX strava_archive_idx_pending ON strava_archive (athlete_id) WHERE status = 0;
+
+COMMENT ON TABLE strava_archive IS '用户的个人数据导出';
+
+COMMENT ON COLUMN strava_archive.athlete_id IS 'strava 用户id';
+COMMENT ON COLUMN strava_archive.status IS '导出状态, 0: 生成中, 1: 已生成, 2: 生成失败, 3: 已过期';
+COMMENT ON COLUMN strava_archive.path IS '生成的 zip 文件路径';
+COMMENT ON COLUMN strava_archive.size IS 'zip 文件大小, 单位字节';
+COMMENT ON COLUMN strava_archive.activities IS '导出的活动数';
+COMMENT ON COLUMN strava_archive.last_error IS '最后一次生成失败的错误信息';
+COMMENT ON COLUMN strava_archive.attempts IS '生成的次数';
+COMMENT ON COLUMN strava_archive.expires_at IS '下载链接的过期时间, 过期后删除文件';
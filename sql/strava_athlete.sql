@@ -0,0 +1,36 @@
+-- https://developers.strava.com/docs/reference/#api-models-DetailedAthlete
+DROP TABLE IF EXISTS strava_athlete;
+CREATE TABLE strava_athlete
+(
+    athlete_id             bigint                   NOT NULL PRIMARY KEY,
+    username               varchar(64)              NOT NULL DEFAULT '',
+    firstname              varchar(64)              NOT NULL DEFAULT '',
+    lastname               varchar(64)              NOT NULL DEFAULT '',
+    profile                varchar(255)             NOT NULL DEFAULT '',
+    profile_medium         varchar(255)             NOT NULL DEFAULT '',
+    city                   varchar(128)             NOT NULL DEFAULT '',
+    "state"                varchar(128)             NOT NULL DEFAULT '',
+    country                varchar(128)             NOT NULL DEFAULT '',
+    sex                    varchar(4)               NOT NULL DEFAULT '',
+    summit                 boolean                  NOT NULL DEFAULT false,
+    measurement_preference varchar(16)              NOT NULL DEFAULT '',
+    ftp                    integer                  NOT NULL DEFAULT 0,
+    weight                 float                    NOT NULL DEFAULT 0.0,
+    bikes                  jsonb,
+    shoes                  jsonb,
+    stats                  jsonb,
+
+    created_at             timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at             timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE strava_athlete IS '用户的strava资料, 登录和收到用户推送时同步';
+
+COMMENT ON COLUMN strava_athlete.athlete_id IS 'strava用户id';
+COMMENT ON COLUMN strava_athlete.summit IS '是否为strava订阅用户';
+COMMENT ON COLUMN strava_athlete.measurement_preference IS '单位偏好: feet, meters';
+COMMENT ON COLUMN strava_athlete.ftp IS '功能阈值功率, 单位瓦';
+COMMENT ON COLUMN strava_athlete.weight IS '体重, 单位千克';
+COMMENT ON COLUMN strava_athlete.bikes IS '自行车, json 列表';
+COMMENT ON COLUMN strava_athlete.shoes IS '跑鞋, json 列表';
+COMMENT ON COLUMN strava_athlete.stats IS 'strava统计的累计数据: 最近四周, 今年, 全部, json';
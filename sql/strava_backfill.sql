@@ -0,0 +1,24 @@
+DROP TABLE IF EXISTS strava_backfill;
+CREATE TABLE strava_backfill
+(
+    athlete_id bigint      NOT NULL PRIMARY KEY,
+    status     integer     NOT NULL DEFAULT 0,
+    before     bigint      NOT NULL DEFAULT 0,
+    imported   integer     NOT NULL DEFAULT 0,
+    skipped    integer     NOT NULL DEFAULT 0,
+    attempts   integer     NOT NULL DEFAULT 0,
+    last_error text        NOT NULL DEFAULT '',
+
+    created_at timestamptz          DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamptz          DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE strava_backfill IS 'strava 历史活动导入进度';
+
+COMMENT ON COLUMN strava_backfill.athlete_id IS 'strava 用户id';
+COMMENT ON COLUMN strava_backfill.status IS '导入状态, 0: 导入中, 1: 导入完成, 2: 导入失败';
+COMMENT ON COLUMN strava_backfill.before IS '游标, 下一次从该时间(unix)之前的活动开始导入, 0 表示从当前时间开始';
+COMMENT ON COLUMN strava_backfill.imported IS '已导入的活动数';
+COMMENT ON COLUMN strava_backfill.skipped IS '已经存在而跳过的活动数';
+COMMENT ON COLUMN strava_backfill.attempts IS '连续失败的次数, 导入成功后清零';
+COMMENT ON COLUMN strava_backfill.last_error IS '最后一次导入失败的错误信息';
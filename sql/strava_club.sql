@@ -0,0 +1,69 @@
+-- https://developers.strava.com/docs/reference/#api-models-DetailedClub
+DROP TABLE IF EXISTS strava_club;
+CREATE TABLE strava_club
+(
+    id             bigint       NOT NULL PRIMARY KEY,
+    "name"         varchar(255) NOT NULL DEFAULT '',
+    sport_type     varchar(32)  NOT NULL DEFAULT '',
+    city           varchar(128) NOT NULL DEFAULT '',
+    country        varchar(128) NOT NULL DEFAULT '',
+    private        boolean      NOT NULL DEFAULT false,
+    member_count   integer      NOT NULL DEFAULT 0,
+    profile_medium varchar(255) NOT NULL DEFAULT '',
+    cover_photo    varchar(255) NOT NULL DEFAULT '',
+    url            varchar(255) NOT NULL DEFAULT '',
+    refreshed_at   timestamptz,
+
+    created_at     timestamptz           DEFAULT CURRENT_TIMESTAMP,
+    updated_at     timestamptz           DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE strava_club IS 'strava 俱乐部';
+
+COMMENT ON COLUMN strava_club.id IS 'strava 返回的俱乐部id';
+COMMENT ON COLUMN strava_club.sport_type IS '运动类型: cycling, running, triathlon, other';
+COMMENT ON COLUMN strava_club.member_count IS '成员数量';
+COMMENT ON COLUMN strava_club.refreshed_at IS '最近一次刷新俱乐部动态的时间, 为空表示还没有刷新过';
+
+DROP TABLE IF EXISTS strava_club_athlete;
+CREATE TABLE strava_club_athlete
+(
+    club_id    bigint NOT NULL,
+    athlete_id bigint NOT NULL,
+
+    created_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (club_id, athlete_id)
+);
+
+CREATE INDEX strava_club_athlete_idx_athlete ON strava_club_athlete (athlete_id);
+
+COMMENT ON TABLE strava_club_athlete IS '用户加入的俱乐部';
+
+DROP TABLE IF EXISTS strava_club_activity;
+CREATE TABLE strava_club_activity
+(
+    id                   bigserial    NOT NULL PRIMARY KEY,
+    club_id              bigint       NOT NULL,
+    fingerprint          varchar(64)  NOT NULL,
+    athlete_name         varchar(255) NOT NULL DEFAULT '',
+    "name"               varchar(255) NOT NULL DEFAULT '',
+    "type"               varchar(32)  NOT NULL DEFAULT '',
+    distance             float        NOT NULL DEFAULT 0.0,
+    moving_time          integer      NOT NULL DEFAULT 0,
+    elapsed_time         integer      NOT NULL DEFAULT 0,
+    total_elevation_gain float        NOT NULL DEFAULT 0.0,
+    backfilled           boolean      NOT NULL DEFAULT false,
+    first_seen_at        timestamptz  NOT NULL,
+
+    created_at           timestamptz           DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX strava_club_activity_idx_fingerprint ON strava_club_activity (club_id, fingerprint);
+CREATE INDEX strava_club_activity_idx_seen ON strava_club_activity (club_id, first_seen_at);
+
+COMMENT ON TABLE strava_club_activity IS '俱乐部动态中的活动, strava 不返回活动id和时间';
+
+COMMENT ON COLUMN strava_club_activity.fingerprint IS '用户名, 类型, 距离, 时间, 爬升的哈希, 用于去重';
+COMMENT ON COLUMN strava_club_activity.athlete_name IS '名字和姓氏首字母, 如: John D.';
+COMMENT ON COLUMN strava_club_activity.backfilled IS '第一次刷新时已经存在的活动, 无法确定时间, 不计入排行榜';
+COMMENT ON COLUMN strava_club_activity.first_seen_at IS '第一次出现在动态中的时间, 作为活动时间';
@@ -0,0 +1,38 @@
+-- https://developers.strava.com/docs/reference/#api-models-DetailedGear
+DROP TABLE IF EXISTS strava_gear;
+CREATE TABLE strava_gear
+(
+    id              varchar(32)              NOT NULL PRIMARY KEY,
+    athlete_id      bigint                   NOT NULL,
+    "name"          varchar(128)             NOT NULL DEFAULT '',
+    brand_name      varchar(128)             NOT NULL DEFAULT '',
+    model_name      varchar(128)             NOT NULL DEFAULT '',
+    description     text                     NOT NULL DEFAULT '',
+    frame_type      integer                  NOT NULL DEFAULT 0,
+    "primary"       boolean                  NOT NULL DEFAULT false,
+    distance        float                    NOT NULL DEFAULT 0.0,
+    retire_distance float                    NOT NULL DEFAULT 0.0,
+    retire_time     integer                  NOT NULL DEFAULT 0,
+    alerted         boolean                  NOT NULL DEFAULT false,
+
+    created_at      timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at      bigint                   NOT NULL DEFAULT 0
+);
+
+CREATE INDEX strava_gear_idx_athlete ON strava_gear (athlete_id);
+
+COMMENT ON TABLE strava_gear IS '装备表: 跑鞋, 自行车';
+
+COMMENT ON COLUMN strava_gear.id IS '装备id, 是strava返回的装备id, 如: b123, g456';
+COMMENT ON COLUMN strava_gear.athlete_id IS 'strava用户id';
+COMMENT ON COLUMN strava_gear.name IS '装备名称';
+COMMENT ON COLUMN strava_gear.brand_name IS '品牌';
+COMMENT ON COLUMN strava_gear.model_name IS '型号';
+COMMENT ON COLUMN strava_gear.description IS '描述';
+COMMENT ON COLUMN strava_gear.frame_type IS '车架类型, 只有自行车有';
+COMMENT ON COLUMN strava_gear.primary IS '是否为默认装备';
+COMMENT ON COLUMN strava_gear.distance IS 'strava统计的总距离, 单位米';
+COMMENT ON COLUMN strava_gear.retire_distance IS '报废提醒距离, 单位米, 0表示不提醒';
+COMMENT ON COLUMN strava_gear.retire_time IS '报废提醒时间, 单位秒, 0表示不提醒';
+COMMENT ON COLUMN strava_gear.alerted IS '是否已经发送报废提醒';
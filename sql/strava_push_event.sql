@@ -8,6 +8,7 @@ DROP TABLE IF EXISTS strava_push_event;
 CREATE TABLE strava_push_event
 (
     id              bigserial       NOT NULL PRIMARY KEY,
+    subscription_id bigint          NOT NULL DEFAULT 0,
     owner_id        bigint          NOT NULL,
     aspect_type     strava_aspect   NOT NULL,
     object_type     strava_object   NOT NULL,
@@ -15,19 +16,27 @@ CREATE TABLE strava_push_event
     event_time      bigint          NOT NULL,
     updates         jsonb,
     status          integer   NOT NULL DEFAULT 0,
+    attempts        integer   NOT NULL DEFAULT 0,
+    last_error      text      NOT NULL DEFAULT '',
 
     created_at      timestamptz        DEFAULT CURRENT_TIMESTAMP,
-    updated_at      timestamptz        DEFAULT CURRENT_TIMESTAMP,
-
-    UNIQUE (object_id)
+    updated_at      timestamptz        DEFAULT CURRENT_TIMESTAMP
 );
 
+-- 同一个 object 会收到多次推送(create, update, delete), 每次推送都需要记录;
+-- strava 重复推送的同一个事件命中唯一索引, 写入时忽略; 活动和用户的 id 可能相同, 需要包含 object_type
+CREATE UNIQUE INDEX strava_push_event_idx_object ON strava_push_event (subscription_id, object_type, object_id, event_time, aspect_type);
+CREATE INDEX strava_push_event_idx_status ON strava_push_event (status);
+
 COMMENT ON TABLE strava_push_event IS 'strava 推送记录表';
 
 COMMENT ON COLUMN strava_push_event.id IS '主键';
+COMMENT ON COLUMN strava_push_event.subscription_id IS 'strava subscription id';
 COMMENT ON COLUMN strava_push_event.owner_id IS 'strava athlete id';
 COMMENT ON COLUMN strava_push_event.aspect_type IS 'event_type: create, update, delete';
 COMMENT ON COLUMN strava_push_event.object_type IS 'object_type: activity, athlete';
 COMMENT ON COLUMN strava_push_event.object_id IS 'athlete_id or activity_id';
 COMMENT ON COLUMN strava_push_event.updates IS '更新内容';
-COMMENT ON COLUMN strava_push_event.status IS '是否处理了信息, 1: 所有数据全部正常写入';
\ No newline at end of file
+COMMENT ON COLUMN strava_push_event.status IS '处理状态, 0: 待处理, 1: 所有数据全部正常写入, 2: 等待重试, 3: 超过最大重试次数';
+COMMENT ON COLUMN strava_push_event.attempts IS '已处理次数';
+COMMENT ON COLUMN strava_push_event.last_error IS '最后一次处理失败的错误信息';
\ No newline at end of file
@@ -0,0 +1,58 @@
+-- https://developers.strava.com/docs/reference/#api-models-Route
+DROP TABLE IF EXISTS strava_route;
+CREATE TABLE strava_route
+(
+    id                    bigint                   NOT NULL PRIMARY KEY,
+    athlete_id            bigint                   NOT NULL,
+    "name"                varchar(255)             NOT NULL DEFAULT '',
+    description           text                     NOT NULL DEFAULT '',
+    "type"                integer                  NOT NULL DEFAULT 0,
+    sub_type              integer                  NOT NULL DEFAULT 0,
+    distance              float                    NOT NULL DEFAULT 0.0,
+    elevation_gain        float                    NOT NULL DEFAULT 0.0,
+    estimated_moving_time integer                  NOT NULL DEFAULT 0,
+    private               boolean                  NOT NULL DEFAULT false,
+    starred               boolean                  NOT NULL DEFAULT false,
+    polyline              text                     NOT NULL DEFAULT '',
+    summary_polyline      text                     NOT NULL DEFAULT '',
+    route_created_at      timestamp WITH TIME ZONE,
+    route_updated_at      timestamp WITH TIME ZONE,
+
+    created_at            timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at            timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at            bigint                   NOT NULL DEFAULT 0
+);
+
+CREATE INDEX strava_route_idx_athlete ON strava_route (athlete_id);
+
+COMMENT ON TABLE strava_route IS '路线表';
+
+COMMENT ON COLUMN strava_route.id IS 'strava返回的路线id';
+COMMENT ON COLUMN strava_route.athlete_id IS 'strava用户id';
+COMMENT ON COLUMN strava_route.type IS '路线类型, 1: 骑行, 2: 跑步';
+COMMENT ON COLUMN strava_route.sub_type IS '路面类型, 1: 公路, 2: 山地, 3: 越野, 4: 步道, 5: 混合';
+COMMENT ON COLUMN strava_route.distance IS '距离, 单位米';
+COMMENT ON COLUMN strava_route.elevation_gain IS '累计爬升, 单位米';
+COMMENT ON COLUMN strava_route.estimated_moving_time IS 'strava预计的用时, 单位秒';
+COMMENT ON COLUMN strava_route.starred IS '是否收藏';
+COMMENT ON COLUMN strava_route.route_created_at IS '路线在strava的创建时间';
+COMMENT ON COLUMN strava_route.route_updated_at IS '路线在strava的修改时间, 变化时重新获取stream';
+
+DROP TABLE IF EXISTS strava_route_stream;
+CREATE TABLE strava_route_stream
+(
+    id         bigint NOT NULL PRIMARY KEY,
+    latlng     jsonb,
+    distance   jsonb,
+    altitude   jsonb,
+    created_at timestamp WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at bigint NOT NULL          DEFAULT 0
+);
+
+COMMENT ON TABLE strava_route_stream IS '路线曲线信息';
+
+COMMENT ON COLUMN strava_route_stream.id IS '路线id';
+COMMENT ON COLUMN strava_route_stream.latlng IS '坐标曲线';
+COMMENT ON COLUMN strava_route_stream.distance IS '距离曲线';
+COMMENT ON COLUMN strava_route_stream.altitude IS '高度曲线';
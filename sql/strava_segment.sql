@@ -0,0 +1,81 @@
+-- https://developers.strava.com/docs/reference/#api-models-SummarySegment
+DROP TABLE IF EXISTS strava_segment;
+CREATE TABLE strava_segment
+(
+    id             bigint                   NOT NULL PRIMARY KEY,
+    "name"         varchar(256)             NOT NULL DEFAULT '',
+    activity_type  varchar(32)              NOT NULL DEFAULT '',
+    distance       float                    NOT NULL DEFAULT 0.0,
+    average_grade  float                    NOT NULL DEFAULT 0.0,
+    maximum_grade  float                    NOT NULL DEFAULT 0.0,
+    elevation_high float                    NOT NULL DEFAULT 0.0,
+    elevation_low  float                    NOT NULL DEFAULT 0.0,
+    start_lat      float                    NOT NULL DEFAULT 0.0,
+    start_lng      float                    NOT NULL DEFAULT 0.0,
+    end_lat        float                    NOT NULL DEFAULT 0.0,
+    end_lng        float                    NOT NULL DEFAULT 0.0,
+    climb_category integer                  NOT NULL DEFAULT 0,
+    city           varchar(128)             NOT NULL DEFAULT '',
+    "state"        varchar(128)             NOT NULL DEFAULT '',
+    country        varchar(128)             NOT NULL DEFAULT '',
+    private        boolean                  NOT NULL DEFAULT false,
+
+    created_at     timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at     timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE strava_segment IS '路段表, 所有用户共享';
+
+COMMENT ON COLUMN strava_segment.id IS '路段id, 是strava返回的路段id';
+COMMENT ON COLUMN strava_segment.name IS '路段名称';
+COMMENT ON COLUMN strava_segment.activity_type IS '活动类型: Ride, Run';
+COMMENT ON COLUMN strava_segment.distance IS '距离, 单位米';
+COMMENT ON COLUMN strava_segment.average_grade IS '平均坡度, 百分比';
+COMMENT ON COLUMN strava_segment.maximum_grade IS '最大坡度, 百分比';
+COMMENT ON COLUMN strava_segment.climb_category IS '爬坡等级 [0, 5]';
+COMMENT ON COLUMN strava_segment.private IS '是否为私密路段';
+
+-- https://developers.strava.com/docs/reference/#api-models-DetailedSegmentEffort
+DROP TABLE IF EXISTS strava_segment_effort;
+CREATE TABLE strava_segment_effort
+(
+    id                bigint                   NOT NULL PRIMARY KEY,
+    segment_id        bigint                   NOT NULL,
+    activity_id       bigint                   NOT NULL,
+    athlete_id        bigint                   NOT NULL,
+    "name"            varchar(256)             NOT NULL DEFAULT '',
+    elapsed_time      integer                  NOT NULL DEFAULT 0,
+    moving_time       integer                  NOT NULL DEFAULT 0,
+    distance          float                    NOT NULL DEFAULT 0.0,
+    start_date_local  timestamp                NOT NULL,
+    average_heartrate float                    NOT NULL DEFAULT 0.0,
+    max_heartrate     float                    NOT NULL DEFAULT 0.0,
+    average_watts     float                    NOT NULL DEFAULT 0.0,
+    device_watts      boolean                  NOT NULL DEFAULT false,
+    average_cadence   float                    NOT NULL DEFAULT 0.0,
+    start_index       integer                  NOT NULL DEFAULT 0,
+    end_index         integer                  NOT NULL DEFAULT 0,
+    pr_rank           integer                  NOT NULL DEFAULT 0,
+    is_pr             boolean                  NOT NULL DEFAULT false,
+    hidden            boolean                  NOT NULL DEFAULT false,
+
+    created_at        timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at        timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at        bigint                   NOT NULL DEFAULT 0
+);
+
+CREATE INDEX strava_segment_effort_idx_activity ON strava_segment_effort (activity_id);
+CREATE INDEX strava_segment_effort_idx_athlete ON strava_segment_effort (athlete_id, segment_id, start_date_local);
+
+COMMENT ON TABLE strava_segment_effort IS '路段成绩表';
+
+COMMENT ON COLUMN strava_segment_effort.id IS '成绩id, 是strava返回的成绩id';
+COMMENT ON COLUMN strava_segment_effort.segment_id IS '路段id';
+COMMENT ON COLUMN strava_segment_effort.activity_id IS '活动id';
+COMMENT ON COLUMN strava_segment_effort.athlete_id IS 'strava用户id';
+COMMENT ON COLUMN strava_segment_effort.elapsed_time IS '经过时间，单位秒';
+COMMENT ON COLUMN strava_segment_effort.moving_time IS '实际运动时间，单位秒';
+COMMENT ON COLUMN strava_segment_effort.start_date_local IS '开始时间';
+COMMENT ON COLUMN strava_segment_effort.pr_rank IS 'strava返回的个人排名, 上传时为前三名才有';
+COMMENT ON COLUMN strava_segment_effort.is_pr IS '是否打破了之前的个人最好成绩';
+COMMENT ON COLUMN strava_segment_effort.hidden IS '是否在活动中隐藏';
@@ -0,0 +1,31 @@
+DROP TABLE IF EXISTS strava_upload;
+CREATE TABLE strava_upload
+(
+    id            bigint       NOT NULL PRIMARY KEY,
+    athlete_id    bigint       NOT NULL,
+    filename      varchar(255) NOT NULL DEFAULT '',
+    data_type     varchar(16)  NOT NULL DEFAULT '',
+    external_id   varchar(255) NOT NULL DEFAULT '',
+    status        integer      NOT NULL DEFAULT 0,
+    strava_status varchar(255) NOT NULL DEFAULT '',
+    last_error    text         NOT NULL DEFAULT '',
+    activity_id   bigint       NOT NULL DEFAULT 0,
+    attempts      integer      NOT NULL DEFAULT 0,
+
+    created_at    timestamptz           DEFAULT CURRENT_TIMESTAMP,
+    updated_at    timestamptz           DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX strava_upload_idx_athlete ON strava_upload (athlete_id, id);
+CREATE INDEX strava_upload_idx_status ON strava_upload (status);
+
+COMMENT ON TABLE strava_upload IS '通过 iself 上传到 strava 的活动文件';
+
+COMMENT ON COLUMN strava_upload.id IS 'strava 返回的 upload id';
+COMMENT ON COLUMN strava_upload.athlete_id IS 'strava 用户id';
+COMMENT ON COLUMN strava_upload.data_type IS '文件类型: fit, fit.gz, tcx, tcx.gz, gpx, gpx.gz';
+COMMENT ON COLUMN strava_upload.status IS '上传状态, 0: 处理中, 1: 已生成活动, 与创建活动的推送一样导入, 2: 上传失败';
+COMMENT ON COLUMN strava_upload.strava_status IS 'strava 返回的处理状态描述';
+COMMENT ON COLUMN strava_upload.last_error IS 'strava 返回的错误或者查询处理状态的错误';
+COMMENT ON COLUMN strava_upload.activity_id IS 'strava 处理完成后生成的活动id';
+COMMENT ON COLUMN strava_upload.attempts IS '查询处理状态的次数';
@@ -0,0 +1,53 @@
+-- https://developers.strava.com/docs/reference/#api-models-ActivityZone
+DROP TABLE IF EXISTS strava_activity_zone;
+CREATE TABLE strava_activity_zone
+(
+    id               bigserial                NOT NULL PRIMARY KEY,
+    activity_id      bigint                   NOT NULL,
+    athlete_id       bigint                   NOT NULL,
+    activity_type    varchar(32)              NOT NULL,
+    "type"           varchar(16)              NOT NULL,
+    "zone"           integer                  NOT NULL,
+    "min"            integer                  NOT NULL DEFAULT 0,
+    "max"            integer                  NOT NULL DEFAULT 0,
+    "time"           integer                  NOT NULL DEFAULT 0,
+    sensor_based     boolean                  NOT NULL DEFAULT false,
+    start_date_local timestamp                NOT NULL,
+
+    created_at       timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at       bigint                   NOT NULL DEFAULT 0
+);
+
+CREATE INDEX strava_activity_zone_idx_activity ON strava_activity_zone (activity_id);
+CREATE INDEX strava_activity_zone_idx_athlete ON strava_activity_zone (athlete_id, activity_type, "type", start_date_local);
+
+COMMENT ON TABLE strava_activity_zone IS '活动心率、功率区间时间';
+
+COMMENT ON COLUMN strava_activity_zone.activity_id IS '活动id';
+COMMENT ON COLUMN strava_activity_zone.athlete_id IS 'strava用户id';
+COMMENT ON COLUMN strava_activity_zone.activity_type IS '活动类型';
+COMMENT ON COLUMN strava_activity_zone.type IS '区间类型: heartrate, power';
+COMMENT ON COLUMN strava_activity_zone.zone IS '第几个区间, 从0开始';
+COMMENT ON COLUMN strava_activity_zone.min IS '区间下限';
+COMMENT ON COLUMN strava_activity_zone.max IS '区间上限, -1 表示没有上限';
+COMMENT ON COLUMN strava_activity_zone.time IS '在区间内的时间，单位秒';
+COMMENT ON COLUMN strava_activity_zone.sensor_based IS '是否来自传感器';
+COMMENT ON COLUMN strava_activity_zone.start_date_local IS '活动开始时间';
+
+DROP TABLE IF EXISTS strava_athlete_zone;
+CREATE TABLE strava_athlete_zone
+(
+    athlete_id bigint                   NOT NULL PRIMARY KEY,
+    heart_rate jsonb,
+    power      jsonb,
+
+    created_at timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE strava_athlete_zone IS '用户心率、功率区间设置';
+
+COMMENT ON COLUMN strava_athlete_zone.athlete_id IS 'strava用户id';
+COMMENT ON COLUMN strava_athlete_zone.heart_rate IS '心率区间, json';
+COMMENT ON COLUMN strava_athlete_zone.power IS '功率区间, json';
@@ -13,6 +13,7 @@ CREATE table "user"
     source     oauth2_source NOT NULL   DEFAULT '',
     source_id  bigint        NOT NULL   DEFAULT 0,
     status     int2          NOT NULL   DEFAULT 1,
+    source_status int2       NOT NULL   DEFAULT 0,
 
     created_at timestamp WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at timestamp WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
@@ -33,3 +34,4 @@ COMMENT ON COLUMN "user".role IS '身份';
 COMMENT ON COLUMN "user".source IS '来源，oauth2: github, google ...';
 COMMENT ON COLUMN "user".source_id IS '来源，oauth2 user id';
 COMMENT ON COLUMN "user".status IS '用户状态: 0 未激活, 1 已激活';
+COMMENT ON COLUMN "user".source_status IS 'oauth2 授权状态: 0 已授权, 1 已撤销授权';